@@ -12,6 +12,8 @@ import (
 	"github.com/ncw/rclone/cmd/mount"
 	"github.com/ncw/rclone/cmd/mountlib"
 	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/vfs"
+	"github.com/ncw/rclone/vfs/vfsflags"
 	"github.com/stretchr/testify/require"
 )
 
@@ -29,7 +31,7 @@ func (r *run) mountFs(t *testing.T, f fs.Fs) {
 	require.NoError(t, err)
 	c, err := fuse.Mount(r.mntDir, options...)
 	require.NoError(t, err)
-	filesys := mount.NewFS(f)
+	filesys := mount.NewFS(vfs.New(f, &vfsflags.Opt))
 	server := fusefs.New(c, nil)
 
 	// Serve the mount point in the background returning error to errChan
@@ -12,6 +12,8 @@ import (
 	"github.com/ncw/rclone/cmd/cmount"
 	"github.com/ncw/rclone/cmd/mountlib"
 	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/vfs"
+	"github.com/ncw/rclone/vfs/vfsflags"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 )
@@ -50,7 +52,7 @@ func (r *run) mountFs(t *testing.T, f fs.Fs) {
 		"--FileSystemName=rclone",
 	}
 
-	fsys := cmount.NewFS(f)
+	fsys := cmount.NewFS(vfs.New(f, &vfsflags.Opt))
 	host := fuse.NewFileSystemHost(fsys)
 
 	// Serve the mount point in the background returning error to errChan
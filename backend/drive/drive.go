@@ -386,6 +386,7 @@ will download it anyway.`,
 			Help:     "Number of API calls to allow without sleeping.",
 			Advanced: true,
 		}},
+		CommandHelp: commandHelp,
 	})
 
 	// register duplicate MIME types first
@@ -447,6 +448,7 @@ type Fs struct {
 	exportExtensions []string           // preferred extensions to download docs
 	importMimeTypes  []string           // MIME types to convert to docs
 	isTeamDrive      bool               // true if this is a team drive
+	m                configmap.Mapper   // config map used to make new oauth clients
 }
 
 type baseObject struct {
@@ -920,6 +922,7 @@ func NewFs(name, path string, m configmap.Mapper) (fs.Fs, error) {
 		root:  root,
 		opt:   *opt,
 		pacer: newPacer(opt),
+		m:     m,
 	}
 	f.isTeamDrive = opt.TeamDriveID != ""
 	f.features = (&fs.Features{
@@ -2326,6 +2329,128 @@ func (f *Fs) changeNotifyRunner(notifyFunc func(string, fs.EntryType), startPage
 	}
 }
 
+var commandHelp = []fs.CommandHelp{{
+	Name:  "get",
+	Short: "Get command for fetching the drive config parameters",
+	Long: `This is a get command which will be used to fetch the various drive config parameters
+
+Usage Examples:
+
+    rclone backend get drive: [-o service_account_file] [-o chunk_size]
+    rclone rc backend/command --json '{"command": "get", "fs": "drive:", "opt": {"service_account_file": ""}}'
+`,
+	Opts: map[string]string{
+		"chunk_size":           "show the current upload chunk size",
+		"service_account_file": "show the current service account file",
+	},
+}, {
+	Name:  "set",
+	Short: "Set command for updating the drive config parameters",
+	Long: `This is a set command which will be used to update the various drive config parameters
+
+Usage Examples:
+
+    rclone backend set drive: [-o service_account_file=sa.json] [-o chunk_size=67108864]
+    rclone rc backend/command --json '{"command": "set", "fs": "drive:", "opt": {"service_account_file": "sa.json"}}'
+
+The changes only last for the lifetime of the backend - they are not
+saved in the config file.  It returns the previous values of the
+parameters set.
+`,
+	Opts: map[string]string{
+		"chunk_size":           "update the current upload chunk size",
+		"service_account_file": "update the current service account file",
+	},
+}}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(name string, arg []string, opt map[string]string) (interface{}, error) {
+	switch name {
+	case "get":
+		out := make(map[string]string)
+		if _, ok := opt["service_account_file"]; ok {
+			out["service_account_file"] = f.opt.ServiceAccountFile
+		}
+		if _, ok := opt["chunk_size"]; ok {
+			out["chunk_size"] = f.opt.ChunkSize.String()
+		}
+		return out, nil
+	case "set":
+		out := make(map[string]map[string]string)
+		if serviceAccountFile, ok := opt["service_account_file"]; ok {
+			oldValue := f.opt.ServiceAccountFile
+			if err := f.changeServiceAccountFile(serviceAccountFile); err != nil {
+				return out, err
+			}
+			out["service_account_file"] = map[string]string{
+				"previous": oldValue,
+				"current":  f.opt.ServiceAccountFile,
+			}
+		}
+		if chunkSize, ok := opt["chunk_size"]; ok {
+			var cs fs.SizeSuffix
+			if err := cs.Set(chunkSize); err != nil {
+				return out, errors.Wrap(err, "bad chunk_size")
+			}
+			oldValue, err := f.setUploadChunkSize(cs)
+			if err != nil {
+				return out, errors.Wrap(err, "bad chunk_size")
+			}
+			out["chunk_size"] = map[string]string{
+				"previous": oldValue.String(),
+				"current":  f.opt.ChunkSize.String(),
+			}
+		}
+		return out, nil
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+// changeServiceAccountFile makes new clients using the service
+// account file passed in, restoring the old clients on error
+func (f *Fs) changeServiceAccountFile(file string) (err error) {
+	fs.Debugf(f, "Changing Service Account File from %s to %s", f.opt.ServiceAccountFile, file)
+	if file == f.opt.ServiceAccountFile {
+		return nil
+	}
+	oldSvc, oldV2Svc, oldClient := f.svc, f.v2Svc, f.client
+	oldFile, oldCredentials := f.opt.ServiceAccountFile, f.opt.ServiceAccountCredentials
+	defer func() {
+		// Undo all the changes instead of doing selective undo's
+		if err != nil {
+			f.svc, f.v2Svc, f.client = oldSvc, oldV2Svc, oldClient
+			f.opt.ServiceAccountFile, f.opt.ServiceAccountCredentials = oldFile, oldCredentials
+		}
+	}()
+	f.opt.ServiceAccountFile = file
+	f.opt.ServiceAccountCredentials = ""
+	oAuthClient, err := createOAuthClient(&f.opt, f.name, f.m)
+	if err != nil {
+		return errors.Wrap(err, "drive: failed when making oauth client")
+	}
+	f.client = oAuthClient
+	f.svc, err = drive.New(f.client)
+	if err != nil {
+		return errors.Wrap(err, "couldn't create Drive client")
+	}
+	if f.opt.V2DownloadMinSize >= 0 {
+		f.v2Svc, err = drive_v2.New(f.client)
+		if err != nil {
+			return errors.Wrap(err, "couldn't create Drive v2 client")
+		}
+	}
+	return nil
+}
+
 // DirCacheFlush resets the directory cache - used in testing as an
 // optional interface
 func (f *Fs) DirCacheFlush() {
@@ -2832,6 +2957,7 @@ var (
 	_ fs.ListRer         = (*Fs)(nil)
 	_ fs.MergeDirser     = (*Fs)(nil)
 	_ fs.Abouter         = (*Fs)(nil)
+	_ fs.Commander       = (*Fs)(nil)
 	_ fs.Object          = (*Object)(nil)
 	_ fs.MimeTyper       = (*Object)(nil)
 	_ fs.IDer            = (*Object)(nil)
@@ -57,6 +57,7 @@ const (
 	timeFormatIn                = time.RFC3339
 	timeFormatOut               = "2006-01-02T15:04:05.000000000Z07:00"
 	metaMtime                   = "mtime" // key to store mtime under in metadata
+	maxComposeSources           = 32      // most objects which can be composed in one go
 	listChunks                  = 1000    // chunk size to read directory listings
 	minSleep                    = 10 * time.Millisecond
 )
@@ -822,6 +823,57 @@ func (f *Fs) Copy(src fs.Object, remote string) (fs.Object, error) {
 	return dstObj, nil
 }
 
+// Compose makes remote from the contents of srcs joined together in
+// order using server side compose.
+//
+// It returns the destination Object and a possible error
+//
+// Will only be called if all the srcs are from this Fs
+//
+// If it isn't possible then return fs.ErrorCantCompose
+func (f *Fs) Compose(srcs []fs.Object, remote string) (fs.Object, error) {
+	if len(srcs) == 0 || len(srcs) > maxComposeSources {
+		fs.Debugf(remote, "Can't compose %d objects", len(srcs))
+		return nil, fs.ErrorCantCompose
+	}
+	req := storage.ComposeRequest{
+		Destination: &storage.Object{
+			Metadata: metadataFromModTime(time.Now()),
+		},
+	}
+	for _, src := range srcs {
+		srcObj, ok := src.(*Object)
+		if !ok || srcObj.fs.bucket != f.bucket {
+			fs.Debugf(src, "Can't compose - not in the same bucket")
+			return nil, fs.ErrorCantCompose
+		}
+		if req.Destination.ContentType == "" {
+			req.Destination.ContentType = srcObj.mimeType
+		}
+		req.SourceObjects = append(req.SourceObjects, &storage.ComposeRequestSourceObjects{
+			Name: srcObj.fs.root + srcObj.remote,
+		})
+	}
+
+	// Temporary Object under construction
+	dstObj := &Object{
+		fs:     f,
+		remote: remote,
+	}
+	var newObject *storage.Object
+	err := f.pacer.Call(func() (bool, error) {
+		var err error
+		newObject, err = f.svc.Objects.Compose(f.bucket, f.root+remote, &req).DestinationPredefinedAcl(f.opt.ObjectACL).Do()
+		return shouldRetry(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Set the metadata for the new object while we have it
+	dstObj.setMetaData(newObject)
+	return dstObj, nil
+}
+
 // Hashes returns the supported hash sets.
 func (f *Fs) Hashes() hash.Set {
 	return hash.Set(hash.MD5)
@@ -1044,6 +1096,7 @@ func (o *Object) MimeType() string {
 var (
 	_ fs.Fs          = &Fs{}
 	_ fs.Copier      = &Fs{}
+	_ fs.Composer    = &Fs{}
 	_ fs.PutStreamer = &Fs{}
 	_ fs.ListRer     = &Fs{}
 	_ fs.Object      = &Object{}
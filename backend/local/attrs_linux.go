@@ -0,0 +1,133 @@
+// Permissions, owner and extended attributes
+
+//+build linux
+
+package local
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/ncw/rclone/fs"
+	"golang.org/x/sys/unix"
+)
+
+// xattrBuf calls read to read an extended attribute or the list of
+// them into a buffer which is grown until it is big enough
+func xattrBuf(read func(buf []byte) (int, error)) ([]byte, error) {
+	size, err := read(nil)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		buf := make([]byte, size)
+		size, err = read(buf)
+		if err == unix.ERANGE {
+			// it grew since the size was read
+			size, err = read(nil)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:size], nil
+	}
+}
+
+// readXattrs returns the extended attributes of path
+func readXattrs(path string) (map[string][]byte, error) {
+	list, err := xattrBuf(func(buf []byte) (int, error) {
+		return unix.Llistxattr(path, buf)
+	})
+	if err == unix.ENOTSUP {
+		return nil, nil
+	} else if err != nil {
+		return nil, &os.PathError{Op: "listxattr", Path: path, Err: err}
+	}
+	xattrs := make(map[string][]byte)
+	for _, name := range bytes.Split(list, []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		value, err := xattrBuf(func(buf []byte) (int, error) {
+			return unix.Lgetxattr(path, string(name), buf)
+		})
+		if err == unix.ENODATA {
+			// removed since it was listed
+			continue
+		} else if err != nil {
+			return nil, &os.PathError{Op: "getxattr", Path: path, Err: err}
+		}
+		xattrs[string(name)] = value
+	}
+	return xattrs, nil
+}
+
+// GetAttrs returns the permissions, owner and extended attributes of
+// the file or directory at remote
+func (f *Fs) GetAttrs(remote string) (*fs.Attrs, error) {
+	path := f.cleanPath(filepath.Join(f.root, remote))
+	fi, err := f.lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	mode := fi.Mode().Perm()
+	attrs := &fs.Attrs{Mode: &mode}
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+		uid, gid := stat.Uid, stat.Gid
+		attrs.UID, attrs.GID = &uid, &gid
+	}
+	attrs.Xattrs, err = readXattrs(path)
+	if err != nil {
+		return nil, err
+	}
+	return attrs, nil
+}
+
+// SetAttrs changes the permissions, owner and extended attributes of
+// the file or directory at remote to those set in attrs
+func (f *Fs) SetAttrs(remote string, attrs *fs.Attrs) error {
+	path := f.cleanPath(filepath.Join(f.root, remote))
+	if attrs.Mode != nil {
+		err := os.Chmod(path, attrs.Mode.Perm())
+		if err != nil {
+			return err
+		}
+	}
+	if attrs.UID != nil || attrs.GID != nil {
+		uid, gid := -1, -1
+		if attrs.UID != nil {
+			uid = int(*attrs.UID)
+		}
+		if attrs.GID != nil {
+			gid = int(*attrs.GID)
+		}
+		err := os.Lchown(path, uid, gid)
+		if err != nil {
+			return err
+		}
+	}
+	for name, value := range attrs.Xattrs {
+		var err error
+		if value == nil {
+			err = unix.Lremovexattr(path, name)
+			if err == unix.ENODATA {
+				err = nil
+			}
+		} else {
+			err = unix.Lsetxattr(path, name, value, 0)
+		}
+		if err != nil {
+			return &os.PathError{Op: "setxattr", Path: path, Err: err}
+		}
+	}
+	return nil
+}
+
+// check interface
+var _ fs.AttrStorer = &Fs{}
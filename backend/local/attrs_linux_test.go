@@ -0,0 +1,57 @@
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config/configmap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttrs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rclone-local-attrs")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "file"), []byte("potato"), 0600))
+	f, err := NewFs("local", dir, configmap.Simple{})
+	require.NoError(t, err)
+	features := f.Features()
+	require.NotNil(t, features.GetAttrs)
+	require.NotNil(t, features.SetAttrs)
+
+	attrs, err := features.GetAttrs("file")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), *attrs.Mode)
+	assert.Equal(t, uint32(os.Getuid()), *attrs.UID)
+	assert.Equal(t, uint32(os.Getgid()), *attrs.GID)
+
+	// mode and owner
+	mode := os.FileMode(0640)
+	uid, gid := uint32(os.Getuid()), uint32(os.Getgid())
+	require.NoError(t, features.SetAttrs("file", &fs.Attrs{Mode: &mode, UID: &uid, GID: &gid}))
+	fi, err := os.Stat(filepath.Join(dir, "file"))
+	require.NoError(t, err)
+	assert.Equal(t, mode, fi.Mode().Perm())
+
+	// extended attributes
+	err = features.SetAttrs("file", &fs.Attrs{Xattrs: map[string][]byte{"user.a": []byte("one"), "user.b": {}}})
+	if err != nil {
+		t.Skipf("file system can't store extended attributes: %v", err)
+	}
+	attrs, err = features.GetAttrs("file")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"user.a": []byte("one"), "user.b": {}}, attrs.Xattrs)
+	require.NoError(t, features.SetAttrs("file", &fs.Attrs{Xattrs: map[string][]byte{"user.b": nil, "user.c": nil}}))
+	attrs, err = features.GetAttrs("file")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"user.a": []byte("one")}, attrs.Xattrs)
+
+	_, err = features.GetAttrs("notfound")
+	assert.True(t, os.IsNotExist(err))
+}
@@ -21,6 +21,7 @@ import (
 	"net/http"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -730,6 +731,7 @@ Use this only if v4 signatures don't work, eg pre Jewel/v10 CEPH.`,
 			Default:  false,
 			Advanced: true,
 		}},
+		CommandHelp: commandHelp,
 	})
 }
 
@@ -1554,11 +1556,310 @@ func (f *Fs) Copy(src fs.Object, remote string) (fs.Object, error) {
 	return f.NewObject(remote)
 }
 
+// copyPart is a byte range of a source object to copy server side as
+// a single part of a multipart upload
+type copyPart struct {
+	source string
+	start  int64
+	end    int64 // inclusive
+}
+
+// composeParts works out how to copy sources of the sizes given into
+// parts of a multipart upload.
+//
+// Every part other than the last must be at least minChunkSize and no
+// part may be bigger than maxSizeForCopy, so sources bigger than that
+// are split into equal sized parts.  Empty sources contribute nothing.
+//
+// If the sources can't be laid out like this it returns
+// fs.ErrorCantCompose
+func composeParts(sources []string, sizes []int64) ([]copyPart, error) {
+	var parts []copyPart
+	for i, source := range sources {
+		size := sizes[i]
+		if size == 0 {
+			continue
+		}
+		n := (size + maxSizeForCopy - 1) / maxSizeForCopy
+		partSize := (size + n - 1) / n
+		for start := int64(0); start < size; start += partSize {
+			end := start + partSize - 1
+			if end >= size {
+				end = size - 1
+			}
+			parts = append(parts, copyPart{source: source, start: start, end: end})
+		}
+	}
+	if len(parts) == 0 || len(parts) > s3manager.MaxUploadParts {
+		return nil, fs.ErrorCantCompose
+	}
+	for _, part := range parts[:len(parts)-1] {
+		if part.end-part.start+1 < int64(minChunkSize) {
+			return nil, fs.ErrorCantCompose
+		}
+	}
+	return parts, nil
+}
+
+// Compose makes remote from the contents of srcs joined together in
+// order using a multipart upload with each part copied server side.
+//
+// It returns the destination Object and a possible error
+//
+// Will only be called if all the srcs are from this Fs
+//
+// If it isn't possible, for instance because a source other than
+// the last is smaller than the minimum part size, then return
+// fs.ErrorCantCompose
+func (f *Fs) Compose(srcs []fs.Object, remote string) (fs.Object, error) {
+	// Work out the parts to copy
+	sources := make([]string, len(srcs))
+	sizes := make([]int64, len(srcs))
+	for i, src := range srcs {
+		srcObj, ok := src.(*Object)
+		if !ok {
+			fs.Debugf(src, "Can't compose - not same remote type")
+			return nil, fs.ErrorCantCompose
+		}
+		sources[i] = pathEscape(srcObj.fs.bucket + "/" + srcObj.fs.root + srcObj.remote)
+		sizes[i] = srcObj.Size()
+	}
+	parts, err := composeParts(sources, sizes)
+	if err != nil {
+		fs.Debugf(remote, "Can't compose - parts must be at least %v and at most %d of them", minChunkSize, s3manager.MaxUploadParts)
+		return nil, err
+	}
+	err = f.Mkdir("")
+	if err != nil {
+		return nil, err
+	}
+
+	key := f.root + remote
+	req := s3.CreateMultipartUploadInput{
+		Bucket: &f.bucket,
+		ACL:    &f.opt.ACL,
+		Key:    &key,
+		Metadata: map[string]*string{
+			metaMtime: aws.String(swift.TimeToFloatString(time.Now())),
+		},
+	}
+	if f.opt.ServerSideEncryption != "" {
+		req.ServerSideEncryption = &f.opt.ServerSideEncryption
+	}
+	if f.opt.SSEKMSKeyID != "" {
+		req.SSEKMSKeyId = &f.opt.SSEKMSKeyID
+	}
+	if f.opt.StorageClass != "" {
+		req.StorageClass = &f.opt.StorageClass
+	}
+	var upload *s3.CreateMultipartUploadOutput
+	err = f.pacer.Call(func() (bool, error) {
+		upload, err = f.c.CreateMultipartUpload(&req)
+		return f.shouldRetry(err)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to start multipart upload")
+	}
+	abort := func() {
+		err := f.pacer.Call(func() (bool, error) {
+			_, err := f.c.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+				Bucket:   &f.bucket,
+				Key:      &key,
+				UploadId: upload.UploadId,
+			})
+			return f.shouldRetry(err)
+		})
+		if err != nil {
+			fs.Errorf(remote, "Failed to abort multipart upload: %v", err)
+		}
+	}
+
+	completed := make([]*s3.CompletedPart, 0, len(parts))
+	for i, part := range parts {
+		partNumber := int64(i + 1)
+		partReq := s3.UploadPartCopyInput{
+			Bucket:          &f.bucket,
+			Key:             &key,
+			CopySource:      aws.String(part.source),
+			PartNumber:      &partNumber,
+			UploadId:        upload.UploadId,
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", part.start, part.end)),
+		}
+		var out *s3.UploadPartCopyOutput
+		err = f.pacer.Call(func() (bool, error) {
+			out, err = f.c.UploadPartCopy(&partReq)
+			return f.shouldRetry(err)
+		})
+		if err != nil {
+			abort()
+			if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "NotImplemented" {
+				fs.Debugf(remote, "Can't compose - server side part copy isn't supported")
+				return nil, fs.ErrorCantCompose
+			}
+			return nil, errors.Wrap(err, "failed to copy part")
+		}
+		completed = append(completed, &s3.CompletedPart{
+			ETag:       out.CopyPartResult.ETag,
+			PartNumber: &partNumber,
+		})
+	}
+
+	err = f.pacer.Call(func() (bool, error) {
+		_, err = f.c.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+			Bucket:          &f.bucket,
+			Key:             &key,
+			UploadId:        upload.UploadId,
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+		})
+		return f.shouldRetry(err)
+	})
+	if err != nil {
+		abort()
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "EntityTooSmall" {
+			fs.Debugf(remote, "Can't compose - server rejected a part as too small")
+			return nil, fs.ErrorCantCompose
+		}
+		return nil, errors.Wrap(err, "failed to complete multipart upload")
+	}
+	return f.NewObject(remote)
+}
+
 // Hashes returns the supported hash sets.
 func (f *Fs) Hashes() hash.Set {
 	return hash.Set(hash.MD5)
 }
 
+var commandHelp = []fs.CommandHelp{{
+	Name:  "restore",
+	Short: "Restore objects from GLACIER to normal storage",
+	Long: `This command can be used to restore one or more objects from GLACIER
+to normal storage.
+
+Usage Examples:
+
+    rclone backend restore s3:bucket/path/to/object [-o priority=PRIORITY] [-o lifetime=DAYS]
+    rclone backend restore s3:bucket/path/to/directory [-o priority=PRIORITY] [-o lifetime=DAYS]
+    rclone backend restore s3:bucket [-o priority=PRIORITY] [-o lifetime=DAYS]
+
+This command also obeys the filters. Test first with the --dry-run flag
+
+    rclone --dry-run backend restore --include "*.txt" s3:bucket/path -o priority=Standard
+
+All the objects shown will be marked for restore, then
+
+    rclone backend restore --include "*.txt" s3:bucket/path -o priority=Standard
+
+It returns a list of status dictionaries with Remote and Status
+keys. The Status will be OK if it was successful or an error message
+if not.
+
+    [
+        {
+            "Status": "OK",
+            "Remote": "test.txt"
+        },
+        {
+            "Status": "OK",
+            "Remote": "test/file4.txt"
+        }
+    ]
+`,
+	Opts: map[string]string{
+		"priority":    "Priority of restore: Standard|Expedited|Bulk",
+		"lifetime":    "Lifetime of the active copy in days",
+		"description": "The optional description for the job.",
+	},
+}}
+
+// restoreStatus is returned for each object by the restore command
+type restoreStatus struct {
+	Status string
+	Remote string
+}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(name string, arg []string, opt map[string]string) (interface{}, error) {
+	switch name {
+	case "restore":
+		return f.restore(opt)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+// restore the objects in the Fs from GLACIER
+func (f *Fs) restore(opt map[string]string) (interface{}, error) {
+	if f.bucket == "" {
+		return nil, fs.ErrorListBucketRequired
+	}
+	req := s3.RestoreObjectInput{
+		Bucket:         &f.bucket,
+		RestoreRequest: &s3.RestoreRequest{},
+	}
+	if lifetime := opt["lifetime"]; lifetime != "" {
+		days, err := strconv.ParseInt(lifetime, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "bad lifetime")
+		}
+		req.RestoreRequest.Days = &days
+	}
+	if priority := opt["priority"]; priority != "" {
+		req.RestoreRequest.GlacierJobParameters = &s3.GlacierJobParameters{
+			Tier: &priority,
+		}
+	}
+	if description := opt["description"]; description != "" {
+		req.RestoreRequest.Description = &description
+	}
+	var (
+		outMu sync.Mutex
+		out   = []restoreStatus{}
+	)
+	err := walk.ListR(f, "", false, fs.Config.MaxDepth, walk.ListObjects, func(entries fs.DirEntries) error {
+		entries.ForObject(func(obj fs.Object) {
+			st := restoreStatus{Status: "OK", Remote: obj.Remote()}
+			defer func() {
+				outMu.Lock()
+				out = append(out, st)
+				outMu.Unlock()
+			}()
+			if fs.Config.DryRun {
+				fs.Logf(obj, "Not restoring as --dry-run")
+				st.Status = "Not restored as --dry-run"
+				return
+			}
+			o, ok := obj.(*Object)
+			if !ok {
+				st.Status = "Not an S3 object"
+				return
+			}
+			key := f.root + o.remote
+			reqCopy := req
+			reqCopy.Key = &key
+			err := f.pacer.Call(func() (bool, error) {
+				_, err := f.c.RestoreObject(&reqCopy)
+				return f.shouldRetry(err)
+			})
+			if err != nil {
+				st.Status = err.Error()
+			}
+		})
+		return nil
+	})
+	if err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
 // ------------------------------------------------------------
 
 // Fs returns the parent Fs
@@ -1954,8 +2255,10 @@ func (o *Object) MimeType() string {
 var (
 	_ fs.Fs          = &Fs{}
 	_ fs.Copier      = &Fs{}
+	_ fs.Composer    = &Fs{}
 	_ fs.PutStreamer = &Fs{}
 	_ fs.ListRer     = &Fs{}
+	_ fs.Commander   = &Fs{}
 	_ fs.Object      = &Object{}
 	_ fs.MimeTyper   = &Object{}
 )
@@ -0,0 +1,89 @@
+package s3
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/ncw/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComposeParts(t *testing.T) {
+	const min = int64(minChunkSize)
+	const max = int64(maxSizeForCopy)
+	for _, test := range []struct {
+		what  string
+		sizes []int64
+		want  []copyPart
+		err   error
+	}{
+		{
+			what:  "small last",
+			sizes: []int64{min, 1},
+			want:  []copyPart{{"0", 0, min - 1}, {"1", 0, 0}},
+		},
+		{
+			what:  "empty last is skipped",
+			sizes: []int64{min, 0},
+			want:  []copyPart{{"0", 0, min - 1}},
+		},
+		{
+			what:  "all empty",
+			sizes: []int64{0, 0},
+			err:   fs.ErrorCantCompose,
+		},
+		{
+			what:  "no sources",
+			sizes: nil,
+			err:   fs.ErrorCantCompose,
+		},
+		{
+			what:  "small middle",
+			sizes: []int64{min, min - 1, min},
+			err:   fs.ErrorCantCompose,
+		},
+		{
+			what:  "exactly max",
+			sizes: []int64{max, 1},
+			want:  []copyPart{{"0", 0, max - 1}, {"1", 0, 0}},
+		},
+		{
+			what:  "just over max is split evenly",
+			sizes: []int64{max + 2, 1},
+			want:  []copyPart{{"0", 0, max / 2}, {"0", max/2 + 1, max + 1}, {"1", 0, 0}},
+		},
+		{
+			what:  "odd size over max",
+			sizes: []int64{2*max + 1},
+			want:  []copyPart{{"0", 0, max * 2 / 3}, {"0", max*2/3 + 1, max*4/3 + 1}, {"0", max*4/3 + 2, 2 * max}},
+		},
+	} {
+		sources := make([]string, len(test.sizes))
+		for i := range sources {
+			sources[i] = string('0' + rune(i))
+		}
+		got, err := composeParts(sources, test.sizes)
+		if test.err != nil {
+			assert.Equal(t, test.err, err, test.what)
+			continue
+		}
+		require.NoError(t, err, test.what)
+		assert.Equal(t, test.want, got, test.what)
+		for i, part := range got {
+			size := part.end - part.start + 1
+			assert.True(t, size <= max, test.what)
+			if i != len(got)-1 {
+				assert.True(t, size >= min, test.what)
+			}
+		}
+	}
+
+	// Too many parts
+	sizes := make([]int64, s3manager.MaxUploadParts+1)
+	for i := range sizes {
+		sizes[i] = min
+	}
+	_, err := composeParts(make([]string, len(sizes)), sizes)
+	assert.Equal(t, fs.ErrorCantCompose, err)
+}
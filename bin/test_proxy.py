@@ -0,0 +1,26 @@
+#!/usr/bin/env python3
+"""
+A demo proxy for rclone serve's --auth-proxy
+
+This takes the user and password as JSON on STDIN and returns the
+config for an sftp backend on STDOUT which logs into sftp.example.com
+with the same user and password.
+"""
+
+import sys
+import json
+
+def main():
+    i = json.load(sys.stdin)
+    o = {
+        "type": "sftp",              # type of backend
+        "_root": "",                 # root of the fs on the backend
+        "_obscure": "pass",          # comma sep list of fields to obscure
+        "user": i["user"],
+        "pass": i["pass"],
+        "host": "sftp.example.com",
+    }
+    json.dump(o, sys.stdout, indent="\t")
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,179 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config/flags"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	options []string
+	useJSON bool
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.StringArrayVarP(cmdFlags, &options, "option", "o", options, "Option in the form name=value or name.")
+	flags.BoolVarP(cmdFlags, &useJSON, "json", "", useJSON, "Always output in JSON format.")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "backend <command> remote:path [opts] <args>",
+	Short: `Run a backend specific command.`,
+	Long: `
+This runs a backend specific command. The commands themselves (except
+for "help") are defined by the backends and you should see the backend
+docs for definitions.
+
+You can discover what commands a backend implements by using
+
+    rclone backend help remote:
+    rclone backend help <backendname>
+
+Pass options to the backend command with -o. This should be key=value or key, eg:
+
+    rclone backend noop . -o echo=yes -o blue
+
+Pass arguments to the backend by placing them on the end of the line
+
+    rclone backend noop . -o echo=yes file1 file2 file3
+
+Commands which return a string or a list of strings print them one
+per line, otherwise the result is printed as JSON.  Use --json to
+always get JSON output.
+
+Note to run these commands on a running backend then see
+[backend/command](/rc/#backend/command) in the rc docs.
+`,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, 1e6, command, args)
+		name, remote := args[0], args[1]
+		cmd.Run(false, false, command, func() error {
+			// show help if remote is a backend name
+			if name == "help" {
+				fsInfo, err := fs.Find(remote)
+				if err == nil {
+					return showHelp(fsInfo)
+				}
+			}
+			fsInfo, _, _, err := fs.ParseRemote(remote)
+			if err != nil {
+				return err
+			}
+			f := cmd.NewFsSrc([]string{remote})
+			if name == "help" {
+				return showHelp(fsInfo)
+			}
+			doCommand := f.Features().Command
+			if doCommand == nil {
+				return errors.Errorf("%v: doesn't support backend commands", f)
+			}
+			out, err := doCommand(name, args[2:], parseOptions(options))
+			if err != nil {
+				if err == fs.ErrorCommandNotFound {
+					return errors.Errorf("%q is not a backend command. Use \"rclone backend help %s\" to see available commands.", name, fsInfo.Name)
+				}
+				return errors.Wrapf(err, "command %q failed", name)
+			}
+			return writeOutput(out)
+		})
+	},
+}
+
+// parseOptions parses a slice of key=value or key strings into a map
+func parseOptions(options []string) map[string]string {
+	opt := make(map[string]string, len(options))
+	for _, option := range options {
+		equals := strings.IndexRune(option, '=')
+		key := option
+		value := ""
+		if equals >= 0 {
+			key = option[:equals]
+			value = option[equals+1:]
+		}
+		opt[key] = value
+	}
+	return opt
+}
+
+// writeOutput shows the result of the backend command to the user
+//
+// strings and []string are written as lines, everything else as JSON
+func writeOutput(out interface{}) error {
+	if !useJSON {
+		switch x := out.(type) {
+		case nil:
+			return nil
+		case string:
+			fmt.Println(x)
+			return nil
+		case []string:
+			for _, line := range x {
+				fmt.Println(line)
+			}
+			return nil
+		}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+	err := enc.Encode(out)
+	if err != nil {
+		return errors.Wrap(err, "failed to write JSON")
+	}
+	return nil
+}
+
+// showHelp shows help for the backend commands of fsInfo
+func showHelp(fsInfo *fs.RegInfo) error {
+	cmds := fsInfo.CommandHelp
+	name := fsInfo.Name
+	if len(cmds) == 0 {
+		return errors.Errorf("%s backend has no commands", name)
+	}
+	fmt.Printf("## Backend commands\n\n")
+	fmt.Printf(`Here are the commands specific to the %s backend.
+
+Run them with
+
+    rclone backend COMMAND remote:
+
+The help below will explain what arguments each command takes.
+
+See [the "rclone backend" command](/commands/rclone_backend/) for more
+info on how to pass options and arguments.
+
+These can be run on a running backend using the rc command
+[backend/command](/rc/#backend/command).
+
+`, name)
+	for _, cmd := range cmds {
+		fmt.Printf("### %s\n\n", cmd.Name)
+		fmt.Printf("%s\n\n", cmd.Short)
+		fmt.Printf("    rclone backend %s remote: [options] [<arguments>+]\n\n", cmd.Name)
+		if cmd.Long != "" {
+			fmt.Printf("%s\n\n", cmd.Long)
+		}
+		if len(cmd.Opts) != 0 {
+			fmt.Printf("Options:\n\n")
+			var keys []string
+			for key := range cmd.Opts {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				fmt.Printf("- %q: %s\n", key, cmd.Opts[key])
+			}
+			fmt.Printf("\n")
+		}
+	}
+	return nil
+}
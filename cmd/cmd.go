@@ -29,6 +29,8 @@ import (
 	"github.com/ncw/rclone/fs/fserrors"
 	"github.com/ncw/rclone/fs/fspath"
 	fslog "github.com/ncw/rclone/fs/log"
+	"github.com/ncw/rclone/fs/notify"
+	"github.com/ncw/rclone/fs/notify/notifyflags"
 	"github.com/ncw/rclone/fs/prom"
 	"github.com/ncw/rclone/fs/prom/promflags"
 	"github.com/ncw/rclone/fs/rc/rcflags"
@@ -220,6 +222,7 @@ func ShowStats() bool {
 // Run the function with stats and retries if required
 func Run(Retry bool, showStats bool, cmd *cobra.Command, f func() error) {
 	var err error
+	startTime := time.Now()
 	stopStats := func() {}
 	if !showStats && ShowStats() {
 		showStats = true
@@ -268,6 +271,7 @@ func Run(Retry bool, showStats bool, cmd *cobra.Command, f func() error) {
 		}
 	}
 	stopStats()
+	_ = notify.Send(&notifyflags.Opt, notify.CommandSummary(cmd.Name(), startTime, err))
 	if err != nil {
 		log.Printf("Failed to %s: %v", cmd.Name(), err)
 		resolveExitCode(err)
@@ -375,6 +379,9 @@ func initConfig() {
 		atexit.Register(p.Stop)
 	}
 
+	// Send notifications when rc jobs finish if configured
+	notify.Start(&notifyflags.Opt)
+
 	// Setup CPU profiling if desired
 	if *cpuProfile != "" {
 		fs.Infof(nil, "Creating CPU profile %q\n", *cpuProfile)
@@ -16,7 +16,6 @@ import (
 	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fs/log"
 	"github.com/ncw/rclone/vfs"
-	"github.com/ncw/rclone/vfs/vfsflags"
 	"github.com/pkg/errors"
 )
 
@@ -32,10 +31,10 @@ type FS struct {
 }
 
 // NewFS makes a new FS
-func NewFS(f fs.Fs) *FS {
+func NewFS(VFS *vfs.VFS) *FS {
 	fsys := &FS{
-		VFS:   vfs.New(f, &vfsflags.Opt),
-		f:     f,
+		VFS:   VFS,
+		f:     VFS.Fs(),
 		ready: make(chan (struct{})),
 	}
 	return fsys
@@ -112,6 +111,19 @@ func (fsys *FS) lookupDir(path string) (dir *vfs.Dir, errc int) {
 	return dir, 0
 }
 
+// lookup a node whose attributes can be changed given a path
+func (fsys *FS) lookupAttributer(path string) (node vfs.Attributer, errc int) {
+	n, errc := fsys.lookupNode(path)
+	if errc != 0 {
+		return nil, errc
+	}
+	node, ok := n.(vfs.Attributer)
+	if !ok {
+		return nil, -fuse.ENOSYS
+	}
+	return node, 0
+}
+
 // lookup a parent Dir given a path returning the dir and the leaf
 func (fsys *FS) lookupParentDir(filePath string) (leaf string, dir *vfs.Dir, errc int) {
 	parentDir, leaf := path.Split(filePath)
@@ -162,8 +174,7 @@ func (fsys *FS) stat(node vfs.Node, stat *fuse.Stat_t) (errc int) {
 	stat.Ino = node.Inode() // FIXME do we need to set the inode number?
 	stat.Mode = uint32(Mode)
 	stat.Nlink = 1
-	stat.Uid = fsys.VFS.Opt.UID
-	stat.Gid = fsys.VFS.Opt.GID
+	stat.Uid, stat.Gid = vfs.Owner(node)
 	//stat.Rdev
 	stat.Size = int64(Size)
 	t := fuse.NewTimespec(modTime)
@@ -478,15 +489,29 @@ func (fsys *FS) Readlink(path string) (errc int, linkPath string) {
 // Chmod changes the permission bits of a file.
 func (fsys *FS) Chmod(path string, mode uint32) (errc int) {
 	defer log.Trace(path, "mode=0%o", mode)("errc=%d", &errc)
-	// This is a no-op for rclone
-	return 0
+	node, errc := fsys.lookupAttributer(path)
+	if errc != 0 {
+		return errc
+	}
+	return translateError(node.Chmod(os.FileMode(mode).Perm()))
 }
 
 // Chown changes the owner and group of a file.
 func (fsys *FS) Chown(path string, uid uint32, gid uint32) (errc int) {
 	defer log.Trace(path, "uid=%d, gid=%d", uid, gid)("errc=%d", &errc)
-	// This is a no-op for rclone
-	return 0
+	node, errc := fsys.lookupAttributer(path)
+	if errc != 0 {
+		return errc
+	}
+	// ^uint32(0) means leave unchanged
+	oldUID, oldGID := node.Owner()
+	if uid == ^uint32(0) {
+		uid = oldUID
+	}
+	if gid == ^uint32(0) {
+		gid = oldGID
+	}
+	return translateError(node.Chown(uid, gid))
 }
 
 // Access checks file access permissions.
@@ -505,22 +530,55 @@ func (fsys *FS) Fsyncdir(path string, datasync bool, fh uint64) (errc int) {
 
 // Setxattr sets extended attributes.
 func (fsys *FS) Setxattr(path string, name string, value []byte, flags int) (errc int) {
-	return -fuse.ENOSYS
+	defer log.Trace(path, "name=%q, flags=%d", name, flags)("errc=%d", &errc)
+	node, errc := fsys.lookupAttributer(path)
+	if errc != 0 {
+		return errc
+	}
+	return translateError(node.Setxattr(name, value, flags))
 }
 
 // Getxattr gets extended attributes.
 func (fsys *FS) Getxattr(path string, name string) (errc int, value []byte) {
-	return -fuse.ENOSYS, nil
+	defer log.Trace(path, "name=%q", name)("errc=%d", &errc)
+	node, errc := fsys.lookupAttributer(path)
+	if errc != 0 {
+		return errc, nil
+	}
+	value, err := node.Getxattr(name)
+	if err != nil {
+		return translateError(err), nil
+	}
+	return 0, value
 }
 
 // Removexattr removes extended attributes.
 func (fsys *FS) Removexattr(path string, name string) (errc int) {
-	return -fuse.ENOSYS
+	defer log.Trace(path, "name=%q", name)("errc=%d", &errc)
+	node, errc := fsys.lookupAttributer(path)
+	if errc != 0 {
+		return errc
+	}
+	return translateError(node.Removexattr(name))
 }
 
 // Listxattr lists extended attributes.
 func (fsys *FS) Listxattr(path string, fill func(name string) bool) (errc int) {
-	return -fuse.ENOSYS
+	defer log.Trace(path, "")("errc=%d", &errc)
+	node, errc := fsys.lookupAttributer(path)
+	if errc != 0 {
+		return errc
+	}
+	names, err := node.Listxattr()
+	if err != nil {
+		return translateError(err)
+	}
+	for _, name := range names {
+		if !fill(name) {
+			return -fuse.ERANGE
+		}
+	}
+	return 0
 }
 
 // Translate errors from mountlib
@@ -549,8 +607,12 @@ func translateError(err error) (errc int) {
 		return -fuse.EROFS
 	case vfs.ENOSYS:
 		return -fuse.ENOSYS
+	case vfs.ELOCKED:
+		return -fuse.EACCES
 	case vfs.EINVAL:
 		return -fuse.EINVAL
+	case vfs.ENOATTR:
+		return -fuse.ENOATTR
 	}
 	fs.Errorf(nil, "IO error: %v", err)
 	return -fuse.EIO
@@ -31,10 +31,11 @@ func init() {
 		name = "mount"
 	}
 	mountlib.NewMountCommand(name, Mount)
+	mountlib.AddRc(name, mountVFS)
 }
 
 // mountOptions configures the options from the command line flags
-func mountOptions(device string, mountpoint string) (options []string) {
+func mountOptions(device string, mountpoint string, opt *vfs.Options) (options []string) {
 	// Options
 	options = []string{
 		"-o", "fsname=" + device,
@@ -86,7 +87,7 @@ func mountOptions(device string, mountpoint string) (options []string) {
 	if mountlib.DefaultPermissions {
 		options = append(options, "-o", "default_permissions")
 	}
-	if vfsflags.Opt.ReadOnly {
+	if opt.ReadOnly {
 		options = append(options, "-o", "ro")
 	}
 	if mountlib.WritebackCache {
@@ -125,25 +126,41 @@ func waitFor(fn func() bool) (ok bool) {
 // returns an error, and an error channel for the serve process to
 // report an error when fusermount is called.
 func mount(f fs.Fs, mountpoint string) (*vfs.VFS, <-chan error, func() error, error) {
+	VFS := vfs.New(f, &vfsflags.Opt)
+	errChan, unmount, err := mountVFS(VFS, mountpoint)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return VFS, errChan, unmount, nil
+}
+
+// mountVFS mounts the VFS passed in on mountpoint
+//
+// The mount point will be ready when this returns.
+//
+// returns an error, and an error channel for the serve process to
+// report an error when fusermount is called.
+func mountVFS(VFS *vfs.VFS, mountpoint string) (<-chan error, func() error, error) {
+	f := VFS.Fs()
 	fs.Debugf(f, "Mounting on %q", mountpoint)
 
 	// Check the mountpoint - in Windows the mountpoint musn't exist before the mount
 	if runtime.GOOS != "windows" {
 		fi, err := os.Stat(mountpoint)
 		if err != nil {
-			return nil, nil, nil, errors.Wrap(err, "mountpoint")
+			return nil, nil, errors.Wrap(err, "mountpoint")
 		}
 		if !fi.IsDir() {
-			return nil, nil, nil, errors.New("mountpoint is not a directory")
+			return nil, nil, errors.New("mountpoint is not a directory")
 		}
 	}
 
 	// Create underlying FS
-	fsys := NewFS(f)
+	fsys := NewFS(VFS)
 	host := fuse.NewFileSystemHost(fsys)
 
 	// Create options
-	options := mountOptions(f.Name()+":"+f.Root(), mountpoint)
+	options := mountOptions(f.Name()+":"+f.Root(), mountpoint, &VFS.Opt)
 	fs.Debugf(f, "Mounting with options: %q", options)
 
 	// Serve the mount point in the background returning error to errChan
@@ -184,7 +201,7 @@ func mount(f fs.Fs, mountpoint string) (*vfs.VFS, <-chan error, func() error, er
 	select {
 	case err := <-errChan:
 		err = errors.Wrap(err, "mount stopped before calling Init")
-		return nil, nil, nil, err
+		return nil, nil, err
 	case <-fsys.ready:
 	}
 
@@ -199,7 +216,7 @@ func mount(f fs.Fs, mountpoint string) (*vfs.VFS, <-chan error, func() error, er
 		}
 	}
 
-	return fsys.VFS, errChan, unmount, nil
+	return errChan, unmount, nil
 }
 
 // Mount mounts the remote at mountpoint.
@@ -27,9 +27,8 @@ var _ fusefs.Node = (*Dir)(nil)
 func (d *Dir) Attr(ctx context.Context, a *fuse.Attr) (err error) {
 	defer log.Trace(d, "")("attr=%+v, err=%v", a, &err)
 	a.Valid = mountlib.AttrTimeout
-	a.Gid = d.VFS().Opt.GID
-	a.Uid = d.VFS().Opt.UID
-	a.Mode = os.ModeDir | d.VFS().Opt.DirPerms
+	a.Uid, a.Gid = d.Dir.Owner()
+	a.Mode = os.ModeDir | d.Dir.Mode()
 	modTime := d.ModTime()
 	a.Atime = modTime
 	a.Mtime = modTime
@@ -43,9 +42,14 @@ func (d *Dir) Attr(ctx context.Context, a *fuse.Attr) (err error) {
 // Check interface satisfied
 var _ fusefs.NodeSetattrer = (*Dir)(nil)
 
-// Setattr handles attribute changes from FUSE. Currently supports ModTime only.
+// Setattr handles attribute changes from FUSE. Currently supports
+// Mode, Uid, Gid and ModTime only.
 func (d *Dir) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) (err error) {
 	defer log.Trace(d, "stat=%+v", req)("err=%v", &err)
+	err = setattr(d.Dir, req)
+	if err != nil {
+		return translateError(err)
+	}
 	if d.VFS().Opt.NoModTime {
 		return nil
 	}
@@ -193,3 +197,41 @@ func (d *Dir) Link(ctx context.Context, req *fuse.LinkRequest, old fusefs.Node)
 	defer log.Trace(d, "req=%v, old=%v", req, old)("new=%v, err=%v", &newNode, &err)
 	return nil, fuse.ENOSYS
 }
+
+// Getxattr gets an extended attribute by the given name from the
+// node.
+//
+// If there is no xattr by that name, returns fuse.ErrNoXattr.
+func (d *Dir) Getxattr(ctx context.Context, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) (err error) {
+	defer log.Trace(d, "name=%q", req.Name)("err=%v", &err)
+	return getxattr(d.Dir, req, resp)
+}
+
+var _ fusefs.NodeGetxattrer = (*Dir)(nil)
+
+// Listxattr lists the extended attributes recorded for the node.
+func (d *Dir) Listxattr(ctx context.Context, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) (err error) {
+	defer log.Trace(d, "")("err=%v", &err)
+	return listxattr(d.Dir, req, resp)
+}
+
+var _ fusefs.NodeListxattrer = (*Dir)(nil)
+
+// Setxattr sets an extended attribute with the given name and
+// value for the node.
+func (d *Dir) Setxattr(ctx context.Context, req *fuse.SetxattrRequest) (err error) {
+	defer log.Trace(d, "name=%q", req.Name)("err=%v", &err)
+	return setxattr(d.Dir, req)
+}
+
+var _ fusefs.NodeSetxattrer = (*Dir)(nil)
+
+// Removexattr removes an extended attribute for the name.
+//
+// If there is no xattr by that name, returns fuse.ErrNoXattr.
+func (d *Dir) Removexattr(ctx context.Context, req *fuse.RemovexattrRequest) (err error) {
+	defer log.Trace(d, "name=%q", req.Name)("err=%v", &err)
+	return removexattr(d.Dir, req)
+}
+
+var _ fusefs.NodeRemovexattrer = (*Dir)(nil)
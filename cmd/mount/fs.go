@@ -13,7 +13,6 @@ import (
 	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fs/log"
 	"github.com/ncw/rclone/vfs"
-	"github.com/ncw/rclone/vfs/vfsflags"
 	"github.com/pkg/errors"
 	"golang.org/x/net/context" // switch to "context" when we stop supporting go1.8
 )
@@ -28,10 +27,10 @@ type FS struct {
 var _ fusefs.FS = (*FS)(nil)
 
 // NewFS makes a new FS
-func NewFS(f fs.Fs) *FS {
+func NewFS(VFS *vfs.VFS) *FS {
 	fsys := &FS{
-		VFS: vfs.New(f, &vfsflags.Opt),
-		f:   f,
+		VFS: VFS,
+		f:   VFS.Fs(),
 	}
 	return fsys
 }
@@ -105,8 +104,66 @@ func translateError(err error) error {
 		return fuse.Errno(syscall.EROFS)
 	case vfs.ENOSYS:
 		return fuse.ENOSYS
+	case vfs.ELOCKED:
+		return fuse.Errno(syscall.EACCES)
 	case vfs.EINVAL:
 		return fuse.Errno(syscall.EINVAL)
+	case vfs.ENOATTR:
+		return fuse.ErrNoXattr
 	}
 	return err
 }
+
+// setattr applies the mode and owner changes in req to node
+func setattr(node vfs.Attributer, req *fuse.SetattrRequest) error {
+	if req.Valid.Mode() {
+		err := node.Chmod(req.Mode)
+		if err != nil {
+			return err
+		}
+	}
+	if req.Valid.Uid() || req.Valid.Gid() {
+		uid, gid := node.Owner()
+		if req.Valid.Uid() {
+			uid = req.Uid
+		}
+		if req.Valid.Gid() {
+			gid = req.Gid
+		}
+		err := node.Chown(uid, gid)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getxattr reads the extended attribute in req from node
+func getxattr(node vfs.Attributer, req *fuse.GetxattrRequest, resp *fuse.GetxattrResponse) error {
+	value, err := node.Getxattr(req.Name)
+	if err != nil {
+		return translateError(err)
+	}
+	resp.Xattr = value
+	return nil
+}
+
+// listxattr lists the extended attributes of node
+func listxattr(node vfs.Attributer, req *fuse.ListxattrRequest, resp *fuse.ListxattrResponse) error {
+	names, err := node.Listxattr()
+	if err != nil {
+		return translateError(err)
+	}
+	resp.Append(names...)
+	return nil
+}
+
+// setxattr sets the extended attribute in req on node
+func setxattr(node vfs.Attributer, req *fuse.SetxattrRequest) error {
+	return translateError(node.Setxattr(req.Name, req.Xattr, int(req.Flags)))
+}
+
+// removexattr removes the extended attribute in req from node
+func removexattr(node vfs.Attributer, req *fuse.RemovexattrRequest) error {
+	return translateError(node.Removexattr(req.Name))
+}
@@ -23,10 +23,11 @@ import (
 
 func init() {
 	mountlib.NewMountCommand("mount", Mount)
+	mountlib.AddRc("mount", mountVFS)
 }
 
 // mountOptions configures the options from the command line flags
-func mountOptions(device string) (options []fuse.MountOption) {
+func mountOptions(device string, opt *vfs.Options) (options []fuse.MountOption) {
 	options = []fuse.MountOption{
 		fuse.MaxReadahead(uint32(mountlib.MaxReadAhead)),
 		fuse.Subtype("rclone"),
@@ -58,7 +59,7 @@ func mountOptions(device string) (options []fuse.MountOption) {
 	if mountlib.DefaultPermissions {
 		options = append(options, fuse.DefaultPermissions())
 	}
-	if vfsflags.Opt.ReadOnly {
+	if opt.ReadOnly {
 		options = append(options, fuse.ReadOnly())
 	}
 	if mountlib.WritebackCache {
@@ -83,13 +84,29 @@ func mountOptions(device string) (options []fuse.MountOption) {
 // returns an error, and an error channel for the serve process to
 // report an error when fusermount is called.
 func mount(f fs.Fs, mountpoint string) (*vfs.VFS, <-chan error, func() error, error) {
-	fs.Debugf(f, "Mounting on %q", mountpoint)
-	c, err := fuse.Mount(mountpoint, mountOptions(f.Name()+":"+f.Root())...)
+	VFS := vfs.New(f, &vfsflags.Opt)
+	errChan, unmount, err := mountVFS(VFS, mountpoint)
 	if err != nil {
 		return nil, nil, nil, err
 	}
+	return VFS, errChan, unmount, nil
+}
+
+// mountVFS mounts the VFS passed in on mountpoint
+//
+// The mount point will be ready when this returns.
+//
+// returns an error, and an error channel for the serve process to
+// report an error when fusermount is called.
+func mountVFS(VFS *vfs.VFS, mountpoint string) (<-chan error, func() error, error) {
+	f := VFS.Fs()
+	fs.Debugf(f, "Mounting on %q", mountpoint)
+	c, err := fuse.Mount(mountpoint, mountOptions(f.Name()+":"+f.Root(), &VFS.Opt)...)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	filesys := NewFS(f)
+	filesys := NewFS(VFS)
 	server := fusefs.New(c, nil)
 
 	// Serve the mount point in the background returning error to errChan
@@ -106,7 +123,7 @@ func mount(f fs.Fs, mountpoint string) (*vfs.VFS, <-chan error, func() error, er
 	// check if the mount process has an error to report
 	<-c.Ready
 	if err := c.MountError; err != nil {
-		return nil, nil, nil, err
+		return nil, nil, err
 	}
 
 	unmount := func() error {
@@ -115,7 +132,7 @@ func mount(f fs.Fs, mountpoint string) (*vfs.VFS, <-chan error, func() error, er
 		return fuse.Unmount(mountpoint)
 	}
 
-	return filesys.VFS, errChan, unmount, nil
+	return errChan, unmount, nil
 }
 
 // Mount mounts the remote at mountpoint.
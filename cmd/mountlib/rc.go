@@ -0,0 +1,369 @@
+// Remote control of mounts
+
+package mountlib
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/rc"
+	"github.com/ncw/rclone/lib/atexit"
+	"github.com/ncw/rclone/vfs"
+	"github.com/ncw/rclone/vfs/vfsflags"
+	"github.com/pkg/errors"
+)
+
+// MountVFSFn is called to mount a VFS on the mountpoint
+//
+// It returns a channel which receives the result of the unmount and a
+// function to unmount the VFS.
+type MountVFSFn func(VFS *vfs.VFS, mountpoint string) (<-chan error, func() error, error)
+
+// MountInfo describes a mount started by the rc
+type MountInfo struct {
+	Fs         string    `json:"fs"`
+	MountPoint string    `json:"mountPoint"`
+	MountType  string    `json:"mountType"`
+	MountedOn  time.Time `json:"mountedOn"`
+	vfs        *vfs.VFS
+	unmount    func() error
+}
+
+var (
+	mountFnsMu sync.Mutex
+	mountFns   = map[string]MountVFSFn{}
+
+	mountsMu      sync.Mutex
+	mounts        = map[string]*MountInfo{}
+	unmountAtExit bool
+)
+
+// AddRc registers fn as the mountType for use by the mount/mount rc
+// call
+func AddRc(mountType string, fn MountVFSFn) {
+	mountFnsMu.Lock()
+	defer mountFnsMu.Unlock()
+	mountFns[mountType] = fn
+}
+
+// ResolveMountFn returns the mount function for mountType.
+//
+// If mountType is empty then it returns "mount" if available otherwise
+// the first mountType in alphabetical order.
+func ResolveMountFn(mountType string) (string, MountVFSFn, error) {
+	mountFnsMu.Lock()
+	defer mountFnsMu.Unlock()
+	if mountType == "" {
+		if _, ok := mountFns["mount"]; ok {
+			mountType = "mount"
+		} else {
+			var types []string
+			for name := range mountFns {
+				types = append(types, name)
+			}
+			sort.Strings(types)
+			if len(types) == 0 {
+				return "", nil, errors.New("mount is not supported on this platform")
+			}
+			mountType = types[0]
+		}
+	}
+	fn, ok := mountFns[mountType]
+	if !ok {
+		return "", nil, errors.Errorf("unknown mount type %q", mountType)
+	}
+	return mountType, fn, nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "mount/mount",
+		AuthRequired: true,
+		Fn:           rcMount,
+		Title:        "Create a new mount point",
+		Help: `rclone allows Linux, FreeBSD, macOS and Windows to mount any of
+Rclone's cloud storage systems as a file system with FUSE.
+
+If no mountType is provided, the priority is given as follows: 1. mount 2.cmount
+
+This takes the following parameters
+
+- fs - a remote path to be mounted (required)
+- mountPoint: valid path on the local machine (required)
+- mountType: One of the values (mount, cmount) specifies the mount implementation to use
+- vfsOpt: a JSON object with VFS options in, as returned by options/get in the vfs block
+
+Eg
+
+    rclone rc mount/mount fs=mydrive: mountPoint=/home/<user>/mountPoint
+    rclone rc mount/mount fs=mydrive: mountPoint=/home/<user>/mountPoint mountType=mount
+    rclone rc mount/mount --json '{"fs": "TestDrive:", "mountPoint": "/mnt/tmp", "vfsOpt": {"CacheMode": 2, "ReadOnly": true}}'
+
+Any VFS options not supplied in vfsOpt are taken from the command
+line flags of the rclone process running the rc server.
+
+The mount options (eg --allow-other) are taken from the command line
+flags of the rclone process running the rc server.
+`,
+		Input: []rc.Param{
+			{Name: "fs", Type: rc.ParamString, Required: true, Help: "a remote path to be mounted"},
+			{Name: "mountPoint", Type: rc.ParamString, Required: true, Help: "valid path on the local machine"},
+			{Name: "mountType", Type: rc.ParamString, Help: "the mount implementation to use"},
+			{Name: "vfsOpt", Type: rc.ParamObject, Help: "VFS options as returned by options/get in the vfs block"},
+		},
+		Output: []rc.Param{},
+	})
+}
+
+// rcMount mounts a remote on a mountpoint
+func rcMount(in rc.Params) (out rc.Params, err error) {
+	mountPoint, err := in.GetString("mountPoint")
+	if err != nil {
+		return nil, err
+	}
+	mountType, err := in.GetString("mountType")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	mountType, mountFn, err := ResolveMountFn(mountType)
+	if err != nil {
+		return nil, err
+	}
+	opt := vfsflags.Opt
+	err = in.GetStruct("vfsOpt", &opt)
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	fsString, err := in.GetString("fs")
+	if err != nil {
+		return nil, err
+	}
+	f, err := rc.GetCachedFs(fsString)
+	if err != nil {
+		return nil, err
+	}
+
+	mountsMu.Lock()
+	defer mountsMu.Unlock()
+	if _, found := mounts[mountPoint]; found {
+		return nil, errors.Errorf("mount point %q is already in use", mountPoint)
+	}
+	VFS := vfs.New(f, &opt)
+	errChan, unmount, err := mountFn(VFS, mountPoint)
+	if err != nil {
+		VFS.Shutdown()
+		return nil, errors.Wrap(err, "mount failed")
+	}
+	info := &MountInfo{
+		Fs:         fsString,
+		MountPoint: mountPoint,
+		MountType:  mountType,
+		MountedOn:  time.Now(),
+		vfs:        VFS,
+		unmount:    unmount,
+	}
+	if len(mounts) == 0 && !unmountAtExit {
+		atexit.Register(func() {
+			_, _ = rcUnmountAll(nil)
+		})
+		unmountAtExit = true
+	}
+	mounts[mountPoint] = info
+	fs.Logf(f, "Mounted on %q with %s", mountPoint, mountType)
+
+	// Forget the mount when it is unmounted
+	go func() {
+		err := <-errChan
+		if err != nil {
+			fs.Errorf(f, "Mount on %q finished with error: %v", mountPoint, err)
+		}
+		mountsMu.Lock()
+		if mounts[mountPoint] == info {
+			delete(mounts, mountPoint)
+			info.vfs.Shutdown()
+		}
+		mountsMu.Unlock()
+	}()
+	return nil, nil
+}
+
+// unmount the mount at mountPoint
+//
+// Call with mountsMu held
+func unmount(mountPoint string) error {
+	info, found := mounts[mountPoint]
+	if !found {
+		return errors.Errorf("mount point %q not found", mountPoint)
+	}
+	err := info.unmount()
+	if err != nil {
+		return errors.Wrapf(err, "failed to unmount %q", mountPoint)
+	}
+	info.vfs.WaitForWriters(time.Minute)
+	// close the databases so the VFS can be mounted again
+	info.vfs.Shutdown()
+	delete(mounts, mountPoint)
+	fs.Logf(nil, "Unmounted %q", mountPoint)
+	return nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "mount/unmount",
+		AuthRequired: true,
+		Fn:           rcUnmount,
+		Title:        "Unmount selected active mount",
+		Help: `
+rclone allows Linux, FreeBSD, macOS and Windows to
+mount any of Rclone's cloud storage systems as a file system with
+FUSE.
+
+This takes the following parameters
+
+- mountPoint: valid path on the local machine where the mount was created (required)
+
+Eg
+
+    rclone rc mount/unmount mountPoint=/home/<user>/mountPoint
+`,
+		Input: []rc.Param{
+			{Name: "mountPoint", Type: rc.ParamString, Required: true, Help: "path on the local machine where the mount was created"},
+		},
+		Output: []rc.Param{},
+	})
+}
+
+// rcUnmount unmounts a mount started with mount/mount
+func rcUnmount(in rc.Params) (out rc.Params, err error) {
+	mountPoint, err := in.GetString("mountPoint")
+	if err != nil {
+		return nil, err
+	}
+	mountsMu.Lock()
+	defer mountsMu.Unlock()
+	return nil, unmount(mountPoint)
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "mount/types",
+		Fn:    rcMountTypes,
+		Title: "Show all possible mount types",
+		Help: `This shows all possible mount types and returns them as a list.
+
+This takes no parameters and returns
+
+- mountTypes: list of mount types
+
+The mount types are strings like "mount" and "cmount" and can be
+passed to mount/mount as the mountType parameter.
+
+Eg
+
+    rclone rc mount/types
+`,
+		Input: []rc.Param{},
+		Output: []rc.Param{
+			{Name: "mountTypes", Type: rc.ParamArray, Required: true, Help: "list of mount types"},
+		},
+	})
+}
+
+// rcMountTypes returns the available mount types
+func rcMountTypes(in rc.Params) (out rc.Params, err error) {
+	mountFnsMu.Lock()
+	defer mountFnsMu.Unlock()
+	mountTypes := []string{}
+	for mountType := range mountFns {
+		mountTypes = append(mountTypes, mountType)
+	}
+	sort.Strings(mountTypes)
+	return rc.Params{
+		"mountTypes": mountTypes,
+	}, nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "mount/listmounts",
+		Fn:    rcListMounts,
+		Title: "Show current mount points",
+		Help: `This shows currently mounted points, which can be used for performing an unmount
+
+This takes no parameters and returns
+
+- mountPoints: list of current mount points, each with
+    - fs: the remote which was mounted
+    - mountPoint: where it is mounted
+    - mountType: the mount implementation in use
+    - mountedOn: the time the mount was created
+
+Eg
+
+    rclone rc mount/listmounts
+`,
+		Input: []rc.Param{},
+		Output: []rc.Param{
+			{Name: "mountPoints", Type: rc.ParamArray, Required: true, Help: "list of current mount points"},
+		},
+	})
+}
+
+// rcListMounts lists the mounts started with mount/mount
+func rcListMounts(in rc.Params) (out rc.Params, err error) {
+	mountsMu.Lock()
+	defer mountsMu.Unlock()
+	var keys []string
+	for mountPoint := range mounts {
+		keys = append(keys, mountPoint)
+	}
+	sort.Strings(keys)
+	mountPoints := []*MountInfo{}
+	for _, mountPoint := range keys {
+		mountPoints = append(mountPoints, mounts[mountPoint])
+	}
+	return rc.Params{
+		"mountPoints": mountPoints,
+	}, nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "mount/unmountall",
+		AuthRequired: true,
+		Fn:           rcUnmountAll,
+		Title:        "Unmount all active mounts",
+		Help: `
+rclone allows Linux, FreeBSD, macOS and Windows to
+mount any of Rclone's cloud storage systems as a file system with
+FUSE.
+
+This unmounts all the mounts created with mount/mount.
+
+This takes no parameters and returns error if unmount does not succeed.
+
+Eg
+
+    rclone rc mount/unmountall
+`,
+		Input:  []rc.Param{},
+		Output: []rc.Param{},
+	})
+}
+
+// rcUnmountAll unmounts all the mounts started with mount/mount
+func rcUnmountAll(in rc.Params) (out rc.Params, err error) {
+	mountsMu.Lock()
+	defer mountsMu.Unlock()
+	for mountPoint := range mounts {
+		if e := unmount(mountPoint); e != nil {
+			fs.Errorf(nil, "%v", e)
+			if err == nil {
+				err = e
+			}
+		}
+	}
+	return nil, err
+}
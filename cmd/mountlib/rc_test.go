@@ -0,0 +1,147 @@
+package mountlib
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+
+	_ "github.com/ncw/rclone/backend/local"
+	"github.com/ncw/rclone/fs/config"
+	"github.com/ncw/rclone/fs/rc"
+	"github.com/ncw/rclone/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRc(t *testing.T) {
+	// Install a fake mount type which doesn't need FUSE
+	var mountedVFS *vfs.VFS
+	AddRc("fake", func(VFS *vfs.VFS, mountpoint string) (<-chan error, func() error, error) {
+		mountedVFS = VFS
+		errChan := make(chan error, 1)
+		unmount := func() error {
+			errChan <- nil
+			return nil
+		}
+		return errChan, unmount, nil
+	})
+
+	localDir, err := ioutil.TempDir("", "rclone-mountlib-localDir")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(localDir) }()
+
+	mount := rc.Calls.Get("mount/mount")
+	require.NotNil(t, mount)
+	unmount := rc.Calls.Get("mount/unmount")
+	require.NotNil(t, unmount)
+	listmounts := rc.Calls.Get("mount/listmounts")
+	require.NotNil(t, listmounts)
+	unmountall := rc.Calls.Get("mount/unmountall")
+	require.NotNil(t, unmountall)
+	types := rc.Calls.Get("mount/types")
+	require.NotNil(t, types)
+
+	out, err := types.Fn(nil)
+	require.NoError(t, err)
+	assert.Contains(t, out["mountTypes"], "fake")
+
+	// Mount with some VFS options
+	in := rc.Params{
+		"fs":         localDir,
+		"mountPoint": "/fake/mountpoint",
+		"mountType":  "fake",
+		"vfsOpt": rc.Params{
+			"ReadOnly": true,
+		},
+	}
+	_, err = mount.Fn(in)
+	require.NoError(t, err)
+	require.NotNil(t, mountedVFS)
+	assert.True(t, mountedVFS.Opt.ReadOnly)
+
+	// Can't mount twice on the same mountpoint
+	_, err = mount.Fn(in)
+	assert.Error(t, err)
+
+	out, err = listmounts.Fn(nil)
+	require.NoError(t, err)
+	mountPoints := out["mountPoints"].([]*MountInfo)
+	require.Equal(t, 1, len(mountPoints))
+	assert.Equal(t, "/fake/mountpoint", mountPoints[0].MountPoint)
+	assert.Equal(t, "fake", mountPoints[0].MountType)
+	assert.Equal(t, localDir, mountPoints[0].Fs)
+
+	_, err = unmount.Fn(rc.Params{"mountPoint": "/fake/mountpoint"})
+	require.NoError(t, err)
+	_, err = unmount.Fn(rc.Params{"mountPoint": "/fake/mountpoint"})
+	assert.Error(t, err)
+
+	// Mount two and unmount them all
+	in["mountPoint"] = "/fake/mountpoint1"
+	_, err = mount.Fn(in)
+	require.NoError(t, err)
+	in["mountPoint"] = "/fake/mountpoint2"
+	_, err = mount.Fn(in)
+	require.NoError(t, err)
+	_, err = unmountall.Fn(nil)
+	require.NoError(t, err)
+
+	out, err = listmounts.Fn(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(out["mountPoints"].([]*MountInfo)))
+
+	// Mount with form parameters which pass vfsOpt as a JSON
+	// string, reading them as the rc server does
+	form, err := url.ParseQuery(url.Values{
+		"fs":         {localDir},
+		"mountPoint": {"/fake/mountpoint3"},
+		"mountType":  {"fake"},
+		"vfsOpt":     {`{"ReadOnly": true, "CacheMode": 2}`},
+	}.Encode())
+	require.NoError(t, err)
+	in = rc.Params{}
+	for k, vs := range form {
+		in[k] = vs[len(vs)-1]
+	}
+	mountedVFS = nil
+	require.NoError(t, mount.Validate(in))
+	_, err = mount.Fn(in)
+	require.NoError(t, err)
+	require.NotNil(t, mountedVFS)
+	assert.True(t, mountedVFS.Opt.ReadOnly)
+	assert.Equal(t, vfs.CacheModeWrites, mountedVFS.Opt.CacheMode)
+	_, err = unmountall.Fn(nil)
+	require.NoError(t, err)
+
+	// Unmounting closes the persistent directory cache so the
+	// remote can be mounted again with it
+	oldCacheDir := config.CacheDir
+	config.CacheDir, err = ioutil.TempDir("", "rclone-mountlib-cacheDir")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(config.CacheDir)
+		config.CacheDir = oldCacheDir
+	}()
+	persist := rc.Params{
+		"fs":         localDir,
+		"mountPoint": "/fake/mountpoint4",
+		"mountType":  "fake",
+		"vfsOpt": rc.Params{
+			"DirCachePersist": true,
+		},
+	}
+	for i := 0; i < 2; i++ {
+		mountedVFS = nil
+		_, err = mount.Fn(persist)
+		require.NoError(t, err)
+		require.NotNil(t, mountedVFS)
+		assert.True(t, mountedVFS.Opt.DirCachePersist)
+		_, err = unmount.Fn(rc.Params{"mountPoint": "/fake/mountpoint4"})
+		require.NoError(t, err)
+	}
+
+	// A vfsOpt which isn't a JSON object is rejected
+	in["vfsOpt"] = "potato"
+	assert.True(t, rc.IsErrParamInvalid(mount.Validate(in)))
+}
@@ -0,0 +1,179 @@
+// The docker volume plugin protocol
+
+// +build linux
+
+package docker
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// contentType is the content type docker plugins talk in
+const contentType = "application/vnd.docker.plugins.v1+json"
+
+// request is the body of a request from docker
+type request struct {
+	Name string            // name of the volume
+	Opts map[string]string // driver options for VolumeDriver.Create
+	ID   string            // unique ID of the caller for VolumeDriver.Mount and Unmount
+}
+
+// volumeInfo describes a volume to docker
+type volumeInfo struct {
+	Name       string
+	Mountpoint string                 `json:",omitempty"`
+	CreatedAt  string                 `json:",omitempty"`
+	Status     map[string]interface{} `json:",omitempty"`
+}
+
+// capabilities describes the plugin to docker
+type capabilities struct {
+	Scope string
+}
+
+// response is the body of the responses to docker.  Only the fields
+// for the call being answered are set.
+type response struct {
+	Err          string
+	Implements   []string      `json:",omitempty"`
+	Mountpoint   string        `json:",omitempty"`
+	Volume       *volumeInfo   `json:",omitempty"`
+	Volumes      []*volumeInfo `json:",omitempty"`
+	Capabilities *capabilities `json:",omitempty"`
+}
+
+// Handler returns an http.Handler serving the docker volume plugin
+// API for the driver
+func (d *Driver) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/Plugin.Activate", handle(func(req *request) (*response, error) {
+		return &response{Implements: []string{"VolumeDriver"}}, nil
+	}))
+	mux.HandleFunc("/VolumeDriver.Create", handle(func(req *request) (*response, error) {
+		return &response{}, d.Create(req.Name, req.Opts)
+	}))
+	mux.HandleFunc("/VolumeDriver.Remove", handle(func(req *request) (*response, error) {
+		return &response{}, d.Remove(req.Name)
+	}))
+	mux.HandleFunc("/VolumeDriver.Mount", handle(func(req *request) (*response, error) {
+		mountpoint, err := d.Mount(req.Name, req.ID)
+		return &response{Mountpoint: mountpoint}, err
+	}))
+	mux.HandleFunc("/VolumeDriver.Unmount", handle(func(req *request) (*response, error) {
+		return &response{}, d.Unmount(req.Name, req.ID)
+	}))
+	mux.HandleFunc("/VolumeDriver.Path", handle(func(req *request) (*response, error) {
+		mountpoint, err := d.Path(req.Name)
+		return &response{Mountpoint: mountpoint}, err
+	}))
+	mux.HandleFunc("/VolumeDriver.Get", handle(func(req *request) (*response, error) {
+		info, err := d.info(req.Name)
+		return &response{Volume: info}, err
+	}))
+	mux.HandleFunc("/VolumeDriver.List", handle(func(req *request) (*response, error) {
+		return &response{Volumes: d.list()}, nil
+	}))
+	mux.HandleFunc("/VolumeDriver.Capabilities", handle(func(req *request) (*response, error) {
+		return &response{Capabilities: &capabilities{Scope: "local"}}, nil
+	}))
+	return mux
+}
+
+// handle makes an http.HandlerFunc which decodes the request, calls
+// fn and encodes the response.  Errors are returned to docker in the
+// Err field.
+func handle(fn func(req *request) (*response, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req request
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil && err != io.EOF {
+			writeResponse(w, http.StatusBadRequest, &response{Err: "failed to read request: " + err.Error()})
+			return
+		}
+		fs.Debugf(nil, "docker: %s %q", r.URL.Path, req.Name)
+		resp, err := fn(&req)
+		if err != nil {
+			fs.Errorf(nil, "docker: %s failed: %v", r.URL.Path, err)
+			writeResponse(w, http.StatusInternalServerError, &response{Err: err.Error()})
+			return
+		}
+		writeResponse(w, http.StatusOK, resp)
+	}
+}
+
+// writeResponse writes resp to w as JSON with status
+func writeResponse(w http.ResponseWriter, status int, resp *response) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		fs.Errorf(nil, "docker: failed to write response: %v", err)
+	}
+}
+
+// info describes the volume
+//
+// Call with the lock held
+func (v *Volume) info() *volumeInfo {
+	return &volumeInfo{
+		Name:       v.Name,
+		Mountpoint: v.path(),
+		CreatedAt:  v.CreatedAt.Format(time.RFC3339),
+		Status: map[string]interface{}{
+			"Mounts": len(v.MountIDs),
+		},
+	}
+}
+
+// info describes the volume called name
+func (d *Driver) info(name string) (*volumeInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v, err := d.get(name)
+	if err != nil {
+		return nil, err
+	}
+	return v.info(), nil
+}
+
+// list describes all the volumes in name order
+func (d *Driver) list() []*volumeInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	infos := []*volumeInfo{}
+	for _, v := range d.volumes {
+		infos = append(infos, v.info())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// listen makes a unix socket at socketPath, removing any left behind
+// by a previous run
+func listen(socketPath string) (net.Listener, error) {
+	err := os.MkdirAll(filepath.Dir(socketPath), 0755)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to make socket directory")
+	}
+	err = os.Remove(socketPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "failed to remove old socket")
+	}
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to listen")
+	}
+	return l, nil
+}
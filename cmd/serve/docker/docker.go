@@ -0,0 +1,135 @@
+// Package docker implements a docker volume plugin which mounts
+// rclone remotes as volumes
+
+// +build linux
+
+package docker
+
+import (
+	"net/http"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/cmd/mountlib"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config/flags"
+	"github.com/ncw/rclone/fs/rc"
+	"github.com/ncw/rclone/lib/atexit"
+	"github.com/ncw/rclone/vfs"
+	"github.com/ncw/rclone/vfs/vfsflags"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Options contains options for the docker volume plugin
+type Options struct {
+	SocketAddr  string // path of the unix socket to listen on
+	BaseDir     string // directory the volumes are mounted in
+	MountType   string // mount implementation to use or "" for the default
+	ForgetState bool   // start with no volumes, ignoring the saved state
+}
+
+// DefaultOpt is the default values used for Options
+var DefaultOpt = Options{
+	SocketAddr: "/run/docker/plugins/rclone.sock",
+	BaseDir:    "/var/lib/docker-volumes/rclone",
+}
+
+// Opt is options set by command line flags
+var Opt = DefaultOpt
+
+// AddFlags adds flags for the docker volume plugin
+func AddFlags(flagSet *pflag.FlagSet, Opt *Options) {
+	rc.AddOption("docker", Opt)
+	flags.StringVarP(flagSet, &Opt.SocketAddr, "socket-addr", "", Opt.SocketAddr, "Path of the unix socket to listen on.")
+	flags.StringVarP(flagSet, &Opt.BaseDir, "base-dir", "", Opt.BaseDir, "Directory to mount the volumes in and save the state.")
+	flags.StringVarP(flagSet, &Opt.MountType, "mount-type", "", Opt.MountType, "Mount implementation to use, eg mount or cmount.")
+	flags.BoolVarP(flagSet, &Opt.ForgetState, "forget-state", "", Opt.ForgetState, "Forget the saved volumes on startup.")
+}
+
+func init() {
+	mountlib.AddFlags(Command.Flags())
+	vfsflags.AddFlags(Command.Flags())
+	AddFlags(Command.Flags(), &Opt)
+}
+
+// Command definition for cobra
+var Command = &cobra.Command{
+	Use:   "docker",
+	Short: `Serve any remote as a docker volume plugin.`,
+	Long: `rclone serve docker implements the docker volume plugin API so
+docker can use rclone remotes as volumes.  Each volume is mounted with
+FUSE on the host when a container using it starts, so containers don't
+need to be privileged or to run rclone themselves.
+
+Run it as root, eg
+
+    sudo rclone serve docker --allow-other
+
+and docker will find the plugin by its socket in /run/docker/plugins
+(set with --socket-addr).  You can then make volumes with the rclone
+driver and use them in containers
+
+    docker volume create mydrive -d rclone -o fs=mydrive:path/to/files
+    docker run -v mydrive:/data --rm -it alpine ls /data
+
+When run as a docker managed plugin set --socket-addr to the socket
+named in the plugin's config.json and --base-dir to a directory in its
+propagated mount.
+
+### Volume options ###
+
+The driver options given with -o when the volume is created say what
+to mount.  Either
+
+- fs - an existing remote from the config file, eg mydrive:path
+
+or make a remote on the fly with
+
+- type - the backend to use, eg sftp or s3
+- any of the options of that backend, eg host=example.com user=me
+
+The backend is configured from these options and its defaults only, so
+the config file, environment variables and command line flags aren't
+used for it.  Password options should be given in plain text as they
+are obscured for the backend.  These options can also be given
+
+- path - the directory in the remote to mount
+- read-only - set to true to mount the volume read only
+- vfs-cache-mode - the --vfs-cache-mode to use for the volume
+
+Option names can use - or _, so access-key-id and access_key_id are
+the same.  All the other VFS and mount flags are taken from the
+command line of rclone serve docker.
+
+The volume is mounted in --base-dir when the first container using it
+starts and unmounted when the last one stops.
+
+### State ###
+
+The volumes and the containers using them are saved in
+--base-dir/.rclone-docker-state.json, so when the plugin is restarted
+it remembers its volumes and mounts the ones which are in use again.
+Use --forget-state to start with no volumes.  The state file contains
+the volume options so it may contain credentials.
+` + vfs.Help,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(0, 0, command, args)
+		cmd.Run(false, false, command, func() error {
+			d, err := NewDriver(&Opt)
+			if err != nil {
+				return err
+			}
+			l, err := listen(Opt.SocketAddr)
+			if err != nil {
+				d.UnmountAll()
+				return err
+			}
+			atexit.Register(func() {
+				_ = l.Close()
+				d.UnmountAll()
+			})
+			fs.Logf(nil, "Serving docker volume plugin on %s", Opt.SocketAddr)
+			return http.Serve(l, d.Handler())
+		})
+	},
+}
@@ -0,0 +1,315 @@
+// +build linux
+
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	_ "github.com/ncw/rclone/backend/local"
+	"github.com/ncw/rclone/cmd/mountlib"
+	"github.com/ncw/rclone/fs/config"
+	"github.com/ncw/rclone/vfs"
+	"github.com/ncw/rclone/vfs/vfsflags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMounts records the VFSes mounted by the fake mount type keyed
+// on mount point
+var (
+	fakeMountsMu sync.Mutex
+	fakeMounts   = map[string]*vfs.VFS{}
+)
+
+func init() {
+	// Install a fake mount type which doesn't need FUSE
+	mountlib.AddRc("fake", func(VFS *vfs.VFS, mountpoint string) (<-chan error, func() error, error) {
+		fakeMountsMu.Lock()
+		fakeMounts[mountpoint] = VFS
+		fakeMountsMu.Unlock()
+		errChan := make(chan error, 1)
+		unmount := func() error {
+			fakeMountsMu.Lock()
+			delete(fakeMounts, mountpoint)
+			fakeMountsMu.Unlock()
+			errChan <- nil
+			return nil
+		}
+		return errChan, unmount, nil
+	})
+}
+
+// fakeMounted returns the VFS mounted on mountpoint or nil
+func fakeMounted(mountpoint string) *vfs.VFS {
+	fakeMountsMu.Lock()
+	defer fakeMountsMu.Unlock()
+	return fakeMounts[mountpoint]
+}
+
+// newTestDriver makes a driver with a temporary base directory and a
+// local directory to make volumes of
+func newTestDriver(t *testing.T) (d *Driver, localDir string, cleanup func()) {
+	baseDir, err := ioutil.TempDir("", "rclone-docker-base")
+	require.NoError(t, err)
+	localDir, err = ioutil.TempDir("", "rclone-docker-local")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(localDir, "file.txt"), []byte("hello"), 0666))
+	opt := DefaultOpt
+	opt.BaseDir = baseDir
+	opt.MountType = "fake"
+	d, err = NewDriver(&opt)
+	require.NoError(t, err)
+	return d, localDir, func() {
+		d.UnmountAll()
+		_ = os.RemoveAll(baseDir)
+		_ = os.RemoveAll(localDir)
+	}
+}
+
+// call makes a plugin API call to h returning the status and response
+func call(t *testing.T, h http.Handler, method string, req interface{}) (int, *response) {
+	body, err := json.Marshal(req)
+	require.NoError(t, err)
+	r := httptest.NewRequest("POST", "/"+method, bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, contentType, w.Header().Get("Content-Type"))
+	var resp response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return w.Code, &resp
+}
+
+func TestAPI(t *testing.T) {
+	d, localDir, cleanup := newTestDriver(t)
+	defer cleanup()
+	h := d.Handler()
+	mountpoint := filepath.Join(d.opt.BaseDir, "vol")
+
+	status, resp := call(t, h, "Plugin.Activate", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{"VolumeDriver"}, resp.Implements)
+
+	status, resp = call(t, h, "VolumeDriver.Capabilities", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, &capabilities{Scope: "local"}, resp.Capabilities)
+
+	// Bad creates
+	for _, test := range []struct {
+		name string
+		opts map[string]string
+		err  string
+	}{
+		{"bad/name", map[string]string{"fs": localDir}, `invalid volume name "bad/name"`},
+		{".hidden", map[string]string{"fs": localDir}, `invalid volume name ".hidden"`},
+		{"vol", nil, "need either the fs or the type option"},
+		{"vol", map[string]string{"type": "local", "fs": localDir}, "can't use both the fs and the type options"},
+		{"vol", map[string]string{"type": "local", "potato": "true"}, `unknown option "potato" for backend "local"`},
+		{"vol", map[string]string{"fs": localDir, "copy-links": "true"}, "backend options can only be used with the type option: copy_links"},
+		{"vol", map[string]string{"fs": localDir, "path": "file.txt"}, "path must be a directory not a file"},
+		{"vol", map[string]string{"fs": localDir, "read-only": "potato"}, `bad read-only option: strconv.ParseBool: parsing "potato": invalid syntax`},
+	} {
+		status, resp = call(t, h, "VolumeDriver.Create", &request{Name: test.name, Opts: test.opts})
+		assert.Equal(t, http.StatusInternalServerError, status, test.name)
+		assert.Equal(t, test.err, resp.Err, test.name)
+	}
+
+	status, resp = call(t, h, "VolumeDriver.List", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 0, len(resp.Volumes))
+
+	// Create a volume with an on the fly local remote
+	opts := map[string]string{"type": "local", "path": localDir, "read-only": "true"}
+	status, resp = call(t, h, "VolumeDriver.Create", &request{Name: "vol", Opts: opts})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "", resp.Err)
+
+	// Creating it again is OK with the same or no options
+	status, _ = call(t, h, "VolumeDriver.Create", &request{Name: "vol", Opts: opts})
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = call(t, h, "VolumeDriver.Create", &request{Name: "vol"})
+	assert.Equal(t, http.StatusOK, status)
+	status, resp = call(t, h, "VolumeDriver.Create", &request{Name: "vol", Opts: map[string]string{"fs": localDir}})
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Equal(t, `volume "vol" already exists with different options`, resp.Err)
+
+	status, resp = call(t, h, "VolumeDriver.Get", &request{Name: "vol"})
+	assert.Equal(t, http.StatusOK, status)
+	require.NotNil(t, resp.Volume)
+	assert.Equal(t, "vol", resp.Volume.Name)
+	assert.Equal(t, "", resp.Volume.Mountpoint)
+	assert.Equal(t, map[string]interface{}{"Mounts": float64(0)}, resp.Volume.Status)
+
+	status, resp = call(t, h, "VolumeDriver.Get", &request{Name: "notfound"})
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Equal(t, `volume "notfound" not found`, resp.Err)
+
+	// Mount it twice
+	status, resp = call(t, h, "VolumeDriver.Mount", &request{Name: "vol", ID: "one"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, mountpoint, resp.Mountpoint)
+	VFS := fakeMounted(mountpoint)
+	require.NotNil(t, VFS)
+	assert.True(t, VFS.Opt.ReadOnly)
+	node, err := VFS.Stat("file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), node.Size())
+
+	status, resp = call(t, h, "VolumeDriver.Mount", &request{Name: "vol", ID: "two"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, mountpoint, resp.Mountpoint)
+	assert.True(t, VFS == fakeMounted(mountpoint))
+
+	status, resp = call(t, h, "VolumeDriver.Path", &request{Name: "vol"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, mountpoint, resp.Mountpoint)
+
+	status, resp = call(t, h, "VolumeDriver.List", nil)
+	assert.Equal(t, http.StatusOK, status)
+	require.Equal(t, 1, len(resp.Volumes))
+	assert.Equal(t, mountpoint, resp.Volumes[0].Mountpoint)
+	assert.Equal(t, map[string]interface{}{"Mounts": float64(2)}, resp.Volumes[0].Status)
+
+	// Can't remove while in use
+	status, resp = call(t, h, "VolumeDriver.Remove", &request{Name: "vol"})
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Equal(t, `volume "vol" is in use`, resp.Err)
+
+	// Unmount stops the mount after the last user
+	status, _ = call(t, h, "VolumeDriver.Unmount", &request{Name: "vol", ID: "one"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotNil(t, fakeMounted(mountpoint))
+	status, resp = call(t, h, "VolumeDriver.Unmount", &request{Name: "vol", ID: "one"})
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Equal(t, `volume "vol" is not mounted by "one"`, resp.Err)
+	status, _ = call(t, h, "VolumeDriver.Unmount", &request{Name: "vol", ID: "two"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Nil(t, fakeMounted(mountpoint))
+
+	status, resp = call(t, h, "VolumeDriver.Path", &request{Name: "vol"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "", resp.Mountpoint)
+
+	status, _ = call(t, h, "VolumeDriver.Remove", &request{Name: "vol"})
+	assert.Equal(t, http.StatusOK, status)
+	_, err = os.Stat(mountpoint)
+	assert.True(t, os.IsNotExist(err))
+
+	status, resp = call(t, h, "VolumeDriver.List", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 0, len(resp.Volumes))
+}
+
+func TestState(t *testing.T) {
+	d, localDir, cleanup := newTestDriver(t)
+	defer cleanup()
+	mountpoint := filepath.Join(d.opt.BaseDir, "mounted")
+
+	require.NoError(t, d.Create("mounted", map[string]string{"fs": localDir}))
+	require.NoError(t, d.Create("idle", map[string]string{"fs": localDir, "vfs-cache-mode": "writes"}))
+	_, err := d.Mount("mounted", "one")
+	require.NoError(t, err)
+
+	// Stop the plugin and start it again
+	d.UnmountAll()
+	assert.Nil(t, fakeMounted(mountpoint))
+	d, err = NewDriver(&d.opt)
+	require.NoError(t, err)
+
+	infos := d.list()
+	require.Equal(t, 2, len(infos))
+	assert.Equal(t, "idle", infos[0].Name)
+	assert.Equal(t, "", infos[0].Mountpoint)
+	assert.Equal(t, "mounted", infos[1].Name)
+	assert.Equal(t, mountpoint, infos[1].Mountpoint)
+	VFS := fakeMounted(mountpoint)
+	require.NotNil(t, VFS)
+
+	// The restored volumes work as before
+	require.NoError(t, d.Unmount("mounted", "one"))
+	assert.Nil(t, fakeMounted(mountpoint))
+	_, err = d.Mount("idle", "two")
+	require.NoError(t, err)
+	VFS = fakeMounted(filepath.Join(d.opt.BaseDir, "idle"))
+	require.NotNil(t, VFS)
+	assert.Equal(t, vfs.CacheModeWrites, VFS.Opt.CacheMode)
+	d.UnmountAll()
+
+	// --forget-state starts again
+	opt := d.opt
+	opt.ForgetState = true
+	d, err = NewDriver(&opt)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(d.list()))
+}
+
+func TestSocket(t *testing.T) {
+	d, _, cleanup := newTestDriver(t)
+	defer cleanup()
+	socketPath := filepath.Join(d.opt.BaseDir, "run", "rclone.sock")
+
+	// A stale socket is replaced
+	require.NoError(t, os.MkdirAll(filepath.Dir(socketPath), 0755))
+	require.NoError(t, ioutil.WriteFile(socketPath, nil, 0666))
+
+	l, err := listen(socketPath)
+	require.NoError(t, err)
+	defer func() { _ = l.Close() }()
+	go func() { _ = http.Serve(l, d.Handler()) }()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return net.Dial("unix", socketPath)
+			},
+		},
+	}
+	resp, err := client.Post("http://plugin/Plugin.Activate", contentType, nil)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"Err":"","Implements":["VolumeDriver"]}`+"\n", string(body))
+}
+
+func TestRemount(t *testing.T) {
+	d, localDir, cleanup := newTestDriver(t)
+	defer cleanup()
+	mountpoint := filepath.Join(d.opt.BaseDir, "vol")
+	oldCacheDir := config.CacheDir
+	var err error
+	config.CacheDir, err = ioutil.TempDir("", "rclone-docker-cache")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(config.CacheDir)
+		config.CacheDir = oldCacheDir
+	}()
+
+	oldPersist := vfsflags.Opt.DirCachePersist
+	vfsflags.Opt.DirCachePersist = true
+	defer func() {
+		vfsflags.Opt.DirCachePersist = oldPersist
+	}()
+
+	// Stopping the mount closes the persistent directory cache so
+	// it can be used when the volume is mounted again
+	require.NoError(t, d.Create("vol", map[string]string{"fs": localDir}))
+	for i := 0; i < 2; i++ {
+		_, err = d.Mount("vol", "one")
+		require.NoError(t, err)
+		VFS := fakeMounted(mountpoint)
+		require.NotNil(t, VFS)
+		assert.True(t, VFS.Opt.DirCachePersist)
+		require.NoError(t, d.Unmount("vol", "one"))
+	}
+}
@@ -0,0 +1,11 @@
+// Build for docker for unsupported platforms to stop go complaining
+// about "no buildable Go source files "
+
+// +build !linux
+
+package docker
+
+import "github.com/spf13/cobra"
+
+// Command definition is nil to show not implemented
+var Command *cobra.Command = nil
@@ -0,0 +1,486 @@
+// +build linux
+
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/cmd/mountlib"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config/configmap"
+	"github.com/ncw/rclone/fs/config/obscure"
+	"github.com/ncw/rclone/vfs"
+	"github.com/ncw/rclone/vfs/vfsflags"
+	"github.com/pkg/errors"
+)
+
+// stateFile is the name of the file in the base directory the
+// volumes are saved in.  Docker volume names can't start with "."
+// so it can't clash with a mount point.
+const stateFile = ".rclone-docker-state.json"
+
+// volumeNameRe matches the volume names docker allows
+var volumeNameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Volume is a docker volume managed by the plugin
+type Volume struct {
+	Name      string            `json:"name"`
+	Options   map[string]string `json:"options"`   // driver options the volume was created with
+	CreatedAt time.Time         `json:"createdAt"` // when the volume was created
+	MountIDs  []string          `json:"mountIDs"`  // IDs of the mount requests using the volume
+
+	mountpoint string       // where the volume is mounted
+	f          fs.Fs        // backend made when the volume was created, if any
+	opt        vfs.Options  // VFS options made with f
+	vfs        *vfs.VFS     // VFS being served - set while mounted
+	unmount    func() error // unmounts the VFS - set while mounted
+}
+
+// Driver implements the docker volume plugin
+type Driver struct {
+	opt       Options
+	statePath string
+
+	mu      sync.Mutex
+	volumes map[string]*Volume
+}
+
+// NewDriver makes a new driver from opt, restoring the volumes saved
+// in its state and mounting any which were in use.
+func NewDriver(opt *Options) (*Driver, error) {
+	d := &Driver{
+		opt:       *opt,
+		statePath: filepath.Join(opt.BaseDir, stateFile),
+		volumes:   map[string]*Volume{},
+	}
+	err := os.MkdirAll(d.opt.BaseDir, 0755)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to make base directory")
+	}
+	if d.opt.ForgetState {
+		err = os.Remove(d.statePath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, errors.Wrap(err, "failed to remove state")
+		}
+	}
+	err = d.restore()
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// restore reads the saved volumes and remounts the ones which were
+// mounted when the plugin stopped.
+func (d *Driver) restore() error {
+	data, err := ioutil.ReadFile(d.statePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "failed to read state")
+	}
+	var volumes []*Volume
+	err = json.Unmarshal(data, &volumes)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse state")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, v := range volumes {
+		v.mountpoint = filepath.Join(d.opt.BaseDir, v.Name)
+		d.volumes[v.Name] = v
+		if len(v.MountIDs) == 0 {
+			continue
+		}
+		err = d.startMount(v)
+		if err != nil {
+			fs.Errorf(nil, "docker: failed to remount volume %q: %v", v.Name, err)
+			v.MountIDs = nil
+		}
+	}
+	fs.Infof(nil, "docker: restored %d volumes", len(volumes))
+	return d.save()
+}
+
+// save writes the volumes to the state file
+//
+// Call with the lock held
+func (d *Driver) save() error {
+	volumes := make([]*Volume, 0, len(d.volumes))
+	for _, v := range d.volumes {
+		volumes = append(volumes, v)
+	}
+	sort.Slice(volumes, func(i, j int) bool {
+		return volumes[i].Name < volumes[j].Name
+	})
+	data, err := json.MarshalIndent(volumes, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal state")
+	}
+	// Write to a temporary file and rename it so the state is
+	// never left half written.  The options may contain
+	// credentials so only the owner can read it.
+	tmpPath := d.statePath + ".tmp"
+	err = ioutil.WriteFile(tmpPath, data, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to write state")
+	}
+	err = os.Rename(tmpPath, d.statePath)
+	if err != nil {
+		return errors.Wrap(err, "failed to write state")
+	}
+	return nil
+}
+
+// newFs makes the backend and the VFS options for the volume from
+// its driver options.
+//
+// The "fs" option names an existing remote, otherwise "type" is the
+// backend to make from the other options.
+func (v *Volume) newFs() (f fs.Fs, opt vfs.Options, err error) {
+	opt = vfsflags.Opt
+	config := configmap.Simple{}
+	var fsString, fsType, fsPath string
+	for key, value := range v.Options {
+		key = strings.Replace(key, "-", "_", -1)
+		switch key {
+		case "fs":
+			fsString = value
+		case "type":
+			fsType = value
+		case "path":
+			fsPath = value
+		case "read_only":
+			opt.ReadOnly, err = strconv.ParseBool(value)
+			if err != nil {
+				return nil, opt, errors.Wrap(err, "bad read-only option")
+			}
+		case "vfs_cache_mode":
+			err = opt.CacheMode.Set(value)
+			if err != nil {
+				return nil, opt, errors.Wrap(err, "bad vfs-cache-mode option")
+			}
+		default:
+			config.Set(key, value)
+		}
+	}
+
+	switch {
+	case fsString != "" && fsType != "":
+		return nil, opt, errors.New("can't use both the fs and the type options")
+	case fsString != "":
+		if len(config) != 0 {
+			return nil, opt, errors.Errorf("backend options can only be used with the type option: %s", strings.Join(sortedKeys(config), ", "))
+		}
+		if fsPath != "" {
+			if !strings.HasSuffix(fsString, ":") && !strings.HasSuffix(fsString, "/") {
+				fsString += "/"
+			}
+			fsString += fsPath
+		}
+		f, err = fs.NewFs(fsString)
+	case fsType != "":
+		f, err = newFsFromOptions(v.Name, fsType, fsPath, config)
+	default:
+		return nil, opt, errors.New("need either the fs or the type option")
+	}
+	if err == fs.ErrorIsFile {
+		return nil, opt, errors.New("path must be a directory not a file")
+	} else if err != nil {
+		return nil, opt, err
+	}
+	return f, opt, nil
+}
+
+// newFsFromOptions makes a backend of type fsType called name on the
+// fly from config.  Password options are obscured and defaults are
+// filled in for anything not set.  The config file, environment and
+// command line aren't read.
+func newFsFromOptions(name, fsType, fsPath string, config configmap.Simple) (fs.Fs, error) {
+	fsInfo, err := fs.Find(fsType)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't find backend for %q", fsType)
+	}
+	options := map[string]*fs.Option{}
+	for i := range fsInfo.Options {
+		o := &fsInfo.Options[i]
+		options[o.Name] = o
+	}
+	for _, key := range sortedKeys(config) {
+		o, ok := options[key]
+		if !ok {
+			return nil, errors.Errorf("unknown option %q for backend %q", key, fsType)
+		}
+		if o.IsPassword {
+			value, _ := config.Get(key)
+			obscuredValue, err := obscure.Obscure(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to obscure %q", key)
+			}
+			config.Set(key, obscuredValue)
+		}
+	}
+	for _, o := range options {
+		if _, ok := config.Get(o.Name); !ok && o.Default != nil {
+			config.Set(o.Name, fmt.Sprint(o.Default))
+		}
+	}
+	return fsInfo.NewFs(name, fsPath, config)
+}
+
+// sortedKeys returns the keys of config in order
+func sortedKeys(config configmap.Simple) []string {
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// startMount mounts the volume on its mount point
+//
+// Call with the lock held
+func (d *Driver) startMount(v *Volume) error {
+	mountType, mountFn, err := mountlib.ResolveMountFn(d.opt.MountType)
+	if err != nil {
+		return err
+	}
+	// Use the backend made when the volume was created if there
+	// is one, otherwise make a new one
+	f, opt := v.f, v.opt
+	v.f = nil
+	if f == nil {
+		f, opt, err = v.newFs()
+		if err != nil {
+			return err
+		}
+	}
+	err = os.MkdirAll(v.mountpoint, 0755)
+	if err != nil {
+		return errors.Wrap(err, "failed to make mount point")
+	}
+	VFS := vfs.New(f, &opt)
+	errChan, unmount, err := mountFn(VFS, v.mountpoint)
+	if err != nil {
+		VFS.Shutdown()
+		return errors.Wrap(err, "mount failed")
+	}
+	v.vfs = VFS
+	v.unmount = unmount
+	fs.Logf(f, "docker: mounted volume %q on %q with %s", v.Name, v.mountpoint, mountType)
+
+	// Forget the mount if it is unmounted from outside
+	go func() {
+		err := <-errChan
+		if err != nil {
+			fs.Errorf(f, "docker: mount of volume %q finished with error: %v", v.Name, err)
+		}
+		d.mu.Lock()
+		if v.vfs == VFS {
+			v.vfs = nil
+			v.unmount = nil
+			VFS.Shutdown()
+		}
+		d.mu.Unlock()
+	}()
+	return nil
+}
+
+// stopMount unmounts the volume
+//
+// Call with the lock held
+func (d *Driver) stopMount(v *Volume) error {
+	if v.vfs == nil {
+		return nil
+	}
+	err := v.unmount()
+	if err != nil {
+		return errors.Wrapf(err, "failed to unmount volume %q", v.Name)
+	}
+	v.vfs.WaitForWriters(time.Minute)
+	// close the databases so the volume can be mounted again
+	v.vfs.Shutdown()
+	v.vfs = nil
+	v.unmount = nil
+	fs.Logf(nil, "docker: unmounted volume %q", v.Name)
+	return nil
+}
+
+// get returns the volume called name
+//
+// Call with the lock held
+func (d *Driver) get(name string) (*Volume, error) {
+	v, ok := d.volumes[name]
+	if !ok {
+		return nil, errors.Errorf("volume %q not found", name)
+	}
+	return v, nil
+}
+
+// Create makes a new volume called name with the driver options
+// passed in.  The options are checked by making the backend.
+//
+// Creating a volume which exists with the same options does nothing.
+func (d *Driver) Create(name string, options map[string]string) error {
+	if !volumeNameRe.MatchString(name) {
+		return errors.Errorf("invalid volume name %q", name)
+	}
+	if options == nil {
+		options = map[string]string{}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if v, ok := d.volumes[name]; ok {
+		if len(options) == 0 || equalOptions(v.Options, options) {
+			return nil
+		}
+		return errors.Errorf("volume %q already exists with different options", name)
+	}
+	v := &Volume{
+		Name:       name,
+		Options:    options,
+		CreatedAt:  time.Now(),
+		mountpoint: filepath.Join(d.opt.BaseDir, name),
+	}
+	f, opt, err := v.newFs()
+	if err != nil {
+		return err
+	}
+	v.f, v.opt = f, opt
+	d.volumes[name] = v
+	fs.Infof(nil, "docker: created volume %q", name)
+	return d.save()
+}
+
+// equalOptions returns true if a and b contain the same options
+func equalOptions(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if otherValue, ok := b[key]; !ok || otherValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Remove deletes the volume called name which must not be in use
+func (d *Driver) Remove(name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v, err := d.get(name)
+	if err != nil {
+		return err
+	}
+	if len(v.MountIDs) != 0 {
+		return errors.Errorf("volume %q is in use", name)
+	}
+	err = os.Remove(v.mountpoint)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to remove mount point")
+	}
+	delete(d.volumes, name)
+	fs.Infof(nil, "docker: removed volume %q", name)
+	return d.save()
+}
+
+// Mount mounts the volume called name for the request id if it isn't
+// mounted already and returns the mount point.
+func (d *Driver) Mount(name, id string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v, err := d.get(name)
+	if err != nil {
+		return "", err
+	}
+	if v.vfs == nil {
+		err = d.startMount(v)
+		if err != nil {
+			return "", err
+		}
+	}
+	for _, mountID := range v.MountIDs {
+		if mountID == id {
+			return v.mountpoint, nil
+		}
+	}
+	v.MountIDs = append(v.MountIDs, id)
+	return v.mountpoint, d.save()
+}
+
+// Unmount releases the volume called name for the request id,
+// unmounting it when it is no longer in use.
+func (d *Driver) Unmount(name, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v, err := d.get(name)
+	if err != nil {
+		return err
+	}
+	found := false
+	for i, mountID := range v.MountIDs {
+		if mountID == id {
+			v.MountIDs = append(v.MountIDs[:i], v.MountIDs[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if !found {
+		return errors.Errorf("volume %q is not mounted by %q", name, id)
+	}
+	if len(v.MountIDs) == 0 {
+		err = d.stopMount(v)
+		if err != nil {
+			v.MountIDs = append(v.MountIDs, id)
+			return err
+		}
+	}
+	return d.save()
+}
+
+// Path returns the mount point of the volume called name or "" if it
+// isn't mounted
+func (d *Driver) Path(name string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v, err := d.get(name)
+	if err != nil {
+		return "", err
+	}
+	return v.path(), nil
+}
+
+// path returns the mount point if mounted or ""
+//
+// Call with the lock held
+func (v *Volume) path() string {
+	if v.vfs == nil {
+		return ""
+	}
+	return v.mountpoint
+}
+
+// UnmountAll unmounts all the volumes without changing the saved
+// state so they are mounted again when the plugin restarts.
+func (d *Driver) UnmountAll() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, v := range d.volumes {
+		err := d.stopMount(v)
+		if err != nil {
+			fs.Errorf(nil, "docker: %v", err)
+		}
+	}
+}
@@ -18,6 +18,10 @@ import (
 	"github.com/ncw/rclone/cmd"
 	"github.com/ncw/rclone/cmd/serve/ftp/ftpflags"
 	"github.com/ncw/rclone/cmd/serve/ftp/ftpopt"
+	"github.com/ncw/rclone/cmd/serve/multi"
+	"github.com/ncw/rclone/cmd/serve/multi/multiflags"
+	"github.com/ncw/rclone/cmd/serve/proxy"
+	"github.com/ncw/rclone/cmd/serve/proxy/proxyflags"
 	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fs/accounting"
 	"github.com/ncw/rclone/fs/log"
@@ -29,22 +33,38 @@ import (
 func init() {
 	ftpflags.AddFlags(Command.Flags())
 	vfsflags.AddFlags(Command.Flags())
+	proxyflags.AddFlags(Command.Flags())
+	multiflags.AddFlags(Command.Flags())
 }
 
 // Command definition for cobra
 var Command = &cobra.Command{
-	Use:   "ftp remote:path",
+	Use:   "ftp remote:path [name=remote:path]*",
 	Short: `Serve remote:path over FTP.`,
 	Long: `
 rclone serve ftp implements a basic ftp server to serve the
 remote over FTP protocol. This can be viewed with a ftp client
 or you can make a remote of type ftp to read and write it.
-` + ftpopt.Help + vfs.Help,
+` + ftpopt.Help + vfs.Help + proxy.Help + multi.Help,
 	Run: func(command *cobra.Command, args []string) {
-		cmd.CheckArgs(1, 1, command, args)
-		f := cmd.NewFsSrc(args)
+		var f fs.Fs
+		useMulti := proxyflags.Opt.AuthProxy == "" && multi.Enabled(&multiflags.Opt, args)
+		if proxyflags.Opt.AuthProxy != "" {
+			cmd.CheckArgs(0, 0, command, args)
+		} else if !useMulti {
+			cmd.CheckArgs(1, 1, command, args)
+			f = cmd.NewFsSrc(args)
+		}
 		cmd.Run(false, false, command, func() error {
-			s, err := newServer(f, &ftpflags.Opt)
+			var remotes *multi.Remotes
+			if useMulti {
+				var err error
+				remotes, err = multi.New(&multiflags.Opt, args, &vfsflags.Opt)
+				if err != nil {
+					return err
+				}
+			}
+			s, err := newServer(f, remotes, &ftpflags.Opt)
 			if err != nil {
 				return err
 			}
@@ -55,12 +75,15 @@ or you can make a remote of type ftp to read and write it.
 
 // server contains everything to run the server
 type server struct {
-	f   fs.Fs
-	srv *ftp.Server
+	f       fs.Fs
+	srv     *ftp.Server
+	vfs     *vfs.VFS       // nil if using the auth proxy or multiple remotes
+	proxy   *proxy.Proxy   // set if using the auth proxy
+	remotes *multi.Remotes // set if serving multiple remotes
 }
 
-// Make a new FTP to serve the remote
-func newServer(f fs.Fs, opt *ftpopt.Options) (*server, error) {
+// Make a new FTP to serve the remote, or remotes if set
+func newServer(f fs.Fs, remotes *multi.Remotes, opt *ftpopt.Options) (*server, error) {
 	host, port, err := net.SplitHostPort(opt.ListenAddr)
 	if err != nil {
 		return nil, errors.New("Failed to parse host:port")
@@ -70,11 +93,21 @@ func newServer(f fs.Fs, opt *ftpopt.Options) (*server, error) {
 		return nil, errors.New("Failed to parse host:port")
 	}
 
+	s := &server{
+		f:       f,
+		remotes: remotes,
+	}
+	if proxyflags.Opt.AuthProxy != "" {
+		s.proxy = proxy.New(&proxyflags.Opt)
+	} else if remotes == nil {
+		s.vfs = vfs.New(f, &vfsflags.Opt)
+	}
+
 	ftpopt := &ftp.ServerOpts{
 		Name:           "Rclone FTP Server",
 		WelcomeMessage: "Welcome on Rclone FTP Server",
 		Factory: &DriverFactory{
-			vfs: vfs.New(f, &vfsflags.Opt),
+			s: s,
 		},
 		Hostname:     host,
 		Port:         portNum,
@@ -82,14 +115,13 @@ func newServer(f fs.Fs, opt *ftpopt.Options) (*server, error) {
 		Auth: &Auth{
 			BasicUser: opt.BasicUser,
 			BasicPass: opt.BasicPass,
+			proxy:     s.proxy,
 		},
 		Logger: &Logger{},
 		//TODO implement a maximum of https://godoc.org/github.com/goftp/server#ServerOpts
 	}
-	return &server{
-		f:   f,
-		srv: ftp.NewServer(ftpopt),
-	}, nil
+	s.srv = ftp.NewServer(ftpopt)
+	return s, nil
 }
 
 // serve runs the ftp server
@@ -135,45 +167,88 @@ func (l *Logger) PrintResponse(sessionID string, code int, message string) {
 type Auth struct {
 	BasicUser string
 	BasicPass string
+	proxy     *proxy.Proxy // if set use this to authenticate
 }
 
 //CheckPasswd handle auth based on configuration
 func (a *Auth) CheckPasswd(user, pass string) (bool, error) {
+	if a.proxy != nil {
+		_, err := a.proxy.Call(user, pass, false)
+		if err != nil {
+			fs.Infof(nil, "proxy login failed: %v", err)
+			return false, nil
+		}
+		return true, nil
+	}
 	return a.BasicUser == user && (a.BasicPass == "" || a.BasicPass == pass), nil
 }
 
 //DriverFactory factory of ftp driver for each session
 type DriverFactory struct {
-	vfs *vfs.VFS
+	s *server
 }
 
 //NewDriver start a new session
 func (f *DriverFactory) NewDriver() (ftp.Driver, error) {
 	log.Trace("", "Init driver")("")
 	return &Driver{
-		vfs: f.vfs,
+		s:   f.s,
+		vfs: f.s.vfs,
 	}, nil
 }
 
 //Driver impletation of ftp server
 type Driver struct {
-	vfs  *vfs.VFS
+	s    *server
+	conn *ftp.Conn
 	lock sync.Mutex
+
+	vfsMu sync.Mutex
+	vfs   *vfs.VFS // set on login if using the auth proxy
 }
 
 //Init a connection
-func (d *Driver) Init(*ftp.Conn) {
+func (d *Driver) Init(conn *ftp.Conn) {
 	defer log.Trace("", "Init session")("")
+	d.conn = conn
+}
+
+// getVFS returns the VFS serving path and the path within it.  It
+// finds the VFS from the remote named in the path if serving multiple
+// remotes or from the auth proxy for the logged in user if necessary.
+func (d *Driver) getVFS(path string) (*vfs.VFS, string, error) {
+	if d.s.remotes != nil {
+		VFS, path := d.s.remotes.Split(path)
+		return VFS, path, nil
+	}
+	d.vfsMu.Lock()
+	defer d.vfsMu.Unlock()
+	if d.vfs != nil {
+		return d.vfs, path, nil
+	}
+	if d.s.proxy == nil || d.conn == nil || !d.conn.IsLogin() {
+		return nil, "", errors.New("Not logged in")
+	}
+	d.vfs = d.s.proxy.Get(d.conn.LoginUser())
+	if d.vfs == nil {
+		return nil, "", errors.New("Login has expired")
+	}
+	return d.vfs, path, nil
 }
 
 //Stat get information on file or folder
 func (d *Driver) Stat(path string) (fi ftp.FileInfo, err error) {
 	defer log.Trace(path, "")("fi=%+v, err = %v", &fi, &err)
-	n, err := d.vfs.Stat(path)
+	VFS, path, err := d.getVFS(path)
+	if err != nil {
+		return nil, err
+	}
+	n, err := VFS.Stat(path)
 	if err != nil {
 		return nil, err
 	}
-	return &FileInfo{n, n.Mode(), d.vfs.Opt.UID, d.vfs.Opt.GID}, err
+	uid, gid := vfs.Owner(n)
+	return &FileInfo{n, n.Mode(), uid, gid}, err
 }
 
 //ChangeDir move current folder
@@ -181,7 +256,11 @@ func (d *Driver) ChangeDir(path string) (err error) {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 	defer log.Trace(path, "")("err = %v", &err)
-	n, err := d.vfs.Stat(path)
+	VFS, path, err := d.getVFS(path)
+	if err != nil {
+		return err
+	}
+	n, err := VFS.Stat(path)
 	if err != nil {
 		return err
 	}
@@ -196,7 +275,11 @@ func (d *Driver) ListDir(path string, callback func(ftp.FileInfo) error) (err er
 	d.lock.Lock()
 	defer d.lock.Unlock()
 	defer log.Trace(path, "")("err = %v", &err)
-	node, err := d.vfs.Stat(path)
+	VFS, path, err := d.getVFS(path)
+	if err != nil {
+		return err
+	}
+	node, err := VFS.Stat(path)
 	if err == vfs.ENOENT {
 		return errors.New("Directory not found")
 	} else if err != nil {
@@ -217,7 +300,8 @@ func (d *Driver) ListDir(path string, callback func(ftp.FileInfo) error) (err er
 	defer accounting.Stats.DoneTransferring(path, true)
 
 	for _, file := range dirEntries {
-		err = callback(&FileInfo{file, file.Mode(), d.vfs.Opt.UID, d.vfs.Opt.GID})
+		uid, gid := vfs.Owner(file)
+		err = callback(&FileInfo{file, file.Mode(), uid, gid})
 		if err != nil {
 			return err
 		}
@@ -230,7 +314,11 @@ func (d *Driver) DeleteDir(path string) (err error) {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 	defer log.Trace(path, "")("err = %v", &err)
-	node, err := d.vfs.Stat(path)
+	VFS, path, err := d.getVFS(path)
+	if err != nil {
+		return err
+	}
+	node, err := VFS.Stat(path)
 	if err != nil {
 		return err
 	}
@@ -249,7 +337,11 @@ func (d *Driver) DeleteFile(path string) (err error) {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 	defer log.Trace(path, "")("err = %v", &err)
-	node, err := d.vfs.Stat(path)
+	VFS, path, err := d.getVFS(path)
+	if err != nil {
+		return err
+	}
+	node, err := VFS.Stat(path)
 	if err != nil {
 		return err
 	}
@@ -268,7 +360,18 @@ func (d *Driver) Rename(oldName, newName string) (err error) {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 	defer log.Trace(oldName, "newName=%q", newName)("err = %v", &err)
-	return d.vfs.Rename(oldName, newName)
+	VFS, oldName, err := d.getVFS(oldName)
+	if err != nil {
+		return err
+	}
+	newVFS, newName, err := d.getVFS(newName)
+	if err != nil {
+		return err
+	}
+	if newVFS != VFS {
+		return multi.ErrCrossRemote
+	}
+	return VFS.Rename(oldName, newName)
 }
 
 //MakeDir create a folder
@@ -276,7 +379,11 @@ func (d *Driver) MakeDir(path string) (err error) {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 	defer log.Trace(path, "")("err = %v", &err)
-	dir, leaf, err := d.vfs.StatParent(path)
+	VFS, path, err := d.getVFS(path)
+	if err != nil {
+		return err
+	}
+	dir, leaf, err := VFS.StatParent(path)
 	if err != nil {
 		return err
 	}
@@ -289,7 +396,11 @@ func (d *Driver) GetFile(path string, offset int64) (size int64, fr io.ReadClose
 	d.lock.Lock()
 	defer d.lock.Unlock()
 	defer log.Trace(path, "offset=%v", offset)("err = %v", &err)
-	node, err := d.vfs.Stat(path)
+	VFS, path, err := d.getVFS(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	node, err := VFS.Stat(path)
 	if err == vfs.ENOENT {
 		fs.Infof(path, "File not found")
 		return 0, nil, errors.New("File not found")
@@ -321,8 +432,12 @@ func (d *Driver) PutFile(path string, data io.Reader, appendData bool) (n int64,
 	d.lock.Lock()
 	defer d.lock.Unlock()
 	defer log.Trace(path, "append=%v", appendData)("err = %v", &err)
+	VFS, path, err := d.getVFS(path)
+	if err != nil {
+		return 0, err
+	}
 	var isExist bool
-	node, err := d.vfs.Stat(path)
+	node, err := VFS.Stat(path)
 	if err == nil {
 		isExist = true
 		if node.IsDir() {
@@ -347,7 +462,7 @@ func (d *Driver) PutFile(path string, data io.Reader, appendData bool) (n int64,
 				return 0, err
 			}
 		}
-		f, err := d.vfs.OpenFile(path, os.O_RDWR|os.O_CREATE, 0660)
+		f, err := VFS.OpenFile(path, os.O_RDWR|os.O_CREATE, 0660)
 		if err != nil {
 			return 0, err
 		}
@@ -359,7 +474,7 @@ func (d *Driver) PutFile(path string, data io.Reader, appendData bool) (n int64,
 		return bytes, nil
 	}
 
-	of, err := d.vfs.OpenFile(path, os.O_APPEND|os.O_RDWR, 0660)
+	of, err := VFS.OpenFile(path, os.O_APPEND|os.O_RDWR, 0660)
 	if err != nil {
 		return 0, err
 	}
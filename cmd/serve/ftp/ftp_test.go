@@ -45,7 +45,7 @@ func TestFTP(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Start the server
-	w, err := newServer(fremote, &opt)
+	w, err := newServer(fremote, nil, &opt)
 	assert.NoError(t, err)
 
 	go func() {
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"io"
 	"net/http"
 	"os"
 	"path"
@@ -11,21 +12,34 @@ import (
 	"github.com/ncw/rclone/cmd/serve/httplib"
 	"github.com/ncw/rclone/cmd/serve/httplib/httpflags"
 	"github.com/ncw/rclone/cmd/serve/httplib/serve"
+	"github.com/ncw/rclone/cmd/serve/multi"
+	"github.com/ncw/rclone/cmd/serve/multi/multiflags"
+	"github.com/ncw/rclone/cmd/serve/proxy"
+	"github.com/ncw/rclone/cmd/serve/proxy/proxyflags"
 	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fs/accounting"
+	"github.com/ncw/rclone/fs/config/flags"
 	"github.com/ncw/rclone/vfs"
 	"github.com/ncw/rclone/vfs/vfsflags"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
+var (
+	readWrite bool
+)
+
 func init() {
 	httpflags.AddFlags(Command.Flags())
 	vfsflags.AddFlags(Command.Flags())
+	proxyflags.AddFlags(Command.Flags())
+	multiflags.AddFlags(Command.Flags())
+	flags.BoolVarP(Command.Flags(), &readWrite, "read-write", "", readWrite, "Allow uploads, deletes and making directories from the web interface.")
 }
 
 // Command definition for cobra
 var Command = &cobra.Command{
-	Use:   "http remote:path",
+	Use:   "http remote:path [name=remote:path]*",
 	Short: `Serve the remote over HTTP.`,
 	Long: `rclone serve http implements a basic web server to serve the remote
 over HTTP.  This can be viewed in a web browser or you can make a
@@ -38,12 +52,65 @@ The server will log errors.  Use -v to see access logs.
 
 --bwlimit will be respected for file transfers.  Use --stats to
 control the stats printing.
-` + httplib.Help + vfs.Help,
+
+### Downloading directories
+
+Directories can be downloaded as an archive of everything in and
+below them by adding "?download=zip" or "?download=tar.gz" to the URL
+of the directory.  The directory listings have links to do this.  The
+archive is streamed as it is made so nothing is stored on disk, and
+--max-depth and the filter flags control what goes into it.  If an
+error occurs part way through then the archive will be incomplete and
+the error will be logged.
+
+### Read write mode
+
+By default the server is read only.  If --read-write is set then the
+directory listings have forms to upload files, create folders and
+delete files and empty folders, so files can be dropped into the
+remote from a web browser.  These are also available to other
+clients
+
+- POST a multipart/form-data body to a directory URL to upload the
+  files in its file parts into that directory, replacing any existing
+  files with the same names
+- POST a form with "mkdir=name" to a directory URL to make the
+  directory "name" in it
+- POST a form with "delete=name" to a directory URL to delete the file
+  or empty directory "name" in it
+- DELETE a file URL to delete the file or a directory URL to delete the
+  empty directory
+
+Successful POSTs redirect back to the directory listing.  POSTs and
+DELETEs with an Origin or Referer header from another site are refused
+so other web pages can't make changes with your browser's credentials.
+If serving through a reverse proxy make sure it passes on the Host
+header.
+
+The writes are protected by the same authentication as reads so you
+will almost certainly want to use --user/--pass, --htpasswd or
+--auth-proxy with --read-write.  Use --vfs-cache-mode writes if you
+want uploads to be written to the remote in the background.
+` + httplib.Help + vfs.Help + proxy.Help + multi.Help,
 	Run: func(command *cobra.Command, args []string) {
-		cmd.CheckArgs(1, 1, command, args)
-		f := cmd.NewFsSrc(args)
+		var f fs.Fs
+		useMulti := proxyflags.Opt.AuthProxy == "" && multi.Enabled(&multiflags.Opt, args)
+		if proxyflags.Opt.AuthProxy != "" {
+			cmd.CheckArgs(0, 0, command, args)
+		} else if !useMulti {
+			cmd.CheckArgs(1, 1, command, args)
+			f = cmd.NewFsSrc(args)
+		}
 		cmd.Run(false, true, command, func() error {
-			s := newServer(f, &httpflags.Opt)
+			var remotes *multi.Remotes
+			if useMulti {
+				var err error
+				remotes, err = multi.New(&multiflags.Opt, args, &vfsflags.Opt)
+				if err != nil {
+					return err
+				}
+			}
+			s := newServer(f, remotes, &httpflags.Opt)
 			err := s.Serve()
 			if err != nil {
 				return err
@@ -57,21 +124,70 @@ control the stats printing.
 // server contains everything to run the server
 type server struct {
 	*httplib.Server
-	f   fs.Fs
-	vfs *vfs.VFS
+	f         fs.Fs
+	vfs       *vfs.VFS       // nil if using the auth proxy or multiple remotes
+	proxy     *proxy.Proxy   // set if using the auth proxy
+	remotes   *multi.Remotes // set if serving multiple remotes
+	readWrite bool           // set if writes are allowed
 }
 
-func newServer(f fs.Fs, opt *httplib.Options) *server {
+func newServer(f fs.Fs, remotes *multi.Remotes, opt *httplib.Options) *server {
 	mux := http.NewServeMux()
 	s := &server{
-		Server: httplib.NewServer(mux, opt),
-		f:      f,
-		vfs:    vfs.New(f, &vfsflags.Opt),
+		f:         f,
+		remotes:   remotes,
+		readWrite: readWrite,
+	}
+	if proxyflags.Opt.AuthProxy != "" {
+		s.proxy = proxy.New(&proxyflags.Opt)
+		// override auth
+		copyOpt := *opt
+		copyOpt.Auth = s.auth
+		opt = &copyOpt
+	} else if remotes == nil {
+		s.vfs = vfs.New(f, &vfsflags.Opt)
 	}
+	s.Server = httplib.NewServer(mux, opt)
 	mux.HandleFunc("/", s.handler)
+	if s.readWrite && !s.UsingAuth() {
+		fs.Logf(nil, "Warning: --read-write is set without any authentication so anyone can modify the remote")
+	}
 	return s
 }
 
+// auth is called by the http server to authenticate users with the
+// auth proxy
+func (s *server) auth(user, pass string) (value interface{}, err error) {
+	VFS, err := s.proxy.Call(user, pass, false)
+	if err != nil {
+		return nil, err
+	}
+	return VFS, nil
+}
+
+// getVFS gets the VFS serving remote for the request and the path of
+// remote within it.  This is found from the remote named in the path
+// if serving multiple remotes, from the context if using the auth
+// proxy, or is the single VFS if not.
+func (s *server) getVFS(r *http.Request, remote string) (VFS *vfs.VFS, vfsRemote string, err error) {
+	if s.remotes != nil {
+		VFS, vfsRemote = s.remotes.Split(remote)
+		return VFS, vfsRemote, nil
+	}
+	if s.vfs != nil {
+		return s.vfs, remote, nil
+	}
+	value := httplib.AuthValue(r)
+	if value == nil {
+		return nil, "", errors.New("no VFS found in context")
+	}
+	VFS, ok := value.(*vfs.VFS)
+	if !ok {
+		return nil, "", errors.Errorf("context value is not VFS: %#v", value)
+	}
+	return VFS, remote, nil
+}
+
 // Serve runs the http server in the background.
 //
 // Use s.Close() and s.Wait() to shutdown server
@@ -86,7 +202,19 @@ func (s *server) Serve() error {
 
 // handler reads incoming requests and dispatches them
 func (s *server) handler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" && r.Method != "HEAD" {
+	switch r.Method {
+	case "GET", "HEAD":
+	case "POST", "DELETE":
+		if !s.readWrite {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !sameOrigin(r) {
+			fs.Errorf(r.URL.Path, "%s: refused %s from another site", r.RemoteAddr, r.Method)
+			http.Error(w, "Cross site request refused", http.StatusForbidden)
+			return
+		}
+	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -96,17 +224,37 @@ func (s *server) handler(w http.ResponseWriter, r *http.Request) {
 	urlPath := r.URL.Path
 	isDir := strings.HasSuffix(urlPath, "/")
 	remote := strings.Trim(urlPath, "/")
-	if isDir {
+	switch {
+	case r.Method == "POST" && isDir:
+		s.postDir(w, r, remote)
+	case r.Method == "POST":
+		http.Error(w, "Can only POST to a directory", http.StatusMethodNotAllowed)
+	case r.Method == "DELETE":
+		s.deleteRemote(w, r, remote, isDir)
+	case isDir:
 		s.serveDir(w, r, remote)
-	} else {
+	default:
 		s.serveFile(w, r, remote)
 	}
 }
 
 // serveDir serves a directory index at dirRemote
 func (s *server) serveDir(w http.ResponseWriter, r *http.Request, dirRemote string) {
+	VFS, vfsRemote, err := s.getVFS(r, dirRemote)
+	if err != nil {
+		serve.Error(dirRemote, w, "Root directory not found", err)
+		return
+	}
+	// Download the directory as an archive if requested
+	if format := r.URL.Query().Get(serve.DownloadParam); format != "" {
+		serve.Archive(w, r, VFS.Fs(), vfsRemote, format, func(o fs.Object) (io.ReadCloser, error) {
+			return VFS.OpenFile(o.Remote(), os.O_RDONLY, 0)
+		})
+		return
+	}
+
 	// List the directory
-	node, err := s.vfs.Stat(dirRemote)
+	node, err := VFS.Stat(vfsRemote)
 	if err == vfs.ENOENT {
 		http.Error(w, "Directory not found", http.StatusNotFound)
 		return
@@ -127,8 +275,10 @@ func (s *server) serveDir(w http.ResponseWriter, r *http.Request, dirRemote stri
 
 	// Make the entries for display
 	directory := serve.NewDirectory(dirRemote, s.HTMLTemplate)
+	directory.ReadWrite = s.readWrite
+	directory.DownloadLinks = true
 	for _, node := range dirEntries {
-		directory.AddEntry(node.Path(), node.IsDir())
+		directory.AddEntry(path.Join(dirRemote, node.Name()), node.IsDir())
 	}
 
 	directory.Serve(w, r)
@@ -136,7 +286,12 @@ func (s *server) serveDir(w http.ResponseWriter, r *http.Request, dirRemote stri
 
 // serveFile serves a file object at remote
 func (s *server) serveFile(w http.ResponseWriter, r *http.Request, remote string) {
-	node, err := s.vfs.Stat(remote)
+	VFS, vfsRemote, err := s.getVFS(r, remote)
+	if err != nil {
+		serve.Error(remote, w, "File not found", err)
+		return
+	}
+	node, err := VFS.Stat(vfsRemote)
 	if err == vfs.ENOENT {
 		fs.Infof(remote, "%s: File not found", r.RemoteAddr)
 		http.Error(w, "File not found", http.StatusNotFound)
@@ -3,19 +3,30 @@
 package http
 
 import (
+	"archive/zip"
+	"bytes"
 	"flag"
+	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 	"time"
 
 	_ "github.com/ncw/rclone/backend/local"
 	"github.com/ncw/rclone/cmd/serve/httplib"
+	"github.com/ncw/rclone/cmd/serve/multi"
+	"github.com/ncw/rclone/cmd/serve/proxy/proxyflags"
 	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fs/config"
 	"github.com/ncw/rclone/fs/filter"
+	"github.com/ncw/rclone/vfs"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -33,7 +44,7 @@ const (
 func startServer(t *testing.T, f fs.Fs) {
 	opt := httplib.DefaultOpt
 	opt.ListenAddr = testBindAddress
-	httpServer = newServer(f, &opt)
+	httpServer = newServer(f, nil, &opt)
 	assert.NoError(t, httpServer.Serve())
 
 	// try to connect to the test server
@@ -201,6 +212,294 @@ func TestGET(t *testing.T) {
 	}
 }
 
+func TestDownload(t *testing.T) {
+	resp, err := http.Get(testURL + "?download=zip")
+	require.NoError(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/zip", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "attachment; filename=files.zip", resp.Header.Get("Content-Disposition"))
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+	var names []string
+	for _, file := range zr.File {
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+	// hidden files and directories are excluded by the filters
+	assert.Equal(t, []string{
+		"files/one%.txt",
+		"files/three/",
+		"files/three/a.txt",
+		"files/three/b.txt",
+		"files/two.txt",
+	}, names)
+}
+
+func TestAuthProxy(t *testing.T) {
+	oldOpt := proxyflags.Opt
+	defer func() {
+		proxyflags.Opt = oldOpt
+	}()
+	proxyflags.Opt.AuthProxy = "go run ../proxy/test_proxy.go"
+
+	opt := httplib.DefaultOpt
+	opt.ListenAddr = "localhost:0"
+	s := newServer(nil, nil, &opt)
+	require.NoError(t, s.Serve())
+	defer func() {
+		s.Close()
+		s.Wait()
+	}()
+	assert.True(t, s.UsingAuth())
+
+	get := func(user, pass string) (int, string) {
+		req, err := http.NewRequest("GET", s.URL(), nil)
+		require.NoError(t, err)
+		if user != "" {
+			req.SetBasicAuth(user, pass)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	status, _ := get("", "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	status, _ = get("potato", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// The test proxy serves the current directory
+	status, body := get("potato", "correct")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "http_test.go")
+}
+
+func TestReadWrite(t *testing.T) {
+	oldReadWrite := readWrite
+	defer func() {
+		readWrite = oldReadWrite
+	}()
+	readWrite = true
+
+	dir, err := ioutil.TempDir("", "rclone-serve-http-test")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	f, err := fs.NewFs(dir)
+	require.NoError(t, err)
+
+	opt := httplib.DefaultOpt
+	opt.ListenAddr = "localhost:0"
+	s := newServer(f, nil, &opt)
+	require.NoError(t, s.Serve())
+	defer func() {
+		s.Close()
+		s.Wait()
+	}()
+
+	// Don't follow the redirects so their status can be checked
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	do := func(method, URL, contentType string, body io.Reader, headers ...string) (int, string) {
+		req, err := http.NewRequest(method, s.URL()+URL, body)
+		require.NoError(t, err)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		data, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(data)
+	}
+	postForm := func(URL string, values url.Values) int {
+		status, _ := do("POST", URL, "application/x-www-form-urlencoded", strings.NewReader(values.Encode()))
+		return status
+	}
+	checkFile := func(name, want string) {
+		got, err := ioutil.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		assert.Equal(t, want, string(got))
+	}
+
+	// The listing should have the forms
+	status, body := do("GET", "", "", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `enctype="multipart/form-data"`)
+	assert.Contains(t, body, `name="mkdir"`)
+
+	// Requests from other sites are refused
+	form := "application/x-www-form-urlencoded"
+	status, _ = do("POST", "", form, strings.NewReader("mkdir=potato"), "Origin", "http://evil.example.com")
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = do("POST", "", form, strings.NewReader("mkdir=potato"), "Origin", "null")
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = do("POST", "", form, strings.NewReader("mkdir=potato"), "Referer", "http://evil.example.com/page.html")
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = do("DELETE", "potato/", "", nil, "Origin", "http://evil.example.com")
+	assert.Equal(t, http.StatusForbidden, status)
+	_, err = os.Stat(filepath.Join(dir, "potato"))
+	assert.True(t, os.IsNotExist(err))
+
+	// but not from the listing
+	status, _ = do("POST", "", form, strings.NewReader("mkdir=potato"), "Origin", s.URL()[:len(s.URL())-1], "Referer", s.URL())
+	assert.Equal(t, http.StatusSeeOther, status)
+	status, _ = do("DELETE", "potato/", "", nil, "Referer", s.URL())
+	assert.Equal(t, http.StatusNoContent, status)
+
+	// Make a directory
+	assert.Equal(t, http.StatusSeeOther, postForm("", url.Values{"mkdir": {"sub dir"}}))
+	fi, err := os.Stat(filepath.Join(dir, "sub dir"))
+	require.NoError(t, err)
+	assert.True(t, fi.IsDir())
+	assert.Equal(t, http.StatusBadRequest, postForm("", url.Values{"mkdir": {"../escape"}}))
+	assert.Equal(t, http.StatusNotFound, postForm("notfound/", url.Values{"mkdir": {"potato"}}))
+
+	// Upload files into it
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, file := range []struct{ name, contents string }{
+		{"one.txt", "one"},
+		{`C:\Users\me\two.txt`, "two two"},
+		{"", ""}, // no file selected
+	} {
+		w, err := mw.CreateFormFile("file", file.name)
+		require.NoError(t, err)
+		_, err = io.WriteString(w, file.contents)
+		require.NoError(t, err)
+	}
+	require.NoError(t, mw.Close())
+	status, _ = do("POST", "sub%20dir/", mw.FormDataContentType(), &buf)
+	assert.Equal(t, http.StatusSeeOther, status)
+	checkFile("sub dir/one.txt", "one")
+	checkFile("sub dir/two.txt", "two two")
+
+	status, body = do("GET", "sub%20dir/", "", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `<input type="hidden" name="delete" value="one.txt">`)
+
+	// Can't POST to a file
+	status, _ = do("POST", "sub%20dir/one.txt", "application/x-www-form-urlencoded", strings.NewReader("mkdir=potato"))
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+
+	// Delete with the form and with DELETE
+	assert.Equal(t, http.StatusSeeOther, postForm("sub%20dir/", url.Values{"delete": {"one.txt"}}))
+	_, err = os.Stat(filepath.Join(dir, "sub dir", "one.txt"))
+	assert.True(t, os.IsNotExist(err))
+	status, _ = do("DELETE", "sub%20dir/", "", nil)
+	assert.Equal(t, http.StatusConflict, status)
+	status, _ = do("DELETE", "sub%20dir/two.txt", "", nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = do("DELETE", "sub%20dir/two.txt", "", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = do("DELETE", "", "", nil)
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Equal(t, http.StatusSeeOther, postForm("", url.Values{"delete": {"sub dir/"}}))
+	_, err = os.Stat(filepath.Join(dir, "sub dir"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestMultipleRemotes(t *testing.T) {
+	oldReadWrite := readWrite
+	defer func() {
+		readWrite = oldReadWrite
+	}()
+	readWrite = true
+
+	dir, err := ioutil.TempDir("", "rclone-serve-http-test")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	for _, name := range []string{"one", "two"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, name), 0777))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name, "file.txt"), []byte(name), 0666))
+	}
+	remotes, err := multi.New(&multi.Options{}, []string{"one=" + filepath.Join(dir, "one"), "two=" + filepath.Join(dir, "two")}, &vfs.DefaultOpt)
+	require.NoError(t, err)
+
+	opt := httplib.DefaultOpt
+	opt.ListenAddr = "localhost:0"
+	s := newServer(nil, remotes, &opt)
+	require.NoError(t, s.Serve())
+	defer func() {
+		s.Close()
+		s.Wait()
+	}()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	do := func(method, URL string, values url.Values) (int, string) {
+		req, err := http.NewRequest(method, s.URL()+URL, strings.NewReader(values.Encode()))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		data, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(data)
+	}
+
+	// The root lists the remotes
+	status, body := do("GET", "", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `href="one/"`)
+	assert.Contains(t, body, `href="two/"`)
+
+	// Each remote is served from its directory
+	status, body = do("GET", "one/", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `href="file.txt"`)
+	status, body = do("GET", "two/file.txt", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "two", body)
+	status, _ = do("GET", "three/file.txt", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// The remotes can be written but not the root
+	status, _ = do("POST", "two/", url.Values{"mkdir": {"sub"}})
+	assert.Equal(t, http.StatusSeeOther, status)
+	fi, err := os.Stat(filepath.Join(dir, "two", "sub"))
+	require.NoError(t, err)
+	assert.True(t, fi.IsDir())
+	status, _ = do("POST", "", url.Values{"mkdir": {"three"}})
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = do("DELETE", "one/", nil)
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = do("DELETE", "one/file.txt", nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	_, err = os.Stat(filepath.Join(dir, "one", "file.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
+
 func TestFinalise(t *testing.T) {
 	httpServer.Close()
 	httpServer.Wait()
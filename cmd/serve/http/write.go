@@ -0,0 +1,284 @@
+// Uploads, deletes and directory creation for --read-write
+
+package http
+
+import (
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ncw/rclone/cmd/serve/httplib/serve"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/accounting"
+	"github.com/ncw/rclone/vfs"
+	"github.com/pkg/errors"
+)
+
+// maxFormValueSize is the largest form value read which isn't a file
+const maxFormValueSize = 64 * 1024
+
+// errBadName is returned for names which can't be used in a directory
+var errBadName = errors.New("bad file name")
+
+// writeError writes an http error for err choosing the status from
+// the type of the error
+func writeError(what interface{}, w http.ResponseWriter, text string, err error) {
+	switch errors.Cause(err) {
+	case errBadName:
+		http.Error(w, text+": bad file name.", http.StatusBadRequest)
+	case vfs.ENOENT:
+		http.Error(w, text+": not found.", http.StatusNotFound)
+	case vfs.EEXIST:
+		http.Error(w, text+": already exists.", http.StatusConflict)
+	case vfs.ENOTEMPTY:
+		http.Error(w, text+": directory not empty.", http.StatusConflict)
+	case vfs.EPERM, vfs.EROFS:
+		http.Error(w, text+": permission denied.", http.StatusForbidden)
+	case vfs.ELOCKED:
+		http.Error(w, text+": locked.", http.StatusLocked)
+	default:
+		serve.Error(what, w, text, err)
+	}
+}
+
+// sameOrigin returns true if r didn't come from a page on another
+// site.
+//
+// Browsers send Origin, or failing that Referer, with form posts so a
+// page elsewhere can't use the user's credentials to change the
+// remote.  Requests with neither are from clients which aren't
+// browsers so are allowed.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return u.Host == r.Host
+}
+
+// checkLeaf returns the leaf name or an error if it isn't a single
+// path element.  Any trailing "/" is removed.
+func checkLeaf(leaf string) (string, error) {
+	leaf = strings.TrimSuffix(leaf, "/")
+	if leaf == "" || leaf == "." || leaf == ".." || strings.ContainsAny(leaf, "/\\") {
+		return "", errBadName
+	}
+	return leaf, nil
+}
+
+// postDir handles a POST to the directory at dirRemote
+//
+// A multipart/form-data body uploads its files to the directory, and
+// mkdir and delete form values make or remove the named entries.
+// Success redirects back to the directory listing.
+func (s *server) postDir(w http.ResponseWriter, r *http.Request, dirRemote string) {
+	VFS, vfsRemote, err := s.getVFS(r, dirRemote)
+	if err != nil {
+		serve.Error(dirRemote, w, "Root directory not found", err)
+		return
+	}
+	node, err := VFS.Stat(vfsRemote)
+	if err == vfs.ENOENT {
+		http.Error(w, "Directory not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		serve.Error(dirRemote, w, "Failed to find directory", err)
+		return
+	}
+	if !node.IsDir() {
+		http.Error(w, "Not a directory", http.StatusNotFound)
+		return
+	}
+	dir := node.(*vfs.Dir)
+
+	mr, err := r.MultipartReader()
+	if err == http.ErrNotMultipart {
+		err = r.ParseForm()
+		if err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		for name, values := range r.PostForm {
+			for _, value := range values {
+				err = formAction(w, dir, name, value)
+				if err != nil {
+					return
+				}
+			}
+		}
+	} else if err != nil {
+		http.Error(w, "Failed to read multipart form", http.StatusBadRequest)
+		return
+	} else {
+		err = postMultipart(w, dir, mr)
+		if err != nil {
+			return
+		}
+	}
+
+	http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+}
+
+// postMultipart uploads the files in mr to dir and runs the actions
+// in its other values.  If an error is returned then the response has
+// been written.
+func postMultipart(w http.ResponseWriter, dir *vfs.Dir, mr *multipart.Reader) error {
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			http.Error(w, "Failed to read multipart form", http.StatusBadRequest)
+			return err
+		}
+		fileName := part.FileName()
+		if fileName != "" {
+			// Old browsers may send the full path of the file
+			leaf := path.Base(strings.Replace(fileName, "\\", "/", -1))
+			err = upload(dir, leaf, part)
+			if err != nil {
+				writeError(path.Join(dir.Path(), leaf), w, "Failed to upload file", err)
+				return err
+			}
+			continue
+		}
+		value, err := ioutil.ReadAll(io.LimitReader(part, maxFormValueSize))
+		if err != nil {
+			http.Error(w, "Failed to read multipart form", http.StatusBadRequest)
+			return err
+		}
+		err = formAction(w, dir, part.FormName(), string(value))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// formAction runs the action for the form value name=value in dir.
+// Unknown names are ignored.  If an error is returned then the
+// response has been written.
+func formAction(w http.ResponseWriter, dir *vfs.Dir, name, value string) (err error) {
+	switch name {
+	case "mkdir":
+		err = mkdir(dir, value)
+		if err != nil {
+			writeError(path.Join(dir.Path(), value), w, "Failed to make directory", err)
+		}
+	case "delete":
+		err = remove(dir, value)
+		if err != nil {
+			writeError(path.Join(dir.Path(), value), w, "Failed to delete", err)
+		}
+	}
+	return err
+}
+
+// upload writes in to the file leaf in dir, replacing any existing
+// file.  The file is removed if the upload fails.
+func upload(dir *vfs.Dir, leaf string, in io.Reader) (err error) {
+	leaf, err = checkLeaf(leaf)
+	if err != nil {
+		return err
+	}
+	remote := path.Join(dir.Path(), leaf)
+	node, err := dir.Stat(leaf)
+	if err == nil && node.IsDir() {
+		return vfs.EEXIST
+	}
+
+	// Account the transfer
+	accounting.Stats.Transferring(remote)
+	defer func() {
+		accounting.Stats.DoneTransferring(remote, err == nil)
+	}()
+
+	fh, err := dir.VFS().OpenFile(remote, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(fh, in)
+	closeErr := fh.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fs.Errorf(remote, "Removing failed upload: %v", err)
+		if removeErr := dir.RemoveName(leaf); removeErr != nil {
+			fs.Errorf(remote, "Failed to remove failed upload: %v", removeErr)
+		}
+		return err
+	}
+	fs.Infof(remote, "Uploaded %d bytes", n)
+	return nil
+}
+
+// mkdir makes the directory leaf in dir
+func mkdir(dir *vfs.Dir, leaf string) error {
+	leaf, err := checkLeaf(leaf)
+	if err != nil {
+		return err
+	}
+	_, err = dir.Mkdir(leaf)
+	if err != nil {
+		return err
+	}
+	fs.Infof(path.Join(dir.Path(), leaf), "Made directory")
+	return nil
+}
+
+// remove deletes the file or empty directory leaf in dir
+func remove(dir *vfs.Dir, leaf string) error {
+	leaf, err := checkLeaf(leaf)
+	if err != nil {
+		return err
+	}
+	node, err := dir.Stat(leaf)
+	if err != nil {
+		return err
+	}
+	err = node.Remove()
+	if err != nil {
+		return err
+	}
+	fs.Infof(node.Path(), "Deleted")
+	return nil
+}
+
+// deleteRemote handles a DELETE of the file or empty directory at
+// remote
+func (s *server) deleteRemote(w http.ResponseWriter, r *http.Request, remote string, isDir bool) {
+	VFS, vfsRemote, err := s.getVFS(r, remote)
+	if err != nil {
+		serve.Error(remote, w, "Root directory not found", err)
+		return
+	}
+	if vfsRemote == "" {
+		http.Error(w, "Can't delete the root directory", http.StatusForbidden)
+		return
+	}
+	node, err := VFS.Stat(vfsRemote)
+	if err == nil && node.IsDir() != isDir {
+		err = vfs.ENOENT
+	}
+	if err == nil {
+		err = node.Remove()
+	}
+	if err != nil {
+		writeError(remote, w, "Failed to delete", err)
+		return
+	}
+	fs.Infof(remote, "%s: Deleted", r.RemoteAddr)
+	w.WriteHeader(http.StatusNoContent)
+}
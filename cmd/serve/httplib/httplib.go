@@ -2,6 +2,7 @@
 package httplib
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
@@ -90,6 +91,27 @@ type Options struct {
 	Realm              string        // realm for authentication
 	BasicUser          string        // single username for basic auth if not using Htpasswd
 	BasicPass          string        // password for BasicUser
+	Auth               AuthFn        `json:"-"` // custom Auth (not set by command line flags)
+}
+
+// AuthFn if used will be used to authenticate user, pass.  If an error
+// is returned then the user is not authenticated.
+//
+// If a non nil value is returned then it is added to the request
+// context under ContextAuthKey and can be read with AuthValue.
+type AuthFn func(user, pass string) (value interface{}, err error)
+
+// contextKey is the type of keys stored in the request context
+type contextKey int
+
+// ContextAuthKey is the key the value returned by AuthFn is stored
+// under in the request context
+const ContextAuthKey contextKey = iota
+
+// AuthValue returns the value stored in the request context by the
+// Auth function or nil if there isn't one
+func AuthValue(r *http.Request) interface{} {
+	return r.Context().Value(ContextAuthKey)
 }
 
 // DefaultOpt is the default values used for Options
@@ -122,6 +144,12 @@ func (s *Server) singleUserProvider(user, realm string) string {
 	return ""
 }
 
+// requireAuth sends a basic auth challenge
+func (s *Server) requireAuth(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", s.Opt.Realm))
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
 // NewServer creates an http server.  The opt can be nil in which case
 // the default options will be used.
 func NewServer(handler http.Handler, opt *Options) *Server {
@@ -136,8 +164,31 @@ func NewServer(handler http.Handler, opt *Options) *Server {
 		s.Opt = DefaultOpt
 	}
 
-	// Use htpasswd if required on everything
-	if s.Opt.HtPasswd != "" || s.Opt.BasicUser != "" {
+	// Use the custom auth function if set, otherwise use htpasswd
+	// if required on everything
+	if s.Opt.Auth != nil {
+		fs.Infof(nil, "Using custom authentication")
+		oldHandler := handler
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, pass, ok := r.BasicAuth()
+			if !ok {
+				fs.Infof(r.URL.Path, "%s: Basic auth challenge sent", r.RemoteAddr)
+				s.requireAuth(w)
+				return
+			}
+			value, err := s.Opt.Auth(user, pass)
+			if err != nil {
+				fs.Infof(r.URL.Path, "%s: Unauthorized request from %s: %v", r.RemoteAddr, user, err)
+				s.requireAuth(w)
+				return
+			}
+			if value != nil {
+				r = r.WithContext(context.WithValue(r.Context(), ContextAuthKey, value))
+			}
+			oldHandler.ServeHTTP(w, r)
+		})
+		s.usingAuth = true
+	} else if s.Opt.HtPasswd != "" || s.Opt.BasicUser != "" {
 		var secretProvider auth.SecretProvider
 		if s.Opt.HtPasswd != "" {
 			fs.Infof(nil, "Using %q as htpasswd storage", s.Opt.HtPasswd)
@@ -0,0 +1,264 @@
+package serve
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/accounting"
+	"github.com/ncw/rclone/fs/walk"
+	"github.com/pkg/errors"
+)
+
+// DownloadParam is the query parameter used to ask for a directory
+// as an archive, eg ?download=zip
+const DownloadParam = "download"
+
+// ArchiveFormats are the archive formats Archive can make
+var ArchiveFormats = []string{"zip", "tar.gz"}
+
+// OpenFn opens an object for reading its contents into an archive
+type OpenFn func(o fs.Object) (io.ReadCloser, error)
+
+// archiver adds files and directories to an archive
+type archiver interface {
+	addDir(name string, o fs.Directory) error
+	addFile(name string, o fs.Object, in io.Reader) error
+	Close() error
+}
+
+// startWriter records whether anything has been written to the
+// response yet
+type startWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+// Write to the response
+func (sw *startWriter) Write(p []byte) (int, error) {
+	sw.started = true
+	return sw.w.Write(p)
+}
+
+// Archive streams the directory dirRemote of f and everything below
+// it to w as an archive in format which should be one of
+// ArchiveFormats.
+//
+// The listing is done with walk.Walk so respects the filters.
+// Objects are read with open, or with their Open method if open is
+// nil, and nothing is buffered to disk.
+//
+// Errors are returned as http errors if nothing has been sent yet,
+// otherwise they are logged and the archive is left incomplete.
+func Archive(w http.ResponseWriter, r *http.Request, f fs.Fs, dirRemote, format string, open OpenFn) {
+	if open == nil {
+		open = func(o fs.Object) (io.ReadCloser, error) {
+			return o.Open()
+		}
+	}
+	var contentType string
+	switch format {
+	case "zip":
+		contentType = "application/zip"
+	case "tar.gz":
+		contentType = "application/gzip"
+	default:
+		http.Error(w, "Unknown archive format - use one of "+strings.Join(ArchiveFormats, ", "), http.StatusBadRequest)
+		return
+	}
+
+	// Name the archive and the directory in it after dirRemote
+	baseName := path.Base(dirRemote)
+	if dirRemote == "" {
+		baseName = path.Base(strings.Trim(f.Root(), "/"))
+		if baseName == "." || baseName == "/" {
+			baseName = f.Name()
+		}
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": baseName + "." + format,
+	}))
+	if r.Method == "HEAD" {
+		return
+	}
+
+	sw := &startWriter{w: w}
+	var a archiver
+	if format == "zip" {
+		a = newZipArchiver(sw)
+	} else {
+		a = newTarGzArchiver(sw)
+	}
+
+	fs.Infof(dirRemote, "%s: Serving directory as %s", r.RemoteAddr, format)
+	err := walk.Walk(f, dirRemote, false, fs.Config.MaxDepth, func(dirPath string, entries fs.DirEntries, err error) error {
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			name := entry.Remote()
+			if dirRemote != "" {
+				name = strings.TrimPrefix(name, dirRemote+"/")
+			}
+			name = path.Join(baseName, name)
+			switch x := entry.(type) {
+			case fs.Object:
+				err = addFile(a, name, x, open)
+			case fs.Directory:
+				err = a.addDir(name, x)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = a.Close()
+	}
+	if err != nil {
+		if !sw.started {
+			w.Header().Del("Content-Disposition")
+			if errors.Cause(err) == fs.ErrorDirNotFound {
+				http.Error(w, "Directory not found", http.StatusNotFound)
+				return
+			}
+			Error(dirRemote, w, "Failed to make archive", err)
+			return
+		}
+		fs.CountError(err)
+		fs.Errorf(dirRemote, "Failed to make archive - archive is incomplete: %v", err)
+	}
+}
+
+// addFile opens o and adds it to the archive as name
+func addFile(a archiver, name string, o fs.Object, open OpenFn) (err error) {
+	// Account the transfer
+	remote := o.Remote()
+	accounting.Stats.Transferring(remote)
+	defer func() {
+		accounting.Stats.DoneTransferring(remote, err == nil)
+	}()
+
+	in, err := open(o)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %q", remote)
+	}
+	defer fs.CheckClose(in, &err)
+	err = a.addFile(name, o, in)
+	if err != nil {
+		return errors.Wrapf(err, "failed to archive %q", remote)
+	}
+	return nil
+}
+
+// zipArchiver makes zip archives
+type zipArchiver struct {
+	zw *zip.Writer
+}
+
+func newZipArchiver(out io.Writer) *zipArchiver {
+	return &zipArchiver{
+		zw: zip.NewWriter(out),
+	}
+}
+
+// addDir adds a directory entry
+func (za *zipArchiver) addDir(name string, o fs.Directory) error {
+	header := &zip.FileHeader{
+		Name:   name + "/",
+		Method: zip.Store,
+	}
+	header.SetModTime(o.ModTime())
+	header.SetMode(os.ModeDir | 0755)
+	_, err := za.zw.CreateHeader(header)
+	return err
+}
+
+// addFile adds a file entry with the contents read from in
+func (za *zipArchiver) addFile(name string, o fs.Object, in io.Reader) error {
+	header := &zip.FileHeader{
+		Name:   name,
+		Method: zip.Deflate,
+	}
+	header.SetModTime(o.ModTime())
+	header.SetMode(0644)
+	out, err := za.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// Close writes the zip central directory
+func (za *zipArchiver) Close() error {
+	return za.zw.Close()
+}
+
+// tarGzArchiver makes gzipped tar archives
+type tarGzArchiver struct {
+	gw *gzip.Writer
+	tw *tar.Writer
+}
+
+func newTarGzArchiver(out io.Writer) *tarGzArchiver {
+	gw := gzip.NewWriter(out)
+	return &tarGzArchiver{
+		gw: gw,
+		tw: tar.NewWriter(gw),
+	}
+}
+
+// addDir adds a directory entry
+func (ta *tarGzArchiver) addDir(name string, o fs.Directory) error {
+	return ta.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0755,
+		ModTime:  o.ModTime(),
+	})
+}
+
+// addFile adds a file entry with the contents read from in
+//
+// tar needs the size in advance so objects of unknown size can't be
+// added.
+func (ta *tarGzArchiver) addFile(name string, o fs.Object, in io.Reader) error {
+	size := o.Size()
+	if size < 0 {
+		return errors.New("can't add object of unknown size to tar archive")
+	}
+	err := ta.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  o.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(ta.tw, in)
+	if err == nil && n != size {
+		err = errors.Errorf("size changed while reading - expecting %d bytes but got %d", size, n)
+	}
+	return err
+}
+
+// Close finishes the tar and gzip streams
+func (ta *tarGzArchiver) Close() error {
+	err := ta.tw.Close()
+	if err != nil {
+		return err
+	}
+	return ta.gw.Close()
+}
@@ -0,0 +1,159 @@
+package serve
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	_ "github.com/ncw/rclone/backend/local"
+	"github.com/ncw/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeArchiveFs makes a local Fs with some files and directories in
+func makeArchiveFs(t *testing.T) (f fs.Fs, cleanup func()) {
+	dir, err := ioutil.TempDir("", "rclone-archive-test")
+	require.NoError(t, err)
+	for _, file := range []struct{ name, contents string }{
+		{"top.txt", "top"},
+		{"sub/one.txt", "one"},
+		{"sub/deeper/two.txt", "two two"},
+		{"sub/empty.txt", ""},
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(file.name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0777))
+		require.NoError(t, ioutil.WriteFile(p, []byte(file.contents), 0666))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub", "emptydir"), 0777))
+	f, err = fs.NewFs(dir)
+	require.NoError(t, err)
+	return f, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// the contents of the archive of "sub"
+var wantArchive = map[string]string{
+	"sub/deeper/":        "",
+	"sub/deeper/two.txt": "two two",
+	"sub/empty.txt":      "",
+	"sub/emptydir/":      "",
+	"sub/one.txt":        "one",
+}
+
+func archive(t *testing.T, f fs.Fs, method, dirRemote, format string) *http.Response {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, "http://example.com/"+dirRemote+"/?download="+format, nil)
+	Archive(w, r, f, dirRemote, format, nil)
+	return w.Result()
+}
+
+func TestArchiveZip(t *testing.T) {
+	f, cleanup := makeArchiveFs(t)
+	defer cleanup()
+
+	resp := archive(t, f, "GET", "sub", "zip")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/zip", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=sub.zip`, resp.Header.Get("Content-Disposition"))
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+	got := map[string]string{}
+	for _, file := range zr.File {
+		in, err := file.Open()
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(in)
+		require.NoError(t, err)
+		require.NoError(t, in.Close())
+		got[file.Name] = string(data)
+		assert.Equal(t, file.Name[len(file.Name)-1] == '/', file.Mode().IsDir(), file.Name)
+	}
+	assert.Equal(t, wantArchive, got)
+}
+
+func TestArchiveTarGz(t *testing.T) {
+	f, cleanup := makeArchiveFs(t)
+	defer cleanup()
+
+	resp := archive(t, f, "GET", "sub", "tar.gz")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/gzip", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=sub.tar.gz`, resp.Header.Get("Content-Disposition"))
+
+	gr, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	tr := tar.NewReader(gr)
+	got := map[string]string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(tr)
+		require.NoError(t, err)
+		got[header.Name] = string(data)
+	}
+	assert.Equal(t, wantArchive, got)
+}
+
+func TestArchiveRoot(t *testing.T) {
+	f, cleanup := makeArchiveFs(t)
+	defer cleanup()
+
+	resp := archive(t, f, "GET", "", "zip")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	root := filepath.Base(f.Root())
+	assert.Equal(t, `attachment; filename=`+root+`.zip`, resp.Header.Get("Content-Disposition"))
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+	var names []string
+	for _, file := range zr.File {
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{
+		root + "/sub/",
+		root + "/sub/deeper/",
+		root + "/sub/deeper/two.txt",
+		root + "/sub/empty.txt",
+		root + "/sub/emptydir/",
+		root + "/sub/one.txt",
+		root + "/top.txt",
+	}, names)
+}
+
+func TestArchiveErrors(t *testing.T) {
+	f, cleanup := makeArchiveFs(t)
+	defer cleanup()
+
+	resp := archive(t, f, "HEAD", "sub", "zip")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/zip", resp.Header.Get("Content-Type"))
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "", string(body))
+
+	resp = archive(t, f, "GET", "sub", "rar")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "Unknown archive format - use one of zip, tar.gz\n", string(body))
+
+	resp = archive(t, f, "GET", "notfound", "zip")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "", resp.Header.Get("Content-Disposition"))
+}
@@ -21,14 +21,14 @@ var Assets = func() http.FileSystem {
 	fs := vfsgen۰FS{
 		"/": &vfsgen۰DirInfo{
 			name:    "/",
-			modTime: time.Date(2018, 12, 16, 6, 54, 42, 894445775, time.UTC),
+			modTime: time.Date(2019, 3, 31, 16, 7, 19, 0, time.UTC),
 		},
 		"/index.html": &vfsgen۰CompressedFileInfo{
 			name:             "index.html",
-			modTime:          time.Date(2018, 12, 16, 6, 54, 42, 790442328, time.UTC),
-			uncompressedSize: 226,
+			modTime:          time.Date(2026, 10, 19, 0, 42, 17, 861030784, time.UTC),
+			uncompressedSize: 825,
 
-			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x5c\x8f\x31\xcf\x83\x20\x10\x86\x77\x7e\xc5\x7d\xc4\xf5\x93\xb8\x35\x0d\xb0\xb4\x6e\x26\x6d\x1a\x3b\x74\x3c\xeb\x29\x24\x4a\x13\xa4\x43\x43\xf8\xef\x0d\xea\xd4\x09\xee\x79\xef\x9e\xcb\xc9\xbf\xf3\xe5\xd4\x3e\xae\x35\x98\x30\x4f\x9a\xc9\xfc\xc0\x84\x6e\x54\x9c\x1c\xcf\x80\xb0\xd7\x4c\xce\x14\x10\x9e\x06\xfd\x42\x41\xf1\x77\x18\xfe\x0f\x39\x0d\x36\x4c\xa4\x63\x84\xb2\xcd\x3f\x48\x49\x8a\x8d\x31\x29\xf6\xd1\xee\xd5\x7f\xb2\xa8\xfa\xe9\x33\x95\x66\x31\x82\x47\x37\x12\x14\x16\x8e\x0a\xca\xda\x05\x6f\x69\xc9\x39\x82\xf1\x34\x28\x1e\x23\x14\xb6\xbc\xdf\x1a\x48\x89\xeb\xad\x6a\x08\x87\xd5\x81\x5a\x76\x1e\xc4\x2a\x22\xd7\xaf\x6c\xdf\x27\xb6\x8b\xbe\x01\x00\x00\xff\xff\x92\x2e\x35\x75\xe2\x00\x00\x00"),
+			compressedContent: []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x7c\x52\xc1\x6e\xdb\x30\x0c\xbd\xfb\x2b\x38\x21\xd7\xda\xe8\x6d\x28\x24\xed\xd0\xf6\x16\xac\x45\x97\x62\xd8\x91\x89\xe8\x98\xa8\x2c\x0b\x32\xb3\x2e\x31\xfc\xef\x83\x12\x27\x48\x82\xa0\x27\x11\x4f\x8f\x7c\x7c\x4f\xd2\xdf\x9e\x5e\x1e\x17\x7f\x5e\x9f\xa1\x91\xd6\xdb\x42\xe7\x03\x3c\x86\xb5\x51\x14\x54\x06\x08\x9d\x2d\x74\x4b\x82\xb0\x6a\x30\xf5\x24\x46\x6d\xa4\xbe\xfb\x9e\x6f\x85\xc5\x93\x1d\x06\x28\x17\xb9\x82\x71\xd4\xd5\x01\x2b\x74\x35\xb5\x2e\x3b\xb7\xcd\x83\xee\xaf\x78\xcd\xbd\x2d\x86\x01\xb8\x86\xf2\xa9\xfb\x0c\xbe\x43\x37\xe7\xf0\xd1\xe7\xcb\x68\x8f\x10\x60\x0f\x1a\xa1\x49\x54\x1b\xf5\xc3\x4d\xa8\xd9\x71\x54\x76\xc7\x51\x57\x68\xa1\x4b\xb7\x28\x82\xa9\x5c\xef\x94\x3d\x9c\x99\xa8\xab\xb8\x97\xa4\xe0\x60\x1c\x27\xed\x37\x42\xf7\x3b\xb1\x50\xd6\xad\xbb\xd4\x42\x4b\xd2\x74\xce\xa8\xd7\x97\x5f\x0b\x05\x14\x56\xb2\x8d\x64\x54\xbb\xf1\xc2\x11\x93\x54\x99\x75\xe7\x50\x30\x47\xc0\x21\x6e\x04\x0e\x94\x9a\x3d\x29\x08\xd8\x9e\xea\x43\x93\xa7\x2b\x62\xbf\x59\xb6\x2c\x0a\xfe\xa2\xdf\x90\x51\xef\x31\x5b\xcd\xd3\xf6\xb3\x6d\x71\x63\x91\xab\x09\x42\xff\xe4\x28\xd5\x7e\x38\x4e\x0a\xa2\xc7\x15\x35\x9d\x77\x94\x8c\xfa\x49\x9f\x50\xef\xeb\x3d\x49\x7d\xbd\xc0\x63\x22\x14\x9a\x1a\xce\xf6\x38\x0f\x2b\x61\x58\x13\xcc\x18\x1e\x0c\x94\xcf\x41\x12\xd3\xfe\xad\x8e\xc9\x0f\x03\xcc\xb8\x7c\x7f\x9b\xc3\x38\xaa\xfc\xd6\x33\x2e\xe7\x84\x75\xe6\x54\x98\x01\xae\x61\x76\x91\xf7\x2d\x9f\xd0\xcb\xd6\x93\x51\x8e\xfb\xe8\x71\xfb\x00\x1c\x3c\x07\x52\xf6\x62\xff\x86\x9d\xa3\x70\x0c\xc0\x91\x27\xa1\x93\x9b\x0b\x6d\x65\xbf\x32\xfe\x74\xe8\xb4\x93\xe1\x93\x5f\xbd\x4c\x50\x9d\xf9\xd7\xd5\xf4\x8d\xab\x46\x5a\x6f\x8b\xff\x03\x00\xb5\xef\xe1\xbd\x39\x03\x00\x00"),
 		},
 	}
 	fs["/"].(*vfsgen۰DirInfo).entries = []os.FileInfo{
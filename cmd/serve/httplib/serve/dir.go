@@ -21,11 +21,13 @@ type DirEntry struct {
 
 // Directory represents a directory
 type Directory struct {
-	DirRemote    string
-	Title        string
-	Entries      []DirEntry
-	Query        string
-	HTMLTemplate *template.Template
+	DirRemote     string
+	Title         string
+	Entries       []DirEntry
+	Query         string
+	HTMLTemplate  *template.Template
+	ReadWrite     bool // show the forms to upload, delete and make directories
+	DownloadLinks bool // show links to download the directory as an archive
 }
 
 // NewDirectory makes an empty Directory
@@ -0,0 +1,241 @@
+// Package multi serves several remotes under top level directories
+package multi
+
+import (
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/vfs"
+	"github.com/pkg/errors"
+)
+
+// Help contains text describing how to serve multiple remotes
+var Help = `
+### Serving multiple remotes
+
+Instead of a single remote:path several can be served by giving them
+as name=remote:path arguments, eg
+
+    rclone serve webdav docs=drive:Documents photos=s3:bucket/photos
+
+Each remote appears as a top level directory with the name given and
+has its own VFS, so its own directory and file cache, using the VFS
+options given on the command line.  Use --all-remotes instead of any
+arguments to serve every configured remote in a directory named after
+it.
+
+The top level directory is read only, so remotes can't be added,
+renamed or removed, and files can't be moved from one remote to
+another.
+`
+
+// ErrCrossRemote is returned when trying to rename a file or
+// directory from one remote to another
+var ErrCrossRemote = errors.New("can't rename between remotes")
+
+// Options is options for serving multiple remotes
+type Options struct {
+	AllRemotes bool // serve all the configured remotes
+}
+
+// DefaultOpt is the default values used for Options
+var DefaultOpt = Options{}
+
+// Enabled returns true if opt and args ask for more than one remote
+// to be served
+func Enabled(opt *Options, args []string) bool {
+	return opt.AllRemotes || len(args) > 1
+}
+
+// Remotes is a set of remotes served as top level directories, each
+// with its own VFS.
+type Remotes struct {
+	root  *vfs.VFS            // read only VFS listing the names
+	names []string            // sorted names of the remotes
+	vfses map[string]*vfs.VFS // VFS for each name
+}
+
+// parseArg parses an argument of the form name=remote:path
+func parseArg(arg string) (name, remote string, err error) {
+	i := strings.IndexRune(arg, '=')
+	if i <= 0 {
+		return "", "", errors.Errorf("expecting name=remote:path but got %q", arg)
+	}
+	name, remote = arg[:i], arg[i+1:]
+	if strings.ContainsAny(name, "/:") || name == "." || name == ".." {
+		return "", "", errors.Errorf("bad name %q in %q - it can't contain / or :", name, arg)
+	}
+	return name, remote, nil
+}
+
+// New makes the Remotes to serve from args of the form
+// name=remote:path, or every configured remote if opt.AllRemotes is
+// set.  Each VFS is made with its own copy of vfsOpt.
+func New(opt *Options, args []string, vfsOpt *vfs.Options) (*Remotes, error) {
+	remotes := map[string]string{}
+	if opt.AllRemotes {
+		if len(args) != 0 {
+			return nil, errors.New("can't use --all-remotes with remotes on the command line")
+		}
+		for _, name := range config.FileSections() {
+			remotes[name] = name + ":"
+		}
+	} else {
+		for _, arg := range args {
+			name, remote, err := parseArg(arg)
+			if err != nil {
+				return nil, err
+			}
+			if _, found := remotes[name]; found {
+				return nil, errors.Errorf("duplicate name %q", name)
+			}
+			remotes[name] = remote
+		}
+	}
+	if len(remotes) == 0 {
+		return nil, errors.New("no remotes to serve")
+	}
+	r := &Remotes{
+		vfses: make(map[string]*vfs.VFS, len(remotes)),
+	}
+	for name, remote := range remotes {
+		f, err := fs.NewFs(remote)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to make remote %q for %q", remote, name)
+		}
+		opt := *vfsOpt
+		r.vfses[name] = vfs.New(f, &opt)
+		r.names = append(r.names, name)
+	}
+	sort.Strings(r.names)
+	rootOpt := *vfsOpt
+	rootOpt.ReadOnly = true
+	rootOpt.CacheMode = vfs.CacheModeOff
+	r.root = vfs.New(newRootFs(r.names), &rootOpt)
+	return r, nil
+}
+
+// Names returns the sorted names of the remotes
+func (r *Remotes) Names() []string {
+	return r.names
+}
+
+// Root returns the read only VFS for the top level directory
+func (r *Remotes) Root() *vfs.VFS {
+	return r.root
+}
+
+// VFS returns the VFS for the remote called name or nil if not found
+func (r *Remotes) VFS(name string) *vfs.VFS {
+	return r.vfses[name]
+}
+
+// Split finds the VFS serving p returning it and the path of p
+// within it.  Paths in the top level directory which aren't the name
+// of a remote are looked up in a read only VFS which lists the names.
+func (r *Remotes) Split(p string) (VFS *vfs.VFS, remote string) {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	name, remote := p, ""
+	if i := strings.IndexRune(p, '/'); i >= 0 {
+		name, remote = p[:i], p[i+1:]
+	}
+	if VFS := r.vfses[name]; VFS != nil {
+		return VFS, remote
+	}
+	return r.root, p
+}
+
+// rootFs is a read only fs.Fs whose only entries are directories
+// named after the remotes being served.
+type rootFs struct {
+	names    []string
+	modTime  time.Time
+	features *fs.Features
+}
+
+// newRootFs makes a rootFs listing names
+func newRootFs(names []string) *rootFs {
+	f := &rootFs{
+		names:   names,
+		modTime: time.Now(),
+	}
+	f.features = (&fs.Features{}).Fill(f)
+	return f
+}
+
+// Name of the remote
+func (f *rootFs) Name() string {
+	return "multi"
+}
+
+// Root of the remote
+func (f *rootFs) Root() string {
+	return ""
+}
+
+// String returns a description of the Fs
+func (f *rootFs) String() string {
+	return "multiple remotes"
+}
+
+// Precision of the ModTimes in this Fs
+func (f *rootFs) Precision() time.Duration {
+	return time.Second
+}
+
+// Hashes returns the supported hash types of the filesystem
+func (f *rootFs) Hashes() hash.Set {
+	return hash.Set(hash.None)
+}
+
+// Features returns the optional features of this Fs
+func (f *rootFs) Features() *fs.Features {
+	return f.features
+}
+
+// List the names as directories in the root.  The directories are
+// empty as their contents come from the remotes.
+func (f *rootFs) List(dir string) (entries fs.DirEntries, err error) {
+	if dir != "" {
+		for _, name := range f.names {
+			if dir == name {
+				return nil, nil
+			}
+		}
+		return nil, fs.ErrorDirNotFound
+	}
+	for _, name := range f.names {
+		entries = append(entries, fs.NewDir(name, f.modTime))
+	}
+	return entries, nil
+}
+
+// NewObject always returns fs.ErrorObjectNotFound as there are no
+// files
+func (f *rootFs) NewObject(remote string) (fs.Object, error) {
+	return nil, fs.ErrorObjectNotFound
+}
+
+// Put isn't allowed
+func (f *rootFs) Put(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return nil, vfs.EROFS
+}
+
+// Mkdir isn't allowed
+func (f *rootFs) Mkdir(dir string) error {
+	return vfs.EROFS
+}
+
+// Rmdir isn't allowed
+func (f *rootFs) Rmdir(dir string) error {
+	return vfs.EROFS
+}
+
+// check interface
+var _ fs.Fs = (*rootFs)(nil)
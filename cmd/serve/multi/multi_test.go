@@ -0,0 +1,105 @@
+package multi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/ncw/rclone/backend/local"
+	"github.com/ncw/rclone/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseArg(t *testing.T) {
+	for _, test := range []struct {
+		in     string
+		name   string
+		remote string
+		err    bool
+	}{
+		{"docs=drive:Documents", "docs", "drive:Documents", false},
+		{"a=b=c", "a", "b=c", false},
+		{"with space=/tmp/x", "with space", "/tmp/x", false},
+		{"drive:Documents", "", "", true},
+		{"=drive:", "", "", true},
+		{"a/b=drive:", "", "", true},
+		{"a:b=drive:", "", "", true},
+		{"..=drive:", "", "", true},
+	} {
+		name, remote, err := parseArg(test.in)
+		assert.Equal(t, test.err, err != nil, test.in)
+		assert.Equal(t, test.name, name, test.in)
+		assert.Equal(t, test.remote, remote, test.in)
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	assert.False(t, Enabled(&Options{}, nil))
+	assert.False(t, Enabled(&Options{}, []string{"remote:"}))
+	assert.True(t, Enabled(&Options{}, []string{"a=remote:", "b=remote:"}))
+	assert.True(t, Enabled(&Options{AllRemotes: true}, nil))
+}
+
+func TestRemotes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rclone-serve-multi-test")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	for _, name := range []string{"one", "two"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, name), 0777))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name, "file.txt"), []byte(name), 0666))
+	}
+
+	_, err = New(&Options{}, []string{"one=" + filepath.Join(dir, "one"), "one=" + filepath.Join(dir, "two")}, &vfs.DefaultOpt)
+	assert.Error(t, err)
+	_, err = New(&Options{AllRemotes: true}, []string{"one=" + filepath.Join(dir, "one")}, &vfs.DefaultOpt)
+	assert.Error(t, err)
+
+	r, err := New(&Options{}, []string{"two=" + filepath.Join(dir, "two"), "one=" + filepath.Join(dir, "one")}, &vfs.DefaultOpt)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"one", "two"}, r.Names())
+	assert.NotEqual(t, r.VFS("one"), r.VFS("two"))
+	assert.Nil(t, r.VFS("three"))
+
+	for _, test := range []struct {
+		in     string
+		vfs    *vfs.VFS
+		remote string
+	}{
+		{"", r.Root(), ""},
+		{"/", r.Root(), ""},
+		{"one", r.VFS("one"), ""},
+		{"/one/", r.VFS("one"), ""},
+		{"/one/file.txt", r.VFS("one"), "file.txt"},
+		{"two/a/b", r.VFS("two"), "a/b"},
+		{"/three/file.txt", r.Root(), "three/file.txt"},
+		{"/one/../two/file.txt", r.VFS("two"), "file.txt"},
+	} {
+		VFS, remote := r.Split(test.in)
+		assert.True(t, test.vfs == VFS, test.in)
+		assert.Equal(t, test.remote, remote, test.in)
+	}
+
+	// the root lists the remotes and is read only
+	root, err := r.Root().Root()
+	require.NoError(t, err)
+	nodes, err := root.ReadDirAll()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(nodes))
+	assert.Equal(t, "one", nodes[0].Name())
+	assert.True(t, nodes[0].IsDir())
+	assert.Equal(t, "two", nodes[1].Name())
+	_, err = root.Mkdir("three")
+	assert.Equal(t, vfs.EROFS, err)
+	_, err = r.Root().Stat("three")
+	assert.Equal(t, vfs.ENOENT, err)
+
+	// the remotes are served from their own VFS
+	VFS, remote := r.Split("two/file.txt")
+	node, err := VFS.Stat(remote)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), node.Size())
+}
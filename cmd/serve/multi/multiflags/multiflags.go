@@ -0,0 +1,20 @@
+// Package multiflags implements command line flags to serve multiple remotes
+package multiflags
+
+import (
+	"github.com/ncw/rclone/cmd/serve/multi"
+	"github.com/ncw/rclone/fs/config/flags"
+	"github.com/ncw/rclone/fs/rc"
+	"github.com/spf13/pflag"
+)
+
+// Options set by command line flags
+var (
+	Opt = multi.DefaultOpt
+)
+
+// AddFlags adds the non filing system specific flags to the command
+func AddFlags(flagSet *pflag.FlagSet) {
+	rc.AddOption("multi", &Opt)
+	flags.BoolVarP(flagSet, &Opt.AllRemotes, "all-remotes", "", Opt.AllRemotes, "Serve all the configured remotes under directories named after them.")
+}
@@ -0,0 +1,227 @@
+// Open file handles shared between NFS calls
+
+package nfs
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/vfs"
+)
+
+// openFileTimeout is how long a file is kept open after it was last
+// used.  NFS has no open or close so files are opened on first use
+// and kept open for the next call.  Files being written are closed,
+// and so uploaded, when the client sends COMMIT or after this.
+const openFileTimeout = 5 * time.Second
+
+// openFile is a file opened for NFS calls
+type openFile struct {
+	path     string
+	write    bool          // set if opened for writing
+	handle   vfs.Handle    // valid once ready is closed if err == nil
+	err      error         // error from opening
+	ready    chan struct{} // closed when the open has finished
+	users    int           // number of calls using the handle
+	lastUsed time.Time     // when the last call finished
+}
+
+// openFiles keeps files open between NFS calls
+type openFiles struct {
+	vfs  *vfs.VFS
+	quit chan struct{}
+
+	mu    sync.Mutex
+	files map[string]*openFile // open files by path
+}
+
+// newOpenFiles makes a new openFiles and starts closing idle files
+func newOpenFiles(VFS *vfs.VFS) *openFiles {
+	of := &openFiles{
+		vfs:   VFS,
+		quit:  make(chan struct{}),
+		files: map[string]*openFile{},
+	}
+	go of.closeIdle()
+	return of
+}
+
+// get returns the open file for path, opening it with flags if
+// necessary.  A file opened for writing is used for reads too.  Call
+// release when finished with it.
+func (of *openFiles) get(path string, flags int) (*openFile, error) {
+	write := flags&(os.O_WRONLY|os.O_RDWR) != 0
+	of.mu.Lock()
+	f := of.files[path]
+	if f != nil && (f.write || !write) {
+		f.users++
+		of.mu.Unlock()
+		<-f.ready
+		if f.err != nil {
+			of.release(f)
+			return nil, f.err
+		}
+		return f, nil
+	}
+	// Open the file.  Any file open for reading is replaced and
+	// will be closed when its last user releases it.
+	old := f
+	f = &openFile{
+		path:  path,
+		write: write,
+		ready: make(chan struct{}),
+		users: 1,
+	}
+	of.files[path] = f
+	if old != nil && old.users == 0 {
+		go of.closeFile(old)
+	}
+	of.mu.Unlock()
+	f.handle, f.err = of.vfs.OpenFile(path, flags, 0666)
+	close(f.ready)
+	if f.err != nil {
+		of.release(f)
+		return nil, f.err
+	}
+	return f, nil
+}
+
+// release finishes a use of f, closing it if it has been replaced or
+// closed while in use
+func (of *openFiles) release(f *openFile) {
+	of.mu.Lock()
+	f.users--
+	f.lastUsed = time.Now()
+	current := of.files[f.path] == f
+	if f.err != nil && current {
+		delete(of.files, f.path)
+	}
+	closeNow := f.users == 0 && !current
+	of.mu.Unlock()
+	if closeNow {
+		_ = of.closeFile(f)
+	}
+}
+
+// closeFile closes f if it was opened successfully
+func (of *openFiles) closeFile(f *openFile) error {
+	if f.err != nil {
+		return nil
+	}
+	err := f.handle.Close()
+	if err != nil {
+		fs.Errorf(f.path, "NFS: failed to close file: %v", err)
+	}
+	return err
+}
+
+// readAt reads into buf from path at off
+func (of *openFiles) readAt(path string, buf []byte, off int64) (n int, err error) {
+	f, err := of.get(path, os.O_RDONLY)
+	if err != nil {
+		return 0, err
+	}
+	defer of.release(f)
+	return f.handle.ReadAt(buf, off)
+}
+
+// writeAt writes buf to path at off
+func (of *openFiles) writeAt(path string, buf []byte, off int64) (n int, err error) {
+	f, err := of.get(path, os.O_RDWR)
+	if err != nil {
+		return 0, err
+	}
+	defer of.release(f)
+	return f.handle.WriteAt(buf, off)
+}
+
+// truncate sets the size of path
+func (of *openFiles) truncate(path string, size int64) error {
+	f, err := of.get(path, os.O_RDWR)
+	if err != nil {
+		return err
+	}
+	defer of.release(f)
+	return f.handle.Truncate(size)
+}
+
+// create makes path if it doesn't exist, truncating it if trunc is
+// set, and leaves it open for writing
+func (of *openFiles) create(path string, trunc bool) error {
+	flags := os.O_RDWR | os.O_CREATE
+	if trunc {
+		flags |= os.O_TRUNC
+	}
+	// Close anything open so the flags are used
+	err := of.close(path)
+	if err != nil {
+		return err
+	}
+	f, err := of.get(path, flags)
+	if err != nil {
+		return err
+	}
+	of.release(f)
+	return nil
+}
+
+// close closes path if it is open, returning any error from closing
+// it.  If it is in use it will be closed when the last user releases
+// it.
+func (of *openFiles) close(path string) error {
+	of.mu.Lock()
+	f := of.files[path]
+	if f == nil {
+		of.mu.Unlock()
+		return nil
+	}
+	delete(of.files, path)
+	inUse := f.users != 0
+	of.mu.Unlock()
+	if inUse {
+		return nil
+	}
+	return of.closeFile(f)
+}
+
+// closeIdle closes files which haven't been used recently until
+// closeAll is called
+func (of *openFiles) closeIdle() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-of.quit:
+			return
+		case <-ticker.C:
+		}
+		var idle []*openFile
+		of.mu.Lock()
+		for path, f := range of.files {
+			if f.users == 0 && time.Since(f.lastUsed) > openFileTimeout {
+				delete(of.files, path)
+				idle = append(idle, f)
+			}
+		}
+		of.mu.Unlock()
+		for _, f := range idle {
+			fs.Debugf(f.path, "NFS: closing idle file")
+			_ = of.closeFile(f)
+		}
+	}
+}
+
+// closeAll closes all the files and stops closing idle files
+func (of *openFiles) closeAll() {
+	close(of.quit)
+	of.mu.Lock()
+	files := of.files
+	of.files = map[string]*openFile{}
+	of.mu.Unlock()
+	for _, f := range files {
+		<-f.ready
+		_ = of.closeFile(f)
+	}
+}
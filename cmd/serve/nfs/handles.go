@@ -0,0 +1,155 @@
+// File handles
+
+package nfs
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config"
+	"github.com/pkg/errors"
+)
+
+// handleSize is the size of the file handles made
+const handleSize = 16
+
+// makeHandle returns the file handle for the VFS path p.  Handles
+// are a hash of the path so the same path always has the same handle,
+// even after the server is restarted.
+func makeHandle(p string) []byte {
+	sum := sha256.Sum256([]byte(p))
+	return sum[:handleSize]
+}
+
+// fileID returns the file id for the handle
+func fileID(handle []byte) uint64 {
+	return binary.BigEndian.Uint64(handle)
+}
+
+// handleCache remembers which path each handle was made from as they
+// can't be turned back into paths
+type handleCache interface {
+	// put remembers that handle was made from path
+	put(handle []byte, path string)
+	// get returns the path handle was made from
+	get(handle []byte) (path string, ok bool)
+	// forget forgets handle
+	forget(handle []byte)
+}
+
+// memoryHandles is a handleCache stored in memory
+type memoryHandles struct {
+	mu    sync.RWMutex
+	paths map[string]string
+}
+
+func newMemoryHandles() *memoryHandles {
+	return &memoryHandles{
+		paths: map[string]string{},
+	}
+}
+
+// put remembers that handle was made from path
+func (m *memoryHandles) put(handle []byte, path string) {
+	m.mu.Lock()
+	m.paths[string(handle)] = path
+	m.mu.Unlock()
+}
+
+// get returns the path handle was made from
+func (m *memoryHandles) get(handle []byte) (path string, ok bool) {
+	m.mu.RLock()
+	path, ok = m.paths[string(handle)]
+	m.mu.RUnlock()
+	return path, ok
+}
+
+// forget forgets handle
+func (m *memoryHandles) forget(handle []byte) {
+	m.mu.Lock()
+	delete(m.paths, string(handle))
+	m.mu.Unlock()
+}
+
+// diskHandles is a handleCache stored on disk so handles remain
+// valid when the server is restarted.  It is fronted by a
+// memoryHandles.
+type diskHandles struct {
+	memory *memoryHandles
+	dir    string
+}
+
+// newDiskHandles makes a handle cache for f in the cache directory
+func newDiskHandles(f fs.Fs) (*diskHandles, error) {
+	fRoot := filepath.FromSlash(f.Root())
+	if runtime.GOOS == "windows" {
+		if strings.HasPrefix(fRoot, `\\?`) {
+			fRoot = fRoot[3:]
+		}
+		fRoot = strings.Replace(fRoot, ":", "", -1)
+	}
+	dir := filepath.Join(config.CacheDir, "serve-nfs", f.Name(), fRoot)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to make handle cache directory")
+	}
+	fs.Debugf(nil, "NFS: handle cache in %q", dir)
+	return &diskHandles{
+		memory: newMemoryHandles(),
+		dir:    dir,
+	}, nil
+}
+
+// file returns the name of the file handle is stored in
+func (d *diskHandles) file(handle []byte) string {
+	name := hex.EncodeToString(handle)
+	return filepath.Join(d.dir, name[:2], name[2:])
+}
+
+// put remembers that handle was made from path
+func (d *diskHandles) put(handle []byte, path string) {
+	if oldPath, ok := d.memory.get(handle); ok && oldPath == path {
+		return
+	}
+	d.memory.put(handle, path)
+	file := d.file(handle)
+	err := os.MkdirAll(filepath.Dir(file), 0700)
+	if err == nil {
+		err = ioutil.WriteFile(file, []byte(path), 0600)
+	}
+	if err != nil {
+		fs.Errorf(nil, "NFS: failed to save handle for %q: %v", path, err)
+	}
+}
+
+// get returns the path handle was made from
+func (d *diskHandles) get(handle []byte) (path string, ok bool) {
+	path, ok = d.memory.get(handle)
+	if ok {
+		return path, true
+	}
+	data, err := ioutil.ReadFile(d.file(handle))
+	if err != nil {
+		return "", false
+	}
+	path = string(data)
+	d.memory.put(handle, path)
+	return path, true
+}
+
+// forget forgets handle
+func (d *diskHandles) forget(handle []byte) {
+	d.memory.forget(handle)
+	err := os.Remove(d.file(handle))
+	if err != nil && !os.IsNotExist(err) {
+		fs.Errorf(nil, "NFS: failed to remove saved handle: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+// The MOUNT protocol version 3 as described in RFC 1813 appendix I
+
+package nfs
+
+import (
+	"strings"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/vfs"
+)
+
+// MOUNT constants
+const (
+	mountPathLen = 1024
+
+	// mountstat3
+	mnt3OK             = 0
+	mnt3ErrNoEnt       = 2
+	mnt3ErrNotDir      = 20
+	mnt3ErrServerFault = 10006
+)
+
+// mount3Program is the MOUNT program
+var mount3Program = program{
+	name:    "MOUNT3",
+	version: 3,
+	procs: []proc{
+		{"NULL", (*server).mount3Null},
+		{"MNT", (*server).mount3Mnt},
+		{"DUMP", (*server).mount3Dump},
+		{"UMNT", (*server).mount3Umnt},
+		{"UMNTALL", (*server).mount3Null},
+		{"EXPORT", (*server).mount3Export},
+	},
+}
+
+// mount3Null does nothing
+func (s *server) mount3Null(args *decoder, res *encoder) {
+}
+
+// mount3Mnt returns the file handle of the directory being mounted.
+// Any directory in the VFS can be mounted.
+func (s *server) mount3Mnt(args *decoder, res *encoder) {
+	dirPath := args.string(mountPathLen)
+	if args.err != nil {
+		return
+	}
+	p := strings.Trim(dirPath, "/")
+	node, err := s.vfs.Stat(p)
+	switch {
+	case err == vfs.ENOENT:
+		res.uint32(mnt3ErrNoEnt)
+		return
+	case err != nil:
+		fs.Errorf(p, "NFS: mount failed: %v", err)
+		res.uint32(mnt3ErrServerFault)
+		return
+	case !node.IsDir():
+		res.uint32(mnt3ErrNotDir)
+		return
+	}
+	fs.Infof(nil, "NFS: mounting %q", dirPath)
+	res.uint32(mnt3OK)
+	res.opaque(s.toHandle(p))
+	// auth flavors accepted
+	res.uint32(2)
+	res.uint32(authUnix)
+	res.uint32(authNone)
+}
+
+// mount3Dump returns the list of mounts which isn't kept
+func (s *server) mount3Dump(args *decoder, res *encoder) {
+	res.bool(false)
+}
+
+// mount3Umnt logs the unmount
+func (s *server) mount3Umnt(args *decoder, res *encoder) {
+	dirPath := args.string(mountPathLen)
+	if args.err != nil {
+		return
+	}
+	fs.Infof(nil, "NFS: unmounting %q", dirPath)
+}
+
+// mount3Export returns the root as the only export
+func (s *server) mount3Export(args *decoder, res *encoder) {
+	res.bool(true)
+	res.string("/")
+	res.bool(false) // no groups
+	res.bool(false) // end of list
+}
@@ -0,0 +1,111 @@
+// Package nfs implements an NFSv3 server to serve an rclone VFS
+package nfs
+
+import (
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/fs/config/flags"
+	"github.com/ncw/rclone/fs/rc"
+	"github.com/ncw/rclone/vfs"
+	"github.com/ncw/rclone/vfs/vfsflags"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Options contains options for the NFS server
+type Options struct {
+	ListenAddr  string // Port to listen on
+	HandleCache string // where to remember file handles - memory or disk
+}
+
+// DefaultOpt is the default values used for Options
+var DefaultOpt = Options{
+	ListenAddr:  "localhost:2049",
+	HandleCache: "memory",
+}
+
+// Opt is options set by command line flags
+var Opt = DefaultOpt
+
+// AddFlags adds flags for the NFS server
+func AddFlags(flagSet *pflag.FlagSet, Opt *Options) {
+	rc.AddOption("nfs", Opt)
+	flags.StringVarP(flagSet, &Opt.ListenAddr, "addr", "", Opt.ListenAddr, "IPaddress:Port or :Port to bind server to.")
+	flags.StringVarP(flagSet, &Opt.HandleCache, "handle-cache", "", Opt.HandleCache, "Where to remember file handles - memory or disk.")
+}
+
+func init() {
+	vfsflags.AddFlags(Command.Flags())
+	AddFlags(Command.Flags(), &Opt)
+}
+
+// Command definition for cobra
+var Command = &cobra.Command{
+	Use:   "nfs remote:path",
+	Short: `Serve the remote as an NFS mount.`,
+	Long: `rclone serve nfs implements an NFSv3 server to serve the remote
+so it can be mounted with the kernel's NFS client.  This is useful on
+machines where FUSE isn't available, eg in containers.
+
+Both the NFS and the MOUNT protocols are served over TCP on --addr,
+which defaults to localhost:2049.  There is no portmapper, NFS locking
+or authentication so the server should only be reachable from the
+machine it is mounted on.  Mount it on Linux like this
+
+    rclone serve nfs remote:path --addr localhost:2049 &
+    sudo mount -t nfs -o port=2049,mountport=2049,nfsvers=3,tcp,mountproto=tcp,nolock localhost:/ /path/to/mountpoint
+
+Any directory in the remote can be mounted by giving its path instead
+of / in the mount command.
+
+On macOS use
+
+    sudo mount -t nfs -o port=2049,mountport=2049,tcp,nolocks,vers=3 localhost:/ /path/to/mountpoint
+
+The files and directories are owned by the user running rclone, or
+the --uid and --gid given, and their permissions are set with
+--dir-perms, --file-perms and --umask.  Symlinks, hard links and
+special files can't be made and changes to the owner and permissions
+are ignored.
+
+### File handles ###
+
+NFS identifies files with handles which must stay the same while the
+file exists.  rclone makes them from the path of the file so they
+don't change when the server is restarted.  It has to remember which
+path each handle was made from though, so by default a client which
+mounted the remote before a restart will get "stale file handle"
+errors until it looks up the files again.  Use --handle-cache disk to
+save the handles in the cache directory so they survive restarts.
+
+Handles are made from the path so renaming a file or directory changes
+its handle, which the kernel deals with by looking it up again.
+
+### Writing files ###
+
+NFS has no open or close, the client just writes data at any offset
+in a file, so --vfs-cache-mode writes or above is needed for files to
+be written.  If the remote isn't --read-only then --vfs-cache-mode
+writes is used unless a higher mode is given.
+
+Files being written are kept open in the VFS cache and uploaded when
+the client commits them, which it does when the file is closed or
+synced, or when they haven't been used for 5 seconds.  Writes the
+client asks to be stable are uploaded before they are acknowledged.
+` + vfs.Help,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		f := cmd.NewFsSrc(args)
+		cmd.Run(false, true, command, func() error {
+			s, err := newServer(f, &Opt)
+			if err != nil {
+				return err
+			}
+			err = s.Serve()
+			if err != nil {
+				return err
+			}
+			s.Wait()
+			return nil
+		})
+	},
+}
@@ -0,0 +1,934 @@
+// The NFS protocol version 3 as described in RFC 1813
+
+package nfs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/vfs"
+)
+
+// NFS constants
+const (
+	maxIOSize   = 1024 * 1024 // largest READ or WRITE
+	nfs3FhSize  = 64          // largest file handle
+	nfs3NameLen = 255         // longest file name
+	nfs3PathLen = 1024        // longest path read
+
+	// ftype3
+	nf3Reg = 1
+	nf3Dir = 2
+
+	// stable_how
+	stableUnstable = 0
+	stableFileSync = 2
+
+	// createmode3
+	createUnchecked = 0
+	createGuarded   = 1
+	createExclusive = 2
+
+	// time_how
+	setToServerTime = 1
+	setToClientTime = 2
+
+	// ACCESS bits
+	access3Read    = 0x0001
+	access3Lookup  = 0x0002
+	access3Modify  = 0x0004
+	access3Extend  = 0x0008
+	access3Delete  = 0x0010
+	access3Execute = 0x0020
+
+	// FSINFO properties
+	fsf3Homogeneous = 0x0008
+	fsf3CanSetTime  = 0x0010
+
+	// unknownSize is reported for sizes and file counts the remote
+	// doesn't know
+	unknownSize = 1 << 50
+)
+
+// nfsStat is an NFSv3 status which can be returned as an error
+type nfsStat uint32
+
+// NFSv3 statuses used
+const (
+	nfs3OK             nfsStat = 0
+	nfs3ErrPerm        nfsStat = 1
+	nfs3ErrNoEnt       nfsStat = 2
+	nfs3ErrIO          nfsStat = 5
+	nfs3ErrAcces       nfsStat = 13
+	nfs3ErrExist       nfsStat = 17
+	nfs3ErrNotDir      nfsStat = 20
+	nfs3ErrIsDir       nfsStat = 21
+	nfs3ErrInval       nfsStat = 22
+	nfs3ErrRoFs        nfsStat = 30
+	nfs3ErrNameTooLong nfsStat = 63
+	nfs3ErrNotEmpty    nfsStat = 66
+	nfs3ErrStale       nfsStat = 70
+	nfs3ErrBadHandle   nfsStat = 10001
+	nfs3ErrNotSync     nfsStat = 10002
+	nfs3ErrBadCookie   nfsStat = 10003
+	nfs3ErrNotSupp     nfsStat = 10004
+	nfs3ErrTooSmall    nfsStat = 10005
+)
+
+// Error returns the status as an error string
+func (st nfsStat) Error() string {
+	return fmt.Sprintf("NFS3 error %d", uint32(st))
+}
+
+// toStat converts err into an NFS status
+func toStat(err error) nfsStat {
+	switch err {
+	case nil:
+		return nfs3OK
+	case vfs.ENOENT:
+		return nfs3ErrNoEnt
+	case vfs.EEXIST:
+		return nfs3ErrExist
+	case vfs.EPERM:
+		return nfs3ErrPerm
+	case vfs.EINVAL:
+		return nfs3ErrInval
+	case vfs.ENOTEMPTY:
+		return nfs3ErrNotEmpty
+	case vfs.EROFS:
+		return nfs3ErrRoFs
+	case vfs.ENOSYS:
+		return nfs3ErrNotSupp
+	case vfs.ELOCKED:
+		return nfs3ErrAcces
+	}
+	if st, ok := err.(nfsStat); ok {
+		return st
+	}
+	fs.Errorf(nil, "NFS: %v", err)
+	return nfs3ErrIO
+}
+
+// putStat writes the status for err
+func putStat(res *encoder, err error) {
+	res.uint32(uint32(toStat(err)))
+}
+
+// nfs3Program is the NFS program
+var nfs3Program = program{
+	name:    "NFS3",
+	version: 3,
+	procs: []proc{
+		{"NULL", (*server).nfs3Null},
+		{"GETATTR", (*server).nfs3Getattr},
+		{"SETATTR", (*server).nfs3Setattr},
+		{"LOOKUP", (*server).nfs3Lookup},
+		{"ACCESS", (*server).nfs3Access},
+		{"READLINK", (*server).nfs3Readlink},
+		{"READ", (*server).nfs3Read},
+		{"WRITE", (*server).nfs3Write},
+		{"CREATE", (*server).nfs3Create},
+		{"MKDIR", (*server).nfs3Mkdir},
+		{"SYMLINK", (*server).nfs3NotSuppDir},
+		{"MKNOD", (*server).nfs3NotSuppDir},
+		{"REMOVE", (*server).nfs3Remove},
+		{"RMDIR", (*server).nfs3Rmdir},
+		{"RENAME", (*server).nfs3Rename},
+		{"LINK", (*server).nfs3Link},
+		{"READDIR", (*server).nfs3Readdir},
+		{"READDIRPLUS", (*server).nfs3Readdirplus},
+		{"FSSTAT", (*server).nfs3Fsstat},
+		{"FSINFO", (*server).nfs3Fsinfo},
+		{"PATHCONF", (*server).nfs3Pathconf},
+		{"COMMIT", (*server).nfs3Commit},
+	},
+}
+
+// sattr is the attributes to set from a sattr3
+//
+// The atime can't be set so is ignored.
+type sattr struct {
+	setMode  bool
+	mode     uint32
+	setUID   bool
+	uid      uint32
+	setGID   bool
+	gid      uint32
+	setSize  bool
+	size     uint64
+	setMtime bool
+	mtime    time.Time
+}
+
+// decodeSattr reads a sattr3
+func decodeSattr(args *decoder) (a sattr) {
+	if args.bool() {
+		a.setMode = true
+		a.mode = args.uint32()
+	}
+	if args.bool() {
+		a.setUID = true
+		a.uid = args.uint32()
+	}
+	if args.bool() {
+		a.setGID = true
+		a.gid = args.uint32()
+	}
+	if args.bool() {
+		a.setSize = true
+		a.size = args.uint64()
+	}
+	if args.uint32() == setToClientTime {
+		_ = args.time() // atime
+	}
+	switch args.uint32() {
+	case setToServerTime:
+		a.setMtime = true
+		a.mtime = time.Now()
+	case setToClientTime:
+		a.setMtime = true
+		a.mtime = args.time()
+	}
+	return a
+}
+
+// setattr sets the attributes in a on node at p
+func (s *server) setattr(p string, node vfs.Node, a *sattr) error {
+	if a.setSize {
+		if node.IsDir() {
+			return nfs3ErrIsDir
+		}
+		err := s.files.truncate(p, int64(a.size))
+		if err != nil {
+			return err
+		}
+	}
+	if a.setMtime {
+		err := node.SetModTime(a.mtime)
+		if err != nil {
+			return err
+		}
+	}
+	if !a.setMode && !a.setUID && !a.setGID {
+		return nil
+	}
+	attrNode, ok := node.(vfs.Attributer)
+	if !ok {
+		return nfs3ErrNotSupp
+	}
+	if a.setMode {
+		err := attrNode.Chmod(os.FileMode(a.mode).Perm())
+		if err != nil {
+			return err
+		}
+	}
+	if a.setUID || a.setGID {
+		uid, gid := attrNode.Owner()
+		if a.setUID {
+			uid = a.uid
+		}
+		if a.setGID {
+			gid = a.gid
+		}
+		err := attrNode.Chown(uid, gid)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkName returns an error if name can't be used for a directory
+// entry
+func checkName(name string) error {
+	if len(name) > nfs3NameLen {
+		return nfs3ErrNameTooLong
+	}
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return nfs3ErrInval
+	}
+	return nil
+}
+
+// writeAttr writes the fattr3 for node
+func (s *server) writeAttr(res *encoder, node vfs.Node) {
+	size := node.Size()
+	if size < 0 {
+		size = 0
+	}
+	if node.IsDir() {
+		res.uint32(nf3Dir)
+	} else {
+		res.uint32(nf3Reg)
+	}
+	res.uint32(uint32(node.Mode().Perm()))
+	res.uint32(1) // nlink
+	uid, gid := vfs.Owner(node)
+	res.uint32(uid)
+	res.uint32(gid)
+	res.uint64(uint64(size)) // size
+	res.uint64(uint64(size)) // used
+	res.uint32(0)            // rdev
+	res.uint32(0)
+	res.uint64(s.fsid)
+	res.uint64(fileID(makeHandle(node.Path())))
+	modTime := node.ModTime()
+	res.time(modTime) // atime
+	res.time(modTime) // mtime
+	res.time(modTime) // ctime
+}
+
+// postOpAttr writes the post_op_attr for node which may be nil
+func (s *server) postOpAttr(res *encoder, node vfs.Node) {
+	if node == nil {
+		res.bool(false)
+		return
+	}
+	res.bool(true)
+	s.writeAttr(res, node)
+}
+
+// postOpAttrPath writes the post_op_attr for the VFS path p
+func (s *server) postOpAttrPath(res *encoder, p string) {
+	node, err := s.vfs.Stat(p)
+	if err != nil {
+		node = nil
+	}
+	s.postOpAttr(res, node)
+}
+
+// wccData writes the wcc_data for the VFS path p.  The attributes
+// from before the operation aren't returned.
+func (s *server) wccData(res *encoder, p string) {
+	res.bool(false)
+	s.postOpAttrPath(res, p)
+}
+
+// noWccData writes a wcc_data with no attributes
+func noWccData(res *encoder) {
+	res.bool(false)
+	res.bool(false)
+}
+
+// postOpFh writes the post_op_fh3 for the VFS path p
+func (s *server) postOpFh(res *encoder, p string) {
+	res.bool(true)
+	res.opaque(s.toHandle(p))
+}
+
+// nfs3Null does nothing
+func (s *server) nfs3Null(args *decoder, res *encoder) {
+}
+
+// nfs3Getattr returns the attributes of a file or directory
+func (s *server) nfs3Getattr(args *decoder, res *encoder) {
+	handle := args.opaque(nfs3FhSize)
+	if args.err != nil {
+		return
+	}
+	_, node, err := s.lookupHandle(handle)
+	putStat(res, err)
+	if err != nil {
+		return
+	}
+	s.writeAttr(res, node)
+}
+
+// nfs3Setattr sets the size and modification time
+func (s *server) nfs3Setattr(args *decoder, res *encoder) {
+	handle := args.opaque(nfs3FhSize)
+	a := decodeSattr(args)
+	guard := args.bool()
+	var guardTime time.Time
+	if guard {
+		guardTime = args.time()
+	}
+	if args.err != nil {
+		return
+	}
+	p, node, err := s.lookupHandle(handle)
+	if err != nil {
+		putStat(res, err)
+		noWccData(res)
+		return
+	}
+	if guard {
+		// The ctime reported is the modification time
+		ctime := node.ModTime()
+		if ctime.Unix() != guardTime.Unix() || ctime.Nanosecond() != guardTime.Nanosecond() {
+			err = nfs3ErrNotSync
+		}
+	}
+	if err == nil {
+		err = s.setattr(p, node, &a)
+	}
+	putStat(res, err)
+	s.wccData(res, p)
+}
+
+// nfs3Lookup looks up a name in a directory
+func (s *server) nfs3Lookup(args *decoder, res *encoder) {
+	dirHandle := args.opaque(nfs3FhSize)
+	name := args.string(nfs3PathLen)
+	if args.err != nil {
+		return
+	}
+	dirPath, dir, err := s.lookupDir(dirHandle)
+	if err != nil {
+		putStat(res, err)
+		res.bool(false)
+		return
+	}
+	var p string
+	var node vfs.Node
+	switch name {
+	case ".":
+		p, node = dirPath, dir
+	case "..":
+		p = path.Dir(dirPath)
+		if p == "." {
+			p = ""
+		}
+		node, err = s.vfs.Stat(p)
+	default:
+		err = checkName(name)
+		if err == nil {
+			p = path.Join(dirPath, name)
+			node, err = dir.Stat(name)
+		}
+	}
+	if err != nil {
+		putStat(res, err)
+		s.postOpAttr(res, dir)
+		return
+	}
+	putStat(res, nil)
+	res.opaque(s.toHandle(p))
+	s.postOpAttr(res, node)
+	s.postOpAttr(res, dir)
+}
+
+// nfs3Access returns which of the access asked for is allowed.
+// Everything is allowed apart from modifications to read only VFSes.
+func (s *server) nfs3Access(args *decoder, res *encoder) {
+	handle := args.opaque(nfs3FhSize)
+	access := args.uint32()
+	if args.err != nil {
+		return
+	}
+	_, node, err := s.lookupHandle(handle)
+	if err != nil {
+		putStat(res, err)
+		res.bool(false)
+		return
+	}
+	allowed := uint32(access3Read | access3Lookup | access3Modify | access3Extend | access3Delete | access3Execute)
+	if s.vfs.Opt.ReadOnly {
+		allowed &^= access3Modify | access3Extend | access3Delete
+	}
+	putStat(res, nil)
+	s.postOpAttr(res, node)
+	res.uint32(access & allowed)
+}
+
+// nfs3Readlink isn't supported as there are no symlinks
+func (s *server) nfs3Readlink(args *decoder, res *encoder) {
+	handle := args.opaque(nfs3FhSize)
+	if args.err != nil {
+		return
+	}
+	_, node, err := s.lookupHandle(handle)
+	if err != nil {
+		putStat(res, err)
+		res.bool(false)
+		return
+	}
+	putStat(res, nfs3ErrNotSupp)
+	s.postOpAttr(res, node)
+}
+
+// nfs3Read reads from a file
+func (s *server) nfs3Read(args *decoder, res *encoder) {
+	handle := args.opaque(nfs3FhSize)
+	offset := args.uint64()
+	count := args.uint32()
+	if args.err != nil {
+		return
+	}
+	p, node, err := s.lookupHandle(handle)
+	if err != nil {
+		putStat(res, err)
+		res.bool(false)
+		return
+	}
+	if node.IsDir() {
+		putStat(res, nfs3ErrIsDir)
+		s.postOpAttr(res, node)
+		return
+	}
+	if count > maxIOSize {
+		count = maxIOSize
+	}
+	buf := make([]byte, count)
+	n, err := s.files.readAt(p, buf, int64(offset))
+	eof := false
+	if err == io.EOF {
+		err = nil
+		eof = true
+	}
+	if err != nil {
+		putStat(res, err)
+		s.postOpAttr(res, node)
+		return
+	}
+	if int64(offset)+int64(n) >= node.Size() {
+		eof = true
+	}
+	putStat(res, nil)
+	s.postOpAttr(res, node)
+	res.uint32(uint32(n))
+	res.bool(eof)
+	res.opaque(buf[:n])
+}
+
+// nfs3Write writes to a file.  Unstable writes are kept in the VFS
+// cache until COMMIT, others are uploaded before replying.
+func (s *server) nfs3Write(args *decoder, res *encoder) {
+	handle := args.opaque(nfs3FhSize)
+	offset := args.uint64()
+	_ = args.uint32() // count - the length of data is used
+	stable := args.uint32()
+	data := args.opaque(maxIOSize)
+	if args.err != nil {
+		return
+	}
+	p, node, err := s.lookupHandle(handle)
+	if err != nil {
+		putStat(res, err)
+		noWccData(res)
+		return
+	}
+	if node.IsDir() {
+		putStat(res, nfs3ErrIsDir)
+		s.wccData(res, p)
+		return
+	}
+	n, err := s.files.writeAt(p, data, int64(offset))
+	committed := uint32(stableUnstable)
+	if err == nil && stable != stableUnstable {
+		err = s.files.close(p)
+		committed = stableFileSync
+	}
+	putStat(res, err)
+	s.wccData(res, p)
+	if err != nil {
+		return
+	}
+	res.uint32(uint32(n))
+	res.uint32(committed)
+	res.fixed(s.writeVerf[:])
+}
+
+// nfs3Create makes a file and leaves it open for writing
+func (s *server) nfs3Create(args *decoder, res *encoder) {
+	dirHandle := args.opaque(nfs3FhSize)
+	name := args.string(nfs3PathLen)
+	mode := args.uint32()
+	var a sattr
+	switch mode {
+	case createUnchecked, createGuarded:
+		a = decodeSattr(args)
+	case createExclusive:
+		_ = args.fixed(8) // verifier
+	default:
+		args.err = errGarbage
+	}
+	if args.err != nil {
+		return
+	}
+	dirPath, dir, err := s.lookupDir(dirHandle)
+	if err != nil {
+		putStat(res, err)
+		noWccData(res)
+		return
+	}
+	p := path.Join(dirPath, name)
+	err = checkName(name)
+	if err == nil {
+		var node vfs.Node
+		node, err = dir.Stat(name)
+		if err == nil && (mode != createUnchecked || node.IsDir()) {
+			err = vfs.EEXIST
+		} else if err == nil || err == vfs.ENOENT {
+			trunc := a.setSize && a.size == 0
+			a.setSize = a.setSize && !trunc
+			err = s.files.create(p, trunc)
+			if err == nil {
+				node, err = s.vfs.Stat(p)
+			}
+			if err == nil {
+				err = s.setattr(p, node, &a)
+			}
+		}
+	}
+	putStat(res, err)
+	if err == nil {
+		s.postOpFh(res, p)
+		s.postOpAttrPath(res, p)
+	}
+	s.wccData(res, dirPath)
+}
+
+// nfs3Mkdir makes a directory
+func (s *server) nfs3Mkdir(args *decoder, res *encoder) {
+	dirHandle := args.opaque(nfs3FhSize)
+	name := args.string(nfs3PathLen)
+	a := decodeSattr(args)
+	if args.err != nil {
+		return
+	}
+	dirPath, dir, err := s.lookupDir(dirHandle)
+	if err != nil {
+		putStat(res, err)
+		noWccData(res)
+		return
+	}
+	p := path.Join(dirPath, name)
+	err = checkName(name)
+	if err == nil {
+		var newDir *vfs.Dir
+		newDir, err = dir.Mkdir(name)
+		if err == nil && a.setMtime {
+			if err := newDir.SetModTime(a.mtime); err != nil {
+				fs.Debugf(p, "NFS: failed to set modification time: %v", err)
+			}
+		}
+	}
+	putStat(res, err)
+	if err == nil {
+		s.postOpFh(res, p)
+		s.postOpAttrPath(res, p)
+	}
+	s.wccData(res, dirPath)
+}
+
+// nfs3NotSuppDir is used for the calls which make things which can't
+// be made in a directory (SYMLINK and MKNOD)
+func (s *server) nfs3NotSuppDir(args *decoder, res *encoder) {
+	dirHandle := args.opaque(nfs3FhSize)
+	if args.err != nil {
+		return
+	}
+	putStat(res, nfs3ErrNotSupp)
+	dirPath, _, err := s.lookupDir(dirHandle)
+	if err != nil {
+		noWccData(res)
+		return
+	}
+	s.wccData(res, dirPath)
+}
+
+// remove removes a file or an empty directory
+func (s *server) remove(args *decoder, res *encoder, isDir bool) {
+	dirHandle := args.opaque(nfs3FhSize)
+	name := args.string(nfs3PathLen)
+	if args.err != nil {
+		return
+	}
+	dirPath, dir, err := s.lookupDir(dirHandle)
+	if err != nil {
+		putStat(res, err)
+		noWccData(res)
+		return
+	}
+	p := path.Join(dirPath, name)
+	err = checkName(name)
+	var node vfs.Node
+	if err == nil {
+		node, err = dir.Stat(name)
+	}
+	if err == nil {
+		if node.IsDir() && !isDir {
+			err = nfs3ErrIsDir
+		} else if !node.IsDir() && isDir {
+			err = nfs3ErrNotDir
+		}
+	}
+	if err == nil {
+		if closeErr := s.files.close(p); closeErr != nil {
+			fs.Debugf(p, "NFS: error closing file before removing: %v", closeErr)
+		}
+		err = node.Remove()
+	}
+	if err == nil {
+		s.handles.forget(makeHandle(p))
+	}
+	putStat(res, err)
+	s.wccData(res, dirPath)
+}
+
+// nfs3Remove removes a file
+func (s *server) nfs3Remove(args *decoder, res *encoder) {
+	s.remove(args, res, false)
+}
+
+// nfs3Rmdir removes an empty directory
+func (s *server) nfs3Rmdir(args *decoder, res *encoder) {
+	s.remove(args, res, true)
+}
+
+// nfs3Rename renames a file or directory
+func (s *server) nfs3Rename(args *decoder, res *encoder) {
+	fromHandle := args.opaque(nfs3FhSize)
+	fromName := args.string(nfs3PathLen)
+	toHandle := args.opaque(nfs3FhSize)
+	toName := args.string(nfs3PathLen)
+	if args.err != nil {
+		return
+	}
+	fromDirPath, fromDir, err := s.lookupDir(fromHandle)
+	if err != nil {
+		putStat(res, err)
+		noWccData(res)
+		noWccData(res)
+		return
+	}
+	toDirPath, toDir, err := s.lookupDir(toHandle)
+	if err != nil {
+		putStat(res, err)
+		s.wccData(res, fromDirPath)
+		noWccData(res)
+		return
+	}
+	fromPath := path.Join(fromDirPath, fromName)
+	toPath := path.Join(toDirPath, toName)
+	err = checkName(fromName)
+	if err == nil {
+		err = checkName(toName)
+	}
+	if err == nil {
+		// Upload anything being written before it is renamed
+		err = s.files.close(fromPath)
+	}
+	if err == nil {
+		err = s.files.close(toPath)
+	}
+	if err == nil {
+		err = fromDir.Rename(fromName, toName, toDir)
+	}
+	if err == nil {
+		s.handles.forget(makeHandle(fromPath))
+	}
+	putStat(res, err)
+	s.wccData(res, fromDirPath)
+	s.wccData(res, toDirPath)
+}
+
+// nfs3Link isn't supported as there are no hard links
+func (s *server) nfs3Link(args *decoder, res *encoder) {
+	handle := args.opaque(nfs3FhSize)
+	if args.err != nil {
+		return
+	}
+	putStat(res, nfs3ErrNotSupp)
+	_, node, err := s.lookupHandle(handle)
+	if err != nil {
+		node = nil
+	}
+	s.postOpAttr(res, node)
+	noWccData(res)
+}
+
+// readdir lists a directory for READDIR and READDIRPLUS
+//
+// Cookies are the index of the next entry in the sorted directory
+// listing.
+func (s *server) readdir(args *decoder, res *encoder, plus bool) {
+	dirHandle := args.opaque(nfs3FhSize)
+	cookie := args.uint64()
+	_ = args.fixed(8) // cookie verifier - not used
+	dirCount := args.uint32()
+	maxCount := dirCount
+	if plus {
+		maxCount = args.uint32()
+	}
+	if args.err != nil {
+		return
+	}
+	_, dir, err := s.lookupDir(dirHandle)
+	if err != nil {
+		putStat(res, err)
+		res.bool(false)
+		return
+	}
+	nodes, err := dir.ReadDirAll()
+	if err == nil && cookie > uint64(len(nodes)) {
+		err = nfs3ErrBadCookie
+	}
+	if err != nil {
+		putStat(res, err)
+		s.postOpAttr(res, dir)
+		return
+	}
+
+	// Add entries while they fit.  The size of the reply is limited
+	// by maxCount and for READDIRPLUS the size of the entries
+	// without the attributes and handles by dirCount.
+	entries := &encoder{}
+	entriesDirSize := 0
+	const overhead = 256 // for the status, attributes and end of list
+	i := int(cookie)
+	for ; i < len(nodes); i++ {
+		node := nodes[i]
+		entry := &encoder{}
+		entry.bool(true)
+		entry.uint64(fileID(makeHandle(node.Path())))
+		entry.string(node.Name())
+		entry.uint64(uint64(i + 1))
+		dirSize := entry.Len()
+		if plus {
+			s.postOpAttr(entry, node)
+			s.postOpFh(entry, node.Path())
+		}
+		if entries.Len()+entry.Len()+overhead > int(maxCount) || entriesDirSize+dirSize > int(dirCount) {
+			break
+		}
+		_, _ = entries.Write(entry.Bytes())
+		entriesDirSize += dirSize
+	}
+	if i == int(cookie) && i < len(nodes) {
+		putStat(res, nfs3ErrTooSmall)
+		s.postOpAttr(res, dir)
+		return
+	}
+	putStat(res, nil)
+	s.postOpAttr(res, dir)
+	res.fixed(make([]byte, 8)) // cookie verifier
+	_, _ = res.Write(entries.Bytes())
+	res.bool(false) // end of entries
+	res.bool(i == len(nodes))
+}
+
+// nfs3Readdir lists a directory
+func (s *server) nfs3Readdir(args *decoder, res *encoder) {
+	s.readdir(args, res, false)
+}
+
+// nfs3Readdirplus lists a directory with attributes and handles
+func (s *server) nfs3Readdirplus(args *decoder, res *encoder) {
+	s.readdir(args, res, true)
+}
+
+// nfs3Fsstat returns the space used and free if the remote knows it
+func (s *server) nfs3Fsstat(args *decoder, res *encoder) {
+	handle := args.opaque(nfs3FhSize)
+	if args.err != nil {
+		return
+	}
+	_, node, err := s.lookupHandle(handle)
+	if err != nil {
+		putStat(res, err)
+		res.bool(false)
+		return
+	}
+	total, used, free := s.vfs.Statfs()
+	if total < 0 {
+		total = unknownSize
+	}
+	if used < 0 {
+		used = 0
+	}
+	if free < 0 {
+		free = total - used
+		if free < 0 {
+			free = 0
+		}
+	}
+	putStat(res, nil)
+	s.postOpAttr(res, node)
+	res.uint64(uint64(total))
+	res.uint64(uint64(free))
+	res.uint64(uint64(free))
+	res.uint64(unknownSize) // total files
+	res.uint64(unknownSize) // free files
+	res.uint64(unknownSize) // available files
+	res.uint32(0)           // invarsec
+}
+
+// nfs3Fsinfo returns the limits of the server
+func (s *server) nfs3Fsinfo(args *decoder, res *encoder) {
+	handle := args.opaque(nfs3FhSize)
+	if args.err != nil {
+		return
+	}
+	_, node, err := s.lookupHandle(handle)
+	if err != nil {
+		putStat(res, err)
+		res.bool(false)
+		return
+	}
+	putStat(res, nil)
+	s.postOpAttr(res, node)
+	res.uint32(maxIOSize) // rtmax
+	res.uint32(maxIOSize) // rtpref
+	res.uint32(4096)      // rtmult
+	res.uint32(maxIOSize) // wtmax
+	res.uint32(maxIOSize) // wtpref
+	res.uint32(4096)      // wtmult
+	res.uint32(64 * 1024) // dtpref
+	res.uint64(1 << 62)   // maxfilesize
+	precision := s.vfs.Fs().Precision()
+	res.uint32(uint32(precision / time.Second))
+	res.uint32(uint32(precision % time.Second))
+	res.uint32(fsf3Homogeneous | fsf3CanSetTime)
+}
+
+// nfs3Pathconf returns information about names
+func (s *server) nfs3Pathconf(args *decoder, res *encoder) {
+	handle := args.opaque(nfs3FhSize)
+	if args.err != nil {
+		return
+	}
+	_, node, err := s.lookupHandle(handle)
+	if err != nil {
+		putStat(res, err)
+		res.bool(false)
+		return
+	}
+	putStat(res, nil)
+	s.postOpAttr(res, node)
+	res.uint32(1)           // linkmax
+	res.uint32(nfs3NameLen) // name_max
+	res.bool(true)          // no_trunc
+	res.bool(true)          // chown_restricted
+	res.bool(false)         // case_insensitive
+	res.bool(true)          // case_preserving
+}
+
+// nfs3Commit closes the file so any unstable writes are uploaded
+func (s *server) nfs3Commit(args *decoder, res *encoder) {
+	handle := args.opaque(nfs3FhSize)
+	_ = args.uint64() // offset
+	_ = args.uint32() // count
+	if args.err != nil {
+		return
+	}
+	p, _, err := s.lookupHandle(handle)
+	if err != nil {
+		putStat(res, err)
+		noWccData(res)
+		return
+	}
+	err = s.files.close(p)
+	putStat(res, err)
+	s.wccData(res, p)
+	if err != nil {
+		return
+	}
+	res.fixed(s.writeVerf[:])
+}
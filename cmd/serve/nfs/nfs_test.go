@@ -0,0 +1,561 @@
+package nfs
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	_ "github.com/ncw/rclone/backend/local"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// client is a minimal RPC client for testing
+type client struct {
+	t   *testing.T
+	c   net.Conn
+	r   *bufio.Reader
+	xid uint32
+}
+
+// call calls proc in prog with args, checks the call succeeded and
+// returns a decoder for the results
+func (c *client) call(prog, vers, proc uint32, args *encoder) *decoder {
+	c.xid++
+	e := &encoder{}
+	e.uint32(c.xid)
+	e.uint32(rpcCall)
+	e.uint32(rpcVersion)
+	e.uint32(prog)
+	e.uint32(vers)
+	e.uint32(proc)
+	e.uint32(authUnix)
+	e.opaque([]byte("creds"))
+	e.uint32(authNone)
+	e.opaque(nil)
+	if args != nil {
+		_, _ = e.Write(args.Bytes())
+	}
+	require.NoError(c.t, writeRecord(c.c, e.Bytes()))
+	record, err := readRecord(c.r)
+	require.NoError(c.t, err)
+	d := newDecoder(record)
+	assert.Equal(c.t, c.xid, d.uint32(), "xid")
+	assert.Equal(c.t, uint32(rpcReply), d.uint32(), "msg_type")
+	assert.Equal(c.t, uint32(msgAccepted), d.uint32(), "reply_stat")
+	_ = d.uint32() // verifier
+	_ = d.opaque(400)
+	require.Equal(c.t, uint32(acceptSuccess), d.uint32(), "accept_stat")
+	return d
+}
+
+// nfs calls an NFS procedure returning the status and the results
+func (c *client) nfs(proc uint32, args *encoder) (nfsStat, *decoder) {
+	d := c.call(progNFS, 3, proc, args)
+	return nfsStat(d.uint32()), d
+}
+
+// attr reads a fattr3 returning the type and size
+func attr(d *decoder) (ftype uint32, size uint64) {
+	ftype = d.uint32()
+	_ = d.uint32() // mode
+	_ = d.uint32() // nlink
+	_ = d.uint32() // uid
+	_ = d.uint32() // gid
+	size = d.uint64()
+	_ = d.uint64() // used
+	_ = d.uint64() // rdev
+	_ = d.uint64() // fsid
+	_ = d.uint64() // fileid
+	_ = d.time()
+	_ = d.time()
+	_ = d.time()
+	return ftype, size
+}
+
+// postOpAttr reads a post_op_attr
+func postOpAttr(d *decoder) (ok bool, ftype uint32, size uint64) {
+	if !d.bool() {
+		return false, 0, 0
+	}
+	ftype, size = attr(d)
+	return true, ftype, size
+}
+
+// wccData reads a wcc_data
+func wccData(d *decoder) {
+	if d.bool() {
+		_ = d.uint64()
+		_ = d.time()
+		_ = d.time()
+	}
+	_, _, _ = postOpAttr(d)
+}
+
+// args makes the arguments for a call on a handle
+func handleArgs(handle []byte) *encoder {
+	e := &encoder{}
+	e.opaque(handle)
+	return e
+}
+
+// dirOpArgs makes a diropargs3
+func dirOpArgs(dir []byte, name string) *encoder {
+	e := handleArgs(dir)
+	e.string(name)
+	return e
+}
+
+// emptySattr writes a sattr3 which sets nothing
+func emptySattr(e *encoder) {
+	for i := 0; i < 6; i++ {
+		e.uint32(0)
+	}
+}
+
+func (c *client) lookup(dir []byte, name string) (nfsStat, []byte) {
+	st, d := c.nfs(3, dirOpArgs(dir, name))
+	if st != nfs3OK {
+		return st, nil
+	}
+	handle := d.opaque(nfs3FhSize)
+	require.NoError(c.t, d.err)
+	return st, handle
+}
+
+func (c *client) getattr(handle []byte) (nfsStat, uint32, uint64) {
+	st, d := c.nfs(1, handleArgs(handle))
+	if st != nfs3OK {
+		return st, 0, 0
+	}
+	ftype, size := attr(d)
+	require.NoError(c.t, d.err)
+	return st, ftype, size
+}
+
+func (c *client) write(handle []byte, offset uint64, data string, stable uint32) (nfsStat, uint32) {
+	args := handleArgs(handle)
+	args.uint64(offset)
+	args.uint32(uint32(len(data)))
+	args.uint32(stable)
+	args.opaque([]byte(data))
+	st, d := c.nfs(7, args)
+	wccData(d)
+	if st != nfs3OK {
+		return st, 0
+	}
+	assert.Equal(c.t, uint32(len(data)), d.uint32())
+	committed := d.uint32()
+	_ = d.fixed(8)
+	require.NoError(c.t, d.err)
+	return st, committed
+}
+
+func (c *client) read(handle []byte, offset uint64, count uint32) (nfsStat, string, bool) {
+	args := handleArgs(handle)
+	args.uint64(offset)
+	args.uint32(count)
+	st, d := c.nfs(6, args)
+	_, _, _ = postOpAttr(d)
+	if st != nfs3OK {
+		return st, "", false
+	}
+	_ = d.uint32()
+	eof := d.bool()
+	data := d.opaque(maxIOSize)
+	require.NoError(c.t, d.err)
+	return st, string(data), eof
+}
+
+func (c *client) readdir(dir []byte, plus bool, count uint32) (nfsStat, []string, bool) {
+	var names []string
+	var cookie uint64
+	for {
+		args := handleArgs(dir)
+		args.uint64(cookie)
+		args.fixed(make([]byte, 8))
+		args.uint32(count)
+		proc := uint32(16)
+		if plus {
+			args.uint32(count)
+			proc = 17
+		}
+		st, d := c.nfs(proc, args)
+		_, _, _ = postOpAttr(d)
+		if st != nfs3OK {
+			return st, nil, false
+		}
+		_ = d.fixed(8)
+		for d.bool() {
+			_ = d.uint64()
+			names = append(names, d.string(nfs3NameLen))
+			cookie = d.uint64()
+			if plus {
+				_, _, _ = postOpAttr(d)
+				require.True(c.t, d.bool())
+				_ = d.opaque(nfs3FhSize)
+			}
+		}
+		eof := d.bool()
+		require.NoError(c.t, d.err)
+		if eof {
+			return st, names, true
+		}
+	}
+}
+
+// setup makes a server serving a temporary local directory and a
+// client connected to it
+func setup(t *testing.T, opt *Options) (s *server, c *client, dir string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "rclone-serve-nfs")
+	require.NoError(t, err)
+	cacheDir, err := ioutil.TempDir("", "rclone-serve-nfs-cache")
+	require.NoError(t, err)
+	oldCacheDir := config.CacheDir
+	config.CacheDir = cacheDir
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0777))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "sub", "existing.txt"), []byte("existing"), 0666))
+
+	f, err := fs.NewFs(dir)
+	require.NoError(t, err)
+	s, err = newServer(f, opt)
+	require.NoError(t, err)
+	require.NoError(t, s.Serve())
+	conn, err := net.Dial("tcp", s.Addr())
+	require.NoError(t, err)
+	c = &client{t: t, c: conn, r: bufio.NewReader(conn)}
+	return s, c, dir, func() {
+		_ = conn.Close()
+		s.Close()
+		s.vfs.Shutdown()
+		config.CacheDir = oldCacheDir
+		_ = os.RemoveAll(dir)
+		_ = os.RemoveAll(cacheDir)
+	}
+}
+
+// mount returns the handle for dirPath from the MOUNT protocol
+func (c *client) mount(dirPath string) (uint32, []byte) {
+	args := &encoder{}
+	args.string(dirPath)
+	d := c.call(progMount, 3, 1, args)
+	st := d.uint32()
+	if st != mnt3OK {
+		return st, nil
+	}
+	handle := d.opaque(nfs3FhSize)
+	n := d.uint32()
+	require.NoError(c.t, d.err)
+	assert.NotEqual(c.t, uint32(0), n)
+	return st, handle
+}
+
+func testOpt() *Options {
+	opt := DefaultOpt
+	opt.ListenAddr = "localhost:0"
+	return &opt
+}
+
+func TestMount(t *testing.T) {
+	_, c, _, cleanup := setup(t, testOpt())
+	defer cleanup()
+
+	// NULL and EXPORT
+	c.call(progMount, 3, 0, nil)
+	d := c.call(progMount, 3, 5, nil)
+	assert.True(t, d.bool())
+	assert.Equal(t, "/", d.string(mountPathLen))
+	assert.False(t, d.bool())
+	assert.False(t, d.bool())
+	require.NoError(t, d.err)
+
+	st, root := c.mount("/")
+	require.Equal(t, uint32(mnt3OK), st)
+	assert.Equal(t, makeHandle(""), root)
+
+	st, sub := c.mount("/sub")
+	require.Equal(t, uint32(mnt3OK), st)
+	nst, handle := c.lookup(sub, "existing.txt")
+	require.Equal(t, nfs3OK, nst)
+	assert.Equal(t, makeHandle("sub/existing.txt"), handle)
+
+	st, _ = c.mount("/notfound")
+	assert.Equal(t, uint32(mnt3ErrNoEnt), st)
+	st, _ = c.mount("/sub/existing.txt")
+	assert.Equal(t, uint32(mnt3ErrNotDir), st)
+}
+
+func TestRPCErrors(t *testing.T) {
+	s, _, _, cleanup := setup(t, testOpt())
+	defer cleanup()
+
+	call := func(prog, vers, proc uint32) *decoder {
+		e := &encoder{}
+		e.uint32(42)
+		e.uint32(rpcCall)
+		e.uint32(rpcVersion)
+		e.uint32(prog)
+		e.uint32(vers)
+		e.uint32(proc)
+		e.uint32(authNone)
+		e.opaque(nil)
+		e.uint32(authNone)
+		e.opaque(nil)
+		d := newDecoder(s.handleCall(e.Bytes()))
+		assert.Equal(t, uint32(42), d.uint32())
+		assert.Equal(t, uint32(rpcReply), d.uint32())
+		assert.Equal(t, uint32(msgAccepted), d.uint32())
+		_ = d.uint32()
+		_ = d.opaque(400)
+		return d
+	}
+	assert.Equal(t, uint32(acceptProgUnavail), call(100000, 2, 0).uint32())
+	d := call(progNFS, 4, 0)
+	assert.Equal(t, uint32(acceptProgMismatch), d.uint32())
+	assert.Equal(t, uint32(3), d.uint32())
+	assert.Equal(t, uint32(3), d.uint32())
+	assert.Equal(t, uint32(acceptProcUnavail), call(progNFS, 3, 22).uint32())
+	// GETATTR with no arguments
+	assert.Equal(t, uint32(acceptGarbageArgs), call(progNFS, 3, 1).uint32())
+	// Replies aren't answered
+	assert.Nil(t, s.handleCall([]byte{0, 0, 0, 1, 0, 0, 0, 1}))
+}
+
+func TestNFS(t *testing.T) {
+	_, c, dir, cleanup := setup(t, testOpt())
+	defer cleanup()
+
+	_, root := c.mount("/")
+	st, ftype, _ := c.getattr(root)
+	require.Equal(t, nfs3OK, st)
+	assert.Equal(t, uint32(nf3Dir), ftype)
+
+	// Unknown handles are stale
+	st, _, _ = c.getattr(makeHandle("potato"))
+	assert.Equal(t, nfs3ErrStale, st)
+	st, _, _ = c.getattr([]byte("short"))
+	assert.Equal(t, nfs3ErrBadHandle, st)
+
+	// Create a file and write to it with unstable writes
+	args := dirOpArgs(root, "file.txt")
+	args.uint32(createGuarded)
+	emptySattr(args)
+	st, d := c.nfs(8, args)
+	require.Equal(t, nfs3OK, st)
+	require.True(t, d.bool())
+	file := d.opaque(nfs3FhSize)
+	assert.Equal(t, makeHandle("file.txt"), file)
+
+	st, _ = c.nfs(8, args)
+	assert.Equal(t, nfs3ErrExist, st)
+
+	st, committed := c.write(file, 6, "world", stableUnstable)
+	require.Equal(t, nfs3OK, st)
+	assert.Equal(t, uint32(stableUnstable), committed)
+	st, _ = c.write(file, 0, "hello ", stableUnstable)
+	require.Equal(t, nfs3OK, st)
+
+	st, _, size := c.getattr(file)
+	require.Equal(t, nfs3OK, st)
+	assert.Equal(t, uint64(11), size)
+
+	// Read back before commit
+	st, data, eof := c.read(file, 0, 100)
+	require.Equal(t, nfs3OK, st)
+	assert.Equal(t, "hello world", data)
+	assert.True(t, eof)
+	st, data, eof = c.read(file, 2, 3)
+	require.Equal(t, nfs3OK, st)
+	assert.Equal(t, "llo", data)
+	assert.False(t, eof)
+
+	// Commit uploads it
+	args = handleArgs(file)
+	args.uint64(0)
+	args.uint32(0)
+	st, _ = c.nfs(21, args)
+	require.Equal(t, nfs3OK, st)
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(contents))
+
+	// Stable writes are uploaded straight away
+	st, committed = c.write(file, 5, "!", stableFileSync)
+	require.Equal(t, nfs3OK, st)
+	assert.Equal(t, uint32(stableFileSync), committed)
+	contents, err = ioutil.ReadFile(filepath.Join(dir, "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello!world", string(contents))
+
+	// Truncate with SETATTR
+	args = handleArgs(file)
+	args.uint32(0) // mode
+	args.uint32(0) // uid
+	args.uint32(0) // gid
+	args.bool(true)
+	args.uint64(5)
+	args.uint32(0) // atime
+	args.uint32(0) // mtime
+	args.bool(false)
+	st, _ = c.nfs(2, args)
+	require.Equal(t, nfs3OK, st)
+	st, _, size = c.getattr(file)
+	require.Equal(t, nfs3OK, st)
+	assert.Equal(t, uint64(5), size)
+
+	// Lookups
+	st, handle := c.lookup(root, "file.txt")
+	require.Equal(t, nfs3OK, st)
+	assert.Equal(t, file, handle)
+	st, _ = c.lookup(root, "notfound")
+	assert.Equal(t, nfs3ErrNoEnt, st)
+	st, _ = c.lookup(file, "x")
+	assert.Equal(t, nfs3ErrNotDir, st)
+	st, handle = c.lookup(root, ".")
+	require.Equal(t, nfs3OK, st)
+	assert.Equal(t, root, handle)
+
+	// Make a directory and move the file into it
+	args = dirOpArgs(root, "dir")
+	emptySattr(args)
+	st, d = c.nfs(9, args)
+	require.Equal(t, nfs3OK, st)
+	require.True(t, d.bool())
+	newDir := d.opaque(nfs3FhSize)
+	st, handle = c.lookup(newDir, "..")
+	require.Equal(t, nfs3OK, st)
+	assert.Equal(t, root, handle)
+
+	args = dirOpArgs(root, "file.txt")
+	args.opaque(newDir)
+	args.string("renamed.txt")
+	st, _ = c.nfs(14, args)
+	require.Equal(t, nfs3OK, st)
+	st, _, _ = c.getattr(file)
+	assert.Equal(t, nfs3ErrStale, st)
+	st, renamed := c.lookup(newDir, "renamed.txt")
+	require.Equal(t, nfs3OK, st)
+	st, data, _ = c.read(renamed, 0, 100)
+	require.Equal(t, nfs3OK, st)
+	assert.Equal(t, "hello", data)
+
+	// List the directories
+	for _, plus := range []bool{false, true} {
+		st, names, eof := c.readdir(root, plus, 4096)
+		require.Equal(t, nfs3OK, st)
+		assert.True(t, eof)
+		sort.Strings(names)
+		assert.Equal(t, []string{"dir", "sub"}, names)
+
+		// With a small count the listing takes several calls
+		st, names, eof = c.readdir(root, plus, 300+100*btoi(plus))
+		require.Equal(t, nfs3OK, st)
+		assert.True(t, eof)
+		sort.Strings(names)
+		assert.Equal(t, []string{"dir", "sub"}, names)
+	}
+
+	// Remove things
+	st, _ = c.nfs(13, dirOpArgs(root, "dir"))
+	assert.Equal(t, nfs3ErrNotEmpty, st)
+	st, _ = c.nfs(12, dirOpArgs(root, "dir"))
+	assert.Equal(t, nfs3ErrIsDir, st)
+	st, _ = c.nfs(13, dirOpArgs(newDir, "renamed.txt"))
+	assert.Equal(t, nfs3ErrNotDir, st)
+	st, _ = c.nfs(12, dirOpArgs(newDir, "renamed.txt"))
+	require.Equal(t, nfs3OK, st)
+	st, _ = c.nfs(13, dirOpArgs(root, "dir"))
+	require.Equal(t, nfs3OK, st)
+	_, err = os.Stat(filepath.Join(dir, "dir"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Unsupported calls
+	st, _ = c.nfs(5, handleArgs(root))
+	assert.Equal(t, nfs3ErrNotSupp, st)
+
+	// File system information
+	st, d = c.nfs(19, handleArgs(root))
+	require.Equal(t, nfs3OK, st)
+	_, _, _ = postOpAttr(d)
+	assert.Equal(t, uint32(maxIOSize), d.uint32())
+	st, d = c.nfs(18, handleArgs(root))
+	require.Equal(t, nfs3OK, st)
+	st, d = c.nfs(20, handleArgs(root))
+	require.Equal(t, nfs3OK, st)
+	_, _, _ = postOpAttr(d)
+	_ = d.uint32()
+	assert.Equal(t, uint32(nfs3NameLen), d.uint32())
+	require.NoError(t, d.err)
+}
+
+func btoi(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestDiskHandles(t *testing.T) {
+	opt := testOpt()
+	opt.HandleCache = "disk"
+	s, c, _, cleanup := setup(t, opt)
+	defer cleanup()
+
+	_, root := c.mount("/")
+	st, handle := c.lookup(root, "sub")
+	require.Equal(t, nfs3OK, st)
+
+	// A new server finds the handles from before
+	s2, err := newServer(s.f, opt)
+	require.NoError(t, err)
+	defer s2.vfs.Shutdown()
+	p, node, err := s2.lookupHandle(handle)
+	require.NoError(t, err)
+	assert.Equal(t, "sub", p)
+	assert.True(t, node.IsDir())
+
+	// But not with a memory cache
+	opt.HandleCache = "memory"
+	s3, err := newServer(s.f, opt)
+	require.NoError(t, err)
+	defer s3.vfs.Shutdown()
+	_, _, err = s3.lookupHandle(handle)
+	assert.Equal(t, nfs3ErrStale, err)
+
+	opt.HandleCache = "potato"
+	_, err = newServer(s.f, opt)
+	assert.EqualError(t, err, `unknown --handle-cache "potato" - use memory or disk`)
+}
+
+func TestXDR(t *testing.T) {
+	e := &encoder{}
+	e.uint32(1)
+	e.uint64(1 << 40)
+	e.bool(true)
+	e.string("hello")
+	e.opaque([]byte{1, 2, 3, 4})
+	assert.Equal(t, 4+8+4+(4+8)+(4+4), e.Len())
+
+	d := newDecoder(e.Bytes())
+	assert.Equal(t, uint32(1), d.uint32())
+	assert.Equal(t, uint64(1<<40), d.uint64())
+	assert.True(t, d.bool())
+	assert.Equal(t, "hello", d.string(10))
+	assert.Equal(t, []byte{1, 2, 3, 4}, d.opaque(4))
+	require.NoError(t, d.err)
+
+	// Running out of data
+	_ = d.uint32()
+	assert.Equal(t, errGarbage, d.err)
+
+	// Too long
+	d = newDecoder(e.Bytes()[13:])
+	_ = d.string(4)
+	assert.Equal(t, errGarbage, d.err)
+}
@@ -0,0 +1,215 @@
+// ONC RPC over TCP as described in RFC 5531
+
+package nfs
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// RPC constants
+const (
+	rpcVersion = 2
+
+	// msg_type
+	rpcCall  = 0
+	rpcReply = 1
+
+	// reply_stat
+	msgAccepted = 0
+	msgDenied   = 1
+
+	// accept_stat
+	acceptSuccess      = 0
+	acceptProgUnavail  = 1
+	acceptProgMismatch = 2
+	acceptProcUnavail  = 3
+	acceptGarbageArgs  = 4
+
+	// reject_stat
+	rejectRPCMismatch = 0
+
+	// auth_flavor
+	authNone = 0
+	authUnix = 1
+
+	// program numbers
+	progNFS   = 100003
+	progMount = 100005
+
+	// maxRecordSize is the largest RPC record accepted, big enough
+	// for a WRITE of maxIOSize
+	maxRecordSize = maxIOSize + 64*1024
+
+	// maxConnRequests is the number of requests on one connection
+	// which are processed at once
+	maxConnRequests = 16
+)
+
+// proc is an RPC procedure
+type proc struct {
+	name string
+	fn   func(s *server, args *decoder, res *encoder)
+}
+
+// program is a version of an RPC program with its procedures
+type program struct {
+	name    string
+	version uint32
+	procs   []proc
+}
+
+// readRecord reads an RPC record made of one or more fragments
+func readRecord(r io.Reader) ([]byte, error) {
+	var record []byte
+	var header [4]byte
+	for {
+		_, err := io.ReadFull(r, header[:])
+		if err != nil {
+			return nil, err
+		}
+		h := binary.BigEndian.Uint32(header[:])
+		last := h&0x80000000 != 0
+		n := int(h & 0x7fffffff)
+		if len(record)+n > maxRecordSize {
+			return nil, errors.Errorf("RPC record too big (%d bytes)", len(record)+n)
+		}
+		start := len(record)
+		record = append(record, make([]byte, n)...)
+		_, err = io.ReadFull(r, record[start:])
+		if err != nil {
+			return nil, err
+		}
+		if last {
+			return record, nil
+		}
+	}
+}
+
+// writeRecord writes data as a single fragment RPC record
+func writeRecord(w io.Writer, data []byte) error {
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, 0x80000000|uint32(len(data)))
+	copy(buf[4:], data)
+	_, err := w.Write(buf)
+	return err
+}
+
+// handleConn serves RPC calls on c until it is closed.  Calls are
+// processed concurrently and the replies written as they finish.
+func (s *server) handleConn(c net.Conn) {
+	defer func() {
+		_ = c.Close()
+	}()
+	fs.Debugf(nil, "NFS: connection from %s", c.RemoteAddr())
+	var (
+		writeMu sync.Mutex
+		wg      sync.WaitGroup
+		tokens  = make(chan struct{}, maxConnRequests)
+		r       = bufio.NewReader(c)
+	)
+	for {
+		record, err := readRecord(r)
+		if err != nil {
+			if err != io.EOF {
+				fs.Debugf(nil, "NFS: connection from %s: %v", c.RemoteAddr(), err)
+			}
+			break
+		}
+		tokens <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+			reply := s.handleCall(record)
+			if reply == nil {
+				return
+			}
+			writeMu.Lock()
+			err := writeRecord(c, reply)
+			writeMu.Unlock()
+			if err != nil {
+				fs.Debugf(nil, "NFS: failed to write reply to %s: %v", c.RemoteAddr(), err)
+			}
+		}()
+	}
+	wg.Wait()
+	fs.Debugf(nil, "NFS: connection from %s closed", c.RemoteAddr())
+}
+
+// handleCall decodes the RPC call in record, runs it and returns the
+// reply or nil if there shouldn't be one.
+func (s *server) handleCall(record []byte) []byte {
+	d := newDecoder(record)
+	xid := d.uint32()
+	msgType := d.uint32()
+	if d.err != nil || msgType != rpcCall {
+		return nil
+	}
+	rpcvers := d.uint32()
+	prog := d.uint32()
+	vers := d.uint32()
+	procNum := d.uint32()
+	_ = d.uint32()    // credential flavor - anyone can connect
+	_ = d.opaque(400) // credential body
+	_ = d.uint32()    // verifier flavor
+	_ = d.opaque(400) // verifier body
+
+	reply := &encoder{}
+	reply.uint32(xid)
+	reply.uint32(rpcReply)
+	if d.err == nil && rpcvers != rpcVersion {
+		reply.uint32(msgDenied)
+		reply.uint32(rejectRPCMismatch)
+		reply.uint32(rpcVersion)
+		reply.uint32(rpcVersion)
+		return reply.Bytes()
+	}
+	reply.uint32(msgAccepted)
+	reply.uint32(authNone)
+	reply.uint32(0)
+	if d.err != nil {
+		reply.uint32(acceptGarbageArgs)
+		return reply.Bytes()
+	}
+
+	var p *program
+	switch prog {
+	case progNFS:
+		p = &nfs3Program
+	case progMount:
+		p = &mount3Program
+	default:
+		reply.uint32(acceptProgUnavail)
+		return reply.Bytes()
+	}
+	if vers != p.version {
+		reply.uint32(acceptProgMismatch)
+		reply.uint32(p.version)
+		reply.uint32(p.version)
+		return reply.Bytes()
+	}
+	if procNum >= uint32(len(p.procs)) {
+		reply.uint32(acceptProcUnavail)
+		return reply.Bytes()
+	}
+	pr := &p.procs[procNum]
+	fs.Debugf(nil, "NFS: %s %s", p.name, pr.name)
+	res := &encoder{}
+	pr.fn(s, d, res)
+	if d.err != nil {
+		reply.uint32(acceptGarbageArgs)
+		return reply.Bytes()
+	}
+	reply.uint32(acceptSuccess)
+	_, _ = reply.Write(res.Bytes())
+	return reply.Bytes()
+}
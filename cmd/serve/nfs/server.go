@@ -0,0 +1,148 @@
+package nfs
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/vfs"
+	"github.com/ncw/rclone/vfs/vfsflags"
+	"github.com/pkg/errors"
+)
+
+// server contains everything to run the NFS server
+type server struct {
+	f         fs.Fs
+	opt       Options
+	vfs       *vfs.VFS
+	handles   handleCache
+	files     *openFiles
+	fsid      uint64  // file system id reported in attributes
+	writeVerf [8]byte // changes when the server restarts so clients resend uncommitted writes
+	listener  net.Listener
+	waitChan  chan struct{} // for waiting on the listener to close
+}
+
+// newServer makes a new NFS server serving f
+func newServer(f fs.Fs, opt *Options) (*server, error) {
+	s := &server{
+		f:        f,
+		opt:      *opt,
+		fsid:     fileID(makeHandle(f.Name() + ":" + f.Root())),
+		waitChan: make(chan struct{}),
+	}
+	binary.BigEndian.PutUint64(s.writeVerf[:], uint64(time.Now().UnixNano()))
+
+	// NFS writes arrive at any offset with no open or close so
+	// they need the VFS cache
+	vfsOpt := vfsflags.Opt
+	if !vfsOpt.ReadOnly && vfsOpt.CacheMode < vfs.CacheModeWrites {
+		fs.Logf(f, "NFS needs --vfs-cache-mode writes or above to write files - using --vfs-cache-mode writes")
+		vfsOpt.CacheMode = vfs.CacheModeWrites
+	}
+	s.vfs = vfs.New(f, &vfsOpt)
+
+	switch s.opt.HandleCache {
+	case "memory":
+		s.handles = newMemoryHandles()
+	case "disk":
+		handles, err := newDiskHandles(f)
+		if err != nil {
+			return nil, err
+		}
+		s.handles = handles
+	default:
+		return nil, errors.Errorf("unknown --handle-cache %q - use memory or disk", s.opt.HandleCache)
+	}
+	s.files = newOpenFiles(s.vfs)
+	return s, nil
+}
+
+// Serve starts the server in the background.  Use s.Close() and
+// s.Wait() to shut it down.
+func (s *server) Serve() (err error) {
+	s.listener, err = net.Listen("tcp", s.opt.ListenAddr)
+	if err != nil {
+		return errors.Wrap(err, "failed to listen for connection")
+	}
+	fs.Logf(nil, "NFS server listening on %v", s.listener.Addr())
+	go s.acceptConnections()
+	return nil
+}
+
+// acceptConnections serves connections until the listener is closed
+func (s *server) acceptConnections() {
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.waitChan:
+				return
+			default:
+			}
+			fs.Errorf(nil, "NFS: failed to accept connection: %v", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		go s.handleConn(c)
+	}
+}
+
+// Addr returns the address the server is listening on
+func (s *server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Wait blocks while the listener is open.
+func (s *server) Wait() {
+	<-s.waitChan
+}
+
+// Close shuts the running server down, closing any open files
+func (s *server) Close() {
+	close(s.waitChan)
+	err := s.listener.Close()
+	if err != nil {
+		fs.Errorf(nil, "Error on closing NFS server: %v", err)
+	}
+	s.files.closeAll()
+}
+
+// toHandle returns the file handle for the VFS path p
+func (s *server) toHandle(p string) []byte {
+	handle := makeHandle(p)
+	s.handles.put(handle, p)
+	return handle
+}
+
+// lookupHandle returns the VFS path and node for handle
+func (s *server) lookupHandle(handle []byte) (string, vfs.Node, error) {
+	if len(handle) != handleSize {
+		return "", nil, nfs3ErrBadHandle
+	}
+	p, ok := s.handles.get(handle)
+	if !ok {
+		return "", nil, nfs3ErrStale
+	}
+	node, err := s.vfs.Stat(p)
+	if err == vfs.ENOENT {
+		return "", nil, nfs3ErrStale
+	} else if err != nil {
+		return "", nil, err
+	}
+	return p, node, nil
+}
+
+// lookupDir returns the VFS path and directory for handle
+func (s *server) lookupDir(handle []byte) (string, *vfs.Dir, error) {
+	p, node, err := s.lookupHandle(handle)
+	if err != nil {
+		return "", nil, err
+	}
+	dir, ok := node.(*vfs.Dir)
+	if !ok {
+		return "", nil, nfs3ErrNotDir
+	}
+	return p, dir, nil
+}
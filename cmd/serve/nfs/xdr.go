@@ -0,0 +1,149 @@
+// XDR encoding and decoding as described in RFC 4506
+
+package nfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// errGarbage is returned when the arguments can't be decoded
+var errGarbage = errors.New("can't decode XDR")
+
+// decoder reads XDR values from a buffer.  The first error is
+// remembered in err and all reads after it return zero values.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+// newDecoder makes a decoder reading from buf
+func newDecoder(buf []byte) *decoder {
+	return &decoder{buf: buf}
+}
+
+// next returns the next n bytes or nil if there aren't enough
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.buf) {
+		d.err = errGarbage
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+// uint32 reads an unsigned int
+func (d *decoder) uint32() uint32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+// uint64 reads an unsigned hyper
+func (d *decoder) uint64() uint64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+// bool reads a boolean
+func (d *decoder) bool() bool {
+	return d.uint32() != 0
+}
+
+// fixed reads fixed length opaque data of n bytes
+func (d *decoder) fixed(n int) []byte {
+	b := d.next(n)
+	d.next(pad(n))
+	return b
+}
+
+// opaque reads variable length opaque data of at most max bytes
+func (d *decoder) opaque(max int) []byte {
+	n := d.uint32()
+	if d.err == nil && n > uint32(max) {
+		d.err = errGarbage
+	}
+	return d.fixed(int(n))
+}
+
+// string reads a string of at most max bytes
+func (d *decoder) string(max int) string {
+	return string(d.opaque(max))
+}
+
+// time reads an nfstime3
+func (d *decoder) time() time.Time {
+	seconds := d.uint32()
+	nseconds := d.uint32()
+	return time.Unix(int64(seconds), int64(nseconds))
+}
+
+// encoder writes XDR values to a buffer
+type encoder struct {
+	bytes.Buffer
+}
+
+// uint32 writes an unsigned int
+func (e *encoder) uint32(x uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], x)
+	_, _ = e.Write(b[:])
+}
+
+// uint64 writes an unsigned hyper
+func (e *encoder) uint64(x uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], x)
+	_, _ = e.Write(b[:])
+}
+
+// bool writes a boolean
+func (e *encoder) bool(x bool) {
+	if x {
+		e.uint32(1)
+	} else {
+		e.uint32(0)
+	}
+}
+
+// fixed writes fixed length opaque data
+func (e *encoder) fixed(b []byte) {
+	var zeros [3]byte
+	_, _ = e.Write(b)
+	_, _ = e.Write(zeros[:pad(len(b))])
+}
+
+// opaque writes variable length opaque data
+func (e *encoder) opaque(b []byte) {
+	e.uint32(uint32(len(b)))
+	e.fixed(b)
+}
+
+// string writes a string
+func (e *encoder) string(s string) {
+	e.opaque([]byte(s))
+}
+
+// time writes an nfstime3
+func (e *encoder) time(t time.Time) {
+	e.uint32(uint32(t.Unix()))
+	e.uint32(uint32(t.Nanosecond()))
+}
+
+// pad returns the number of bytes needed to pad n bytes to a multiple
+// of 4
+func pad(n int) int {
+	return (4 - n%4) % 4
+}
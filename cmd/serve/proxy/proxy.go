@@ -0,0 +1,303 @@
+// Package proxy implements a programmable proxy for rclone serve
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config/configmap"
+	"github.com/ncw/rclone/fs/config/obscure"
+	"github.com/ncw/rclone/vfs"
+	"github.com/ncw/rclone/vfs/vfsflags"
+	"github.com/pkg/errors"
+)
+
+// Help contains text describing how to use the proxy
+var Help = strings.Replace(`
+### Auth Proxy
+
+If you supply the parameter |--auth-proxy /path/to/program| then
+rclone will use that program to generate backends on the fly which
+then are used to authenticate incoming requests.  This uses a simple
+JSON based protocol with input on STDIN and output on STDOUT.
+
+There is an example program
+[bin/test_proxy.py](https://github.com/ncw/rclone/blob/master/bin/test_proxy.py)
+in the rclone source code.
+
+The program's job is to take a |user| and |pass| or |public_key| on
+the input and turn those into the config for a backend on STDOUT in
+JSON format.  This config will have any default parameters for the
+backend added, but it won't use configuration from environment
+variables or command line options - it is the job of the proxy
+program to make a complete config.
+
+This config generated must have this extra parameter
+
+- |_root| - root to use for the backend
+
+And it may have this parameter
+
+- |_obscure| - comma separated strings for parameters to obscure
+
+If password authentication was used by the client, input to the proxy
+process (on STDIN) would look similar to this:
+
+|||
+{
+	"user": "me",
+	"pass": "mypassword"
+}
+|||
+
+If public-key authentication was used by the client, input to the
+proxy process (on STDIN) would look similar to this:
+
+|||
+{
+	"user": "me",
+	"public_key": "AAAAB3NzaC1yc2EAAAADAQABAAABAQDuwESFdAe14hVS6omeyX7edc...JQdf"
+}
+|||
+
+And as an example return this on STDOUT
+
+|||
+{
+	"type": "sftp",
+	"_root": "",
+	"_obscure": "pass",
+	"user": "me",
+	"pass": "mypassword",
+	"host": "sftp.example.com"
+}
+|||
+
+This would mean that an SFTP backend would be created on the fly for
+the |user| and |pass|/|public_key| returned in the output to the host
+given.  Note that since |_obscure| is set to |pass|, rclone will
+obscure the |pass| parameter before creating the backend (which is
+required for sftp backends).
+
+The program can manipulate the supplied |user| in any way, for example
+to make proxy to many different sftp backends, you could make the
+|user| be |user@example.com| and then set the |host| to |example.com|
+in the output and the user to |user|.  For security you'd probably
+want to restrict the |host| to a limited list.
+
+Note that an internal cache is keyed on |user| so only use that for
+configuration, don't use |pass| or |public_key|.  This also means that
+if a user's password or public-key is changed the cache will need to
+expire (which takes 5 mins) before it takes effect.
+
+This can be used to build general purpose proxies to any kind of
+backend that rclone supports.
+`, "|", "`", -1)
+
+// Options is options for creating the proxy
+type Options struct {
+	AuthProxy string // program to run to authenticate users
+}
+
+// DefaultOpt is the default values used for Options
+var DefaultOpt = Options{
+	AuthProxy: "",
+}
+
+// cacheExpireDuration is how long an unused entry stays in the cache
+const cacheExpireDuration = 5 * time.Minute
+
+// Proxy represents a proxy to turn auth requests into a VFS
+type Proxy struct {
+	cmdLine []string // broken down command line
+	opt     Options
+
+	mu    sync.Mutex
+	cache map[string]*cacheEntry // VFS cache keyed on user
+}
+
+// cacheEntry is what is stored in the VFS cache
+type cacheEntry struct {
+	vfs      *vfs.VFS          // stored VFS
+	pwHash   [sha256.Size]byte // sha256 of the password or public key
+	lastUsed time.Time         // when this was last used
+}
+
+// New creates a new proxy with the Options passed in
+func New(opt *Options) *Proxy {
+	return &Proxy{
+		opt:     *opt,
+		cmdLine: strings.Fields(opt.AuthProxy),
+		cache:   map[string]*cacheEntry{},
+	}
+}
+
+// run the proxy command returning a config map
+func (p *Proxy) run(in map[string]string) (config configmap.Simple, err error) {
+	if len(p.cmdLine) == 0 {
+		return nil, errors.New("proxy: no --auth-proxy program set")
+	}
+	cmd := exec.Command(p.cmdLine[0], p.cmdLine[1:]...)
+	inBytes, err := json.MarshalIndent(in, "", "\t")
+	if err != nil {
+		return nil, errors.Wrap(err, "proxy: failed to marshal input")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewBuffer(inBytes)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	start := time.Now()
+	err = cmd.Run()
+	fs.Debugf(nil, "Calling proxy %v", p.cmdLine)
+	duration := time.Since(start)
+	if err != nil {
+		return nil, errors.Wrapf(err, "proxy: failed on %v: %q", p.cmdLine, strings.TrimSpace(stderr.String()))
+	}
+	err = json.Unmarshal(stdout.Bytes(), &config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "proxy: failed to read output: %q", stdout.String())
+	}
+	fs.Debugf(nil, "Proxy returned in %v", duration)
+
+	// Obscure any values in the config map that need it
+	obscureFields, ok := config.Get("_obscure")
+	if ok {
+		for _, key := range strings.Split(obscureFields, ",") {
+			value, ok := config.Get(key)
+			if ok {
+				obscuredValue, err := obscure.Obscure(value)
+				if err != nil {
+					return nil, errors.Wrap(err, "proxy")
+				}
+				config.Set(key, obscuredValue)
+			}
+		}
+	}
+
+	return config, nil
+}
+
+// call runs the auth proxy and returns a new VFS made from the
+// config it returns
+func (p *Proxy) call(user, auth string, isPublicKey bool) (*vfs.VFS, error) {
+	in := map[string]string{
+		"user": user,
+	}
+	if isPublicKey {
+		in["public_key"] = auth
+	} else {
+		in["pass"] = auth
+	}
+	config, err := p.run(in)
+	if err != nil {
+		return nil, err
+	}
+
+	// Look for required fields in the answer
+	fsName, ok := config.Get("type")
+	if !ok {
+		return nil, errors.New("proxy: type not set in result")
+	}
+	root, ok := config.Get("_root")
+	if !ok {
+		return nil, errors.New("proxy: _root not set in result")
+	}
+
+	// Find the backend
+	fsInfo, err := fs.Find(fsName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "proxy: couldn't find backend for %q", fsName)
+	}
+
+	// Remove the internal keys from the config
+	for key := range config {
+		if strings.HasPrefix(key, "_") {
+			delete(config, key)
+		}
+	}
+
+	// Fill in the defaults for anything the proxy didn't set.  The
+	// config file, environment and command line aren't read.
+	for i := range fsInfo.Options {
+		o := &fsInfo.Options[i]
+		if _, ok := config.Get(o.Name); !ok && o.Default != nil {
+			config.Set(o.Name, fmt.Sprint(o.Default))
+		}
+	}
+
+	configName := fsName + "-" + user
+	f, err := fsInfo.NewFs(configName, root, config)
+	if err != nil {
+		return nil, errors.Wrap(err, "proxy: failed to make backend")
+	}
+	return vfs.New(f, &vfsflags.Opt), nil
+}
+
+// Call runs the auth proxy with the username and password or public
+// key and returns a *vfs.VFS for the user.  Answers are cached by
+// user for a while so the proxy isn't run on every login.
+func (p *Proxy) Call(user, auth string, isPublicKey bool) (VFS *vfs.VFS, err error) {
+	pwHash := sha256.Sum256([]byte(auth))
+
+	p.mu.Lock()
+	p.expire()
+	entry, ok := p.cache[user]
+	if ok && subtle.ConstantTimeCompare(entry.pwHash[:], pwHash[:]) == 1 {
+		entry.lastUsed = time.Now()
+		p.mu.Unlock()
+		return entry.vfs, nil
+	}
+	p.mu.Unlock()
+
+	// Not in the cache or the password didn't match so run the
+	// proxy which will decide whether the password is OK
+	VFS, err = p.call(user, auth, isPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.cache[user] = &cacheEntry{
+		vfs:      VFS,
+		pwHash:   pwHash,
+		lastUsed: time.Now(),
+	}
+	p.mu.Unlock()
+	return VFS, nil
+}
+
+// Get returns the VFS for user if it has been authenticated by Call
+// or nil if not
+func (p *Proxy) Get(user string) *vfs.VFS {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry, ok := p.cache[user]
+	if !ok {
+		return nil
+	}
+	entry.lastUsed = time.Now()
+	return entry.vfs
+}
+
+// expire removes cache entries which haven't been used recently
+//
+// The VFS isn't shut down as connections may still be using it.
+//
+// Call with the lock held
+func (p *Proxy) expire() {
+	now := time.Now()
+	for user, entry := range p.cache {
+		if now.Sub(entry.lastUsed) > cacheExpireDuration {
+			fs.Debugf(nil, "proxy: expiring cache entry for %q", user)
+			delete(p.cache, user)
+		}
+	}
+}
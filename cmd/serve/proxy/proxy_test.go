@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	_ "github.com/ncw/rclone/backend/local"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestProxy() *Proxy {
+	opt := DefaultOpt
+	opt.AuthProxy = "go run test_proxy.go"
+	return New(&opt)
+}
+
+func TestRun(t *testing.T) {
+	p := newTestProxy()
+
+	config, err := p.run(map[string]string{
+		"user": "potato",
+		"pass": "correct",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "local", config["type"])
+	assert.Equal(t, "potato", config["user"])
+	// pass should have been obscured
+	assert.NotEqual(t, "", config["pass"])
+	assert.NotEqual(t, "correct", config["pass"])
+
+	_, err = p.run(map[string]string{
+		"user": "potato",
+		"pass": "wrong",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bad password")
+
+	p = New(&DefaultOpt)
+	_, err = p.run(map[string]string{"user": "potato"})
+	assert.Error(t, err)
+}
+
+func TestCall(t *testing.T) {
+	p := newTestProxy()
+
+	assert.Nil(t, p.Get("potato"))
+
+	// Wrong password
+	_, err := p.Call("potato", "wrong", false)
+	require.Error(t, err)
+	assert.Nil(t, p.Get("potato"))
+
+	// Right password
+	vfs, err := p.Call("potato", "correct", false)
+	require.NoError(t, err)
+	require.NotNil(t, vfs)
+	assert.Equal(t, "local-potato", vfs.Fs().Name())
+	assert.Equal(t, vfs, p.Get("potato"))
+
+	// Cached
+	vfs2, err := p.Call("potato", "correct", false)
+	require.NoError(t, err)
+	assert.True(t, vfs == vfs2)
+
+	// Wrong password isn't served from the cache
+	_, err = p.Call("potato", "wrong", false)
+	require.Error(t, err)
+
+	// Public key
+	vfs3, err := p.Call("sausage", "valid", true)
+	require.NoError(t, err)
+	assert.False(t, vfs == vfs3)
+	_, err = p.Call("sausage", "invalid", true)
+	require.Error(t, err)
+
+	// Expire
+	p.mu.Lock()
+	p.cache["potato"].lastUsed = time.Now().Add(-2 * cacheExpireDuration)
+	p.expire()
+	p.mu.Unlock()
+	assert.Nil(t, p.Get("potato"))
+	assert.NotNil(t, p.Get("sausage"))
+}
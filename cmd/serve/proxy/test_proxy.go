@@ -0,0 +1,33 @@
+// +build ignore
+
+// A proxy to test the auth proxy which accepts the password
+// "correct" or the public key "valid" and makes a local backend
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+)
+
+func main() {
+	in := make(map[string]string)
+	err := json.NewDecoder(os.Stdin).Decode(&in)
+	if err != nil {
+		log.Fatalf("failed to read input: %v", err)
+	}
+	if in["pass"] != "correct" && in["public_key"] != "valid" {
+		log.Fatalf("bad password or public key for %q", in["user"])
+	}
+	out := map[string]string{
+		"type":     "local",
+		"_root":    "",
+		"_obscure": "pass",
+		"user":     in["user"],
+		"pass":     in["pass"],
+	}
+	err = json.NewEncoder(os.Stdout).Encode(out)
+	if err != nil {
+		log.Fatalf("failed to write output: %v", err)
+	}
+}
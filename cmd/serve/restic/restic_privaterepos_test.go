@@ -0,0 +1,223 @@
+// +build go1.9
+
+package restic
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/cmd/serve/httplib/httpflags"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newUserRequest returns a new HTTP request for user
+func newUserRequest(t testing.TB, user, method, path string, body string) *http.Request {
+	req := newRequest(t, method, path, strings.NewReader(body))
+	if user != "" {
+		req.SetBasicAuth(user, "password")
+	}
+	return req
+}
+
+func TestSplitRepo(t *testing.T) {
+	for _, test := range []struct {
+		in       string
+		repo     string
+		fileType string
+	}{
+		{"/", "/", ""},
+		{"/config", "/", "config"},
+		{"/data/", "/", "data"},
+		{"/data/0123", "/", "data"},
+		{"/repo/", "/repo", ""},
+		{"/user/repo/config", "/user/repo", "config"},
+		{"/user/repo/keys/", "/user/repo", "keys"},
+		{"/user/repo/locks/0123", "/user/repo", "locks"},
+		{"/user/repo/snapshots/0123", "/user/repo", "snapshots"},
+	} {
+		repo, fileType := splitRepo(test.in)
+		assert.Equal(t, test.repo, repo, test.in)
+		assert.Equal(t, test.fileType, fileType, test.in)
+	}
+}
+
+// TestPrivateRepos checks users can only use their own repositories
+func TestPrivateRepos(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "rclone-restic-test-")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempdir))
+	}()
+
+	prev := privateRepos
+	privateRepos = true
+	defer func() {
+		privateRepos = prev
+	}()
+
+	f := cmd.NewFsSrc([]string{tempdir})
+	srv := newServer(f, &httpflags.Opt)
+
+	for _, test := range []struct {
+		user   string
+		method string
+		path   string
+		want   int
+	}{
+		{"", "POST", "/alice/repo/?create=true", http.StatusUnauthorized},
+		{"bob", "POST", "/alice/repo/?create=true", http.StatusUnauthorized},
+		{"bob", "POST", "/alicebob/?create=true", http.StatusUnauthorized},
+		{"alice", "POST", "/?create=true", http.StatusUnauthorized},
+		{"alice", "POST", "/alice/repo/?create=true", http.StatusOK},
+		{"alice", "POST", "/alice/repo/config", http.StatusOK},
+		{"alice", "GET", "/alice/repo/config", http.StatusOK},
+		{"bob", "GET", "/alice/repo/config", http.StatusUnauthorized},
+		{"bob", "DELETE", "/alice/repo/config", http.StatusUnauthorized},
+		{"bob", "POST", "/bob/?create=true", http.StatusOK},
+		{"bob", "POST", "/bob/config", http.StatusOK},
+	} {
+		checkRequest(t, srv.handler,
+			newUserRequest(t, test.user, test.method, test.path, "config"),
+			[]wantFunc{wantCode(test.want)})
+	}
+	_, err = os.Stat(filepath.Join(tempdir, "alice", "repo", "config"))
+	assert.NoError(t, err)
+}
+
+// getRepos reads the repository list as user
+func getRepos(t *testing.T, srv *server, user string) (repos []repoInfo) {
+	rr := httptest.NewRecorder()
+	srv.handler(rr, newUserRequest(t, user, "GET", adminReposPath, ""))
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &repos))
+	return repos
+}
+
+// TestAdminRepos checks the listing of the repositories
+func TestAdminRepos(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "rclone-restic-test-")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempdir))
+	}()
+
+	f := cmd.NewFsSrc([]string{tempdir})
+	srv := newServer(f, &httpflags.Opt)
+
+	for _, req := range []struct {
+		user string
+		path string
+		body string
+	}{
+		{"alice", "/alice/repo/config", "12345"},
+		{"alice", "/alice/repo/data/0123456789", "0123456789"},
+		{"alice", "/alice/repo/snapshots/0123", "123"},
+		{"alice", "/alice/repo/locks/0123", "lock"},
+		{"bob", "/bob/config", "1"},
+		{"bob", "/bob/notrepo/file", "this isn't in a repo"},
+	} {
+		checkRequest(t, srv.handler,
+			newUserRequest(t, req.user, "POST", req.path, req.body),
+			[]wantFunc{wantCode(http.StatusOK)})
+	}
+
+	alice := repoInfo{Name: "/alice/repo", Size: 22, Files: 4, Snapshots: 1, Locks: 1}
+	bob := repoInfo{Name: "/bob", Size: 21, Files: 2}
+	assert.Equal(t, []repoInfo{alice, bob}, getRepos(t, srv, "alice"))
+
+	// with private repos users only see their own unless admin
+	prevPrivate, prevAdmin := privateRepos, adminUser
+	privateRepos, adminUser = true, "admin"
+	defer func() {
+		privateRepos, adminUser = prevPrivate, prevAdmin
+	}()
+	assert.Equal(t, []repoInfo{alice}, getRepos(t, srv, "alice"))
+	assert.Equal(t, []repoInfo{bob}, getRepos(t, srv, "bob"))
+	assert.Equal(t, []repoInfo{}, getRepos(t, srv, "carol"))
+	assert.Equal(t, []repoInfo{alice, bob}, getRepos(t, srv, "admin"))
+
+	checkRequest(t, srv.handler,
+		newUserRequest(t, "admin", "DELETE", adminReposPath, ""),
+		[]wantFunc{wantCode(http.StatusMethodNotAllowed)})
+}
+
+// counterValue reads the current value of a counter
+func counterValue(t *testing.T, c interface {
+	Write(*dto.Metric) error
+}) float64 {
+	var m dto.Metric
+	require.NoError(t, c.Write(&m))
+	return m.GetCounter().GetValue()
+}
+
+// TestMetricsAndStaleLocks checks the metrics are updated and stale
+// locks are removed
+func TestMetricsAndStaleLocks(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "rclone-restic-test-")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, os.RemoveAll(tempdir))
+	}()
+
+	f := cmd.NewFsSrc([]string{tempdir})
+	srv := newServer(f, &httpflags.Opt)
+
+	written := promBytesWritten.WithLabelValues("/metrics", "data")
+	read := promBytesRead.WithLabelValues("/metrics", "data")
+	deleted := promFilesDeleted.WithLabelValues("/metrics", "keys")
+	stale := promStaleLocks.WithLabelValues("/metrics")
+	startWritten, startRead, startDeleted, startStale := counterValue(t, written), counterValue(t, read), counterValue(t, deleted), counterValue(t, stale)
+
+	for _, seq := range []TestRequest{
+		{newRequest(t, "POST", "/metrics/data/0123456789", strings.NewReader("0123456789")), []wantFunc{wantCode(http.StatusOK)}},
+		{newRequest(t, "GET", "/metrics/data/0123456789", nil), []wantFunc{wantCode(http.StatusOK)}},
+		{newRequest(t, "HEAD", "/metrics/data/0123456789", nil), []wantFunc{wantCode(http.StatusOK)}},
+		{newRequest(t, "POST", "/metrics/keys/0123", strings.NewReader("key")), []wantFunc{wantCode(http.StatusOK)}},
+		{newRequest(t, "DELETE", "/metrics/keys/0123", nil), []wantFunc{wantCode(http.StatusOK)}},
+		{newRequest(t, "POST", "/metrics/locks/old", strings.NewReader("old")), []wantFunc{wantCode(http.StatusOK)}},
+		{newRequest(t, "POST", "/metrics/locks/new", strings.NewReader("new")), []wantFunc{wantCode(http.StatusOK)}},
+	} {
+		checkRequest(t, srv.handler, seq.req, seq.want)
+	}
+
+	assert.Equal(t, 10.0, counterValue(t, written)-startWritten)
+	assert.Equal(t, 10.0, counterValue(t, read)-startRead)
+	assert.Equal(t, 1.0, counterValue(t, deleted)-startDeleted)
+
+	// make one of the locks old
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(tempdir, "metrics", "locks", "old"), old, old))
+
+	listLocks := func() (ls listItems) {
+		req := newRequest(t, "GET", "/metrics/locks/", nil)
+		req.Header.Set("Accept", resticAPIV2)
+		rr := httptest.NewRecorder()
+		srv.handler(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &ls))
+		return ls
+	}
+
+	// without --stale-lock-age nothing is removed
+	assert.ElementsMatch(t, listItems{{Name: "new", Size: 3}, {Name: "old", Size: 3}}, listLocks())
+
+	prev := staleLockAge
+	staleLockAge = time.Hour
+	defer func() {
+		staleLockAge = prev
+	}()
+	assert.Equal(t, listItems{{Name: "new", Size: 3}}, listLocks())
+	assert.Equal(t, 1.0, counterValue(t, stale)-startStale)
+	_, err = os.Stat(filepath.Join(tempdir, "metrics", "locks", "old"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,218 @@
+// +build go1.9
+
+package restic
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/fserrors"
+	"github.com/ncw/rclone/fs/walk"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// adminReposPath is where the list of repositories is served
+const adminReposPath = "/_admin/repos"
+
+// Prometheus metrics for each repository.  These are served by
+// --metrics-addr along with the rest of rclone's metrics.
+var (
+	promBytesWritten = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rclone_restic_written_bytes_total",
+		Help: "Number of bytes written to the repository",
+	}, []string{"repo", "type"})
+	promBytesRead = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rclone_restic_read_bytes_total",
+		Help: "Number of bytes read from the repository",
+	}, []string{"repo", "type"})
+	promFilesWritten = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rclone_restic_written_files_total",
+		Help: "Number of files written to the repository",
+	}, []string{"repo", "type"})
+	promFilesRead = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rclone_restic_read_files_total",
+		Help: "Number of files read from the repository",
+	}, []string{"repo", "type"})
+	promFilesDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rclone_restic_deleted_files_total",
+		Help: "Number of files deleted from the repository",
+	}, []string{"repo", "type"})
+	promStaleLocks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rclone_restic_stale_locks_removed_total",
+		Help: "Number of stale lock files removed from the repository",
+	}, []string{"repo"})
+	promErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rclone_restic_errors_total",
+		Help: "Number of requests to the repository which failed with a server error",
+	}, []string{"repo"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		promBytesWritten,
+		promBytesRead,
+		promFilesWritten,
+		promFilesRead,
+		promFilesDeleted,
+		promStaleLocks,
+		promErrors,
+	)
+}
+
+// isFileType returns true if name is one of the types of file or
+// directory restic keeps at the root of a repository
+func isFileType(name string) bool {
+	switch name {
+	case "config", "data", "index", "keys", "locks", "snapshots":
+		return true
+	}
+	return false
+}
+
+// splitRepo splits a URL path into the repository it refers to and
+// the type of file within it, eg "/user/repo/data/0123" returns
+// "/user/repo" and "data".  The type is "" for the repository itself.
+func splitRepo(urlPath string) (repo, fileType string) {
+	p := strings.Trim(urlPath, "/")
+	var parts []string
+	if p != "" {
+		parts = strings.Split(p, "/")
+	}
+	for i := len(parts) - 1; i >= 0 && i >= len(parts)-2; i-- {
+		if isFileType(parts[i]) {
+			return "/" + strings.Join(parts[:i], "/"), parts[i]
+		}
+	}
+	return "/" + p, ""
+}
+
+// countingWriter is an http.ResponseWriter which counts the bytes
+// written and the status
+type countingWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+// WriteHeader records the status
+func (w *countingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write counts the bytes written
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// repoInfo is an element of the list of repositories returned by the
+// admin endpoint
+type repoInfo struct {
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	Files     int64  `json:"files"`
+	Snapshots int64  `json:"snapshots"`
+	Locks     int64  `json:"locks"`
+}
+
+// listRepos finds the repositories under dir - a repository is any
+// directory with a config file in.
+func (s *server) listRepos(dir string) ([]*repoInfo, error) {
+	var objects []fs.Object
+	err := walk.ListR(s.f, dir, true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			if o, ok := entry.(fs.Object); ok {
+				objects = append(objects, o)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if _, cause := fserrors.Cause(err); cause != fs.ErrorDirNotFound {
+			return nil, err
+		}
+	}
+	repos := map[string]*repoInfo{}
+	for _, o := range objects {
+		if path.Base(o.Remote()) == "config" {
+			repoDir := path.Dir(o.Remote())
+			repos[repoDir] = &repoInfo{Name: path.Clean("/" + repoDir)}
+		}
+	}
+	for _, o := range objects {
+		// find the innermost repository the object is in
+		dir := path.Dir(o.Remote())
+		for {
+			repo := repos[dir]
+			if repo != nil {
+				repo.Size += o.Size()
+				repo.Files++
+				switch path.Base(path.Dir(o.Remote())) {
+				case "snapshots":
+					repo.Snapshots++
+				case "locks":
+					repo.Locks++
+				}
+				break
+			}
+			if dir == "." || dir == "/" || dir == "" {
+				break
+			}
+			dir = path.Dir(dir)
+		}
+	}
+	list := make([]*repoInfo, 0, len(repos))
+	for _, repo := range repos {
+		list = append(list, repo)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
+
+// adminRepos serves the list of repositories with their sizes.
+//
+// If --private-repos is set then users only see their own
+// repositories unless they are the --admin-user.
+func (s *server) adminRepos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	dir := ""
+	if privateRepos {
+		user, _, _ := r.BasicAuth()
+		if user != adminUser || adminUser == "" {
+			dir = user
+		}
+	}
+	repos, err := s.listRepos(dir)
+	if err != nil {
+		fs.Errorf(dir, "Failed to list repositories: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(repos)
+	if err != nil {
+		fs.Errorf(dir, "Failed to write repository list: %v", err)
+	}
+}
+
+// isStaleLock returns true if the entry is a lock file which is older
+// than --stale-lock-age
+func isStaleLock(entry fs.DirEntry, now time.Time) bool {
+	o, ok := entry.(fs.Object)
+	if !ok || staleLockAge <= 0 {
+		return false
+	}
+	return now.Sub(o.ModTime()) > staleLockAge
+}
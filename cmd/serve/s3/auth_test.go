@@ -0,0 +1,143 @@
+package s3
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+// newTestSigner makes a signer which signs like the S3 client does
+func newTestSigner(secret string) *v4.Signer {
+	return v4.NewSigner(credentials.NewStaticCredentials(testAccessKey, secret, ""), func(s *v4.Signer) {
+		s.DisableURIPathEscaping = true
+	})
+}
+
+func TestAuthenticate(t *testing.T) {
+	s := &server{
+		keys: map[string]string{testAccessKey: testSecretKey},
+	}
+	now := time.Now()
+	const body = "potato"
+	// The path is escaped as the S3 client would
+	const target = "/bucket/dir/a%20b%2Bc%24.txt?uploadId=1&partNumber=2"
+
+	for _, test := range []struct {
+		name     string
+		sign     func(r *http.Request) error
+		tamper   bool
+		wantAuth error
+		wantRead error
+	}{{
+		name: "Header",
+		sign: func(r *http.Request) error {
+			_, err := newTestSigner(testSecretKey).Sign(r, bytes.NewReader([]byte(body)), "s3", "us-east-1", now)
+			return err
+		},
+	}, {
+		name: "HeaderTamperedBody",
+		sign: func(r *http.Request) error {
+			_, err := newTestSigner(testSecretKey).Sign(r, bytes.NewReader([]byte(body)), "s3", "us-east-1", now)
+			return err
+		},
+		tamper:   true,
+		wantRead: errContentSHA256Mismatch,
+	}, {
+		name: "Presigned",
+		sign: func(r *http.Request) error {
+			_, err := newTestSigner(testSecretKey).Presign(r, nil, "s3", "us-east-1", time.Hour, now)
+			return err
+		},
+		tamper: true,
+	}, {
+		name: "PresignedExpired",
+		sign: func(r *http.Request) error {
+			_, err := newTestSigner(testSecretKey).Presign(r, nil, "s3", "us-east-1", time.Hour, now.Add(-2*time.Hour))
+			return err
+		},
+		wantAuth: errExpiredToken,
+	}, {
+		name: "BadSecret",
+		sign: func(r *http.Request) error {
+			_, err := newTestSigner("potato").Sign(r, bytes.NewReader([]byte(body)), "s3", "us-east-1", now)
+			return err
+		},
+		wantAuth: errSignatureDoesNotMatch,
+	}, {
+		name: "BadAccessKey",
+		sign: func(r *http.Request) error {
+			signer := v4.NewSigner(credentials.NewStaticCredentials("potato", testSecretKey, ""))
+			_, err := signer.Sign(r, bytes.NewReader([]byte(body)), "s3", "us-east-1", now)
+			return err
+		},
+		wantAuth: errInvalidAccessKeyID,
+	}, {
+		name: "Skewed",
+		sign: func(r *http.Request) error {
+			_, err := newTestSigner(testSecretKey).Sign(r, bytes.NewReader([]byte(body)), "s3", "us-east-1", now.Add(-time.Hour))
+			return err
+		},
+		wantAuth: errRequestTimeTooSkewed,
+	}, {
+		name: "Unsigned",
+		sign: func(r *http.Request) error {
+			return nil
+		},
+		wantAuth: errMissingAuth,
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("PUT", target, bytes.NewReader([]byte(body)))
+			require.NoError(t, test.sign(r))
+			if test.tamper {
+				r.Body = ioutil.NopCloser(bytes.NewReader([]byte("carrot")))
+			}
+			err := s.authenticate(r)
+			assert.Equal(t, test.wantAuth, err)
+			if err != nil {
+				return
+			}
+			data, err := ioutil.ReadAll(r.Body)
+			assert.Equal(t, test.wantRead, err)
+			if test.wantRead == nil {
+				assert.Len(t, data, len(body))
+			}
+		})
+	}
+}
+
+func TestAuthenticateNoKeys(t *testing.T) {
+	s := &server{}
+	r := httptest.NewRequest("GET", "/", nil)
+	assert.NoError(t, s.authenticate(r))
+}
+
+func TestCheckContentMD5(t *testing.T) {
+	r := httptest.NewRequest("PUT", "/bucket/key", bytes.NewReader([]byte("potato")))
+	r.Header.Set("Content-MD5", "potato")
+	assert.Equal(t, errInvalidDigest, checkContentMD5(r))
+
+	// MD5 of "potato"
+	r.Header.Set("Content-MD5", "juICeYORXseKzEUCfYdDFg==")
+	require.NoError(t, checkContentMD5(r))
+	_, err := ioutil.ReadAll(r.Body)
+	assert.NoError(t, err)
+
+	r = httptest.NewRequest("PUT", "/bucket/key", bytes.NewReader([]byte("carrot")))
+	r.Header.Set("Content-MD5", "juICeYORXseKzEUCfYdDFg==")
+	require.NoError(t, checkContentMD5(r))
+	_, err = ioutil.ReadAll(r.Body)
+	assert.Equal(t, errBadDigest, err)
+}
@@ -0,0 +1,261 @@
+package s3
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ncw/rclone/vfs"
+)
+
+// maxKeys is the default and maximum number of keys returned in a
+// single listing
+const maxKeys = 1000
+
+// listEntry is an object or common prefix found while listing
+type listEntry struct {
+	key    string   // the key or the common prefix
+	node   vfs.Node // the node for objects
+	prefix bool     // set if this is a common prefix
+}
+
+// commonPrefix is a common prefix in a listing
+type commonPrefix struct {
+	Prefix string
+}
+
+// listObject is an object in a listing
+type listObject struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	Owner        *owner `xml:",omitempty"`
+	StorageClass string
+}
+
+// listBucketResult is the response to ListObjects
+type listBucketResult struct {
+	XMLName        xml.Name `xml:"ListBucketResult"`
+	Xmlns          string   `xml:"xmlns,attr"`
+	Name           string
+	Prefix         string
+	Marker         string
+	NextMarker     string `xml:",omitempty"`
+	MaxKeys        int
+	Delimiter      string `xml:",omitempty"`
+	IsTruncated    bool
+	Contents       []listObject
+	CommonPrefixes []commonPrefix
+}
+
+// listBucketResultV2 is the response to ListObjectsV2
+type listBucketResultV2 struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Xmlns                 string   `xml:"xmlns,attr"`
+	Name                  string
+	Prefix                string
+	StartAfter            string `xml:",omitempty"`
+	ContinuationToken     string `xml:",omitempty"`
+	NextContinuationToken string `xml:",omitempty"`
+	KeyCount              int
+	MaxKeys               int
+	Delimiter             string `xml:",omitempty"`
+	IsTruncated           bool
+	Contents              []listObject
+	CommonPrefixes        []commonPrefix
+}
+
+// lister lists the objects in a bucket
+type lister struct {
+	prefix    string      // only list keys with this prefix
+	delimiter string      // group keys up to the delimiter into common prefixes
+	after     string      // only list entries after this
+	entries   []listEntry // entries found
+	prefixes  map[string]struct{}
+}
+
+// add the file at key to the listing
+func (l *lister) add(key string, node vfs.Node) {
+	if !strings.HasPrefix(key, l.prefix) {
+		return
+	}
+	if l.delimiter != "" {
+		if i := strings.Index(key[len(l.prefix):], l.delimiter); i >= 0 {
+			common := key[:len(l.prefix)+i+len(l.delimiter)]
+			if _, found := l.prefixes[common]; !found && common > l.after {
+				l.prefixes[common] = struct{}{}
+				l.entries = append(l.entries, listEntry{key: common, prefix: true})
+			}
+			return
+		}
+	}
+	if key > l.after {
+		l.entries = append(l.entries, listEntry{key: key, node: node})
+	}
+}
+
+// walk dir, whose keys start with dirKey, adding the files found
+func (l *lister) walk(dir *vfs.Dir, dirKey string) error {
+	nodes, err := dir.ReadDirAll()
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		key := dirKey + node.Name()
+		if !node.IsDir() {
+			l.add(key, node)
+			continue
+		}
+		key += "/"
+		// Only descend into directories which could contain keys
+		// with the prefix
+		if !strings.HasPrefix(key, l.prefix) && !strings.HasPrefix(l.prefix, key) {
+			continue
+		}
+		// Everything in this directory sorts before l.after
+		if key < l.after && !strings.HasPrefix(l.after, key) {
+			continue
+		}
+		// With a / delimiter the directory is a common prefix
+		// so there is no need to read it
+		if l.delimiter == "/" && strings.HasPrefix(key, l.prefix) {
+			l.add(key, node)
+			continue
+		}
+		err = l.walk(node.(*vfs.Dir), key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listObjects lists the objects in the bucket, implementing both
+// ListObjects and ListObjectsV2
+func (s *server) listObjects(w http.ResponseWriter, r *http.Request, bucket string) error {
+	dir, err := s.bucketDir(bucket)
+	if err != nil {
+		return err
+	}
+	q := r.URL.Query()
+	v2 := q.Get("list-type") == "2"
+	max := maxKeys
+	if value := q.Get("max-keys"); value != "" {
+		max, err = strconv.Atoi(value)
+		if err != nil || max < 0 {
+			return newError(http.StatusBadRequest, "InvalidArgument", "max-keys must be an integer from 0 to 2147483647")
+		}
+		if max > maxKeys {
+			max = maxKeys
+		}
+	}
+	l := lister{
+		prefix:    q.Get("prefix"),
+		delimiter: q.Get("delimiter"),
+		prefixes:  map[string]struct{}{},
+	}
+	var continuationToken string
+	if v2 {
+		continuationToken = q.Get("continuation-token")
+		if continuationToken != "" {
+			after, err := base64.URLEncoding.DecodeString(continuationToken)
+			if err != nil {
+				return newError(http.StatusBadRequest, "InvalidArgument", "The continuation token provided is incorrect")
+			}
+			l.after = string(after)
+		} else {
+			l.after = q.Get("start-after")
+		}
+	} else {
+		l.after = q.Get("marker")
+	}
+
+	// Start the walk at the deepest directory the prefix names
+	dirKey := ""
+	if i := strings.LastIndex(l.prefix, "/"); i >= 0 {
+		dirKey = l.prefix[:i+1]
+		node, err := s.vfs.Stat(path.Join(bucket, dirKey))
+		if err == vfs.ENOENT || (err == nil && !node.IsDir()) {
+			dir = nil
+		} else if err != nil {
+			return err
+		} else {
+			dir = node.(*vfs.Dir)
+		}
+	}
+	if dir != nil {
+		err = l.walk(dir, dirKey)
+		if err != nil {
+			return err
+		}
+	}
+	sort.Slice(l.entries, func(i, j int) bool {
+		return l.entries[i].key < l.entries[j].key
+	})
+	entries := l.entries
+	truncated := len(entries) > max
+	if truncated {
+		entries = entries[:max]
+	}
+	contents := []listObject{}
+	commonPrefixes := []commonPrefix{}
+	for _, entry := range entries {
+		if entry.prefix {
+			commonPrefixes = append(commonPrefixes, commonPrefix{Prefix: entry.key})
+			continue
+		}
+		object := listObject{
+			Key:          entry.key,
+			LastModified: formatTime(entry.node.ModTime()),
+			ETag:         s.objectETag(entry.node),
+			Size:         entry.node.Size(),
+			StorageClass: "STANDARD",
+		}
+		if !v2 || q.Get("fetch-owner") == "true" {
+			object.Owner = &rcloneOwner
+		}
+		contents = append(contents, object)
+	}
+	var next string
+	if truncated && len(entries) > 0 {
+		next = entries[len(entries)-1].key
+	}
+	if v2 {
+		out := listBucketResultV2{
+			Xmlns:             xmlNamespace,
+			Name:              bucket,
+			Prefix:            l.prefix,
+			StartAfter:        q.Get("start-after"),
+			ContinuationToken: continuationToken,
+			KeyCount:          len(entries),
+			MaxKeys:           max,
+			Delimiter:         l.delimiter,
+			IsTruncated:       truncated,
+			Contents:          contents,
+			CommonPrefixes:    commonPrefixes,
+		}
+		if next != "" {
+			out.NextContinuationToken = base64.URLEncoding.EncodeToString([]byte(next))
+		}
+		writeXML(w, http.StatusOK, &out)
+		return nil
+	}
+	writeXML(w, http.StatusOK, &listBucketResult{
+		Xmlns:          xmlNamespace,
+		Name:           bucket,
+		Prefix:         l.prefix,
+		Marker:         l.after,
+		NextMarker:     next,
+		MaxKeys:        max,
+		Delimiter:      l.delimiter,
+		IsTruncated:    truncated,
+		Contents:       contents,
+		CommonPrefixes: commonPrefixes,
+	})
+	return nil
+}
@@ -0,0 +1,604 @@
+// Multipart uploads
+
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config"
+	"github.com/ncw/rclone/vfs"
+	"github.com/pkg/errors"
+)
+
+const (
+	// parts must be numbered from 1 to maxPartNumber
+	maxPartNumber = 10000
+	// all parts apart from the last must be at least this big
+	minPartSize = 5 * 1024 * 1024
+)
+
+// part is a part of a multipart upload which has been received
+type part struct {
+	size int64
+	etag string // hex MD5 of the part
+}
+
+// upload is a multipart upload in progress
+type upload struct {
+	bucket  string
+	key     string
+	dir     string    // directory the parts are stored in
+	modTime time.Time // modification time to set or zero
+
+	mu       sync.Mutex
+	parts    map[int]part
+	lastUsed time.Time // when the upload was started or last had a part stored
+	locked   bool      // set while the parts are being joined or removed
+}
+
+// partPath returns the path the part is stored at
+func (u *upload) partPath(partNumber int) string {
+	return filepath.Join(u.dir, strconv.Itoa(partNumber))
+}
+
+// uploads holds the multipart uploads in progress and the objects
+// being received.
+//
+// These are stored outside the VFS cache as they aren't files in the
+// VFS until they are complete - storing them in the VFS would upload
+// them to the remote.  Instead the space they use counts against
+// --vfs-cache-max-size and incomplete multipart uploads which haven't
+// been used for --vfs-cache-max-age are discarded.
+type uploads struct {
+	dir          string             // temporary directory to store the parts
+	maxSize      int64              // max bytes to store or -1 for no limit
+	maxAge       time.Duration      // discard uploads unused for this long
+	pollInterval time.Duration      // how often to look for unused uploads
+	cancel       context.CancelFunc // stop the cleaner
+	wg           sync.WaitGroup     // wait for the cleaner to stop
+
+	mu      sync.Mutex
+	uploads map[string]*upload
+	used    int64 // bytes stored in dir
+}
+
+// newUploads makes a new uploads storing the parts in a temporary
+// directory in the cache directory limited by the cache options in
+// opt
+func newUploads(opt *vfs.Options) (*uploads, error) {
+	cacheDir := filepath.Join(config.CacheDir, "serve-s3")
+	err := os.MkdirAll(cacheDir, 0700)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cache directory")
+	}
+	dir, err := ioutil.TempDir(cacheDir, "uploads-")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create multipart upload directory")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	us := &uploads{
+		dir:          dir,
+		maxSize:      int64(opt.CacheMaxSize),
+		maxAge:       opt.CacheMaxAge,
+		pollInterval: opt.CachePollInterval,
+		cancel:       cancel,
+		uploads:      map[string]*upload{},
+	}
+	us.wg.Add(1)
+	go us.cleaner(ctx)
+	return us, nil
+}
+
+// cleaner discards unused uploads every pollInterval until ctx is
+// cancelled
+func (us *uploads) cleaner(ctx context.Context) {
+	defer us.wg.Done()
+	if us.pollInterval <= 0 {
+		return
+	}
+	timer := time.NewTicker(us.pollInterval)
+	defer timer.Stop()
+	for {
+		select {
+		case now := <-timer.C:
+			us.expire(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// expire discards the uploads which haven't been used for longer
+// than maxAge at now
+func (us *uploads) expire(now time.Time) {
+	var expired []*upload
+	us.mu.Lock()
+	for uploadID, u := range us.uploads {
+		u.mu.Lock()
+		if now.Sub(u.lastUsed) > us.maxAge {
+			delete(us.uploads, uploadID)
+			expired = append(expired, u)
+		}
+		u.mu.Unlock()
+	}
+	us.mu.Unlock()
+	for _, u := range expired {
+		fs.Infof(objectPath(u.bucket, u.key), "Discarding multipart upload unused for more than %v", us.maxAge)
+		us.remove(u)
+	}
+}
+
+// reserve n bytes of space for storing uploads returning
+// errCacheFull if there isn't room
+func (us *uploads) reserve(n int64) error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	if us.maxSize >= 0 && us.used+n > us.maxSize {
+		return errCacheFull
+	}
+	us.used += n
+	return nil
+}
+
+// release n bytes of space reserved with reserve
+func (us *uploads) release(n int64) {
+	us.mu.Lock()
+	us.used -= n
+	us.mu.Unlock()
+}
+
+// quotaWriter writes to out reserving the space used in us
+type quotaWriter struct {
+	us  *uploads
+	out io.Writer
+}
+
+// Write p to out if there is room for it
+func (w quotaWriter) Write(p []byte) (n int, err error) {
+	err = w.us.reserve(int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	n, err = w.out.Write(p)
+	if n < len(p) {
+		w.us.release(int64(len(p) - n))
+	}
+	return n, err
+}
+
+// newUpload starts a new upload returning its ID
+func (us *uploads) newUpload(bucket, key string, modTime time.Time) (string, error) {
+	var id [16]byte
+	_, err := io.ReadFull(rand.Reader, id[:])
+	if err != nil {
+		return "", errors.Wrap(err, "failed to make upload ID")
+	}
+	uploadID := hex.EncodeToString(id[:])
+	u := &upload{
+		bucket:   bucket,
+		key:      key,
+		dir:      filepath.Join(us.dir, uploadID),
+		modTime:  modTime,
+		parts:    map[int]part{},
+		lastUsed: time.Now(),
+	}
+	err = os.Mkdir(u.dir, 0700)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create upload directory")
+	}
+	us.mu.Lock()
+	us.uploads[uploadID] = u
+	us.mu.Unlock()
+	return uploadID, nil
+}
+
+// get the upload with uploadID for key in bucket, removing it if
+// remove is set
+func (us *uploads) get(uploadID, bucket, key string, remove bool) (*upload, error) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	u, ok := us.uploads[uploadID]
+	if !ok || u.bucket != bucket || u.key != key {
+		return nil, errNoSuchUpload
+	}
+	if remove {
+		delete(us.uploads, uploadID)
+	}
+	return u, nil
+}
+
+// put u back as uploadID so it can be used again after it was
+// taken by get
+func (us *uploads) put(uploadID string, u *upload) {
+	u.mu.Lock()
+	u.locked = false
+	u.lastUsed = time.Now()
+	u.mu.Unlock()
+	us.mu.Lock()
+	us.uploads[uploadID] = u
+	us.mu.Unlock()
+}
+
+// remove the parts of u
+func (us *uploads) remove(u *upload) {
+	u.mu.Lock()
+	u.locked = true
+	var size int64
+	for _, p := range u.parts {
+		size += p.size
+	}
+	u.parts = map[int]part{}
+	u.mu.Unlock()
+	us.release(size)
+	err := os.RemoveAll(u.dir)
+	if err != nil {
+		fs.Errorf(nil, "Failed to remove multipart upload directory: %v", err)
+	}
+}
+
+// close discards all the uploads in progress
+func (us *uploads) close() {
+	us.cancel()
+	us.wg.Wait()
+	us.mu.Lock()
+	us.uploads = map[string]*upload{}
+	us.mu.Unlock()
+	err := os.RemoveAll(us.dir)
+	if err != nil {
+		fs.Errorf(nil, "Failed to remove multipart upload directory: %v", err)
+	}
+}
+
+// spool copies in to a temporary file returning it rewound to the
+// start.  Use discard to remove it when finished.
+func (us *uploads) spool(in io.Reader) (*os.File, error) {
+	f, err := ioutil.TempFile(us.dir, "put-")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create temporary file")
+	}
+	_, err = io.Copy(quotaWriter{us: us, out: f}, in)
+	if err != nil {
+		us.discard(f)
+		return nil, err
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		us.discard(f)
+		return nil, errors.Wrap(err, "failed to rewind temporary file")
+	}
+	return f, nil
+}
+
+// discard closes and removes a file made by spool
+func (us *uploads) discard(f *os.File) {
+	if fi, err := f.Stat(); err == nil {
+		us.release(fi.Size())
+	}
+	_ = f.Close()
+	err := os.Remove(f.Name())
+	if err != nil {
+		fs.Errorf(nil, "Failed to remove temporary file: %v", err)
+	}
+}
+
+// initiateMultipartUploadResult is the response to CreateMultipartUpload
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string
+	Key      string
+	UploadID string `xml:"UploadId"`
+}
+
+// createMultipartUpload starts a multipart upload
+func (s *server) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	_, err := s.bucketDir(bucket)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(key, "/") {
+		return newError(http.StatusBadRequest, "InvalidRequest", "Objects ending in / can't contain data.")
+	}
+	uploadID, err := s.uploads.newUpload(bucket, key, requestModTime(r))
+	if err != nil {
+		return err
+	}
+	fs.Debugf(objectPath(bucket, key), "Started multipart upload %s", uploadID)
+	writeXML(w, http.StatusOK, &initiateMultipartUploadResult{
+		Xmlns:    xmlNamespace,
+		Bucket:   bucket,
+		Key:      key,
+		UploadID: uploadID,
+	})
+	return nil
+}
+
+// partUpload returns the upload and part number of a request to
+// store a part
+func (s *server) partUpload(r *http.Request, bucket, key string) (u *upload, partNumber int, err error) {
+	q := r.URL.Query()
+	u, err = s.uploads.get(q.Get("uploadId"), bucket, key, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	partNumber, err = strconv.Atoi(q.Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > maxPartNumber {
+		return nil, 0, newError(http.StatusBadRequest, "InvalidArgument", fmt.Sprintf("Part number must be an integer between 1 and %d, inclusive", maxPartNumber))
+	}
+	return u, partNumber, nil
+}
+
+// storePart stores the data read from in as part partNumber of u
+func (us *uploads) storePart(u *upload, partNumber int, in io.Reader) (p part, err error) {
+	out, err := ioutil.TempFile(u.dir, "part-")
+	if err != nil {
+		return p, errors.Wrap(err, "failed to create part")
+	}
+	var size int64
+	defer func() {
+		if err != nil {
+			_ = out.Close()
+			_ = os.Remove(out.Name())
+			us.release(size)
+		}
+	}()
+	hasher := md5.New()
+	size, err = io.Copy(io.MultiWriter(quotaWriter{us: us, out: out}, hasher), in)
+	if err != nil {
+		return p, err
+	}
+	err = out.Close()
+	if err != nil {
+		return p, errors.Wrap(err, "failed to write part")
+	}
+	p = part{
+		size: size,
+		etag: hex.EncodeToString(hasher.Sum(nil)),
+	}
+	// Rename into place with the lock held so the part stored
+	// matches its entry if the part is uploaded more than once.
+	// Don't change the parts while they are being joined.
+	u.mu.Lock()
+	old, replaced := u.parts[partNumber]
+	if u.locked {
+		err = errNoSuchUpload
+	} else {
+		err = os.Rename(out.Name(), u.partPath(partNumber))
+	}
+	if err == nil {
+		u.parts[partNumber] = p
+		u.lastUsed = time.Now()
+	}
+	u.mu.Unlock()
+	if err == nil && replaced {
+		us.release(old.size)
+	}
+	if err == errNoSuchUpload {
+		return p, err
+	} else if err != nil {
+		return p, errors.Wrap(err, "failed to store part")
+	}
+	return p, nil
+}
+
+// uploadPart stores a part of a multipart upload
+func (s *server) uploadPart(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	u, partNumber, err := s.partUpload(r, bucket, key)
+	if err != nil {
+		return err
+	}
+	p, err := s.uploads.storePart(u, partNumber, r.Body)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("ETag", `"`+p.etag+`"`)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// copyPartResult is the response to UploadPartCopy
+type copyPartResult struct {
+	XMLName      xml.Name `xml:"CopyPartResult"`
+	Xmlns        string   `xml:"xmlns,attr"`
+	LastModified string
+	ETag         string
+}
+
+// uploadPartCopy stores a part of a multipart upload copied from
+// all or a range of an existing object
+func (s *server) uploadPartCopy(w http.ResponseWriter, r *http.Request, bucket, key string) (err error) {
+	u, partNumber, err := s.partUpload(r, bucket, key)
+	if err != nil {
+		return err
+	}
+	_, _, srcNode, err := s.copySource(r)
+	if err != nil {
+		return err
+	}
+	if srcNode.IsDir() {
+		return newError(http.StatusBadRequest, "InvalidRequest", "Directory markers can't be copied.")
+	}
+	size := srcNode.Size()
+	start, length := int64(0), size
+	if sourceRange := r.Header.Get("X-Amz-Copy-Source-Range"); sourceRange != "" {
+		var end int64
+		_, err = fmt.Sscanf(sourceRange, "bytes=%d-%d", &start, &end)
+		if err != nil || start < 0 || end < start || end >= size {
+			return newError(http.StatusBadRequest, "InvalidArgument", "The x-amz-copy-source-range value must be of the form bytes=first-last where first and last are the zero-based offsets of the first and last bytes to copy")
+		}
+		length = end - start + 1
+	}
+	in, err := srcNode.Open(os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(in, &err)
+	p, err := s.uploads.storePart(u, partNumber, io.NewSectionReader(in, start, length))
+	if err != nil {
+		return err
+	}
+	writeXML(w, http.StatusOK, &copyPartResult{
+		Xmlns:        xmlNamespace,
+		LastModified: formatTime(time.Now()),
+		ETag:         `"` + p.etag + `"`,
+	})
+	return nil
+}
+
+// completeMultipartUpload is the body of a CompleteMultipartUpload request
+type completeMultipartUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []struct {
+		PartNumber int
+		ETag       string
+	} `xml:"Part"`
+}
+
+// completeMultipartUploadResult is the response to CompleteMultipartUpload
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string
+	Bucket   string
+	Key      string
+	ETag     string
+}
+
+// completeMultipartUpload joins the parts listed in the body and
+// writes them to the object through the VFS
+func (s *server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) (err error) {
+	uploadID := r.URL.Query().Get("uploadId")
+	var req completeMultipartUpload
+	err = xml.NewDecoder(io.LimitReader(r.Body, maxXMLBodySize)).Decode(&req)
+	if err != nil || len(req.Parts) == 0 {
+		fs.Debugf(r.URL.Path, "Failed to decode CompleteMultipartUpload request: %v", err)
+		return errMalformedXML
+	}
+	for i := 1; i < len(req.Parts); i++ {
+		if req.Parts[i].PartNumber <= req.Parts[i-1].PartNumber {
+			return errInvalidPartOrder
+		}
+	}
+
+	// Take the upload so it can't be completed twice or aborted
+	// while it is being completed, putting it back if the
+	// completion fails so it can be retried
+	u, err := s.uploads.get(uploadID, bucket, key, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			s.uploads.put(uploadID, u)
+		} else {
+			s.uploads.remove(u)
+		}
+	}()
+
+	// Check the parts and work out the multipart ETag
+	u.mu.Lock()
+	u.locked = true
+	etagHasher := md5.New()
+	var paths []string
+	for i, reqPart := range req.Parts {
+		p, ok := u.parts[reqPart.PartNumber]
+		if !ok || strings.Trim(reqPart.ETag, `"`) != p.etag {
+			u.mu.Unlock()
+			return errInvalidPart
+		}
+		if p.size < minPartSize && i != len(req.Parts)-1 {
+			u.mu.Unlock()
+			return errEntityTooSmall
+		}
+		sum, _ := hex.DecodeString(p.etag)
+		_, _ = etagHasher.Write(sum)
+		paths = append(paths, u.partPath(reqPart.PartNumber))
+	}
+	u.mu.Unlock()
+	etag := fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(etagHasher.Sum(nil)), len(req.Parts))
+
+	in := &partsReader{paths: paths}
+	defer fs.CheckClose(in, &err)
+	_, err = s.writeObject(objectPath(bucket, key), in, u.modTime)
+	if err != nil {
+		return err
+	}
+	fs.Debugf(objectPath(bucket, key), "Completed multipart upload %s with %d parts", uploadID, len(req.Parts))
+	writeXML(w, http.StatusOK, &completeMultipartUploadResult{
+		Xmlns:    xmlNamespace,
+		Location: "/" + bucket + "/" + key,
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     etag,
+	})
+	return nil
+}
+
+// abortMultipartUpload discards a multipart upload
+func (s *server) abortMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	u, err := s.uploads.get(r.URL.Query().Get("uploadId"), bucket, key, true)
+	if err != nil {
+		return err
+	}
+	s.uploads.remove(u)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// partsReader reads the files in paths one after another
+type partsReader struct {
+	paths []string
+	in    *os.File
+}
+
+// Read from the current part opening the next one when it is finished
+func (pr *partsReader) Read(p []byte) (n int, err error) {
+	for {
+		if pr.in == nil {
+			if len(pr.paths) == 0 {
+				return 0, io.EOF
+			}
+			pr.in, err = os.Open(pr.paths[0])
+			if err != nil {
+				return 0, errors.Wrap(err, "failed to open part")
+			}
+			pr.paths = pr.paths[1:]
+		}
+		n, err = pr.in.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+		err = pr.Close()
+		if err != nil {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// Close the current part if open
+func (pr *partsReader) Close() error {
+	if pr.in == nil {
+		return nil
+	}
+	err := pr.in.Close()
+	pr.in = nil
+	return err
+}
@@ -0,0 +1,101 @@
+package s3
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config"
+	"github.com/ncw/rclone/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestUploads makes an uploads limited to maxSize bytes in a
+// temporary cache directory
+func newTestUploads(t *testing.T, maxSize fs.SizeSuffix) (*uploads, func()) {
+	oldCacheDir := config.CacheDir
+	var err error
+	config.CacheDir, err = ioutil.TempDir("", "serve-s3-uploads")
+	require.NoError(t, err)
+	opt := vfs.DefaultOpt
+	opt.CacheMaxSize = maxSize
+	opt.CachePollInterval = 0
+	us, err := newUploads(&opt)
+	require.NoError(t, err)
+	return us, func() {
+		us.close()
+		_ = os.RemoveAll(config.CacheDir)
+		config.CacheDir = oldCacheDir
+	}
+}
+
+func TestUploadsMaxSize(t *testing.T) {
+	us, cleanup := newTestUploads(t, 100)
+	defer cleanup()
+
+	// A spooled object uses space until it is discarded
+	f, err := us.spool(bytes.NewReader(make([]byte, 60)))
+	require.NoError(t, err)
+	assert.Equal(t, int64(60), us.used)
+	_, err = us.spool(bytes.NewReader(make([]byte, 41)))
+	assert.Equal(t, errCacheFull, err)
+	assert.Equal(t, int64(60), us.used)
+	us.discard(f)
+	assert.Equal(t, int64(0), us.used)
+
+	// Parts use space until the upload is removed
+	uploadID, err := us.newUpload("bucket", "key", time.Time{})
+	require.NoError(t, err)
+	u, err := us.get(uploadID, "bucket", "key", false)
+	require.NoError(t, err)
+	_, err = us.storePart(u, 1, bytes.NewReader(make([]byte, 50)))
+	require.NoError(t, err)
+	_, err = us.storePart(u, 2, bytes.NewReader(make([]byte, 30)))
+	require.NoError(t, err)
+	assert.Equal(t, int64(80), us.used)
+	_, err = us.storePart(u, 3, bytes.NewReader(make([]byte, 21)))
+	assert.Equal(t, errCacheFull, err)
+	assert.Equal(t, int64(80), us.used)
+
+	// Replacing a part releases the space of the old one
+	_, err = us.storePart(u, 1, bytes.NewReader(make([]byte, 10)))
+	require.NoError(t, err)
+	assert.Equal(t, int64(40), us.used)
+
+	us.remove(u)
+	assert.Equal(t, int64(0), us.used)
+}
+
+func TestUploadsExpire(t *testing.T) {
+	us, cleanup := newTestUploads(t, -1)
+	defer cleanup()
+
+	uploadID, err := us.newUpload("bucket", "key", time.Time{})
+	require.NoError(t, err)
+	u, err := us.get(uploadID, "bucket", "key", false)
+	require.NoError(t, err)
+	_, err = us.storePart(u, 1, bytes.NewReader(make([]byte, 10)))
+	require.NoError(t, err)
+
+	// Not expired yet
+	us.expire(time.Now())
+	_, err = us.get(uploadID, "bucket", "key", false)
+	require.NoError(t, err)
+
+	// Expired
+	us.expire(time.Now().Add(us.maxAge + time.Second))
+	_, err = us.get(uploadID, "bucket", "key", false)
+	assert.Equal(t, errNoSuchUpload, err)
+	assert.Equal(t, int64(0), us.used)
+	_, err = os.Stat(u.dir)
+	assert.True(t, os.IsNotExist(err))
+
+	// Parts can't be stored in an expired upload
+	_, err = us.storePart(u, 2, bytes.NewReader(make([]byte, 10)))
+	assert.Error(t, err)
+	assert.Equal(t, int64(0), us.used)
+}
@@ -0,0 +1,481 @@
+package s3
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/vfs"
+	"github.com/ncw/swift"
+)
+
+// ETag of an empty object
+const emptyETag = `"d41d8cd98f00b204e9800998ecf8427e"`
+
+// maximum size of the XML body of a request
+const maxXMLBodySize = 1 << 20
+
+// errKeyConflict is returned when an object would need to be both a
+// file and a directory
+var errKeyConflict = newError(http.StatusConflict, "InvalidRequest", "The object key conflicts with an existing object or directory.")
+
+// formatTime formats t in the ISO 8601 format used in XML responses
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// requestModTime reads the modification time from the X-Amz-Meta-Mtime
+// header, or from the query if it was hoisted there when presigning.
+//
+// It returns a zero time if it wasn't found.
+func requestModTime(r *http.Request) time.Time {
+	value := r.Header.Get("X-Amz-Meta-Mtime")
+	if value == "" {
+		for k, v := range r.URL.Query() {
+			if strings.EqualFold(k, "X-Amz-Meta-Mtime") && len(v) > 0 {
+				value = v[0]
+			}
+		}
+	}
+	if value == "" {
+		return time.Time{}
+	}
+	modTime, err := swift.FloatStringToTime(value)
+	if err != nil {
+		fs.Debugf(r.URL.Path, "Failed to parse mtime %q: %v", value, err)
+		return time.Time{}
+	}
+	return modTime
+}
+
+// objectETag returns the quoted ETag for node.
+//
+// This is the hash if available, otherwise it is made from the
+// modification time and size.  The "-" stops clients thinking it is
+// an MD5.
+func (s *server) objectETag(node vfs.Node) string {
+	if node.IsDir() {
+		return emptyETag
+	}
+	if s.etagHash != hash.None {
+		if o, ok := node.DirEntry().(fs.Object); ok {
+			sum, err := o.Hash(s.etagHash)
+			if err == nil && sum != "" {
+				return `"` + sum + `"`
+			}
+			if err != nil {
+				fs.Debugf(o, "Failed to read hash for ETag: %v", err)
+			}
+		}
+	}
+	return fmt.Sprintf(`"%x-%x"`, node.ModTime().UnixNano(), node.Size())
+}
+
+// setObjectHeaders sets the headers describing node
+func (s *server) setObjectHeaders(w http.ResponseWriter, node vfs.Node) {
+	modTime := node.ModTime()
+	h := w.Header()
+	h.Set("Content-Type", fs.MimeTypeFromName(node.Name()))
+	h.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	h.Set("X-Amz-Meta-Mtime", swift.TimeToFloatString(modTime))
+	h.Set("ETag", s.objectETag(node))
+	h.Set("Accept-Ranges", "bytes")
+}
+
+// objectNode finds the node for key in bucket.
+//
+// Keys ending in / are directory markers and refer to directories.
+func (s *server) objectNode(bucket, key string) (vfs.Node, error) {
+	_, err := s.bucketDir(bucket)
+	if err != nil {
+		return nil, err
+	}
+	node, err := s.vfs.Stat(objectPath(bucket, key))
+	if err == vfs.ENOENT {
+		return nil, errNoSuchKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if node.IsDir() != strings.HasSuffix(key, "/") {
+		return nil, errNoSuchKey
+	}
+	return node, nil
+}
+
+// headObject returns the headers for the object
+func (s *server) headObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	node, err := s.objectNode(bucket, key)
+	if err != nil {
+		return err
+	}
+	s.setObjectHeaders(w, node)
+	size := int64(0)
+	if !node.IsDir() {
+		size = node.Size()
+	}
+	w.Header().Set("Content-Length", fmt.Sprint(size))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// getObject returns the object, or a range of it
+func (s *server) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) (err error) {
+	node, err := s.objectNode(bucket, key)
+	if err != nil {
+		return err
+	}
+	s.setObjectHeaders(w, node)
+	if node.IsDir() {
+		w.Header().Set("Content-Length", "0")
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+	in, err := node.Open(os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(in, &err)
+	http.ServeContent(w, r, "", node.ModTime(), in)
+	return nil
+}
+
+// mkdirAll makes the directory dirPath and any parents necessary
+func (s *server) mkdirAll(dirPath string) (dir *vfs.Dir, err error) {
+	dir, err = s.vfs.Root()
+	if err != nil {
+		return nil, err
+	}
+	if dirPath == "" || dirPath == "." {
+		return dir, nil
+	}
+	for _, leaf := range strings.Split(dirPath, "/") {
+		node, err := dir.Stat(leaf)
+		switch {
+		case err == vfs.ENOENT:
+			dir, err = dir.Mkdir(leaf)
+			if err != nil {
+				return nil, err
+			}
+		case err != nil:
+			return nil, err
+		case !node.IsDir():
+			return nil, errKeyConflict
+		default:
+			dir = node.(*vfs.Dir)
+		}
+	}
+	return dir, nil
+}
+
+// writeObject writes in to the file at filePath through the VFS
+// setting its modification time to modTime if it isn't zero.
+//
+// It returns the ETag of the new object.
+func (s *server) writeObject(filePath string, in io.Reader, modTime time.Time) (etag string, err error) {
+	_, err = s.mkdirAll(path.Dir(filePath))
+	if err != nil {
+		return "", err
+	}
+	node, err := s.vfs.Stat(filePath)
+	if err == nil && node.IsDir() {
+		return "", errKeyConflict
+	}
+	out, err := s.vfs.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return "", err
+	}
+	var hasher *hash.MultiHasher
+	if s.etagHash != hash.None {
+		hasher, err = hash.NewMultiHasherTypes(hash.NewHashSet(s.etagHash))
+		if err != nil {
+			return "", err
+		}
+		in = io.TeeReader(in, hasher)
+	}
+	_, err = io.Copy(out, in)
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Don't leave a partial object behind
+		if node, statErr := s.vfs.Stat(filePath); statErr == nil {
+			if removeErr := node.Remove(); removeErr != nil {
+				fs.Errorf(filePath, "Failed to remove partial object: %v", removeErr)
+			}
+		}
+		return "", err
+	}
+	node, err = s.vfs.Stat(filePath)
+	if err != nil {
+		return "", err
+	}
+	if !modTime.IsZero() {
+		err = node.SetModTime(modTime)
+		if err != nil {
+			return "", err
+		}
+	}
+	if hasher != nil {
+		return `"` + hasher.Sums()[s.etagHash] + `"`, nil
+	}
+	return s.objectETag(node), nil
+}
+
+// putObject uploads the body of the request to the object
+func (s *server) putObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	_, err := s.bucketDir(bucket)
+	if err != nil {
+		return err
+	}
+	objectPath := objectPath(bucket, key)
+	if strings.HasSuffix(key, "/") {
+		// Directory markers can be made but can't contain data
+		if r.ContentLength > 0 {
+			return newError(http.StatusBadRequest, "InvalidRequest", "Objects ending in / can't contain data.")
+		}
+		_, err = s.mkdirAll(objectPath)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("ETag", emptyETag)
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+	// Receive the whole object before writing it so a failed upload
+	// doesn't change the object
+	in, err := s.uploads.spool(r.Body)
+	if err != nil {
+		return err
+	}
+	defer s.uploads.discard(in)
+	etag, err := s.writeObject(objectPath, in, requestModTime(r))
+	if err != nil {
+		return err
+	}
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// copySource returns the bucket, key and node of the object named in
+// the X-Amz-Copy-Source header
+func (s *server) copySource(r *http.Request) (bucket, key string, node vfs.Node, err error) {
+	source := r.Header.Get("X-Amz-Copy-Source")
+	// ignore the versionId if set
+	if i := strings.IndexRune(source, '?'); i >= 0 {
+		source = source[:i]
+	}
+	source, err = url.PathUnescape(source)
+	if err != nil {
+		return "", "", nil, newError(http.StatusBadRequest, "InvalidArgument", "Copy Source must mention the source bucket and key: sourcebucket/sourcekey")
+	}
+	bucket, key = splitPath(source)
+	if bucket == "" || key == "" || checkKey(bucket) != nil || checkKey(key) != nil {
+		return "", "", nil, newError(http.StatusBadRequest, "InvalidArgument", "Copy Source must mention the source bucket and key: sourcebucket/sourcekey")
+	}
+	node, err = s.objectNode(bucket, key)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return bucket, key, node, nil
+}
+
+// copyObjectResult is the response to CopyObject
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	Xmlns        string   `xml:"xmlns,attr"`
+	LastModified string
+	ETag         string
+}
+
+// copyObject copies the object named in the X-Amz-Copy-Source header
+// to key in bucket.
+//
+// Copying an object to itself with the REPLACE metadata directive
+// just sets the modification time.
+func (s *server) copyObject(w http.ResponseWriter, r *http.Request, bucket, key string) (err error) {
+	srcBucket, srcKey, srcNode, err := s.copySource(r)
+	if err != nil {
+		return err
+	}
+	if srcNode.IsDir() || strings.HasSuffix(key, "/") {
+		return newError(http.StatusBadRequest, "InvalidRequest", "Directory markers can't be copied.")
+	}
+	_, err = s.bucketDir(bucket)
+	if err != nil {
+		return err
+	}
+	modTime := srcNode.ModTime()
+	directive := r.Header.Get("X-Amz-Metadata-Directive")
+	switch directive {
+	case "", "COPY":
+	case "REPLACE":
+		modTime = requestModTime(r)
+		if modTime.IsZero() {
+			modTime = time.Now()
+		}
+	default:
+		return newError(http.StatusBadRequest, "InvalidArgument", "Unknown metadata directive.")
+	}
+	srcPath, dstPath := objectPath(srcBucket, srcKey), objectPath(bucket, key)
+	var etag string
+	if srcPath == dstPath {
+		if directive != "REPLACE" {
+			return newError(http.StatusBadRequest, "InvalidRequest", "This copy request is illegal because it is trying to copy an object to itself without changing the object's metadata.")
+		}
+		err = srcNode.SetModTime(modTime)
+		if err != nil {
+			return err
+		}
+		etag = s.objectETag(srcNode)
+	} else {
+		var in vfs.Handle
+		in, err = srcNode.Open(os.O_RDONLY)
+		if err != nil {
+			return err
+		}
+		defer fs.CheckClose(in, &err)
+		etag, err = s.writeObject(dstPath, in, modTime)
+		if err != nil {
+			return err
+		}
+	}
+	writeXML(w, http.StatusOK, &copyObjectResult{
+		Xmlns:        xmlNamespace,
+		LastModified: formatTime(modTime),
+		ETag:         etag,
+	})
+	return nil
+}
+
+// removeObject removes the object at key in bucket then any
+// directories left empty, up to but not including the bucket.
+//
+// It isn't an error if the object doesn't exist.
+func (s *server) removeObject(bucket, key string) error {
+	node, err := s.objectNode(bucket, key)
+	if err == errNoSuchKey {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if dir, ok := node.(*vfs.Dir); ok {
+		// Directory markers are only removed if empty
+		nodes, err := dir.ReadDirAll()
+		if err != nil {
+			return err
+		}
+		if len(nodes) != 0 {
+			return nil
+		}
+	}
+	err = node.Remove()
+	if err != nil {
+		return err
+	}
+	for dirPath := path.Dir(node.Path()); strings.ContainsRune(dirPath, '/'); dirPath = path.Dir(dirPath) {
+		parent, err := s.vfs.Stat(dirPath)
+		if err != nil || !parent.IsDir() {
+			break
+		}
+		nodes, err := parent.(*vfs.Dir).ReadDirAll()
+		if err != nil || len(nodes) != 0 {
+			break
+		}
+		err = parent.Remove()
+		if err != nil {
+			fs.Debugf(dirPath, "Failed to remove empty directory: %v", err)
+			break
+		}
+	}
+	return nil
+}
+
+// deleteObject removes the object
+func (s *server) deleteObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	err := s.removeObject(bucket, key)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// deleteRequest is the body of a DeleteObjects request
+type deleteRequest struct {
+	XMLName xml.Name `xml:"Delete"`
+	Quiet   bool
+	Objects []struct {
+		Key string
+	} `xml:"Object"`
+}
+
+// deletedObject is an object which was deleted by DeleteObjects
+type deletedObject struct {
+	Key string
+}
+
+// deleteError is an object which couldn't be deleted by DeleteObjects
+type deleteError struct {
+	Key     string
+	Code    string
+	Message string
+}
+
+// deleteResult is the response to DeleteObjects
+type deleteResult struct {
+	XMLName xml.Name        `xml:"DeleteResult"`
+	Xmlns   string          `xml:"xmlns,attr"`
+	Deleted []deletedObject `xml:"Deleted"`
+	Errors  []deleteError   `xml:"Error"`
+}
+
+// deleteObjects removes the objects listed in the body
+func (s *server) deleteObjects(w http.ResponseWriter, r *http.Request, bucket string) error {
+	_, err := s.bucketDir(bucket)
+	if err != nil {
+		return err
+	}
+	var req deleteRequest
+	err = xml.NewDecoder(io.LimitReader(r.Body, maxXMLBodySize)).Decode(&req)
+	if err != nil {
+		fs.Debugf(r.URL.Path, "Failed to decode DeleteObjects request: %v", err)
+		return errMalformedXML
+	}
+	out := deleteResult{
+		Xmlns: xmlNamespace,
+	}
+	for _, object := range req.Objects {
+		err := checkKey(object.Key)
+		if err == nil {
+			err = s.removeObject(bucket, object.Key)
+		}
+		if err != nil {
+			s3Err, ok := err.(*s3Error)
+			if !ok {
+				fs.Errorf(objectPath(bucket, object.Key), "Failed to delete: %v", err)
+				s3Err = errInternal
+			}
+			out.Errors = append(out.Errors, deleteError{
+				Key:     object.Key,
+				Code:    s3Err.Code,
+				Message: s3Err.Message,
+			})
+		} else if !req.Quiet {
+			out.Deleted = append(out.Deleted, deletedObject{Key: object.Key})
+		}
+	}
+	writeXML(w, http.StatusOK, &out)
+	return nil
+}
@@ -0,0 +1,131 @@
+// Package s3 implements an S3 compatible server to serve an rclone VFS
+package s3
+
+import (
+	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/cmd/serve/httplib"
+	"github.com/ncw/rclone/cmd/serve/httplib/httpflags"
+	"github.com/ncw/rclone/fs/config/flags"
+	"github.com/ncw/rclone/fs/rc"
+	"github.com/ncw/rclone/vfs"
+	"github.com/ncw/rclone/vfs/vfsflags"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Options contains options for the S3 server
+type Options struct {
+	AuthKeys []string // "accessKey,secretKey" pairs allowed to sign requests
+	EtagHash string   // name of the hash to use for ETags or "" for none
+}
+
+// DefaultOpt is the default values used for Options
+var DefaultOpt = Options{
+	EtagHash: "MD5",
+}
+
+// Opt is options set by command line flags
+var Opt = DefaultOpt
+
+// AddFlags adds flags for the s3 server
+func AddFlags(flagSet *pflag.FlagSet, Opt *Options) {
+	rc.AddOption("s3", &Opt)
+	flags.StringArrayVarP(flagSet, &Opt.AuthKeys, "auth-key", "", Opt.AuthKeys, "Set key pair for v4 authorization, split by comma")
+	flags.StringVarP(flagSet, &Opt.EtagHash, "etag-hash", "", Opt.EtagHash, "Which hash to use for the ETag, or blank for none")
+}
+
+func init() {
+	httpflags.AddFlags(Command.Flags())
+	vfsflags.AddFlags(Command.Flags())
+	AddFlags(Command.Flags(), &Opt)
+}
+
+// Command definition for cobra
+var Command = &cobra.Command{
+	Use:   "s3 remote:path",
+	Short: `Serve remote:path over s3.`,
+	Long: `rclone serve s3 implements a basic S3 server that serves the
+remote as an S3 compatible object store.  This can be used with S3
+clients, or you can make a remote of type s3 to use with it.
+
+The top level directories of remote:path are presented as buckets and
+everything below them as objects.  Files in the top level directory
+aren't visible.  Creating a bucket makes a top level directory and
+deleting an empty bucket removes it.
+
+The following operations are supported
+
+- ListBuckets, HeadBucket, CreateBucket, DeleteBucket, GetBucketLocation
+- ListObjects and ListObjectsV2
+- GetObject (including ranges), HeadObject, PutObject, CopyObject
+- DeleteObject and DeleteObjects
+- CreateMultipartUpload, UploadPart, UploadPartCopy,
+  CompleteMultipartUpload and AbortMultipartUpload
+
+Requests must use path style addressing, so configure clients to use
+path style (eg with force_path_style = true in an rclone s3 remote).
+
+Object metadata isn't stored apart from the modification time which
+is read from and returned in the X-Amz-Meta-Mtime header in the same
+way as the rclone s3 backend does.  Directories are created as needed
+when objects are uploaded and empty directories are removed when the
+last object in them is deleted.
+
+### Authentication ###
+
+Requests are authenticated with AWS Signature Version 4, using either
+the Authorization header or presigned URLs.  Use --auth-key to supply
+the access key ID and secret access key separated by a comma, eg
+
+    --auth-key ACCESS_KEY_ID,SECRET_ACCESS_KEY
+
+Repeat the flag to allow more than one key pair.  If no --auth-key is
+supplied then no authentication is done.  The --user, --pass and
+--htpasswd flags can't be used as S3 clients don't send basic auth.
+
+### ETags ###
+
+By default the MD5 hash of the object is used as its ETag if the remote
+supports it, which makes the rclone s3 backend able to check the
+integrity of transfers.  Calculating the MD5 can be slow on remotes
+which don't store it (eg local disk) so use --etag-hash to use a
+different hash or set it to "" to use ETags made from the size and
+modification time instead.
+
+### Uploads ###
+
+Uploaded objects are stored in temporary files in the rclone cache
+directory until they have been received completely, so a failed upload
+leaves any existing object unchanged.  The parts of multipart uploads
+are stored there until the upload is completed.  They are then joined
+together and written through the VFS, so with --vfs-cache-mode writes
+or above they go through the VFS write cache and any write back.
+
+The temporary files aren't kept in the VFS cache as they aren't files
+in the VFS until they are complete, but they still obey its limits.
+The space they use counts against --vfs-cache-max-size, and an upload
+which would go over it fails with EntityTooLarge.  Incomplete
+multipart uploads which haven't had a part uploaded for
+--vfs-cache-max-age are discarded, checking every
+--vfs-cache-poll-interval, as are any left when the server stops.
+
+--bwlimit will be respected for file transfers.  Use --stats to
+control the stats printing.
+` + httplib.Help + vfs.Help,
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		f := cmd.NewFsSrc(args)
+		cmd.Run(false, true, command, func() error {
+			s, err := newServer(f, &httpflags.Opt, &Opt)
+			if err != nil {
+				return err
+			}
+			err = s.Serve()
+			if err != nil {
+				return err
+			}
+			s.Wait()
+			return nil
+		})
+	},
+}
@@ -0,0 +1,386 @@
+// Serve s3 tests set up a server and run the integration tests
+// for the s3 remote against it.
+//
+// We skip tests on platforms with troublesome character mappings
+
+//+build !windows,!darwin
+
+package s3
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	_ "github.com/ncw/rclone/backend/local"
+	"github.com/ncw/rclone/cmd/serve/httplib"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config"
+	"github.com/ncw/rclone/fstest"
+	"github.com/ncw/swift"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testBindAddress = "localhost:0"
+)
+
+// startServer starts a server serving f with test credentials
+func startServer(t *testing.T, f fs.Fs) (*server, func()) {
+	cacheDir, err := ioutil.TempDir("", "rclone-serve-s3-test")
+	require.NoError(t, err)
+	oldCacheDir := config.CacheDir
+	config.CacheDir = cacheDir
+
+	httpOpt := httplib.DefaultOpt
+	httpOpt.ListenAddr = testBindAddress
+	opt := DefaultOpt
+	opt.AuthKeys = []string{testAccessKey + "," + testSecretKey}
+	s, err := newServer(f, &httpOpt, &opt)
+	require.NoError(t, err)
+	require.NoError(t, s.Serve())
+	return s, func() {
+		s.Close()
+		s.Wait()
+		config.CacheDir = oldCacheDir
+		_ = os.RemoveAll(cacheDir)
+	}
+}
+
+// TestS3 runs the s3 server then runs the unit tests for the
+// s3 remote against it.
+func TestS3(t *testing.T) {
+	fstest.Initialise()
+
+	fremote, _, clean, err := fstest.RandomRemote(*fstest.RemoteName, *fstest.SubDir)
+	assert.NoError(t, err)
+	defer clean()
+
+	err = fremote.Mkdir("")
+	assert.NoError(t, err)
+
+	// Start the server
+	s, cleanup := startServer(t, fremote)
+	defer cleanup()
+
+	// Change directory to run the tests
+	err = os.Chdir("../../../backend/s3")
+	assert.NoError(t, err, "failed to cd to s3 backend")
+
+	// Run the s3 tests with an on the fly remote
+	args := []string{"test"}
+	if testing.Verbose() {
+		args = append(args, "-v")
+	}
+	if *fstest.Verbose {
+		args = append(args, "-verbose")
+	}
+	args = append(args, "-list-retries", fmt.Sprint(*fstest.ListRetries))
+	args = append(args, "-remote", "s3test:")
+	cmd := exec.Command("go", args...)
+	cmd.Env = append(os.Environ(),
+		"RCLONE_CONFIG_S3TEST_TYPE=s3",
+		"RCLONE_CONFIG_S3TEST_PROVIDER=Other",
+		"RCLONE_CONFIG_S3TEST_ENDPOINT="+strings.TrimSuffix(s.URL(), "/"),
+		"RCLONE_CONFIG_S3TEST_ACCESS_KEY_ID="+testAccessKey,
+		"RCLONE_CONFIG_S3TEST_SECRET_ACCESS_KEY="+testSecretKey,
+		"RCLONE_CONFIG_S3TEST_FORCE_PATH_STYLE=true",
+	)
+	out, err := cmd.CombinedOutput()
+	if len(out) != 0 {
+		t.Logf("\n----------\n%s----------\n", string(out))
+	}
+	assert.NoError(t, err, "Running s3 integration tests")
+}
+
+// TestS3Client tests the operations the s3 backend doesn't use with
+// the AWS SDK
+func TestS3Client(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rclone-serve-s3-test-root")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	f, err := fs.NewFs(dir)
+	require.NoError(t, err)
+
+	s, cleanup := startServer(t, f)
+	defer cleanup()
+
+	ses, err := session.NewSession(aws.NewConfig().
+		WithCredentials(credentials.NewStaticCredentials(testAccessKey, testSecretKey, "")).
+		WithEndpoint(strings.TrimSuffix(s.URL(), "/")).
+		WithRegion("us-east-1").
+		WithS3ForcePathStyle(true).
+		WithMaxRetries(0))
+	require.NoError(t, err)
+	c := s3.New(ses)
+
+	errorCode := func(err error) string {
+		if awsErr, ok := err.(awserr.Error); ok {
+			return awsErr.Code()
+		}
+		return fmt.Sprint(err)
+	}
+	put := func(key, contents string) {
+		_, err := c.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String(key),
+			Body:   bytes.NewReader([]byte(contents)),
+		})
+		require.NoError(t, err)
+	}
+
+	t.Run("Buckets", func(t *testing.T) {
+		_, err := c.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String("bucket")})
+		require.NoError(t, err)
+		_, err = c.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String("bucket")})
+		require.NoError(t, err)
+		_, err = c.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String("potato")})
+		assert.Error(t, err)
+		out, err := c.ListBuckets(&s3.ListBucketsInput{})
+		require.NoError(t, err)
+		require.Len(t, out.Buckets, 1)
+		assert.Equal(t, "bucket", aws.StringValue(out.Buckets[0].Name))
+	})
+
+	t.Run("PutGetHead", func(t *testing.T) {
+		modTime := time.Date(2001, 2, 3, 4, 5, 6, 123456789, time.UTC)
+		_, err := c.PutObject(&s3.PutObjectInput{
+			Bucket:   aws.String("bucket"),
+			Key:      aws.String("dir/file with spaces+plus.txt"),
+			Body:     bytes.NewReader([]byte("hello world")),
+			Metadata: map[string]*string{"Mtime": aws.String(swift.TimeToFloatString(modTime))},
+		})
+		require.NoError(t, err)
+		head, err := c.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("dir/file with spaces+plus.txt"),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(11), aws.Int64Value(head.ContentLength))
+		assert.Equal(t, `"5eb63bbbe01eeed093cb22bb8f5acdc3"`, aws.StringValue(head.ETag))
+		assert.Equal(t, "text/plain; charset=utf-8", aws.StringValue(head.ContentType))
+		gotModTime, err := swift.FloatStringToTime(aws.StringValue(head.Metadata["Mtime"]))
+		require.NoError(t, err)
+		assert.True(t, modTime.Equal(gotModTime), gotModTime)
+
+		get, err := c.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("dir/file with spaces+plus.txt"),
+			Range:  aws.String("bytes=6-"),
+		})
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(get.Body)
+		require.NoError(t, err)
+		require.NoError(t, get.Body.Close())
+		assert.Equal(t, "world", string(data))
+
+		_, err = c.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("dir"),
+		})
+		assert.Equal(t, "NotFound", errorCode(err))
+		_, err = c.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("potato"),
+		})
+		assert.Equal(t, "NoSuchKey", errorCode(err))
+		_, err = c.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String("potato"),
+			Key:    aws.String("potato"),
+		})
+		assert.Equal(t, "NoSuchBucket", errorCode(err))
+	})
+
+	t.Run("List", func(t *testing.T) {
+		put("a/1.txt", "1")
+		put("a/2.txt", "2")
+		put("a/b/3.txt", "3")
+		put("a-4.txt", "4")
+
+		// V2 with a delimiter and paging
+		var keys []string
+		input := &s3.ListObjectsV2Input{
+			Bucket:    aws.String("bucket"),
+			Prefix:    aws.String("a"),
+			Delimiter: aws.String("/"),
+			MaxKeys:   aws.Int64(1),
+		}
+		err := c.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, object := range page.Contents {
+				keys = append(keys, aws.StringValue(object.Key))
+			}
+			for _, prefix := range page.CommonPrefixes {
+				keys = append(keys, aws.StringValue(prefix.Prefix))
+			}
+			return true
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a-4.txt", "a/"}, keys)
+
+		// V1 recursive
+		out, err := c.ListObjects(&s3.ListObjectsInput{
+			Bucket: aws.String("bucket"),
+			Prefix: aws.String("a/"),
+			Marker: aws.String("a/1.txt"),
+		})
+		require.NoError(t, err)
+		keys = nil
+		for _, object := range out.Contents {
+			keys = append(keys, aws.StringValue(object.Key))
+		}
+		assert.Equal(t, []string{"a/2.txt", "a/b/3.txt"}, keys)
+		assert.False(t, aws.BoolValue(out.IsTruncated))
+		assert.Equal(t, `"c81e728d9d4c2f636f067f89cc14862c"`, aws.StringValue(out.Contents[0].ETag))
+		assert.Equal(t, int64(1), aws.Int64Value(out.Contents[0].Size))
+	})
+
+	t.Run("Copy", func(t *testing.T) {
+		_, err := c.CopyObject(&s3.CopyObjectInput{
+			Bucket:     aws.String("bucket"),
+			Key:        aws.String("copy/2.txt"),
+			CopySource: aws.String("bucket/a/2.txt"),
+		})
+		require.NoError(t, err)
+		get, err := c.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("copy/2.txt"),
+		})
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(get.Body)
+		require.NoError(t, err)
+		require.NoError(t, get.Body.Close())
+		assert.Equal(t, "2", string(data))
+
+		_, err = c.CopyObject(&s3.CopyObjectInput{
+			Bucket:     aws.String("bucket"),
+			Key:        aws.String("copy/2.txt"),
+			CopySource: aws.String("bucket/copy/2.txt"),
+		})
+		assert.Equal(t, "InvalidRequest", errorCode(err))
+	})
+
+	t.Run("Multipart", func(t *testing.T) {
+		create, err := c.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("multipart/file.bin"),
+		})
+		require.NoError(t, err)
+		parts := [][]byte{bytes.Repeat([]byte("a"), minPartSize), []byte("end")}
+		var completed []*s3.CompletedPart
+		for i, part := range parts {
+			out, err := c.UploadPart(&s3.UploadPartInput{
+				Bucket:     aws.String("bucket"),
+				Key:        aws.String("multipart/file.bin"),
+				UploadId:   create.UploadId,
+				PartNumber: aws.Int64(int64(i + 1)),
+				Body:       bytes.NewReader(part),
+			})
+			require.NoError(t, err)
+			completed = append(completed, &s3.CompletedPart{
+				ETag:       out.ETag,
+				PartNumber: aws.Int64(int64(i + 1)),
+			})
+		}
+
+		// Check the parts are validated
+		_, err = c.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String("bucket"),
+			Key:             aws.String("multipart/file.bin"),
+			UploadId:        create.UploadId,
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: []*s3.CompletedPart{completed[1], completed[0]}},
+		})
+		assert.Equal(t, "InvalidPartOrder", errorCode(err))
+		_, err = c.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String("bucket"),
+			Key:             aws.String("multipart/file.bin"),
+			UploadId:        create.UploadId,
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: []*s3.CompletedPart{{ETag: aws.String(`"potato"`), PartNumber: aws.Int64(1)}}},
+		})
+		assert.Equal(t, "InvalidPart", errorCode(err))
+
+		// The upload is still there after a failed completion
+		out, err := c.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String("bucket"),
+			Key:             aws.String("multipart/file.bin"),
+			UploadId:        create.UploadId,
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+		})
+		require.NoError(t, err)
+		assert.True(t, strings.HasSuffix(aws.StringValue(out.ETag), `-2"`), aws.StringValue(out.ETag))
+		head, err := c.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("multipart/file.bin"),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(minPartSize+3), aws.Int64Value(head.ContentLength))
+
+		// Can't complete twice
+		_, err = c.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String("bucket"),
+			Key:             aws.String("multipart/file.bin"),
+			UploadId:        create.UploadId,
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+		})
+		assert.Equal(t, "NoSuchUpload", errorCode(err))
+
+		// Abort
+		create, err = c.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("multipart/aborted.bin"),
+		})
+		require.NoError(t, err)
+		_, err = c.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   aws.String("bucket"),
+			Key:      aws.String("multipart/aborted.bin"),
+			UploadId: create.UploadId,
+		})
+		require.NoError(t, err)
+		_, err = c.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("multipart/aborted.bin"),
+		})
+		assert.Equal(t, "NotFound", errorCode(err))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		_, err := c.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String("bucket")})
+		assert.Equal(t, "BucketNotEmpty", errorCode(err))
+
+		_, err = c.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("a/b/3.txt"),
+		})
+		require.NoError(t, err)
+		// The empty directory should have been removed
+		_, err = os.Stat(dir + "/bucket/a/b")
+		assert.True(t, os.IsNotExist(err))
+
+		var objects []*s3.ObjectIdentifier
+		for _, key := range []string{"a/1.txt", "a/2.txt", "a-4.txt", "copy/2.txt", "dir/file with spaces+plus.txt", "multipart/file.bin", "potato"} {
+			objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(key)})
+		}
+		out, err := c.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String("bucket"),
+			Delete: &s3.Delete{Objects: objects},
+		})
+		require.NoError(t, err)
+		assert.Len(t, out.Deleted, len(objects))
+		assert.Len(t, out.Errors, 0)
+
+		_, err = c.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String("bucket")})
+		require.NoError(t, err)
+		_, err = os.Stat(dir + "/bucket")
+		assert.True(t, os.IsNotExist(err))
+	})
+}
@@ -0,0 +1,444 @@
+package s3
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ncw/rclone/cmd/serve/httplib"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/vfs"
+	"github.com/ncw/rclone/vfs/vfsflags"
+	"github.com/pkg/errors"
+)
+
+// xmlNamespace is the namespace of the S3 XML responses
+const xmlNamespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// Sub resources of buckets and objects which aren't implemented
+var unsupportedSubResources = []string{
+	"accelerate", "acl", "analytics", "cors", "encryption",
+	"inventory", "legal-hold", "lifecycle", "logging", "metrics",
+	"notification", "object-lock", "policy", "replication",
+	"requestPayment", "restore", "retention", "select", "tagging",
+	"torrent", "versioning", "versions", "website",
+}
+
+// server contains everything to run the server
+type server struct {
+	*httplib.Server
+	f         fs.Fs
+	opt       Options
+	vfs       *vfs.VFS
+	keys      map[string]string // secret keys by access key ID
+	etagHash  hash.Type         // hash to use for ETags or hash.None
+	uploads   *uploads          // multipart uploads in progress
+	requestID uint64            // incremented for each request
+}
+
+func newServer(f fs.Fs, httpOpt *httplib.Options, opt *Options) (*server, error) {
+	if httpOpt.BasicUser != "" || httpOpt.HtPasswd != "" {
+		return nil, errors.New("serve s3 uses --auth-key for authentication - can't use --user, --pass or --htpasswd")
+	}
+	s := &server{
+		f:    f,
+		opt:  *opt,
+		vfs:  vfs.New(f, &vfsflags.Opt),
+		keys: make(map[string]string, len(opt.AuthKeys)),
+	}
+	for _, pair := range opt.AuthKeys {
+		split := strings.SplitN(pair, ",", 2)
+		if len(split) != 2 || split[0] == "" || split[1] == "" {
+			return nil, errors.Errorf("bad --auth-key %q - must be ACCESS_KEY_ID,SECRET_ACCESS_KEY", pair)
+		}
+		s.keys[split[0]] = split[1]
+	}
+	if opt.EtagHash != "" {
+		err := s.etagHash.Set(opt.EtagHash)
+		if err != nil {
+			return nil, errors.Wrap(err, "bad --etag-hash")
+		}
+		if !f.Hashes().Contains(s.etagHash) {
+			fs.Debugf(f, "Remote doesn't support %v so not using it for ETags", s.etagHash)
+			s.etagHash = hash.None
+		}
+	}
+	var err error
+	s.uploads, err = newUploads(&s.vfs.Opt)
+	if err != nil {
+		return nil, err
+	}
+	s.Server = httplib.NewServer(http.HandlerFunc(s.handler), httpOpt)
+	return s, nil
+}
+
+// Serve runs the s3 server in the background.
+//
+// Use s.Close() and s.Wait() to shutdown server
+func (s *server) Serve() error {
+	err := s.Server.Serve()
+	if err != nil {
+		return err
+	}
+	if len(s.keys) == 0 {
+		fs.Logf(s.f, "No --auth-key supplied so serving without authentication")
+	}
+	fs.Logf(s.f, "Serving S3 on %s", s.URL())
+	return nil
+}
+
+// Close shuts the running server down discarding any incomplete
+// multipart uploads
+func (s *server) Close() {
+	s.Server.Close()
+	s.uploads.close()
+}
+
+// s3Error is an error to be returned to the client
+type s3Error struct {
+	Status  int    `xml:"-"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// Error satisfies the error interface
+func (e *s3Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// newError makes a new s3Error
+func newError(status int, code, message string) *s3Error {
+	return &s3Error{Status: status, Code: code, Message: message}
+}
+
+// S3 errors returned to the client
+var (
+	errAccessDenied          = newError(http.StatusForbidden, "AccessDenied", "Access Denied")
+	errBadDigest             = newError(http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received.")
+	errBucketNotEmpty        = newError(http.StatusConflict, "BucketNotEmpty", "The bucket you tried to delete is not empty.")
+	errCacheFull             = newError(http.StatusBadRequest, "EntityTooLarge", "Your proposed upload would take the uploads stored by the server over --vfs-cache-max-size.")
+	errContentSHA256Mismatch = newError(http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed.")
+	errEntityTooSmall        = newError(http.StatusBadRequest, "EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size.")
+	errExpiredToken          = newError(http.StatusForbidden, "AccessDenied", "Request has expired")
+	errInternal              = newError(http.StatusInternalServerError, "InternalError", "We encountered an internal error. Please try again.")
+	errInvalidAccessKeyID    = newError(http.StatusForbidden, "InvalidAccessKeyId", "The AWS Access Key Id you provided does not exist in our records.")
+	errInvalidDigest         = newError(http.StatusBadRequest, "InvalidDigest", "The Content-MD5 you specified is not valid.")
+	errInvalidPart           = newError(http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found.")
+	errInvalidPartOrder      = newError(http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order.")
+	errMalformedXML          = newError(http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.")
+	errMethodNotAllowed      = newError(http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource.")
+	errMissingAuth           = newError(http.StatusForbidden, "AccessDenied", "Access Denied - no authorization supplied")
+	errNoSuchBucket          = newError(http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist.")
+	errNoSuchKey             = newError(http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+	errNoSuchUpload          = newError(http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist.")
+	errNotImplemented        = newError(http.StatusNotImplemented, "NotImplemented", "A header or query you provided implies functionality that is not implemented.")
+	errRequestTimeTooSkewed  = newError(http.StatusForbidden, "RequestTimeTooSkewed", "The difference between the request time and the server's time is too large.")
+	errSignatureDoesNotMatch = newError(http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided.")
+)
+
+// errorResponse is the XML body of an error
+type errorResponse struct {
+	XMLName xml.Name `xml:"Error"`
+	*s3Error
+	Resource  string `xml:"Resource"`
+	RequestID string `xml:"RequestId"`
+}
+
+// writeError writes err to the client translating it into an S3
+// error if necessary
+func (s *server) writeError(w http.ResponseWriter, r *http.Request, requestID string, err error) {
+	s3Err, ok := errors.Cause(err).(*s3Error)
+	if !ok {
+		switch errors.Cause(err) {
+		case vfs.ENOENT:
+			s3Err = errNoSuchKey
+		case vfs.EROFS, vfs.EPERM, vfs.ELOCKED:
+			s3Err = errAccessDenied
+		default:
+			fs.Errorf(r.URL.Path, "%s request failed: %v", r.Method, err)
+			s3Err = errInternal
+		}
+	}
+	fs.Debugf(r.URL.Path, "%s request error: %v", r.Method, err)
+	if r.Method == "HEAD" {
+		w.WriteHeader(s3Err.Status)
+		return
+	}
+	writeXML(w, s3Err.Status, &errorResponse{
+		s3Error:   s3Err,
+		Resource:  r.URL.Path,
+		RequestID: requestID,
+	})
+}
+
+// writeXML writes out as the XML response body with the status given
+func writeXML(w http.ResponseWriter, status int, out interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, err := w.Write([]byte(xml.Header))
+	if err == nil {
+		err = xml.NewEncoder(w).Encode(out)
+	}
+	if err != nil {
+		fs.Errorf(nil, "Failed to write XML response: %v", err)
+	}
+}
+
+// splitPath splits the URL path into bucket and key
+func splitPath(urlPath string) (bucket, key string) {
+	urlPath = strings.TrimPrefix(urlPath, "/")
+	i := strings.IndexRune(urlPath, '/')
+	if i < 0 {
+		return urlPath, ""
+	}
+	return urlPath[:i], urlPath[i+1:]
+}
+
+// checkKey checks the key is a valid relative path, allowing a
+// trailing / for directory markers
+func checkKey(key string) error {
+	for _, segment := range strings.Split(strings.TrimSuffix(key, "/"), "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return newError(http.StatusBadRequest, "InvalidArgument", fmt.Sprintf("Unsupported object key %q", key))
+		}
+	}
+	return nil
+}
+
+// handler serves the S3 API dispatching on path then method
+func (s *server) handler(w http.ResponseWriter, r *http.Request) {
+	requestID := fmt.Sprintf("%016X", atomic.AddUint64(&s.requestID, 1))
+	w.Header().Set("Server", "rclone/"+fs.Version)
+	w.Header().Set("X-Amz-Request-Id", requestID)
+	fs.Debugf(r.URL.Path, "%s %s", r.Method, r.URL.RawQuery)
+	err := s.serve(w, r)
+	if err != nil {
+		s.writeError(w, r, requestID, err)
+	}
+}
+
+// serve the request returning an error if it failed
+func (s *server) serve(w http.ResponseWriter, r *http.Request) error {
+	err := s.authenticate(r)
+	if err != nil {
+		return err
+	}
+	err = checkContentMD5(r)
+	if err != nil {
+		return err
+	}
+	q := r.URL.Query()
+	for _, subResource := range unsupportedSubResources {
+		if _, found := q[subResource]; found {
+			return errNotImplemented
+		}
+	}
+	bucket, key := splitPath(r.URL.Path)
+	if bucket == "" {
+		if r.Method != "GET" {
+			return errMethodNotAllowed
+		}
+		return s.listBuckets(w, r)
+	}
+	if err := checkKey(bucket); err != nil {
+		return err
+	}
+	if key == "" {
+		return s.serveBucket(w, r, bucket)
+	}
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	_, isUpload := q["uploadId"]
+	switch r.Method {
+	case "GET":
+		if isUpload {
+			return errNotImplemented
+		}
+		return s.getObject(w, r, bucket, key)
+	case "HEAD":
+		return s.headObject(w, r, bucket, key)
+	case "PUT":
+		if isUpload {
+			if r.Header.Get("X-Amz-Copy-Source") != "" {
+				return s.uploadPartCopy(w, r, bucket, key)
+			}
+			return s.uploadPart(w, r, bucket, key)
+		}
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			return s.copyObject(w, r, bucket, key)
+		}
+		return s.putObject(w, r, bucket, key)
+	case "DELETE":
+		if isUpload {
+			return s.abortMultipartUpload(w, r, bucket, key)
+		}
+		return s.deleteObject(w, r, bucket, key)
+	case "POST":
+		if _, found := q["uploads"]; found {
+			return s.createMultipartUpload(w, r, bucket, key)
+		}
+		if isUpload {
+			return s.completeMultipartUpload(w, r, bucket, key)
+		}
+	}
+	return errMethodNotAllowed
+}
+
+// serveBucket serves the operations on a bucket
+func (s *server) serveBucket(w http.ResponseWriter, r *http.Request, bucket string) error {
+	q := r.URL.Query()
+	switch r.Method {
+	case "GET":
+		if _, found := q["location"]; found {
+			return s.getBucketLocation(w, r, bucket)
+		}
+		if _, found := q["uploads"]; found {
+			return errNotImplemented
+		}
+		return s.listObjects(w, r, bucket)
+	case "HEAD":
+		_, err := s.bucketDir(bucket)
+		return err
+	case "PUT":
+		return s.createBucket(w, r, bucket)
+	case "DELETE":
+		return s.deleteBucket(w, r, bucket)
+	case "POST":
+		if _, found := q["delete"]; found {
+			return s.deleteObjects(w, r, bucket)
+		}
+	}
+	return errMethodNotAllowed
+}
+
+// bucketDir returns the directory for the bucket or errNoSuchBucket
+func (s *server) bucketDir(bucket string) (*vfs.Dir, error) {
+	node, err := s.vfs.Stat(bucket)
+	if err == vfs.ENOENT || (err == nil && !node.IsDir()) {
+		return nil, errNoSuchBucket
+	}
+	if err != nil {
+		return nil, err
+	}
+	return node.(*vfs.Dir), nil
+}
+
+// bucket describes a bucket in the ListBuckets response
+type bucketInfo struct {
+	Name         string
+	CreationDate string
+}
+
+// listAllMyBucketsResult is the response to ListBuckets
+type listAllMyBucketsResult struct {
+	XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Owner   owner
+	Buckets []bucketInfo `xml:"Buckets>Bucket"`
+}
+
+// owner is the owner of all the buckets and objects
+type owner struct {
+	ID          string
+	DisplayName string
+}
+
+// rcloneOwner is returned as the owner of everything
+var rcloneOwner = owner{
+	ID:          "rclone",
+	DisplayName: "rclone",
+}
+
+// listBuckets lists the top level directories as buckets
+func (s *server) listBuckets(w http.ResponseWriter, r *http.Request) error {
+	root, err := s.vfs.Root()
+	if err != nil {
+		return err
+	}
+	nodes, err := root.ReadDirAll()
+	if err != nil {
+		return err
+	}
+	out := listAllMyBucketsResult{
+		Xmlns:   xmlNamespace,
+		Owner:   rcloneOwner,
+		Buckets: []bucketInfo{},
+	}
+	for _, node := range nodes {
+		if !node.IsDir() {
+			continue
+		}
+		out.Buckets = append(out.Buckets, bucketInfo{
+			Name:         node.Name(),
+			CreationDate: formatTime(node.ModTime()),
+		})
+	}
+	writeXML(w, http.StatusOK, &out)
+	return nil
+}
+
+// locationConstraint is the response to GetBucketLocation
+type locationConstraint struct {
+	XMLName  xml.Name `xml:"LocationConstraint"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:",chardata"`
+}
+
+// getBucketLocation returns an empty location meaning us-east-1
+func (s *server) getBucketLocation(w http.ResponseWriter, r *http.Request, bucket string) error {
+	_, err := s.bucketDir(bucket)
+	if err != nil {
+		return err
+	}
+	writeXML(w, http.StatusOK, &locationConstraint{Xmlns: xmlNamespace})
+	return nil
+}
+
+// createBucket makes the directory for the bucket, succeeding if it
+// already exists
+func (s *server) createBucket(w http.ResponseWriter, r *http.Request, bucket string) error {
+	root, err := s.vfs.Root()
+	if err != nil {
+		return err
+	}
+	node, err := root.Stat(bucket)
+	if err == nil && !node.IsDir() {
+		return newError(http.StatusConflict, "BucketAlreadyExists", "The requested bucket name is not available.")
+	}
+	if err == vfs.ENOENT {
+		_, err = root.Mkdir(bucket)
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", "/"+bucket)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// deleteBucket removes the bucket's directory if it is empty
+func (s *server) deleteBucket(w http.ResponseWriter, r *http.Request, bucket string) error {
+	dir, err := s.bucketDir(bucket)
+	if err != nil {
+		return err
+	}
+	err = dir.Remove()
+	if err == vfs.ENOTEMPTY {
+		return errBucketNotEmpty
+	}
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// objectPath returns the VFS path of key in bucket
+func objectPath(bucket, key string) string {
+	return path.Join(bucket, key)
+}
@@ -6,9 +6,13 @@ import (
 	"github.com/ncw/rclone/cmd/serve/dlna"
 
 	"github.com/ncw/rclone/cmd"
+	"github.com/ncw/rclone/cmd/serve/docker"
 	"github.com/ncw/rclone/cmd/serve/ftp"
 	"github.com/ncw/rclone/cmd/serve/http"
+	"github.com/ncw/rclone/cmd/serve/nfs"
 	"github.com/ncw/rclone/cmd/serve/restic"
+	"github.com/ncw/rclone/cmd/serve/s3"
+	"github.com/ncw/rclone/cmd/serve/sftp"
 	"github.com/ncw/rclone/cmd/serve/webdav"
 	"github.com/spf13/cobra"
 )
@@ -27,6 +31,14 @@ func init() {
 	if ftp.Command != nil {
 		Command.AddCommand(ftp.Command)
 	}
+	if sftp.Command != nil {
+		Command.AddCommand(sftp.Command)
+	}
+	Command.AddCommand(s3.Command)
+	Command.AddCommand(nfs.Command)
+	if docker.Command != nil {
+		Command.AddCommand(docker.Command)
+	}
 	cmd.Root.AddCommand(Command)
 }
 
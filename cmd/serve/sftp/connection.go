@@ -0,0 +1,257 @@
+// +build !plan9
+
+package sftp
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/vfs"
+	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Hashes of the string "abc\n" which the rclone sftp backend uses to
+// find out which hashes the server supports.
+var hashTests = map[hash.Type]string{
+	hash.MD5:  "0bee89b07a248e27c83fc3d5951213c1",
+	hash.SHA1: "03cfd743661f07975fa2f1220c5194cbaff48451",
+}
+
+// Hashes of the empty string for when no file is supplied
+var emptyHashes = map[hash.Type]string{
+	hash.MD5:  "d41d8cd98f00b204e9800998ecf8427e",
+	hash.SHA1: "da39a3ee5e6b4b0d3255bfef95601890afd80709",
+}
+
+// conn encapsulates a single SSH connection
+type conn struct {
+	what string
+	vfs  *vfs.VFS
+}
+
+// execCommand implements an extremely limited shell so that the
+// rclone sftp backend can read hashes and disk usage.
+func (c *conn) execCommand(out io.Writer, command string) (err error) {
+	binary, args := command, ""
+	space := strings.Index(command, " ")
+	if space >= 0 {
+		binary = command[:space]
+		args = strings.TrimLeft(command[space+1:], " ")
+	}
+	args = shellUnEscape(args)
+	fs.Debugf(c.what, "exec command: binary = %q, args = %q", binary, args)
+	switch binary {
+	case "df":
+		total, used, free := c.vfs.Statfs()
+		if total < 0 {
+			return errors.New("df not supported")
+		}
+		perc := 0
+		if total > 0 && used >= 0 {
+			perc = int(100 * used / total)
+		}
+		_, err = fmt.Fprintf(out, "%-14s %10s %10s %10s %4s %s\n", "Filesystem", "1K-blocks", "Used", "Available", "Use%", "Mounted on")
+		if err != nil {
+			return errors.Wrap(err, "send output failed")
+		}
+		_, err = fmt.Fprintf(out, "%-14s %10d %10d %10d %3d%% %s\n", "rclone", total/1024, used/1024, free/1024, perc, "/")
+		if err != nil {
+			return errors.Wrap(err, "send output failed")
+		}
+	case "md5sum", "sha1sum":
+		ht := hash.MD5
+		if binary == "sha1sum" {
+			ht = hash.SHA1
+		}
+		if !c.vfs.Fs().Hashes().Contains(ht) {
+			return errors.Errorf("%v hash not supported", ht)
+		}
+		var hashSum string
+		if args == "" {
+			// empty hash for no input
+			hashSum = emptyHashes[ht]
+			args = "-"
+		} else {
+			node, err := c.vfs.Stat(args)
+			if err != nil {
+				return errors.Wrapf(err, "hash failed finding file %q", args)
+			}
+			if node.IsDir() {
+				return errors.New("can't hash directory")
+			}
+			o, ok := node.DirEntry().(fs.ObjectInfo)
+			if !ok {
+				return errors.New("unexpected non file")
+			}
+			hashSum, err = o.Hash(ht)
+			if err != nil {
+				return errors.Wrap(err, "hash failed")
+			}
+			if hashSum == "" {
+				// The remote didn't supply the hash so
+				// read the file to calculate it
+				hashSum, err = c.hashFile(args, ht)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		_, err = fmt.Fprintf(out, "%s  %s\n", hashSum, args)
+		if err != nil {
+			return errors.Wrap(err, "send output failed")
+		}
+	case "echo":
+		// special cases for rclone command detection
+		var ht hash.Type
+		switch args {
+		case "'abc' | md5sum":
+			ht = hash.MD5
+		case "'abc' | sha1sum":
+			ht = hash.SHA1
+		default:
+			_, err = fmt.Fprintf(out, "%s\n", args)
+			if err != nil {
+				return errors.Wrap(err, "send output failed")
+			}
+			return nil
+		}
+		if !c.vfs.Fs().Hashes().Contains(ht) {
+			return errors.Errorf("%v hash not supported", ht)
+		}
+		_, err = fmt.Fprintf(out, "%s  -\n", hashTests[ht])
+		if err != nil {
+			return errors.Wrap(err, "send output failed")
+		}
+	default:
+		return errors.Errorf("%q not implemented", command)
+	}
+	return nil
+}
+
+// hashFile reads the file at path calculating its hash of type ht
+func (c *conn) hashFile(path string, ht hash.Type) (hashSum string, err error) {
+	in, err := c.vfs.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return "", errors.Wrap(err, "hash failed opening file")
+	}
+	defer fs.CheckClose(in, &err)
+	hashes, err := hash.StreamTypes(in, hash.NewHashSet(ht))
+	if err != nil {
+		return "", errors.Wrap(err, "hash failed reading file")
+	}
+	return hashes[ht], nil
+}
+
+// handle a new incoming channel request
+func (c *conn) handleChannel(newChannel ssh.NewChannel) {
+	fs.Debugf(c.what, "Incoming channel: %s", newChannel.ChannelType())
+	if newChannel.ChannelType() != "session" {
+		err := newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+		fs.Debugf(c.what, "Unknown channel type: %s", newChannel.ChannelType())
+		if err != nil {
+			fs.Errorf(c.what, "Failed to reject unknown channel: %v", err)
+		}
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		fs.Errorf(c.what, "could not accept channel: %v", err)
+		return
+	}
+	defer func() {
+		err := channel.Close()
+		if err != nil && err != io.EOF {
+			fs.Debugf(c.what, "Failed to close channel: %v", err)
+		}
+	}()
+	fs.Debugf(c.what, "Channel accepted")
+
+	// Sessions have out-of-band requests such as "shell",
+	// "pty-req" and "env".  Here we handle only the "subsystem"
+	// request for sftp and "exec" for the hashes and df.
+	for req := range requests {
+		var start func()
+		switch req.Type {
+		case "subsystem":
+			var subsystem struct{ Name string }
+			if ssh.Unmarshal(req.Payload, &subsystem) == nil && subsystem.Name == "sftp" {
+				start = func() { c.handleSFTP(channel) }
+			}
+		case "exec":
+			var exec struct{ Command string }
+			if ssh.Unmarshal(req.Payload, &exec) == nil {
+				start = func() { c.handleExec(channel, exec.Command) }
+			}
+		}
+		fs.Debugf(c.what, " - accepted %s request: %v", req.Type, start != nil)
+		err := req.Reply(start != nil, nil)
+		if err != nil {
+			fs.Errorf(c.what, "Failed to Reply to request: %v", err)
+			return
+		}
+		if start != nil {
+			go start()
+		}
+	}
+}
+
+// serveChannels serves each incoming channel in its own go routine
+// until the connection is closed
+func (c *conn) serveChannels(chans <-chan ssh.NewChannel) {
+	for newChannel := range chans {
+		go c.handleChannel(newChannel)
+	}
+	fs.Debugf(c.what, "Connection closed")
+}
+
+// handleSFTP serves the sftp subsystem on channel
+func (c *conn) handleSFTP(channel ssh.Channel) {
+	server := sftp.NewRequestServer(channel, newVFSHandler(c.vfs))
+	err := server.Serve()
+	if err == nil || err == io.EOF {
+		fs.Debugf(c.what, "exited session")
+	} else {
+		fs.Errorf(c.what, "completed with error: %v", err)
+	}
+	err = server.Close()
+	if err != nil && err != io.EOF {
+		fs.Debugf(c.what, "Failed to close sftp server: %v", err)
+	}
+}
+
+// handleExec runs command on channel sending the exit status back
+// and closing the channel when done
+func (c *conn) handleExec(channel ssh.Channel, command string) {
+	var status uint32
+	err := c.execCommand(channel, command)
+	if err != nil {
+		fs.Errorf(c.what, "Failed to run command %q: %v", command, err)
+		_, _ = fmt.Fprintf(channel.Stderr(), "%v\n", err)
+		status = 1
+	}
+	_, err = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+	if err != nil {
+		fs.Debugf(c.what, "Failed to send exit status: %v", err)
+	}
+	err = channel.Close()
+	if err != nil && err != io.EOF {
+		fs.Debugf(c.what, "Failed to close channel: %v", err)
+	}
+}
+
+var shellUnEscapeRegex = regexp.MustCompile(`\\(.)`)
+
+// shellUnEscape unescapes a string that was escaped by the rclone sftp
+// backend's shellEscape
+func shellUnEscape(str string) string {
+	str = strings.Replace(str, "'\n'", "\n", -1)
+	str = shellUnEscapeRegex.ReplaceAllString(str, `$1`)
+	return str
+}
@@ -0,0 +1,82 @@
+// +build !plan9
+
+package sftp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	_ "github.com/ncw/rclone/backend/local"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShellUnEscape(t *testing.T) {
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"potato", "potato"},
+		{`dir/file\ with\ spaces.txt`, "dir/file with spaces.txt"},
+		{`\$\(rm\ -rf\)`, "$(rm -rf)"},
+		{`back\\slash`, `back\slash`},
+		{"new'\n'line", "new\nline"},
+	} {
+		got := shellUnEscape(test.in)
+		assert.Equal(t, test.want, got, test.in)
+	}
+}
+
+func TestExecCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rclone-serve-sftp")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	f, err := fs.NewFs(dir)
+	require.NoError(t, err)
+	c := &conn{
+		what: "test",
+		vfs:  vfs.New(f, nil),
+	}
+
+	// local supports MD5 and SHA1 so both should be detected
+	for _, test := range []struct {
+		command string
+		want    string
+	}{
+		{"echo 'abc' | md5sum", "0bee89b07a248e27c83fc3d5951213c1  -\n"},
+		{"echo 'abc' | sha1sum", "03cfd743661f07975fa2f1220c5194cbaff48451  -\n"},
+		{"echo potato", "potato\n"},
+		{"md5sum", "d41d8cd98f00b204e9800998ecf8427e  -\n"},
+	} {
+		var out bytes.Buffer
+		err := c.execCommand(&out, test.command)
+		require.NoError(t, err, test.command)
+		assert.Equal(t, test.want, out.String(), test.command)
+	}
+
+	// Hash a file
+	fd, err := c.vfs.OpenFile("file name.txt", os.O_WRONLY|os.O_CREATE, 0777)
+	require.NoError(t, err)
+	_, err = fd.Write([]byte("abc\n"))
+	require.NoError(t, err)
+	require.NoError(t, fd.Close())
+	var out bytes.Buffer
+	err = c.execCommand(&out, `sha1sum file\ name.txt`)
+	require.NoError(t, err)
+	assert.Equal(t, "03cfd743661f07975fa2f1220c5194cbaff48451  file name.txt\n", out.String())
+
+	// Errors
+	for _, command := range []string{
+		"md5sum notfound.txt",
+		"rm -rf /",
+	} {
+		err := c.execCommand(&out, command)
+		assert.Error(t, err, command)
+	}
+}
@@ -0,0 +1,157 @@
+// +build !plan9
+
+package sftp
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/vfs"
+	"github.com/pkg/sftp"
+)
+
+// vfsHandler converts the VFS to be served by SFTP
+type vfsHandler struct {
+	*vfs.VFS
+}
+
+// vfsHandler returns a Handlers object with the test handlers.
+func newVFSHandler(vfs *vfs.VFS) sftp.Handlers {
+	v := vfsHandler{VFS: vfs}
+	return sftp.Handlers{
+		FileGet:  v,
+		FilePut:  v,
+		FileCmd:  v,
+		FileList: v,
+	}
+}
+
+// Fileread opens the file for reading
+func (v vfsHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	file, err := v.OpenFile(r.Filepath, os.O_RDONLY, 0777)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Filewrite opens the file for writing using the flags in the request
+func (v vfsHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	pflags := r.Pflags()
+	flags := os.O_WRONLY
+	if pflags.Read {
+		flags = os.O_RDWR
+	}
+	if pflags.Creat {
+		flags |= os.O_CREATE
+	}
+	if pflags.Trunc {
+		flags |= os.O_TRUNC
+	}
+	if pflags.Excl {
+		flags |= os.O_EXCL
+	}
+	if pflags.Append {
+		flags |= os.O_APPEND
+	}
+	file, err := v.OpenFile(r.Filepath, flags, 0777)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Filecmd runs the non read/write commands
+func (v vfsHandler) Filecmd(r *sftp.Request) error {
+	switch r.Method {
+	case "Setstat":
+		node, err := v.Stat(r.Filepath)
+		if err != nil {
+			return err
+		}
+		attr := r.Attributes()
+		flags := r.AttrFlags()
+		if flags.Size {
+			err = node.Truncate(int64(attr.Size))
+			if err != nil {
+				return err
+			}
+		}
+		if flags.Acmodtime && attr.Mtime != 0 {
+			err = node.SetModTime(time.Unix(int64(attr.Mtime), 0))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case "Rename":
+		return v.Rename(r.Filepath, r.Target)
+	case "Rmdir", "Remove":
+		node, err := v.Stat(r.Filepath)
+		if err != nil {
+			return err
+		}
+		return node.Remove()
+	case "Mkdir":
+		dir, leaf, err := v.StatParent(r.Filepath)
+		if err != nil {
+			return err
+		}
+		_, err = dir.Mkdir(leaf)
+		return err
+	case "Symlink":
+		return sftp.ErrSshFxOpUnsupported
+	}
+	return sftp.ErrSshFxOpUnsupported
+}
+
+// listerat implements sftp.ListerAt on a slice of os.FileInfo
+type listerat []os.FileInfo
+
+// ListAt copies the entries from offset into ls
+func (f listerat) ListAt(ls []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(f)) {
+		return 0, io.EOF
+	}
+	n := copy(ls, f[offset:])
+	if n < len(ls) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Filelist lists directories and stats files
+func (v vfsHandler) Filelist(r *sftp.Request) (l sftp.ListerAt, err error) {
+	switch r.Method {
+	case "List":
+		node, err := v.Stat(r.Filepath)
+		if err != nil {
+			return nil, err
+		}
+		if !node.IsDir() {
+			return nil, syscall.ENOTDIR
+		}
+		handle, err := node.Open(os.O_RDONLY)
+		if err != nil {
+			return nil, err
+		}
+		defer fs.CheckClose(handle, &err)
+		fis, err := handle.Readdir(-1)
+		if err != nil {
+			return nil, err
+		}
+		return listerat(fis), nil
+	case "Stat":
+		node, err := v.Stat(r.Filepath)
+		if err != nil {
+			return nil, err
+		}
+		return listerat([]os.FileInfo{node}), nil
+	case "Readlink":
+		return nil, sftp.ErrSshFxOpUnsupported
+	}
+	return nil, sftp.ErrSshFxOpUnsupported
+}
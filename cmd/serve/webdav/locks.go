@@ -0,0 +1,331 @@
+//+build go1.9
+
+package webdav
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/vfs"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+// lock is a single webdav lock
+type lock struct {
+	Token     string
+	Root      string
+	Duration  time.Duration // negative means infinite
+	OwnerXML  string
+	ZeroDepth bool
+	Expiry    time.Time // zero if Duration is infinite
+	held      bool      // set while a request is using the lock
+}
+
+// details returns the lock as webdav.LockDetails
+func (l *lock) details() webdav.LockDetails {
+	return webdav.LockDetails{
+		Root:      l.Root,
+		Duration:  l.Duration,
+		OwnerXML:  l.OwnerXML,
+		ZeroDepth: l.ZeroDepth,
+	}
+}
+
+// covers returns true if the lock applies to name
+func (l *lock) covers(name string) bool {
+	if name == l.Root {
+		return true
+	}
+	if l.ZeroDepth {
+		return false
+	}
+	return l.Root == "/" || strings.HasPrefix(name, l.Root+"/")
+}
+
+// temporary returns true if this is one of the locks the webdav
+// handler makes for the length of a request from a client which
+// doesn't use locks.  These have no owner and never expire.
+//
+// They aren't saved and don't stop the VFS being changed as they
+// are only there to stop other webdav clients getting in the way of
+// the request.
+func (l *lock) temporary() bool {
+	return l.OwnerXML == "" && l.Duration < 0
+}
+
+// setExpiry sets the expiry time from the duration
+func (l *lock) setExpiry(now time.Time) {
+	if l.Duration < 0 {
+		l.Expiry = time.Time{}
+	} else {
+		l.Expiry = now.Add(l.Duration)
+	}
+}
+
+// expired returns true if the lock has expired at now
+func (l *lock) expired(now time.Time) bool {
+	return !l.held && !l.Expiry.IsZero() && !now.Before(l.Expiry)
+}
+
+// lockSystem is a webdav.LockSystem which saves its locks to a file
+// so they survive restarts and which can stop locked paths being
+// changed through the VFS by anything other than the lock holder.
+type lockSystem struct {
+	mu      sync.Mutex
+	file    string // where to save the locks - "" for memory only
+	byToken map[string]*lock
+}
+
+// check interface
+var _ webdav.LockSystem = (*lockSystem)(nil)
+
+// newLockSystem makes a lock system saving its locks in file, loading
+// any saved there already.  If file is "" then the locks are kept in
+// memory only.
+func newLockSystem(file string) (*lockSystem, error) {
+	ls := &lockSystem{
+		file:    file,
+		byToken: make(map[string]*lock),
+	}
+	if file == "" {
+		return ls, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return ls, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to read webdav locks")
+	}
+	var locks []*lock
+	err = json.Unmarshal(data, &locks)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode webdav locks")
+	}
+	now := time.Now()
+	for _, l := range locks {
+		if !l.expired(now) {
+			ls.byToken[l.Token] = l
+		}
+	}
+	fs.Debugf(nil, "WebDAV: loaded %d locks from %q", len(ls.byToken), file)
+	return ls, nil
+}
+
+// save writes the locks to the file if set - call with mu held
+func (ls *lockSystem) save() {
+	if ls.file == "" {
+		return
+	}
+	locks := []*lock{}
+	for _, l := range ls.byToken {
+		if !l.temporary() {
+			locks = append(locks, l)
+		}
+	}
+	data, err := json.MarshalIndent(locks, "", "\t")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(ls.file), 0700)
+	}
+	if err == nil {
+		tmp := ls.file + ".tmp"
+		err = ioutil.WriteFile(tmp, data, 0600)
+		if err == nil {
+			err = os.Rename(tmp, ls.file)
+		}
+	}
+	if err != nil {
+		fs.Errorf(nil, "WebDAV: failed to save locks: %v", err)
+	}
+}
+
+// expire removes any expired locks - call with mu held
+func (ls *lockSystem) expire(now time.Time) {
+	changed := false
+	for token, l := range ls.byToken {
+		if l.expired(now) {
+			delete(ls.byToken, token)
+			changed = changed || !l.temporary()
+		}
+	}
+	if changed {
+		ls.save()
+	}
+}
+
+// unused returns true if there are no locks which haven't expired
+func (ls *lockSystem) unused(now time.Time) bool {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.expire(now)
+	return len(ls.byToken) == 0
+}
+
+// lookup finds a lock matching one of the conditions which covers
+// name and isn't held - call with mu held
+func (ls *lockSystem) lookup(name string, conditions ...webdav.Condition) *lock {
+	for _, c := range conditions {
+		l := ls.byToken[c.Token]
+		if l != nil && !l.held && l.covers(name) {
+			return l
+		}
+	}
+	return nil
+}
+
+// Confirm confirms that the caller can claim all of the locks
+// specified by the conditions - see webdav.LockSystem
+func (ls *lockSystem) Confirm(now time.Time, name0, name1 string, conditions ...webdav.Condition) (func(), error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.expire(now)
+
+	var l0, l1 *lock
+	if name0 != "" {
+		if l0 = ls.lookup(path.Clean(name0), conditions...); l0 == nil {
+			return nil, webdav.ErrConfirmationFailed
+		}
+	}
+	if name1 != "" {
+		if l1 = ls.lookup(path.Clean(name1), conditions...); l1 == nil {
+			return nil, webdav.ErrConfirmationFailed
+		}
+	}
+	if l1 == l0 {
+		l1 = nil
+	}
+	for _, l := range []*lock{l0, l1} {
+		if l != nil {
+			l.held = true
+		}
+	}
+	return func() {
+		ls.mu.Lock()
+		defer ls.mu.Unlock()
+		for _, l := range []*lock{l0, l1} {
+			if l != nil {
+				l.held = false
+			}
+		}
+	}, nil
+}
+
+// canCreate returns true if a lock can be made on root - call with mu held
+func (ls *lockSystem) canCreate(root string, zeroDepth bool) bool {
+	for _, l := range ls.byToken {
+		if l.covers(root) {
+			return false
+		}
+		// a new infinite depth lock can't cover an existing lock
+		if !zeroDepth && (root == "/" || strings.HasPrefix(l.Root, root+"/")) {
+			return false
+		}
+	}
+	return true
+}
+
+// newToken makes a new unique lock token
+func newToken() (string, error) {
+	var b [16]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("opaquelocktoken:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// Create creates a lock - see webdav.LockSystem
+func (ls *lockSystem) Create(now time.Time, details webdav.LockDetails) (string, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.expire(now)
+
+	root := path.Clean("/" + details.Root)
+	if !ls.canCreate(root, details.ZeroDepth) {
+		return "", webdav.ErrLocked
+	}
+	token, err := newToken()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to make lock token")
+	}
+	l := &lock{
+		Token:     token,
+		Root:      root,
+		Duration:  details.Duration,
+		OwnerXML:  details.OwnerXML,
+		ZeroDepth: details.ZeroDepth,
+	}
+	l.setExpiry(now)
+	ls.byToken[token] = l
+	if !l.temporary() {
+		ls.save()
+	}
+	return token, nil
+}
+
+// Refresh refreshes the lock with the given token - see webdav.LockSystem
+func (ls *lockSystem) Refresh(now time.Time, token string, duration time.Duration) (webdav.LockDetails, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.expire(now)
+
+	l := ls.byToken[token]
+	if l == nil {
+		return webdav.LockDetails{}, webdav.ErrNoSuchLock
+	}
+	if l.held {
+		return webdav.LockDetails{}, webdav.ErrLocked
+	}
+	l.Duration = duration
+	l.setExpiry(now)
+	ls.save()
+	return l.details(), nil
+}
+
+// Unlock unlocks the lock with the given token - see webdav.LockSystem
+func (ls *lockSystem) Unlock(now time.Time, token string) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.expire(now)
+
+	l := ls.byToken[token]
+	if l == nil {
+		return webdav.ErrNoSuchLock
+	}
+	if l.held {
+		return webdav.ErrLocked
+	}
+	delete(ls.byToken, token)
+	if !l.temporary() {
+		ls.save()
+	}
+	return nil
+}
+
+// checkVFS is used as the vfs.LockChecker so nothing but the lock
+// holder can change locked paths through the VFS.
+//
+// A lock is only held by the webdav handler while it is running a
+// request which presented its token, so any other change to a path
+// covered by a lock which isn't held is refused.
+func (ls *lockSystem) checkVFS(name string) error {
+	name = path.Clean("/" + name)
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	now := time.Now()
+	for _, l := range ls.byToken {
+		if !l.held && !l.temporary() && !l.expired(now) && l.covers(name) {
+			return vfs.ELOCKED
+		}
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+//+build go1.9
+
+package webdav
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+// Names of the quota properties from RFC 4331
+var (
+	quotaAvailableName = xml.Name{Space: "DAV:", Local: "quota-available-bytes"}
+	quotaUsedName      = xml.Name{Space: "DAV:", Local: "quota-used-bytes"}
+)
+
+// propStore keeps the dead properties clients set on files and
+// directories, saving them in a file so they survive restarts.
+type propStore struct {
+	mu     sync.Mutex
+	file   string                                  // where to save the properties - "" for memory only
+	byName map[string]map[xml.Name]webdav.Property // properties by path
+}
+
+// storedProps is how the properties for one path are saved
+type storedProps struct {
+	Name  string
+	Props []webdav.Property
+}
+
+// newPropStore makes a property store saving its properties in file,
+// loading any saved there already.  If file is "" then the properties
+// are kept in memory only.
+func newPropStore(file string) (*propStore, error) {
+	ps := &propStore{
+		file:   file,
+		byName: make(map[string]map[xml.Name]webdav.Property),
+	}
+	if file == "" {
+		return ps, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return ps, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to read webdav properties")
+	}
+	var stored []storedProps
+	err = json.Unmarshal(data, &stored)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode webdav properties")
+	}
+	for _, s := range stored {
+		props := make(map[xml.Name]webdav.Property, len(s.Props))
+		for _, p := range s.Props {
+			props[p.XMLName] = p
+		}
+		ps.byName[s.Name] = props
+	}
+	return ps, nil
+}
+
+// cleanName returns name in the form the properties are stored under
+func cleanName(name string) string {
+	return path.Clean("/" + name)
+}
+
+// save writes the properties to the file if set - call with mu held
+func (ps *propStore) save() error {
+	if ps.file == "" {
+		return nil
+	}
+	stored := []storedProps{}
+	for name, props := range ps.byName {
+		s := storedProps{Name: name}
+		for _, p := range props {
+			s.Props = append(s.Props, p)
+		}
+		stored = append(stored, s)
+	}
+	data, err := json.MarshalIndent(stored, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode webdav properties")
+	}
+	err = os.MkdirAll(filepath.Dir(ps.file), 0700)
+	if err != nil {
+		return errors.Wrap(err, "failed to make webdav properties directory")
+	}
+	tmp := ps.file + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to write webdav properties")
+	}
+	return os.Rename(tmp, ps.file)
+}
+
+// get returns a copy of the properties for name
+func (ps *propStore) get(name string) map[xml.Name]webdav.Property {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	props := make(map[xml.Name]webdav.Property, len(ps.byName[cleanName(name)]))
+	for k, p := range ps.byName[cleanName(name)] {
+		props[k] = p
+	}
+	return props
+}
+
+// patch applies patches to the properties for name
+func (ps *propStore) patch(name string, patches []webdav.Proppatch) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	name = cleanName(name)
+	props := make(map[xml.Name]webdav.Property, len(ps.byName[name]))
+	for k, p := range ps.byName[name] {
+		props[k] = p
+	}
+	old, hadOld := ps.byName[name]
+	for _, patch := range patches {
+		for _, p := range patch.Props {
+			if patch.Remove {
+				delete(props, p.XMLName)
+			} else {
+				props[p.XMLName] = p
+			}
+		}
+	}
+	if len(props) == 0 {
+		delete(ps.byName, name)
+	} else {
+		ps.byName[name] = props
+	}
+	err := ps.save()
+	if err != nil {
+		// put the old properties back
+		if hadOld {
+			ps.byName[name] = old
+		} else {
+			delete(ps.byName, name)
+		}
+	}
+	return err
+}
+
+// forEachUnder calls fn for each stored name which is name or inside
+// it - call with mu held
+func (ps *propStore) forEachUnder(name string, fn func(n string)) {
+	var names []string
+	for n := range ps.byName {
+		if n == name || name == "/" || strings.HasPrefix(n, name+"/") {
+			names = append(names, n)
+		}
+	}
+	for _, n := range names {
+		fn(n)
+	}
+}
+
+// rename moves the properties for oldName and anything inside it to
+// newName
+func (ps *propStore) rename(oldName, newName string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	oldName, newName = cleanName(oldName), cleanName(newName)
+	// remove anything the rename overwrites
+	ps.forEachUnder(newName, func(n string) {
+		delete(ps.byName, n)
+	})
+	moved := false
+	ps.forEachUnder(oldName, func(n string) {
+		ps.byName[newName+n[len(oldName):]] = ps.byName[n]
+		delete(ps.byName, n)
+		moved = true
+	})
+	if moved {
+		if err := ps.save(); err != nil {
+			fs.Errorf(oldName, "WebDAV: failed to save properties after rename: %v", err)
+		}
+	}
+}
+
+// remove removes the properties for name and anything inside it
+func (ps *propStore) remove(name string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	removed := false
+	ps.forEachUnder(cleanName(name), func(n string) {
+		delete(ps.byName, n)
+		removed = true
+	})
+	if removed {
+		if err := ps.save(); err != nil {
+			fs.Errorf(name, "WebDAV: failed to save properties after remove: %v", err)
+		}
+	}
+}
+
+// DeadProps returns a copy of the dead properties of the file or
+// directory.  Directories also get the RFC 4331 quota properties if
+// the remote can report them.
+func (h Handle) DeadProps() (map[xml.Name]webdav.Property, error) {
+	node := h.Handle.Node()
+	props := h.props.get(node.Path())
+	if node.IsDir() {
+		_, used, free := h.vfs.Statfs()
+		if free >= 0 {
+			props[quotaAvailableName] = webdav.Property{XMLName: quotaAvailableName, InnerXML: []byte(strconv.FormatInt(free, 10))}
+		}
+		if used >= 0 {
+			props[quotaUsedName] = webdav.Property{XMLName: quotaUsedName, InnerXML: []byte(strconv.FormatInt(used, 10))}
+		}
+	}
+	return props, nil
+}
+
+// Patch patches the dead properties of the file or directory.  The
+// quota properties can't be changed.
+func (h Handle) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	pstatOK := webdav.Propstat{Status: http.StatusOK}
+	pstatForbidden := webdav.Propstat{
+		Status:   http.StatusForbidden,
+		XMLError: `<D:cannot-modify-protected-property xmlns:D="DAV:"/>`,
+	}
+	pstatFailedDep := webdav.Propstat{Status: webdav.StatusFailedDependency}
+	for _, patch := range patches {
+		for _, p := range patch.Props {
+			pstatOK.Props = append(pstatOK.Props, webdav.Property{XMLName: p.XMLName})
+			if p.XMLName == quotaAvailableName || p.XMLName == quotaUsedName {
+				pstatForbidden.Props = append(pstatForbidden.Props, webdav.Property{XMLName: p.XMLName})
+			} else {
+				pstatFailedDep.Props = append(pstatFailedDep.Props, webdav.Property{XMLName: p.XMLName})
+			}
+		}
+	}
+	// patching is all or nothing
+	if len(pstatForbidden.Props) != 0 {
+		if len(pstatFailedDep.Props) == 0 {
+			return []webdav.Propstat{pstatForbidden}, nil
+		}
+		return []webdav.Propstat{pstatForbidden, pstatFailedDep}, nil
+	}
+	err := h.props.patch(h.Handle.Node().Path(), patches)
+	if err != nil {
+		return nil, err
+	}
+	return []webdav.Propstat{pstatOK}, nil
+}
+
+// check interface
+var _ webdav.DeadPropsHolder = Handle{}
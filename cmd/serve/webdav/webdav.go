@@ -5,15 +5,27 @@ package webdav
 import (
 	"net/http"
 	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/ncw/rclone/cmd"
 	"github.com/ncw/rclone/cmd/serve/httplib"
 	"github.com/ncw/rclone/cmd/serve/httplib/httpflags"
+	"github.com/ncw/rclone/cmd/serve/multi"
+	"github.com/ncw/rclone/cmd/serve/multi/multiflags"
+	"github.com/ncw/rclone/cmd/serve/proxy"
+	"github.com/ncw/rclone/cmd/serve/proxy/proxyflags"
 	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config"
 	"github.com/ncw/rclone/fs/hash"
 	"github.com/ncw/rclone/fs/log"
 	"github.com/ncw/rclone/vfs"
 	"github.com/ncw/rclone/vfs/vfsflags"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"golang.org/x/net/context" // switch to "context" when we stop supporting go1.8
 	"golang.org/x/net/webdav"
@@ -27,12 +39,14 @@ var (
 func init() {
 	httpflags.AddFlags(Command.Flags())
 	vfsflags.AddFlags(Command.Flags())
+	proxyflags.AddFlags(Command.Flags())
+	multiflags.AddFlags(Command.Flags())
 	Command.Flags().StringVar(&hashName, "etag-hash", "", "Which hash to use for the ETag, or auto or blank for off")
 }
 
 // Command definition for cobra
 var Command = &cobra.Command{
-	Use:   "webdav remote:path",
+	Use:   "webdav remote:path [name=remote:path]*",
 	Short: `Serve remote:path over webdav.`,
 	Long: `
 rclone serve webdav implements a basic webdav server to serve the
@@ -53,12 +67,41 @@ supported hash on the backend or you can use a named hash such as
 
 Use "rclone hashsum" to see the full list.
 
-` + httplib.Help + vfs.Help,
+### Locking and properties
+
+Locks taken by webdav clients, as Windows Explorer, macOS Finder and
+office programs do when editing files, are saved in the cache
+directory so they survive restarts of the server.  While a file or
+directory is locked it can't be changed through rclone by anything
+other than the client holding the lock, so other clients of the same
+rclone process will get a "locked" error.
+
+Any custom properties webdav clients set on files and directories are
+saved in the cache directory too, and are moved or removed when the
+file or directory is renamed or deleted over webdav.
+
+Directories report the quota-available-bytes and quota-used-bytes
+properties from RFC 4331 if the remote supports "rclone about".
+
+When using --auth-proxy each user has their own locks and properties.
+These are kept in memory and are forgotten once the user has stopped
+using the server and holds no locks.
+
+` + httplib.Help + vfs.Help + proxy.Help + multi.Help,
 	RunE: func(command *cobra.Command, args []string) error {
-		cmd.CheckArgs(1, 1, command, args)
-		f := cmd.NewFsSrc(args)
+		var f fs.Fs
+		useMulti := proxyflags.Opt.AuthProxy == "" && multi.Enabled(&multiflags.Opt, args)
+		if proxyflags.Opt.AuthProxy != "" {
+			cmd.CheckArgs(0, 0, command, args)
+		} else if !useMulti {
+			cmd.CheckArgs(1, 1, command, args)
+			f = cmd.NewFsSrc(args)
+		}
 		hashType = hash.None
 		if hashName == "auto" {
+			if f == nil {
+				return errors.New("--etag-hash auto can't be used with --auth-proxy or multiple remotes")
+			}
 			hashType = f.Hashes().GetOne()
 		} else if hashName != "" {
 			err := hashType.Set(hashName)
@@ -70,8 +113,19 @@ Use "rclone hashsum" to see the full list.
 			fs.Debugf(f, "Using hash %v for ETag", hashType)
 		}
 		cmd.Run(false, false, command, func() error {
-			s := newWebDAV(f, &httpflags.Opt)
-			err := s.serve()
+			var remotes *multi.Remotes
+			if useMulti {
+				var err error
+				remotes, err = multi.New(&multiflags.Opt, args, &vfsflags.Opt)
+				if err != nil {
+					return err
+				}
+			}
+			s, err := newWebDAV(f, remotes, &httpflags.Opt)
+			if err != nil {
+				return err
+			}
+			err = s.serve()
 			if err != nil {
 				return err
 			}
@@ -96,28 +150,213 @@ Use "rclone hashsum" to see the full list.
 // overwriting another existing file or directory is an error is OS-dependent.
 type WebDAV struct {
 	*httplib.Server
-	f   fs.Fs
-	vfs *vfs.VFS
+	f       fs.Fs
+	vfs     *vfs.VFS       // nil if using the auth proxy or multiple remotes
+	proxy   *proxy.Proxy   // set if using the auth proxy
+	remotes *multi.Remotes // set if serving multiple remotes
+	locks   *lockSystem    // nil if using the auth proxy
+	propsMu sync.Mutex
+	props   map[*vfs.VFS]*propStore  // dead properties for each VFS if not using the auth proxy
+	states  map[*vfs.VFS]*proxyState // locks and dead properties for each auth proxy VFS
+}
+
+// proxyStateExpire is how long the state for an auth proxy VFS with
+// no locks is kept after it was last used.  This is longer than the
+// auth proxy keeps unused VFSes.
+const proxyStateExpire = 10 * time.Minute
+
+// proxyState is the locks and dead properties for a VFS made by the
+// auth proxy
+type proxyState struct {
+	handler  *webdav.Handler
+	locks    *lockSystem
+	props    *propStore
+	lastUsed time.Time
 }
 
 // check interface
 var _ webdav.FileSystem = (*WebDAV)(nil)
 
-// Make a new WebDAV to serve the remote
-func newWebDAV(f fs.Fs, opt *httplib.Options) *WebDAV {
-	w := &WebDAV{
-		f:   f,
-		vfs: vfs.New(f, &vfsflags.Opt),
+// Make a new WebDAV to serve the remote, or remotes if set
+func newWebDAV(f fs.Fs, remotes *multi.Remotes, opt *httplib.Options) (w *WebDAV, err error) {
+	w = &WebDAV{
+		f:       f,
+		remotes: remotes,
+		props:   make(map[*vfs.VFS]*propStore),
+		states:  make(map[*vfs.VFS]*proxyState),
+	}
+	if remotes != nil {
+		w.locks, err = newLockSystem(filepath.Join(stateDir(remotes.Root().Fs()), "locks.json"))
+		if err != nil {
+			return nil, err
+		}
+		// the locks are on the full path so add the name of the remote
+		for _, name := range remotes.Names() {
+			name := name
+			remotes.VFS(name).SetLockChecker(func(p string) error {
+				return w.locks.checkVFS(path.Join(name, p))
+			})
+		}
+	} else if proxyflags.Opt.AuthProxy != "" {
+		w.proxy = proxy.New(&proxyflags.Opt)
+		// override auth
+		copyOpt := *opt
+		copyOpt.Auth = w.auth
+		opt = &copyOpt
+	} else {
+		w.vfs = vfs.New(f, &vfsflags.Opt)
+		w.locks, err = newLockSystem(filepath.Join(stateDir(f), "locks.json"))
+		if err != nil {
+			return nil, err
+		}
+		w.vfs.SetLockChecker(w.locks.checkVFS)
 	}
 
-	handler := &webdav.Handler{
+	var handler http.Handler
+	if w.proxy != nil {
+		// each VFS has its own locks so choose the handler per request
+		handler = http.HandlerFunc(w.serveProxy)
+	} else {
+		handler = w.newHandler(w.locks)
+	}
+
+	w.Server = httplib.NewServer(handler, opt)
+	return w, nil
+}
+
+// newHandler makes a webdav handler for w using locks
+func (w *WebDAV) newHandler(locks *lockSystem) *webdav.Handler {
+	return &webdav.Handler{
 		FileSystem: w,
-		LockSystem: webdav.NewMemLS(),
+		LockSystem: locks,
 		Logger:     w.logRequest, // FIXME
 	}
+}
 
-	w.Server = httplib.NewServer(handler, opt)
-	return w
+// getProxyState gets the locks and properties for VFS made by the auth
+// proxy, making them if necessary and forgetting those of any VFS
+// which hasn't been used for a while and has no locks.
+func (w *WebDAV) getProxyState(VFS *vfs.VFS) (*proxyState, error) {
+	w.propsMu.Lock()
+	defer w.propsMu.Unlock()
+	now := time.Now()
+	for stateVFS, state := range w.states {
+		if stateVFS != VFS && now.Sub(state.lastUsed) > proxyStateExpire && state.locks.unused(now) {
+			stateVFS.SetLockChecker(nil)
+			delete(w.states, stateVFS)
+		}
+	}
+	state := w.states[VFS]
+	if state == nil {
+		locks, err := newLockSystem("")
+		if err != nil {
+			return nil, err
+		}
+		props, err := newPropStore("")
+		if err != nil {
+			return nil, err
+		}
+		state = &proxyState{
+			handler: w.newHandler(locks),
+			locks:   locks,
+			props:   props,
+		}
+		VFS.SetLockChecker(locks.checkVFS)
+		w.states[VFS] = state
+	}
+	state.lastUsed = now
+	return state, nil
+}
+
+// serveProxy serves a request using the handler for the VFS the auth
+// proxy returned for the user
+func (w *WebDAV) serveProxy(rw http.ResponseWriter, r *http.Request) {
+	VFS, _, err := w.getVFS(r.Context(), "")
+	if err != nil {
+		fs.Errorf(nil, "WebDAV: %v", err)
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	state, err := w.getProxyState(VFS)
+	if err != nil {
+		fs.Errorf(nil, "WebDAV: failed to make locks and properties: %v", err)
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	state.handler.ServeHTTP(rw, r)
+}
+
+// stateDir returns the directory in the cache directory where the
+// locks and properties for f are saved
+func stateDir(f fs.Fs) string {
+	fRoot := filepath.FromSlash(f.Root())
+	if runtime.GOOS == "windows" {
+		if strings.HasPrefix(fRoot, `\\?`) {
+			fRoot = fRoot[3:]
+		}
+		fRoot = strings.Replace(fRoot, ":", "", -1)
+	}
+	return filepath.Join(config.CacheDir, "serve-webdav", f.Name(), fRoot)
+}
+
+// getProps gets the property store for VFS, making it if necessary
+func (w *WebDAV) getProps(VFS *vfs.VFS) (*propStore, error) {
+	if w.proxy != nil {
+		state, err := w.getProxyState(VFS)
+		if err != nil {
+			return nil, err
+		}
+		return state.props, nil
+	}
+	w.propsMu.Lock()
+	defer w.propsMu.Unlock()
+	if props := w.props[VFS]; props != nil {
+		return props, nil
+	}
+	props, err := newPropStore(filepath.Join(stateDir(VFS.Fs()), "props.json"))
+	if err != nil {
+		return nil, err
+	}
+	w.props[VFS] = props
+	return props, nil
+}
+
+// auth is called by the http server to authenticate users with the
+// auth proxy
+func (w *WebDAV) auth(user, pass string) (value interface{}, err error) {
+	VFS, err := w.proxy.Call(user, pass, false)
+	if err != nil {
+		return nil, err
+	}
+	// make the locks now so they are checked by the VFS
+	_, err = w.getProxyState(VFS)
+	if err != nil {
+		return nil, err
+	}
+	return VFS, nil
+}
+
+// getVFS gets the VFS serving name for the request and the path of
+// name within it.  This is found from the remote named in the path if
+// serving multiple remotes, from the context if using the auth proxy,
+// or is the single VFS if not.
+func (w *WebDAV) getVFS(ctx context.Context, name string) (VFS *vfs.VFS, vfsName string, err error) {
+	if w.remotes != nil {
+		VFS, vfsName = w.remotes.Split(name)
+		return VFS, vfsName, nil
+	}
+	if w.vfs != nil {
+		return w.vfs, name, nil
+	}
+	value := ctx.Value(httplib.ContextAuthKey)
+	if value == nil {
+		return nil, "", errors.New("no VFS found in context")
+	}
+	VFS, ok := value.(*vfs.VFS)
+	if !ok {
+		return nil, "", errors.Errorf("context value is not VFS: %#v", value)
+	}
+	return VFS, name, nil
 }
 
 // serve runs the http server in the background.
@@ -140,7 +379,11 @@ func (w *WebDAV) logRequest(r *http.Request, err error) {
 // Mkdir creates a directory
 func (w *WebDAV) Mkdir(ctx context.Context, name string, perm os.FileMode) (err error) {
 	defer log.Trace(name, "perm=%v", perm)("err = %v", &err)
-	dir, leaf, err := w.vfs.StatParent(name)
+	VFS, name, err := w.getVFS(ctx, name)
+	if err != nil {
+		return err
+	}
+	dir, leaf, err := VFS.StatParent(name)
 	if err != nil {
 		return err
 	}
@@ -151,17 +394,34 @@ func (w *WebDAV) Mkdir(ctx context.Context, name string, perm os.FileMode) (err
 // OpenFile opens a file or a directory
 func (w *WebDAV) OpenFile(ctx context.Context, name string, flags int, perm os.FileMode) (file webdav.File, err error) {
 	defer log.Trace(name, "flags=%v, perm=%v", flags, perm)("err = %v", &err)
-	f, err := w.vfs.OpenFile(name, flags, perm)
+	VFS, vfsName, err := w.getVFS(ctx, name)
 	if err != nil {
 		return nil, err
 	}
-	return Handle{f}, nil
+	props, err := w.getProps(VFS)
+	if err != nil {
+		return nil, err
+	}
+	// The webdav handler only opens with plain O_RDWR to patch the
+	// properties so open read only as the contents won't change.
+	if flags == os.O_RDWR {
+		flags = os.O_RDONLY
+	}
+	f, err := VFS.OpenFile(vfsName, flags, perm)
+	if err != nil {
+		return nil, err
+	}
+	return Handle{Handle: f, vfs: VFS, props: props, rootName: w.rootName(name, vfsName)}, nil
 }
 
 // RemoveAll removes a file or a directory and its contents
 func (w *WebDAV) RemoveAll(ctx context.Context, name string) (err error) {
 	defer log.Trace(name, "")("err = %v", &err)
-	node, err := w.vfs.Stat(name)
+	VFS, name, err := w.getVFS(ctx, name)
+	if err != nil {
+		return err
+	}
+	node, err := VFS.Stat(name)
 	if err != nil {
 		return err
 	}
@@ -169,28 +429,70 @@ func (w *WebDAV) RemoveAll(ctx context.Context, name string) (err error) {
 	if err != nil {
 		return err
 	}
+	props, err := w.getProps(VFS)
+	if err != nil {
+		return err
+	}
+	props.remove(name)
 	return nil
 }
 
 // Rename a file or a directory
 func (w *WebDAV) Rename(ctx context.Context, oldName, newName string) (err error) {
 	defer log.Trace(oldName, "newName=%q", newName)("err = %v", &err)
-	return w.vfs.Rename(oldName, newName)
+	VFS, oldName, err := w.getVFS(ctx, oldName)
+	if err != nil {
+		return err
+	}
+	newVFS, newName, err := w.getVFS(ctx, newName)
+	if err != nil {
+		return err
+	}
+	if newVFS != VFS {
+		return multi.ErrCrossRemote
+	}
+	err = VFS.Rename(oldName, newName)
+	if err != nil {
+		return err
+	}
+	props, err := w.getProps(VFS)
+	if err != nil {
+		return err
+	}
+	props.rename(oldName, newName)
+	return nil
 }
 
 // Stat returns info about the file or directory
 func (w *WebDAV) Stat(ctx context.Context, name string) (fi os.FileInfo, err error) {
 	defer log.Trace(name, "")("fi=%+v, err = %v", &fi, &err)
-	fi, err = w.vfs.Stat(name)
+	VFS, vfsName, err := w.getVFS(ctx, name)
 	if err != nil {
 		return nil, err
 	}
-	return FileInfo{fi}, nil
+	fi, err = VFS.Stat(vfsName)
+	if err != nil {
+		return nil, err
+	}
+	return wrapFileInfo(fi, w.rootName(name, vfsName)), nil
+}
+
+// rootName returns the name of the remote if name is the root of one
+// of multiple remotes being served, otherwise "".
+func (w *WebDAV) rootName(name, vfsName string) string {
+	name = path.Clean("/" + name)
+	if w.remotes == nil || vfsName != "" || name == "/" {
+		return ""
+	}
+	return path.Base(name)
 }
 
 // Handle represents an open file
 type Handle struct {
 	vfs.Handle
+	vfs      *vfs.VFS
+	props    *propStore
+	rootName string // name of the remote if this is its root, see WebDAV.rootName
 }
 
 // Readdir reads directory entries from the handle
@@ -212,7 +514,28 @@ func (h Handle) Stat() (fi os.FileInfo, err error) {
 	if err != nil {
 		return nil, err
 	}
-	return FileInfo{fi}, nil
+	return wrapFileInfo(fi, h.rootName), nil
+}
+
+// wrapFileInfo wraps fi as a FileInfo, renaming it to rootName if set
+func wrapFileInfo(fi os.FileInfo, rootName string) os.FileInfo {
+	if rootName != "" {
+		return remoteRootInfo{FileInfo: FileInfo{fi}, name: rootName}
+	}
+	return FileInfo{fi}
+}
+
+// remoteRootInfo is the FileInfo for the root directory of one of
+// multiple remotes being served, which is named after the remote
+// rather than "/"
+type remoteRootInfo struct {
+	FileInfo
+	name string
+}
+
+// Name returns the name the remote is served under
+func (fi remoteRootInfo) Name() string {
+	return fi.name
 }
 
 // FileInfo represents info about a file satisfying os.FileInfo and
@@ -8,14 +8,27 @@
 package webdav
 
 import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	_ "github.com/ncw/rclone/backend/local"
 	"github.com/ncw/rclone/cmd/serve/httplib"
+	"github.com/ncw/rclone/cmd/serve/multi"
+	"github.com/ncw/rclone/cmd/serve/proxy/proxyflags"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/config"
 	"github.com/ncw/rclone/fstest"
+	"github.com/ncw/rclone/vfs"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/net/webdav"
 )
 
@@ -47,17 +60,14 @@ func TestWebDav(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Start the server
-	w := newWebDAV(fremote, &opt)
+	w, err := newWebDAV(fremote, nil, &opt)
+	require.NoError(t, err)
 	assert.NoError(t, w.serve())
 	defer func() {
 		w.Close()
 		w.Wait()
 	}()
 
-	// Change directory to run the tests
-	err = os.Chdir("../../../backend/webdav")
-	assert.NoError(t, err, "failed to cd to webdav remote")
-
 	// Run the webdav tests with an on the fly remote
 	args := []string{"test"}
 	if testing.Verbose() {
@@ -68,6 +78,7 @@ func TestWebDav(t *testing.T) {
 	}
 	args = append(args, "-remote", "webdavtest:")
 	cmd := exec.Command("go", args...)
+	cmd.Dir = "../../../backend/webdav"
 	cmd.Env = append(os.Environ(),
 		"RCLONE_CONFIG_WEBDAVTEST_TYPE=webdav",
 		"RCLONE_CONFIG_WEBDAVTEST_URL="+testURL,
@@ -79,3 +90,288 @@ func TestWebDav(t *testing.T) {
 	}
 	assert.NoError(t, err, "Running webdav integration tests")
 }
+
+func TestLockSystem(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rclone-webdav-locks")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	file := filepath.Join(dir, "locks.json")
+	now := time.Now()
+
+	ls, err := newLockSystem(file)
+	require.NoError(t, err)
+	token, err := ls.Create(now, webdav.LockDetails{Root: "/dir", Duration: time.Hour, OwnerXML: "<owner>me</owner>"})
+	require.NoError(t, err)
+	assert.Contains(t, token, "opaquelocktoken:")
+
+	// conflicting locks
+	_, err = ls.Create(now, webdav.LockDetails{Root: "/dir/file", Duration: time.Hour})
+	assert.Equal(t, webdav.ErrLocked, err)
+	_, err = ls.Create(now, webdav.LockDetails{Root: "/", Duration: -1})
+	assert.Equal(t, webdav.ErrLocked, err)
+	other, err := ls.Create(now, webdav.LockDetails{Root: "/other", Duration: time.Hour, ZeroDepth: true})
+	require.NoError(t, err)
+
+	// the VFS can't change locked paths unless the lock is held
+	assert.Equal(t, vfs.ELOCKED, ls.checkVFS("dir/file"))
+	assert.NoError(t, ls.checkVFS("dirt"))
+	assert.NoError(t, ls.checkVFS("other/file"))
+	_, err = ls.Confirm(now, "/dir/file", "", webdav.Condition{Token: "bad"})
+	assert.Equal(t, webdav.ErrConfirmationFailed, err)
+	release, err := ls.Confirm(now, "/dir/file", "", webdav.Condition{Token: token})
+	require.NoError(t, err)
+	assert.NoError(t, ls.checkVFS("dir/file"))
+	assert.Equal(t, webdav.ErrLocked, ls.Unlock(now, token))
+	release()
+	assert.Equal(t, vfs.ELOCKED, ls.checkVFS("dir/file"))
+
+	// temporary locks don't stop the VFS and aren't saved
+	temp, err := ls.Create(now, webdav.LockDetails{Root: "/temp", Duration: -1, ZeroDepth: true})
+	require.NoError(t, err)
+	assert.NoError(t, ls.checkVFS("temp"))
+
+	// locks survive a restart
+	ls, err = newLockSystem(file)
+	require.NoError(t, err)
+	assert.Equal(t, vfs.ELOCKED, ls.checkVFS("dir/file"))
+	assert.Equal(t, webdav.ErrNoSuchLock, ls.Unlock(now, temp))
+	details, err := ls.Refresh(now, other, 2*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "/other", details.Root)
+	assert.Equal(t, 2*time.Hour, details.Duration)
+
+	// and expire
+	assert.NoError(t, ls.Unlock(now, token))
+	assert.NoError(t, ls.checkVFS("dir/file"))
+	_, err = ls.Confirm(now.Add(3*time.Hour), "/other", "", webdav.Condition{Token: other})
+	assert.Equal(t, webdav.ErrConfirmationFailed, err)
+	ls, err = newLockSystem(file)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(ls.byToken))
+}
+
+// davRequest makes a webdav request returning the status and body
+func davRequest(t *testing.T, method, url, body string, headers ...string) (int, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Close = true // the server is restarted
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	data, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(data)
+}
+
+func TestLocksAndProps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rclone-webdav")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	oldCacheDir := config.CacheDir
+	config.CacheDir = filepath.Join(dir, "cache")
+	defer func() {
+		config.CacheDir = oldCacheDir
+	}()
+	root := filepath.Join(dir, "root")
+	require.NoError(t, os.Mkdir(root, 0777))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "file.txt"), []byte("hello"), 0666))
+	f, err := fs.NewFs(root)
+	require.NoError(t, err)
+
+	opt := httplib.DefaultOpt
+	opt.ListenAddr = "localhost:51779"
+	url := "http://" + opt.ListenAddr + "/"
+	start := func() *WebDAV {
+		w, err := newWebDAV(f, nil, &opt)
+		require.NoError(t, err)
+		require.NoError(t, w.serve())
+		return w
+	}
+	stop := func(w *WebDAV) {
+		w.Close()
+		w.Wait()
+	}
+	w := start()
+
+	// quota properties on directories
+	status, body := davRequest(t, "PROPFIND", url, `<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:prop><D:quota-available-bytes/><D:quota-used-bytes/></D:prop></D:propfind>`, "Depth", "0")
+	assert.Equal(t, http.StatusMultiStatus, status)
+	assert.Regexp(t, `quota-available-bytes[^>]*>[0-9]+<`, body)
+	assert.Regexp(t, `quota-used-bytes[^>]*>[0-9]+<`, body)
+
+	// which can't be changed
+	status, body = davRequest(t, "PROPPATCH", url, `<?xml version="1.0"?><D:propertyupdate xmlns:D="DAV:"><D:set><D:prop><D:quota-used-bytes>1</D:quota-used-bytes></D:prop></D:set></D:propertyupdate>`)
+	assert.Equal(t, http.StatusMultiStatus, status)
+	assert.Contains(t, body, "403 Forbidden")
+
+	// set a custom property
+	status, body = davRequest(t, "PROPPATCH", url+"file.txt", `<?xml version="1.0"?><D:propertyupdate xmlns:D="DAV:" xmlns:Z="urn:schemas-microsoft-com:"><D:set><D:prop><Z:Win32FileAttributes>00000020</Z:Win32FileAttributes></D:prop></D:set></D:propertyupdate>`)
+	assert.Equal(t, http.StatusMultiStatus, status)
+	assert.Contains(t, body, "200 OK")
+
+	// lock the file
+	status, body = davRequest(t, "LOCK", url+"file.txt", `<?xml version="1.0"?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype><D:owner>office</D:owner></D:lockinfo>`, "Timeout", "Second-3600")
+	assert.Equal(t, http.StatusOK, status)
+	token := regexp.MustCompile(`opaquelocktoken:[0-9a-f-]+`).FindString(body)
+	require.NotEqual(t, "", token)
+
+	// restart the server
+	stop(w)
+	w = start()
+	defer stop(w)
+
+	// the property is still there
+	status, body = davRequest(t, "PROPFIND", url+"file.txt", `<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:prop><Z:Win32FileAttributes xmlns:Z="urn:schemas-microsoft-com:"/></D:prop></D:propfind>`, "Depth", "0")
+	assert.Equal(t, http.StatusMultiStatus, status)
+	assert.Contains(t, body, "00000020")
+
+	// the lock is still there and stops other users of the VFS
+	status, _ = davRequest(t, "PUT", url+"file.txt", "new contents")
+	assert.Equal(t, http.StatusLocked, status)
+	_, err = w.vfs.OpenFile("file.txt", os.O_WRONLY|os.O_TRUNC, 0666)
+	assert.Equal(t, vfs.ELOCKED, err)
+
+	// but not the lock holder
+	status, _ = davRequest(t, "PUT", url+"file.txt", "new contents", "If", "(<"+token+">)")
+	assert.Equal(t, http.StatusCreated, status)
+
+	status, _ = davRequest(t, "UNLOCK", url+"file.txt", "", "Lock-Token", "<"+token+">")
+	assert.Equal(t, http.StatusNoContent, status)
+
+	// properties follow the file when it is moved
+	status, _ = davRequest(t, "MOVE", url+"file.txt", "", "Destination", url+"moved.txt")
+	assert.Equal(t, http.StatusCreated, status)
+	status, body = davRequest(t, "PROPFIND", url+"moved.txt", `<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:prop><Z:Win32FileAttributes xmlns:Z="urn:schemas-microsoft-com:"/></D:prop></D:propfind>`, "Depth", "0")
+	assert.Equal(t, http.StatusMultiStatus, status)
+	assert.Contains(t, body, "00000020")
+}
+
+func TestMultipleRemotes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rclone-webdav")
+	require.NoError(t, err)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	oldCacheDir := config.CacheDir
+	config.CacheDir = filepath.Join(dir, "cache")
+	defer func() {
+		config.CacheDir = oldCacheDir
+	}()
+	for _, name := range []string{"one", "two"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, name), 0777))
+	}
+	remotes, err := multi.New(&multi.Options{}, []string{"one=" + filepath.Join(dir, "one"), "two=" + filepath.Join(dir, "two")}, &vfs.DefaultOpt)
+	require.NoError(t, err)
+
+	opt := httplib.DefaultOpt
+	opt.ListenAddr = "localhost:51780"
+	url := "http://" + opt.ListenAddr + "/"
+	w, err := newWebDAV(nil, remotes, &opt)
+	require.NoError(t, err)
+	require.NoError(t, w.serve())
+	defer func() {
+		w.Close()
+		w.Wait()
+	}()
+
+	// the root lists the remotes
+	status, body := davRequest(t, "PROPFIND", url, "", "Depth", "1")
+	assert.Equal(t, http.StatusMultiStatus, status)
+	assert.Contains(t, body, "<D:href>/one</D:href>")
+	assert.Contains(t, body, "<D:displayname>one</D:displayname>")
+	assert.Contains(t, body, "<D:href>/two</D:href>")
+
+	// files go into the right remote
+	status, _ = davRequest(t, "PUT", url+"one/file.txt", "hello")
+	assert.Equal(t, http.StatusCreated, status)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "one", "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	status, _ = davRequest(t, "MKCOL", url+"three", "")
+	assert.NotEqual(t, http.StatusCreated, status)
+
+	// but can't be moved between them
+	status, _ = davRequest(t, "MOVE", url+"one/file.txt", "", "Destination", url+"two/file.txt")
+	assert.NotEqual(t, http.StatusCreated, status)
+	_, err = os.Stat(filepath.Join(dir, "one", "file.txt"))
+	assert.NoError(t, err)
+
+	// locks on the full path guard the VFS of the remote
+	status, _ = davRequest(t, "LOCK", url+"one/file.txt", `<?xml version="1.0"?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype><D:owner>office</D:owner></D:lockinfo>`)
+	assert.Equal(t, http.StatusOK, status)
+	_, err = remotes.VFS("one").OpenFile("file.txt", os.O_WRONLY|os.O_TRUNC, 0666)
+	assert.Equal(t, vfs.ELOCKED, err)
+}
+
+func TestAuthProxyLocks(t *testing.T) {
+	oldOpt := proxyflags.Opt
+	defer func() {
+		proxyflags.Opt = oldOpt
+	}()
+	proxyflags.Opt.AuthProxy = "go run ../proxy/test_proxy.go"
+
+	opt := httplib.DefaultOpt
+	opt.ListenAddr = "localhost:51781"
+	url := "http://" + opt.ListenAddr + "/"
+	w, err := newWebDAV(nil, nil, &opt)
+	require.NoError(t, err)
+	require.NoError(t, w.serve())
+	defer func() {
+		w.Close()
+		w.Wait()
+	}()
+
+	// The test proxy serves the current directory
+	auth := func(user string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":correct"))
+	}
+	lock := func(user string) (int, string) {
+		status, body := davRequest(t, "LOCK", url+"webdav_test.go", `<?xml version="1.0"?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype><D:owner>office</D:owner></D:lockinfo>`, "Timeout", "Second-3600", "Authorization", auth(user))
+		return status, regexp.MustCompile(`opaquelocktoken:[0-9a-f-]+`).FindString(body)
+	}
+
+	// each user has their own locks
+	status, token := lock("potato")
+	assert.Equal(t, http.StatusOK, status)
+	require.NotEqual(t, "", token)
+	status, otherToken := lock("other")
+	assert.Equal(t, http.StatusOK, status)
+	require.NotEqual(t, "", otherToken)
+	status, _ = lock("potato")
+	assert.Equal(t, http.StatusLocked, status)
+
+	// which stop other users of the VFS changing the file
+	VFS := w.proxy.Get("potato")
+	require.NotNil(t, VFS)
+	_, err = VFS.OpenFile("webdav_test.go", os.O_WRONLY|os.O_TRUNC, 0666)
+	assert.Equal(t, vfs.ELOCKED, err)
+
+	// the state is kept while there are locks even if it isn't used
+	w.propsMu.Lock()
+	for _, state := range w.states {
+		state.lastUsed = time.Now().Add(-2 * proxyStateExpire)
+	}
+	w.propsMu.Unlock()
+	status, _ = davRequest(t, "UNLOCK", url+"webdav_test.go", "", "Lock-Token", "<"+otherToken+">", "Authorization", auth("other"))
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.Equal(t, 2, len(w.states))
+
+	// and forgotten when it has none
+	status, _ = davRequest(t, "UNLOCK", url+"webdav_test.go", "", "Lock-Token", "<"+token+">", "Authorization", auth("potato"))
+	assert.Equal(t, http.StatusNoContent, status)
+	w.propsMu.Lock()
+	w.states[w.proxy.Get("other")].lastUsed = time.Now().Add(-2 * proxyStateExpire)
+	w.propsMu.Unlock()
+	_, err = w.getProxyState(VFS)
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(w.states))
+}
@@ -41,6 +41,7 @@ type Account struct {
 	closed  bool          // set if the file is closed
 	exit    chan struct{} // channel that will be closed when transfer is finished
 	withBuf bool          // is using a buffered in
+	bufSize int64         // size of the buffer if set with WithBufferSize
 }
 
 const averagePeriod = 16 // period to do exponentially weighted averages over
@@ -71,10 +72,26 @@ func NewAccount(in io.ReadCloser, obj fs.Object) *Account {
 
 // WithBuffer - If the file is above a certain size it adds an Async reader
 func (acc *Account) WithBuffer() *Account {
+	bufSize := int64(fs.Config.BufferSize)
+	if acc.bufSize > 0 {
+		bufSize = acc.bufSize
+	}
+	return acc.withBuffer(bufSize)
+}
+
+// WithBufferSize is like WithBuffer but reads up to bufSize bytes
+// ahead rather than --buffer-size
+func (acc *Account) WithBufferSize(bufSize int64) *Account {
+	acc.bufSize = bufSize
+	return acc.withBuffer(bufSize)
+}
+
+// withBuffer adds an Async reader of up to bufSize bytes
+func (acc *Account) withBuffer(bufSize int64) *Account {
 	acc.withBuf = true
 	var buffers int
-	if acc.size >= int64(fs.Config.BufferSize) || acc.size == -1 {
-		buffers = int(int64(fs.Config.BufferSize) / asyncreader.BufferSize)
+	if acc.size >= bufSize || acc.size == -1 {
+		buffers = int(bufSize / asyncreader.BufferSize)
 	} else {
 		buffers = int(acc.size / asyncreader.BufferSize)
 	}
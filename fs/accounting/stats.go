@@ -63,6 +63,21 @@ Returns the following values:
 Values for "transferring", "checking" and "lastError" are only assigned if data is available.
 The value for "eta" is null if an eta cannot be determined.
 `,
+		Input: []rc.Param{},
+		Output: []rc.Param{
+			{Name: "speed", Type: rc.ParamNumber, Required: true, Help: "average speed in bytes/sec since start of the process"},
+			{Name: "bytes", Type: rc.ParamInteger, Required: true, Help: "total transferred bytes since the start of the process"},
+			{Name: "errors", Type: rc.ParamInteger, Required: true, Help: "number of errors"},
+			{Name: "fatalError", Type: rc.ParamBool, Required: true, Help: "whether there has been at least one FatalError"},
+			{Name: "retryError", Type: rc.ParamBool, Required: true, Help: "whether there has been at least one non-NoRetryError"},
+			{Name: "checks", Type: rc.ParamInteger, Required: true, Help: "number of checked files"},
+			{Name: "transfers", Type: rc.ParamInteger, Required: true, Help: "number of transferred files"},
+			{Name: "deletes", Type: rc.ParamInteger, Required: true, Help: "number of deleted files"},
+			{Name: "elapsedTime", Type: rc.ParamNumber, Required: true, Help: "time in seconds since the start of the process"},
+			{Name: "lastError", Type: rc.ParamString, Help: "last occurred error"},
+			{Name: "transferring", Type: rc.ParamArray, Help: "currently active file transfers"},
+			{Name: "checking", Type: rc.ParamArray, Help: "names of currently active file checks"},
+		},
 	})
 }
 
@@ -142,8 +157,9 @@ func (s *StatsInfo) RemoteStats(in rc.Params) (out rc.Params, err error) {
 		}
 		out["transferring"] = t
 	}
-	if s.errors > 0 {
-		out["lastError"] = s.lastError
+	if s.errors > 0 && s.lastError != nil {
+		// errors don't marshal to JSON so send the text
+		out["lastError"] = s.lastError.Error()
 	}
 	return out, nil
 }
@@ -1,6 +1,7 @@
 package accounting
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"testing"
@@ -117,3 +118,18 @@ func TestStatsError(t *testing.T) {
 	assert.False(t, s.HadRetryError())
 	assert.Equal(t, time.Time{}, s.RetryAfter())
 }
+
+func TestRemoteStatsLastError(t *testing.T) {
+	s := NewStats()
+	out, err := s.RemoteStats(nil)
+	assert.NoError(t, err)
+	assert.NotContains(t, out, "lastError")
+
+	s.Error(errors.New("potato"))
+	out, err = s.RemoteStats(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "potato", out["lastError"])
+	b, err := json.Marshal(out)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"lastError":"potato"`)
+}
@@ -165,5 +165,11 @@ Eg
 The format of the parameter is exactly the same as passed to --bwlimit
 except only one bandwidth may be specified.
 `,
+		Input: []rc.Param{
+			{Name: "rate", Type: rc.ParamString, Required: true, Help: "the bandwidth limit in the format of --bwlimit"},
+		},
+		Output: []rc.Param{
+			{Name: "rate", Type: rc.ParamString, Required: true, Help: "the bandwidth limit set"},
+		},
 	})
 }
@@ -29,6 +29,27 @@ type ChunkedReader struct {
 	sizeIter    ChunkSizeIterator // function to calculate the next chunk size
 	closed      bool              // has Close been called?
 	opened      time.Time
+	prefetch    int64      // if > 0 open the next chunk this many bytes before the end of the current one
+	next        *chunkOpen // the next chunk being opened in the background
+}
+
+// chunkOpen is a chunk being opened in the background
+type chunkOpen struct {
+	offset int64         // start of the chunk
+	length int64         // length of the chunk, -1 for to the end
+	done   chan struct{} // closed when the open has finished
+	rc     io.ReadCloser // the opened chunk if err is nil
+	err    error         // error opening the chunk
+}
+
+// discard closes the chunk when it has been opened
+func (co *chunkOpen) discard() {
+	go func() {
+		<-co.done
+		if co.rc != nil {
+			_ = co.rc.Close()
+		}
+	}()
 }
 
 // ChunkSizeIterator is used to calculate the chunk size values.
@@ -111,6 +132,19 @@ func NewWithChunkSizeIterator(o fs.Object, sizeIter ChunkSizeIterator) *ChunkedR
 	}
 }
 
+// WithPrefetch makes the ChunkedReader start opening the next chunk
+// in the background when reading gets within window bytes of the end
+// of the current one.  This hides the time taken to open the chunk
+// from the reader at the cost of an extra connection for a while.
+//
+// A window of <= 0 disables prefetching.
+func (cr *ChunkedReader) WithPrefetch(window int64) *ChunkedReader {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.prefetch = window
+	return cr
+}
+
 // Read from the file - for details see io.Reader
 func (cr *ChunkedReader) Read(p []byte) (n int, err error) {
 	now := time.Now()
@@ -138,7 +172,11 @@ func (cr *ChunkedReader) Read(p []byte) (n int, err error) {
 		switch {
 		case cr.chunkSize > 0 && cr.offset == chunkEnd: // last chunk read completely
 			cr.chunkOffset = cr.offset
-			cr.chunkSize = fixNeg(cr.sizeIter.NextChunkSize())
+			if cr.next != nil {
+				cr.chunkSize = cr.next.length
+			} else {
+				cr.chunkSize = fixNeg(cr.sizeIter.NextChunkSize())
+			}
 			// recalculate the chunk boundary. valid only when chunkSize > 0
 			chunkEnd = cr.chunkOffset + cr.chunkSize
 			fallthrough
@@ -161,6 +199,9 @@ func (cr *ChunkedReader) Read(p []byte) (n int, err error) {
 		rn, err = io.ReadFull(cr.rc, buf)
 		n += rn
 		cr.offset += int64(rn)
+		if cr.prefetch > 0 && cr.next == nil && cr.chunkSize > 0 && chunkEnd-cr.offset <= cr.prefetch {
+			cr.startPrefetch()
+		}
 		if err != nil {
 			if err == io.ErrUnexpectedEOF {
 				err = io.EOF
@@ -183,6 +224,7 @@ func (cr *ChunkedReader) Close() error {
 	}
 	cr.closed = true
 
+	cr.discardPrefetch()
 	return cr.resetReader(nil, 0)
 }
 
@@ -216,6 +258,7 @@ func (cr *ChunkedReader) RangeSeek(offset int64, whence int, length int64) (int6
 	cr.chunkOffset = cr.offset + offset
 	// force reopen on next Read
 	cr.offset = -1
+	cr.discardPrefetch()
 	cr.sizeIter.Reset(length)
 	if length > 0 {
 		cr.chunkSize = length
@@ -262,6 +305,20 @@ func (cr *ChunkedReader) openRange() (err error) {
 		return ErrorFileClosed
 	}
 
+	if next := cr.next; next != nil {
+		cr.next = nil
+		if next.offset == offset && next.length == length {
+			<-next.done
+			if next.err == nil {
+				promOpenPrefetches.Add(1)
+				return cr.resetReader(next.rc, offset)
+			}
+			fs.Debugf(cr.o, "ChunkedReader.openRange prefetch failed (%s). Trying Open", next.err)
+		} else {
+			next.discard()
+		}
+	}
+
 	if rs, ok := cr.rc.(fs.RangeSeeker); ok {
 		n, err := rs.RangeSeek(offset, io.SeekStart, length)
 		if err == nil && n == offset {
@@ -276,20 +333,57 @@ func (cr *ChunkedReader) openRange() (err error) {
 		}
 	}
 
-	var rc io.ReadCloser
+	rc, err := openChunk(cr.o, offset, length)
+	if err != nil {
+		return err
+	}
+	return cr.resetReader(rc, offset)
+}
+
+// openChunk opens length bytes of o from offset
+//
+// A length <= 0 will request till the end of the file
+func openChunk(o fs.Object, offset, length int64) (rc io.ReadCloser, err error) {
 	if length <= 0 {
 		if offset == 0 {
-			rc, err = cr.o.Open()
-		} else {
-			rc, err = cr.o.Open(&fs.RangeOption{Start: offset, End: -1})
+			return o.Open()
 		}
-	} else {
-		rc, err = cr.o.Open(&fs.RangeOption{Start: offset, End: offset + length - 1})
+		return o.Open(&fs.RangeOption{Start: offset, End: -1})
 	}
-	if err != nil {
-		return err
+	return o.Open(&fs.RangeOption{Start: offset, End: offset + length - 1})
+}
+
+// startPrefetch starts opening the chunk after the current one in
+// the background if there is one
+//
+// Must be called with cr.mu held
+func (cr *ChunkedReader) startPrefetch() {
+	offset := cr.chunkOffset + cr.chunkSize
+	if size := cr.o.Size(); size >= 0 && offset >= size {
+		return
+	}
+	next := &chunkOpen{
+		offset: offset,
+		length: fixNeg(cr.sizeIter.NextChunkSize()),
+		done:   make(chan struct{}),
+	}
+	fs.Debugf(cr.o, "ChunkedReader.startPrefetch at %d length %d", next.offset, next.length)
+	go func(o fs.Object) {
+		next.rc, next.err = openChunk(o, next.offset, next.length)
+		close(next.done)
+	}(cr.o)
+	cr.next = next
+}
+
+// discardPrefetch abandons the chunk being opened in the background
+// if any
+//
+// Must be called with cr.mu held
+func (cr *ChunkedReader) discardPrefetch() {
+	if cr.next != nil {
+		cr.next.discard()
+		cr.next = nil
 	}
-	return cr.resetReader(rc, offset)
 }
 
 // resetReader switches the current reader to the given reader.
@@ -337,6 +431,10 @@ var (
 		Name: "rclone_chunkedreader_open_seeks_total",
 		Help: "Number of seeks while opening a range",
 	})
+	promOpenPrefetches = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "rclone_chunkedreader_open_prefetches_total",
+		Help: "Number of chunks opened in the background before they were needed",
+	})
 	promOpenTimes = prometheus.NewHistogram(prometheus.HistogramOpts{
 		Name: "rclone_chunkedreader_open_histogram_seconds",
 		Help: "Time spent opening a range",
@@ -355,6 +453,7 @@ func init() {
 		promReadTimes,
 		promOpenErrors,
 		promOpenSeeks,
+		promOpenPrefetches,
 		promOpenTimes,
 		promConnDurations,
 	)
@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fstest/mockobject"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -102,6 +105,115 @@ func TestErrorAfterClose(t *testing.T) {
 	require.Error(t, err)
 }
 
+// countingObject counts the opens and closes of its chunks
+type countingObject struct {
+	fs.Object
+	mu     sync.Mutex
+	starts []int64 // start of each chunk opened
+	open   int     // number of chunks currently open
+}
+
+func (o *countingObject) Open(options ...fs.OpenOption) (io.ReadCloser, error) {
+	rc, err := o.Object.Open(options...)
+	if err != nil {
+		return nil, err
+	}
+	var start int64
+	for _, option := range options {
+		if x, ok := option.(*fs.RangeOption); ok {
+			start = x.Start
+		}
+	}
+	o.mu.Lock()
+	o.starts = append(o.starts, start)
+	o.open++
+	o.mu.Unlock()
+	return &countingReadCloser{ReadCloser: rc, o: o}, nil
+}
+
+// opened returns the chunk starts and the number still open
+func (o *countingObject) opened() ([]int64, int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]int64(nil), o.starts...), o.open
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	o *countingObject
+}
+
+func (rc *countingReadCloser) Close() error {
+	rc.o.mu.Lock()
+	rc.o.open--
+	rc.o.mu.Unlock()
+	return rc.ReadCloser.Close()
+}
+
+func TestChunkedReaderPrefetch(t *testing.T) {
+	content := makeContent(t, 1024)
+	o := &countingObject{Object: mockobject.New("test.bin").WithContent(content, mockobject.SeekModeNone)}
+
+	// reading it all opens each chunk once
+	cr := New(o, 100, 100).WithPrefetch(50)
+	buf := make([]byte, 32)
+	var got []byte
+	for {
+		n, err := cr.Read(buf)
+		got = append(got, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		// the next chunk is opened before the end of this one
+		if offset := len(got); offset%100 >= 50 && offset < 1000 {
+			waitOpened(t, o, offset/100+2)
+		}
+	}
+	assert.Equal(t, content, got)
+	starts, _ := o.opened()
+	assert.Equal(t, []int64{0, 100, 200, 300, 400, 500, 600, 700, 800, 900, 1000}, starts)
+	require.NoError(t, cr.Close())
+	_, open := o.opened()
+	assert.Equal(t, 0, open)
+
+	// seeking away closes the prefetched chunk
+	o = &countingObject{Object: o.Object}
+	cr = New(o, 100, 100).WithPrefetch(50)
+	n, err := cr.Read(make([]byte, 60))
+	require.NoError(t, err)
+	assert.Equal(t, 60, n)
+	waitOpened(t, o, 2)
+	_, err = cr.RangeSeek(500, io.SeekStart, -1)
+	require.NoError(t, err)
+	n, err = cr.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, content[500:500+n], buf[:n])
+	require.NoError(t, cr.Close())
+	waitOpened(t, o, 3)
+	for i := 0; i < 100; i++ {
+		if _, open = o.opened(); open == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 0, open)
+	starts, _ = o.opened()
+	assert.ElementsMatch(t, []int64{0, 100, 500}, starts)
+}
+
+// waitOpened waits for o to have had n chunks opened
+func waitOpened(t *testing.T, o *countingObject, n int) {
+	for i := 0; i < 100; i++ {
+		if starts, _ := o.opened(); len(starts) >= n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	starts, _ := o.opened()
+	t.Fatalf("expecting %d chunks opened but got %v", n, starts)
+}
+
 func makeContent(t *testing.T, size int) []byte {
 	content := make([]byte, size)
 	r := rand.New(rand.NewSource(42))
@@ -49,6 +49,7 @@ var (
 	ErrorCantCopy                    = errors.New("can't copy object - incompatible remotes")
 	ErrorCantMove                    = errors.New("can't move object - incompatible remotes")
 	ErrorCantDirMove                 = errors.New("can't move directory - incompatible remotes")
+	ErrorCantCompose                 = errors.New("can't compose objects")
 	ErrorDirExists                   = errors.New("can't copy directory - destination already exists")
 	ErrorCantSetModTime              = errors.New("can't set modified time")
 	ErrorCantSetModTimeWithoutDelete = errors.New("can't set modified time without deleting existing object")
@@ -65,6 +66,7 @@ var (
 	ErrorDirectoryNotEmpty           = errors.New("directory not empty")
 	ErrorImmutableModified           = errors.New("immutable file modified")
 	ErrorPermissionDenied            = errors.New("permission denied")
+	ErrorCommandNotFound             = errors.New("command not found")
 )
 
 // RegInfo provides information about a filesystem
@@ -83,6 +85,18 @@ type RegInfo struct {
 	Config func(name string, config configmap.Mapper) `json:"-"`
 	// Options for the Fs configuration
 	Options Options
+	// The command help, if any
+	CommandHelp []CommandHelp
+}
+
+// CommandHelp describes a single backend Command
+//
+// These are automatically inserted in the docs
+type CommandHelp struct {
+	Name  string            // Name of the command, eg "link"
+	Short string            // Single line description
+	Long  string            // Long multi-line description
+	Opts  map[string]string // maps option name to a single line help
 }
 
 // FileName returns the on disk file name for this backend
@@ -398,6 +412,19 @@ type Usage struct {
 	Objects *int64 `json:"objects,omitempty"` // objects in the storage system
 }
 
+// Attrs are the POSIX permissions, owner and extended attributes of
+// a file or directory used by GetAttrs and SetAttrs
+//
+// If a value is nil then it isn't set, or when passed to SetAttrs
+// isn't changed.  An extended attribute with a nil value passed to
+// SetAttrs is removed.
+type Attrs struct {
+	Mode   *os.FileMode      // permission bits
+	UID    *uint32           // user ID of the owner
+	GID    *uint32           // group ID of the owner
+	Xattrs map[string][]byte // extended attributes
+}
+
 // Features describe the optional features of the Fs
 type Features struct {
 	// Feature flags, whether Fs
@@ -451,6 +478,25 @@ type Features struct {
 	// If destination exists then return fs.ErrorDirExists
 	DirMove func(src Fs, srcRemote, dstRemote string) error
 
+	// Compose makes the remote path given from the contents of
+	// srcs joined together in order using server side operations.
+	//
+	// It returns the destination Object and a possible error
+	//
+	// Will only be called if all the srcs are from this Fs
+	//
+	// If it isn't possible then return fs.ErrorCantCompose
+	Compose func(srcs []Object, remote string) (Object, error)
+
+	// GetAttrs returns the permissions, owner and extended
+	// attributes of the file or directory at remote
+	GetAttrs func(remote string) (*Attrs, error)
+
+	// SetAttrs changes the permissions, owner and extended
+	// attributes of the file or directory at remote to those set
+	// in attrs
+	SetAttrs func(remote string, attrs *Attrs) error
+
 	// ChangeNotify calls the passed function with a path
 	// that has had changes. If the implementation
 	// uses polling, it should adhere to the given interval.
@@ -519,6 +565,17 @@ type Features struct {
 
 	// About gets quota information from the Fs
 	About func() (*Usage, error)
+
+	// Command the backend to run a named command
+	//
+	// The command run is name
+	// args may be used to read arguments from
+	// opts may be used to read optional arguments from
+	//
+	// The result should be capable of being JSON encoded
+	// If it is a string or a []string it will be shown to the user
+	// otherwise it will be JSON encoded and shown to the user like that
+	Command func(name string, arg []string, opt map[string]string) (interface{}, error)
 }
 
 // Disable nil's out the named feature.  If it isn't found then it
@@ -577,6 +634,13 @@ func (ft *Features) Fill(f Fs) *Features {
 	if do, ok := f.(DirMover); ok {
 		ft.DirMove = do.DirMove
 	}
+	if do, ok := f.(Composer); ok {
+		ft.Compose = do.Compose
+	}
+	if do, ok := f.(AttrStorer); ok {
+		ft.GetAttrs = do.GetAttrs
+		ft.SetAttrs = do.SetAttrs
+	}
 	if do, ok := f.(ChangeNotifier); ok {
 		ft.ChangeNotify = do.ChangeNotify
 	}
@@ -611,6 +675,9 @@ func (ft *Features) Fill(f Fs) *Features {
 	if do, ok := f.(Abouter); ok {
 		ft.About = do.About
 	}
+	if do, ok := f.(Commander); ok {
+		ft.Command = do.Command
+	}
 	return ft.DisableList(Config.DisableFeatures)
 }
 
@@ -643,6 +710,15 @@ func (ft *Features) Mask(f Fs) *Features {
 	if mask.DirMove == nil {
 		ft.DirMove = nil
 	}
+	if mask.Compose == nil {
+		ft.Compose = nil
+	}
+	if mask.GetAttrs == nil {
+		ft.GetAttrs = nil
+	}
+	if mask.SetAttrs == nil {
+		ft.SetAttrs = nil
+	}
 	if mask.ChangeNotify == nil {
 		ft.ChangeNotify = nil
 	}
@@ -670,6 +746,7 @@ func (ft *Features) Mask(f Fs) *Features {
 	if mask.About == nil {
 		ft.About = nil
 	}
+	// Command is always local so we don't mask it
 	return ft.DisableList(Config.DisableFeatures)
 }
 
@@ -749,6 +826,31 @@ type DirMover interface {
 	DirMove(src Fs, srcRemote, dstRemote string) error
 }
 
+// Composer is an optional interface for Fs
+type Composer interface {
+	// Compose makes the remote path given from the contents of
+	// srcs joined together in order using server side operations.
+	//
+	// It returns the destination Object and a possible error
+	//
+	// Will only be called if all the srcs are from this Fs
+	//
+	// If it isn't possible then return fs.ErrorCantCompose
+	Compose(srcs []Object, remote string) (Object, error)
+}
+
+// AttrStorer is an optional interface for Fs
+type AttrStorer interface {
+	// GetAttrs returns the permissions, owner and extended
+	// attributes of the file or directory at remote
+	GetAttrs(remote string) (*Attrs, error)
+
+	// SetAttrs changes the permissions, owner and extended
+	// attributes of the file or directory at remote to those set
+	// in attrs
+	SetAttrs(remote string, attrs *Attrs) error
+}
+
 // ChangeNotifier is an optional interface for Fs
 type ChangeNotifier interface {
 	// ChangeNotify calls the passed function with a path
@@ -869,6 +971,20 @@ type Abouter interface {
 	About() (*Usage, error)
 }
 
+// Commander is an interface to wrap the Command function
+type Commander interface {
+	// Command the backend to run a named command
+	//
+	// The command run is name
+	// args may be used to read arguments from
+	// opts may be used to read optional arguments from
+	//
+	// The result should be capable of being JSON encoded
+	// If it is a string or a []string it will be shown to the user
+	// otherwise it will be JSON encoded and shown to the user like that
+	Command(name string, arg []string, opt map[string]string) (interface{}, error)
+}
+
 // ObjectsChan is a channel of Objects
 type ObjectsChan chan Object
 
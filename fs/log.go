@@ -3,6 +3,7 @@ package fs
 import (
 	"fmt"
 	"log"
+	"sync"
 
 	"github.com/pkg/errors"
 )
@@ -73,6 +74,25 @@ var LogPrint = func(level LogLevel, text string) {
 	_ = log.Output(4, text)
 }
 
+// LogHook is called with the level and text of each log line
+type LogHook func(level LogLevel, text string)
+
+var (
+	logHooksMu sync.RWMutex
+	logHooks   []LogHook
+)
+
+// AddLogHook adds hook to be called with each log line produced by
+// LogPrintf after it has been sent to LogPrint.
+//
+// The hook is only called for log lines at or above the configured
+// log level.  It must not block or produce log lines itself.
+func AddLogHook(hook LogHook) {
+	logHooksMu.Lock()
+	logHooks = append(logHooks, hook)
+	logHooksMu.Unlock()
+}
+
 // LogPrintf produces a log string from the arguments passed in
 func LogPrintf(level LogLevel, o interface{}, text string, args ...interface{}) {
 	out := fmt.Sprintf(text, args...)
@@ -80,6 +100,11 @@ func LogPrintf(level LogLevel, o interface{}, text string, args ...interface{})
 		out = fmt.Sprintf("%v: %s", o, out)
 	}
 	LogPrint(level, out)
+	logHooksMu.RLock()
+	for _, hook := range logHooks {
+		hook(level, out)
+	}
+	logHooksMu.RUnlock()
 }
 
 // LogLevelPrintf writes logs at the given level
@@ -1,6 +1,32 @@
 package fs
 
-import "github.com/spf13/pflag"
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
 
 // Check it satisfies the interface
 var _ pflag.Value = (*LogLevel)(nil)
+
+func TestAddLogHook(t *testing.T) {
+	var got []string
+	AddLogHook(func(level LogLevel, text string) {
+		if strings.Contains(text, "log hook potato") {
+			got = append(got, level.String()+" "+text)
+		}
+	})
+	oldLogPrint := LogPrint
+	LogPrint = func(level LogLevel, text string) {}
+	defer func() {
+		LogPrint = oldLogPrint
+	}()
+	LogPrintf(LogLevelNotice, "obj", "log hook %s", "potato")
+	LogPrintf(LogLevelDebug, nil, "log hook potato")
+	assert.Equal(t, []string{
+		"NOTICE obj: log hook potato",
+		"DEBUG log hook potato",
+	}, got)
+}
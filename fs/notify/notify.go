@@ -0,0 +1,205 @@
+// Package notify sends a summary of finished jobs and commands to
+// webhooks and local programs
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/accounting"
+	"github.com/ncw/rclone/fs/fshttp"
+	"github.com/ncw/rclone/fs/rc"
+	"github.com/pkg/errors"
+)
+
+// Options contains options for the notifications
+type Options struct {
+	Webhooks   []string      // URLs to POST the summary to
+	Command    string        // command to run with the summary on stdin
+	OnlyErrors bool          // set to only notify if there were errors
+	Timeout    time.Duration // timeout for each webhook or command
+}
+
+// DefaultOpt is the default values used for Options
+var DefaultOpt = Options{
+	Timeout: time.Minute,
+}
+
+// Enabled returns true if any notification has been configured
+func (opt *Options) Enabled() bool {
+	return len(opt.Webhooks) != 0 || opt.Command != ""
+}
+
+// Summary describes a finished rc job or command line run
+type Summary struct {
+	Source    string    `json:"source"`          // "job" or "command"
+	Name      string    `json:"name"`            // name of the command or job
+	JobID     int64     `json:"jobid,omitempty"` // id of the rc job if set
+	StartTime time.Time `json:"startTime"`       // time the work started
+	EndTime   time.Time `json:"endTime"`         // time the work finished
+	Duration  float64   `json:"duration"`        // time in seconds that the work took
+	Success   bool      `json:"success"`         // true for success false otherwise
+	Error     string    `json:"error"`           // error or empty string for no error
+	Stats     rc.Params `json:"stats"`           // output of core/stats
+}
+
+// newSummary makes a Summary filling in the stats
+func newSummary(source, name string, start, end time.Time, err error) *Summary {
+	s := &Summary{
+		Source:    source,
+		Name:      name,
+		StartTime: start,
+		EndTime:   end,
+		Duration:  end.Sub(start).Seconds(),
+		Success:   err == nil,
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	s.Stats, _ = accounting.Stats.RemoteStats(nil)
+	return s
+}
+
+// CommandSummary makes a Summary for the command line command name
+// which started at start and returned err.
+//
+// Errors counted in the stats are reported as failure too.
+func CommandSummary(name string, start time.Time, err error) *Summary {
+	if err == nil && accounting.Stats.Errored() {
+		err = accounting.Stats.GetLastError()
+		if err == nil {
+			err = errors.Errorf("%d errors", accounting.Stats.GetErrors())
+		}
+	}
+	return newSummary("command", name, start, time.Now(), err)
+}
+
+// JobSummary makes a Summary for the finished rc job
+func JobSummary(job *rc.Job) *Summary {
+	var err error
+	if !job.Success {
+		err = errors.New(job.Error)
+	}
+	s := newSummary("job", fmt.Sprintf("job/%d", job.ID), job.StartTime, job.EndTime, err)
+	s.JobID = job.ID
+	return s
+}
+
+// Send the summary to all the configured webhooks and run the
+// command if set.
+//
+// It returns the first error encountered having tried all of them.
+func Send(opt *Options, s *Summary) (err error) {
+	if !opt.Enabled() || (opt.OnlyErrors && s.Success) {
+		return nil
+	}
+	body, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal notification")
+	}
+	var (
+		wg      sync.WaitGroup
+		errMu   sync.Mutex
+		saveErr = func(e error) {
+			errMu.Lock()
+			if err == nil {
+				err = e
+			}
+			errMu.Unlock()
+		}
+	)
+	for _, URL := range opt.Webhooks {
+		wg.Add(1)
+		go func(URL string) {
+			defer wg.Done()
+			if e := postWebhook(opt, URL, body); e != nil {
+				fs.Errorf(nil, "notify: webhook %q failed: %v", URL, e)
+				saveErr(e)
+			}
+		}(URL)
+	}
+	if opt.Command != "" {
+		if e := runCommand(opt, s, body); e != nil {
+			fs.Errorf(nil, "notify: command %q failed: %v", opt.Command, e)
+			saveErr(e)
+		}
+	}
+	wg.Wait()
+	return err
+}
+
+// postWebhook POSTs the JSON body to URL
+func postWebhook(opt *Options, URL string, body []byte) (err error) {
+	client := *fshttp.NewClient(fs.Config)
+	client.Timeout = opt.Timeout
+	resp, err := client.Post(URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(resp.Body, &err)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("HTTP error %d: %s", resp.StatusCode, resp.Status)
+	}
+	fs.Debugf(nil, "notify: sent summary to %q", URL)
+	return nil
+}
+
+// runCommand runs the configured command with the JSON body on stdin
+// and some of the summary in environment variables
+func runCommand(opt *Options, s *Summary, body []byte) error {
+	args := strings.Fields(opt.Command)
+	if len(args) == 0 {
+		return errors.New("no program given in --notify-command")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"RCLONE_NOTIFY_SOURCE="+s.Source,
+		"RCLONE_NOTIFY_NAME="+s.Name,
+		fmt.Sprintf("RCLONE_NOTIFY_SUCCESS=%v", s.Success),
+		"RCLONE_NOTIFY_ERROR="+s.Error,
+		fmt.Sprintf("RCLONE_NOTIFY_DURATION=%f", s.Duration),
+	)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	if opt.Timeout <= 0 {
+		return <-done
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(opt.Timeout):
+		_ = cmd.Process.Kill()
+		<-done
+		return errors.Errorf("timed out after %v", opt.Timeout)
+	}
+}
+
+// Start sends notifications for all rc jobs as they finish.
+//
+// The options are read each time a job finishes so they may be
+// changed with options/set.
+func Start(opt *Options) {
+	rc.AddFinishHook(func(job *rc.Job) {
+		if !opt.Enabled() {
+			return
+		}
+		go func() {
+			_ = Send(opt, JobSummary(job))
+		}()
+	})
+}
@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendWebhook(t *testing.T) {
+	received := make(chan *Summary, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		var s Summary
+		require.NoError(t, json.Unmarshal(body, &s))
+		received <- &s
+	}))
+	defer ts.Close()
+
+	opt := DefaultOpt
+	opt.Webhooks = []string{ts.URL}
+	start := time.Now().Add(-time.Second)
+	err := Send(&opt, CommandSummary("sync", start, errors.New("potato")))
+	require.NoError(t, err)
+
+	s := <-received
+	assert.Equal(t, "command", s.Source)
+	assert.Equal(t, "sync", s.Name)
+	assert.Equal(t, false, s.Success)
+	assert.Equal(t, "potato", s.Error)
+	assert.True(t, s.Duration >= 1)
+	assert.NotNil(t, s.Stats["bytes"])
+}
+
+func TestSendWebhookError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	opt := DefaultOpt
+	opt.Webhooks = []string{ts.URL}
+	err := Send(&opt, CommandSummary("copy", time.Now(), nil))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "500")
+}
+
+func TestSendOnlyErrors(t *testing.T) {
+	called := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer ts.Close()
+
+	opt := DefaultOpt
+	opt.Webhooks = []string{ts.URL}
+	opt.OnlyErrors = true
+	s := newSummary("command", "copy", time.Now(), time.Now(), nil)
+	require.NoError(t, Send(&opt, s))
+	assert.False(t, called)
+}
+
+func TestSendNotEnabled(t *testing.T) {
+	opt := DefaultOpt
+	assert.False(t, opt.Enabled())
+	require.NoError(t, Send(&opt, CommandSummary("copy", time.Now(), nil)))
+}
+
+func TestSendCommandBlank(t *testing.T) {
+	opt := DefaultOpt
+	opt.Command = "  "
+	err := Send(&opt, CommandSummary("copy", time.Now(), nil))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no program")
+}
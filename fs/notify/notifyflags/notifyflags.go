@@ -0,0 +1,23 @@
+// Package notifyflags implements command line flags to set up notifications
+package notifyflags
+
+import (
+	"github.com/ncw/rclone/fs/config/flags"
+	"github.com/ncw/rclone/fs/notify"
+	"github.com/ncw/rclone/fs/rc"
+	"github.com/spf13/pflag"
+)
+
+// Options set by command line flags
+var (
+	Opt = notify.DefaultOpt
+)
+
+// AddFlags adds the notification flags to the flagSet
+func AddFlags(flagSet *pflag.FlagSet) {
+	rc.AddOption("notify", &Opt)
+	flags.StringArrayVarP(flagSet, &Opt.Webhooks, "notify-webhook", "", nil, "POST a JSON summary to this URL when a command or rc job finishes. May be repeated.")
+	flags.StringVarP(flagSet, &Opt.Command, "notify-command", "", "", "Run this command with a JSON summary on stdin when a command or rc job finishes.")
+	flags.BoolVarP(flagSet, &Opt.OnlyErrors, "notify-only-errors", "", false, "Only send notifications when there were errors.")
+	flags.DurationVarP(flagSet, &Opt.Timeout, "notify-timeout", "", Opt.Timeout, "Timeout for each notification webhook or command.")
+}
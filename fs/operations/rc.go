@@ -32,6 +32,14 @@ The result is
 
 See the lsjson command for more information on the above and examples.
 `,
+		Input: []rc.Param{
+			{Name: "fs", Type: rc.ParamString, Required: true, Help: "a remote name string eg \"drive:\""},
+			{Name: "remote", Type: rc.ParamString, Required: true, Help: "a path within that remote eg \"dir\""},
+			{Name: "opt", Type: rc.ParamObject, Help: "a dictionary of options to control the listing"},
+		},
+		Output: []rc.Param{
+			{Name: "list", Type: rc.ParamArray, Required: true, Help: "the entries as described in the lsjson command"},
+		},
 	})
 }
 
@@ -72,6 +80,18 @@ func init() {
 
 The result is as returned from rclone about --json
 `,
+		Input: []rc.Param{
+			{Name: "fs", Type: rc.ParamString, Required: true, Help: "a remote name string eg \"drive:\""},
+			{Name: "remote", Type: rc.ParamString, Help: "a path within that remote eg \"dir\""},
+		},
+		Output: []rc.Param{
+			{Name: "total", Type: rc.ParamInteger, Help: "quota of bytes that can be used"},
+			{Name: "used", Type: rc.ParamInteger, Help: "bytes in use"},
+			{Name: "trashed", Type: rc.ParamInteger, Help: "bytes in trash"},
+			{Name: "other", Type: rc.ParamInteger, Help: "other usage eg gmail in drive"},
+			{Name: "free", Type: rc.ParamInteger, Help: "bytes which can be uploaded before reaching the quota"},
+			{Name: "objects", Type: rc.ParamInteger, Help: "objects in the storage system"},
+		},
 	})
 }
 
@@ -117,6 +137,13 @@ func init() {
 - dstFs - a remote name string eg "drive2:" for the destination
 - dstRemote - a path within that remote eg "file2.txt" for the destination
 `,
+			Input: []rc.Param{
+				{Name: "srcFs", Type: rc.ParamString, Required: true, Help: "a remote name string eg \"drive:\" for the source"},
+				{Name: "srcRemote", Type: rc.ParamString, Required: true, Help: "a path within that remote eg \"file.txt\" for the source"},
+				{Name: "dstFs", Type: rc.ParamString, Required: true, Help: "a remote name string eg \"drive2:\" for the destination"},
+				{Name: "dstRemote", Type: rc.ParamString, Required: true, Help: "a path within that remote eg \"file2.txt\" for the destination"},
+			},
+			Output: []rc.Param{},
 		})
 	}
 }
@@ -140,21 +167,30 @@ func init() {
 		title    string
 		help     string
 		noRemote bool
+		params   []rc.Param
 	}{
 		{name: "mkdir", title: "Make a destination directory or container"},
 		{name: "rmdir", title: "Remove an empty directory or container"},
 		{name: "purge", title: "Remove a directory or container and all of its contents"},
-		{name: "rmdirs", title: "Remove all the empty directories in the path", help: "- leaveRoot - boolean, set to true not to delete the root\n"},
+		{name: "rmdirs", title: "Remove all the empty directories in the path", help: "- leaveRoot - boolean, set to true not to delete the root\n", params: []rc.Param{
+			{Name: "leaveRoot", Type: rc.ParamBool, Help: "set to true not to delete the root"},
+		}},
 		{name: "delete", title: "Remove files in the path", noRemote: true},
 		{name: "deletefile", title: "Remove the single file pointed to"},
-		{name: "copyurl", title: "Copy the URL to the object", help: "- url - string, URL to read from\n"},
+		{name: "copyurl", title: "Copy the URL to the object", help: "- url - string, URL to read from\n", params: []rc.Param{
+			{Name: "url", Type: rc.ParamString, Required: true, Help: "URL to read from"},
+		}},
 		{name: "cleanup", title: "Remove trashed files in the remote or path", noRemote: true},
 	} {
 		op := op
 		remote := "- remote - a path within that remote eg \"dir\"\n"
+		input := []rc.Param{{Name: "fs", Type: rc.ParamString, Required: true, Help: "a remote name string eg \"drive:\""}}
 		if op.noRemote {
 			remote = ""
+		} else {
+			input = append(input, rc.Param{Name: "remote", Type: rc.ParamString, Required: true, Help: "a path within that remote eg \"dir\""})
 		}
+		input = append(input, op.params...)
 		rc.Add(rc.Call{
 			Path:         "operations/" + op.name,
 			AuthRequired: true,
@@ -168,6 +204,8 @@ func init() {
 ` + remote + op.help + `
 See the [` + op.name + ` command](/commands/rclone_` + op.name + `/) command for more information on the above.
 `,
+			Input:  input,
+			Output: []rc.Param{},
 		})
 	}
 }
@@ -237,6 +275,13 @@ Returns
 
 See the [size command](/commands/rclone_size/) command for more information on the above.
 `,
+		Input: []rc.Param{
+			{Name: "fs", Type: rc.ParamString, Required: true, Help: "a remote name string eg \"drive:path/to/dir\""},
+		},
+		Output: []rc.Param{
+			{Name: "count", Type: rc.ParamInteger, Required: true, Help: "number of files"},
+			{Name: "bytes", Type: rc.ParamInteger, Required: true, Help: "number of bytes in those files"},
+		},
 	})
 }
 
@@ -273,6 +318,13 @@ Returns
 
 See the [link command](/commands/rclone_link/) command for more information on the above.
 `,
+		Input: []rc.Param{
+			{Name: "fs", Type: rc.ParamString, Required: true, Help: "a remote name string eg \"drive:\""},
+			{Name: "remote", Type: rc.ParamString, Required: true, Help: "a path within that remote eg \"dir\""},
+		},
+		Output: []rc.Param{
+			{Name: "url", Type: rc.ParamString, Required: true, Help: "URL of the resource"},
+		},
 	})
 }
 
@@ -290,3 +342,91 @@ func rcPublicLink(in rc.Params) (out rc.Params, err error) {
 	out["url"] = url
 	return out, nil
 }
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "backend/command",
+		AuthRequired: true,
+		Fn:           rcBackend,
+		Title:        "Runs a backend command.",
+		Help: `This takes the following parameters
+
+- command - a string with the command name
+- fs - a remote name string eg "drive:"
+- arg - a list of arguments for the backend command
+- opt - a map of string to string of options
+
+Returns
+
+- result - result from the backend command
+
+For example
+
+    rclone rc backend/command --json '{"command": "noop", "fs": ".", "opt": {"echo": "yes", "blue": ""}, "arg": ["path1", "path2"]}'
+
+Returns
+
+` + "```" + `
+{
+	"result": {
+		"arg": [
+			"path1",
+			"path2"
+		],
+		"name": "noop",
+		"opt": {
+			"blue": "",
+			"echo": "yes"
+		}
+	}
+}
+` + "```" + `
+
+Note that this is the direct equivalent of using this "backend"
+command:
+
+    rclone backend noop . -o echo=yes -o blue path1 path2
+
+See the [backend](/commands/rclone_backend/) command for more information.
+`,
+		Input: []rc.Param{
+			{Name: "command", Type: rc.ParamString, Required: true, Help: "the name of the backend command"},
+			{Name: "fs", Type: rc.ParamString, Required: true, Help: "a remote name string eg \"drive:\""},
+			{Name: "arg", Type: rc.ParamArray, Help: "a list of arguments for the backend command"},
+			{Name: "opt", Type: rc.ParamObject, Help: "a map of string to string of options"},
+		},
+	})
+}
+
+// Run a backend command
+func rcBackend(in rc.Params) (out rc.Params, err error) {
+	f, err := rc.GetFs(in)
+	if err != nil {
+		return nil, err
+	}
+	doCommand := f.Features().Command
+	if doCommand == nil {
+		return nil, errors.Errorf("%v: doesn't support backend commands", f)
+	}
+	command, err := in.GetString("command")
+	if err != nil {
+		return nil, err
+	}
+	var opt = map[string]string{}
+	err = in.GetStruct("opt", &opt)
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	var arg = []string{}
+	err = in.GetStruct("arg", &arg)
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	result, err := doCommand(command, arg, opt)
+	if err != nil {
+		return nil, errors.Wrapf(err, "command %q failed", command)
+	}
+	out = make(rc.Params)
+	out["result"] = result
+	return out, nil
+}
@@ -369,3 +369,46 @@ func TestRcPublicLink(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "doesn't support public links")
 }
+
+// backend/command: Runs a backend command
+func TestRcBackend(t *testing.T) {
+	r, call := rcNewRun(t, "backend/command")
+	defer r.Finalise()
+	r.Mkdir(r.Fremote)
+
+	in := rc.Params{
+		"fs":      r.FremoteName,
+		"command": "noop",
+		"opt": map[string]string{
+			"echo": "yes",
+			"blue": "",
+		},
+		"arg": []string{
+			"path1",
+			"path2",
+		},
+	}
+	out, err := call.Fn(in)
+	if err != nil {
+		assert.Contains(t, err.Error(), "doesn't support backend commands")
+		return
+	}
+	assert.Equal(t, rc.Params{
+		"result": map[string]interface{}{
+			"arg": []string{
+				"path1",
+				"path2",
+			},
+			"name": "noop",
+			"opt": map[string]string{
+				"blue": "",
+				"echo": "yes",
+			},
+		},
+	}, out)
+
+	in["command"] = "potato"
+	_, err = call.Fn(in)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "command not found")
+}
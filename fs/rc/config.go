@@ -32,6 +32,10 @@ func init() {
 		Title: "List all the option blocks",
 		Help: `Returns
 - options - a list of the options block names`,
+		Input: []Param{},
+		Output: []Param{
+			{Name: "options", Type: ParamArray, Required: true, Help: "the option block names"},
+		},
 	})
 }
 
@@ -57,6 +61,7 @@ object with the current option values in.
 This shows the internal names of the option within rclone which should
 map to the external options very easily with a few exceptions.
 `,
+		Input: []Param{},
 	})
 }
 
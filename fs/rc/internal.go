@@ -63,6 +63,10 @@ func init() {
 		Help: `
 This lists all the registered remote control commands as a JSON map in
 the commands response.`,
+		Input: []Param{},
+		Output: []Param{
+			{Name: "commands", Type: ParamArray, Required: true, Help: "the registered commands"},
+		},
 	})
 }
 
@@ -81,6 +85,10 @@ func init() {
 		Help: `
 This returns PID of current process.
 Useful for stopping rclone process.`,
+		Input: []Param{},
+		Output: []Param{
+			{Name: "pid", Type: ParamInteger, Required: true, Help: "PID of the current process"},
+		},
 	})
 }
 
@@ -148,6 +156,7 @@ This tells the go runtime to do a garbage collection run.  It isn't
 necessary to call this normally, but it can be useful for debugging
 memory problems.
 `,
+		Input: []Param{},
 	})
 }
 
@@ -173,6 +182,15 @@ This shows the current version of go and the go runtime
 - goVersion - version of Go runtime in use
 
 `,
+		Input: []Param{},
+		Output: []Param{
+			{Name: "version", Type: ParamString, Required: true, Help: "rclone version, eg \"v1.44\""},
+			{Name: "decomposed", Type: ParamArray, Required: true, Help: "version number as [major, minor, patch, subpatch]"},
+			{Name: "isGit", Type: ParamBool, Required: true, Help: "true if this was compiled from the git version"},
+			{Name: "os", Type: ParamString, Required: true, Help: "OS in use as according to Go"},
+			{Name: "arch", Type: ParamString, Required: true, Help: "cpu architecture in use according to Go"},
+			{Name: "goVersion", Type: ParamString, Required: true, Help: "version of Go runtime in use"},
+		},
 	})
 }
 
@@ -205,6 +223,12 @@ Pass a clear string and rclone will obscure it for the config file:
 Returns
 - obscured - string
 `,
+		Input: []Param{
+			{Name: "clear", Type: ParamString, Required: true, Help: "the string to obscure"},
+		},
+		Output: []Param{
+			{Name: "obscured", Type: ParamString, Required: true, Help: "the obscured string"},
+		},
 	})
 }
 
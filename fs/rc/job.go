@@ -41,8 +41,52 @@ type Jobs struct {
 var (
 	running = newJobs()
 	jobID   = int64(0)
+
+	startHooksMu sync.RWMutex
+	startHooks   []func(job *Job)
+
+	finishHooksMu sync.RWMutex
+	finishHooks   []func(job *Job)
 )
 
+// AddStartHook adds fn to be called with each job as it is started.
+//
+// fn is called before the job starts running.
+func AddStartHook(fn func(job *Job)) {
+	startHooksMu.Lock()
+	startHooks = append(startHooks, fn)
+	startHooksMu.Unlock()
+}
+
+// callStartHooks calls all the start hooks with the job
+func callStartHooks(job *Job) {
+	startHooksMu.RLock()
+	defer startHooksMu.RUnlock()
+	for _, fn := range startHooks {
+		fn(job)
+	}
+}
+
+// AddFinishHook adds fn to be called with each job once it has
+// finished.
+//
+// The job is finished when fn is called so its fields won't change
+// any more.
+func AddFinishHook(fn func(job *Job)) {
+	finishHooksMu.Lock()
+	finishHooks = append(finishHooks, fn)
+	finishHooksMu.Unlock()
+}
+
+// callFinishHooks calls all the finish hooks with the job
+func callFinishHooks(job *Job) {
+	finishHooksMu.RLock()
+	defer finishHooksMu.RUnlock()
+	for _, fn := range finishHooks {
+		fn(job)
+	}
+}
+
 // newJobs makes a new Jobs structure
 func newJobs() *Jobs {
 	return &Jobs{
@@ -117,6 +161,7 @@ func (job *Job) finish(out Params, err error) {
 	}
 	job.Finished = true
 	job.mu.Unlock()
+	callFinishHooks(job)
 	running.kickExpire() // make sure this job gets expired
 }
 
@@ -136,10 +181,11 @@ func (jobs *Jobs) NewJob(fn Func, in Params) *Job {
 		ID:        atomic.AddInt64(&jobID, 1),
 		StartTime: time.Now(),
 	}
-	go job.run(fn, in)
 	jobs.mu.Lock()
 	jobs.jobs[job.ID] = job
 	jobs.mu.Unlock()
+	callStartHooks(job)
+	go job.run(fn, in)
 	return job
 
 }
@@ -171,6 +217,19 @@ Results
 - success - boolean - true for success false otherwise
 - output - output of the job as would have been returned if called synchronously
 `,
+		Input: []Param{
+			{Name: "jobid", Type: ParamInteger, Required: true, Help: "id of the job"},
+		},
+		Output: []Param{
+			{Name: "duration", Type: ParamNumber, Required: true, Help: "time in seconds that the job ran for"},
+			{Name: "endTime", Type: ParamString, Required: true, Help: "time the job finished"},
+			{Name: "error", Type: ParamString, Required: true, Help: "error from the job or empty string for no error"},
+			{Name: "finished", Type: ParamBool, Required: true, Help: "whether the job has finished or not"},
+			{Name: "id", Type: ParamInteger, Required: true, Help: "id of the job"},
+			{Name: "startTime", Type: ParamString, Required: true, Help: "time the job started"},
+			{Name: "success", Type: ParamBool, Required: true, Help: "true for success false otherwise"},
+			{Name: "output", Type: ParamObject, Help: "output of the job as would have been returned if called synchronously"},
+		},
 	})
 }
 
@@ -204,6 +263,10 @@ func init() {
 Results
 - jobids - array of integer job ids
 `,
+		Input: []Param{},
+		Output: []Param{
+			{Name: "jobids", Type: ParamArray, Required: true, Help: "array of integer job ids"},
+		},
 	})
 }
 
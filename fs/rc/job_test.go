@@ -229,3 +229,46 @@ func TestRcJobList(t *testing.T) {
 	require.NotNil(t, out)
 	assert.Equal(t, Params{"jobids": []int64{1}}, out)
 }
+
+func TestAddFinishHook(t *testing.T) {
+	jobs := newJobs()
+	finished := make(chan *Job, 1)
+	AddFinishHook(func(j *Job) {
+		if j.Error == "finish hook potato" {
+			finished <- j
+		}
+	})
+	job := jobs.NewJob(longFn, Params{})
+	job.finish(Params{"a": 1}, errors.New("finish hook potato"))
+	select {
+	case j := <-finished:
+		assert.Equal(t, job, j)
+		assert.Equal(t, true, j.Finished)
+		assert.Equal(t, false, j.Success)
+	case <-time.After(time.Second):
+		t.Fatal("finish hook not called")
+	}
+}
+
+func TestAddStartHook(t *testing.T) {
+	jobs := newJobs()
+	started := make(chan *Job, 10)
+	AddStartHook(func(j *Job) {
+		select {
+		case started <- j:
+		default:
+		}
+	})
+	job := jobs.NewJob(noopFn, Params{})
+	for {
+		select {
+		case j := <-started:
+			if j == job {
+				assert.Equal(t, job, jobs.Get(j.ID))
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatal("start hook not called")
+		}
+	}
+}
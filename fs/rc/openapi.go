@@ -0,0 +1,152 @@
+// Describe the remote control functions as an OpenAPI document
+
+package rc
+
+import (
+	"strings"
+
+	"github.com/ncw/rclone/fs"
+)
+
+func init() {
+	Add(Call{
+		Path:  "rc/openapi",
+		Fn:    rcOpenAPI,
+		Title: "Return an OpenAPI 3 description of the remote control commands",
+		Help: `
+This returns an OpenAPI 3 document describing all the registered
+remote control commands.  It can be used to generate clients for the
+rc API.
+
+Each command is described as a POST to its path.  Commands which
+declare their parameters have them described with their types and
+whether they are required, otherwise the input and output are
+described as a free-form JSON object.
+
+The core, job, operations, sync, mount and options calls declare
+their parameters.  Calls whose parameters can't be listed up front,
+such as options/set which takes the option blocks, and most of the
+calls added by backends and the VFS are free-form.
+
+Eg
+
+    rclone rc rc/openapi > rclone-openapi.json
+`,
+		Input: []Param{},
+		Output: []Param{
+			{Name: "openapi", Type: ParamString, Required: true, Help: "the OpenAPI version of the document"},
+			{Name: "info", Type: ParamObject, Required: true, Help: "information about the API"},
+			{Name: "paths", Type: ParamObject, Required: true, Help: "the description of each command"},
+			{Name: "components", Type: ParamObject, Required: true, Help: "shared definitions"},
+		},
+	})
+}
+
+// Return the OpenAPI document for the global registry
+func rcOpenAPI(in Params) (out Params, err error) {
+	return openAPI(Calls.List()), nil
+}
+
+// paramsSchema returns a JSON schema describing an object with params
+// in.
+//
+// If params is nil then the schema describes any object.
+func paramsSchema(params []Param) Params {
+	schema := Params{
+		"type": "object",
+	}
+	if params == nil {
+		schema["additionalProperties"] = true
+		return schema
+	}
+	properties := Params{}
+	required := []string{}
+	for _, param := range params {
+		property := Params{
+			"type": string(param.Type),
+		}
+		if param.Help != "" {
+			property["description"] = param.Help
+		}
+		properties[param.Name] = property
+		if param.Required {
+			required = append(required, param.Name)
+		}
+	}
+	schema["properties"] = properties
+	if len(required) != 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// jsonContent returns the content description for a JSON body
+// described by schema
+func jsonContent(schema interface{}) Params {
+	return Params{
+		"application/json": Params{
+			"schema": schema,
+		},
+	}
+}
+
+// openAPI returns an OpenAPI 3 document describing calls
+func openAPI(calls []*Call) Params {
+	paths := Params{}
+	for _, call := range calls {
+		tag := call.Path
+		if i := strings.IndexRune(tag, '/'); i >= 0 {
+			tag = tag[:i]
+		}
+		operation := Params{
+			"operationId": strings.Replace(call.Path, "/", "_", -1),
+			"summary":     call.Title,
+			"description": call.Help,
+			"tags":        []string{tag},
+			"requestBody": Params{
+				"content": jsonContent(paramsSchema(call.Input)),
+			},
+			"responses": Params{
+				"200": Params{
+					"description": "Success",
+					"content":     jsonContent(paramsSchema(call.Output)),
+				},
+				"default": Params{
+					"description": "Error",
+					"content":     jsonContent(Params{"$ref": "#/components/schemas/Error"}),
+				},
+			},
+		}
+		if call.AuthRequired {
+			operation["security"] = []Params{{"basicAuth": []string{}}}
+		}
+		paths["/"+call.Path] = Params{
+			"post": operation,
+		}
+	}
+	return Params{
+		"openapi": "3.0.0",
+		"info": Params{
+			"title":       "rclone remote control",
+			"description": "The remote control API of rclone, see https://rclone.org/rc/",
+			"version":     fs.Version,
+		},
+		"paths": paths,
+		"components": Params{
+			"schemas": Params{
+				"Error": paramsSchema([]Param{
+					{Name: "error", Type: ParamString, Required: true, Help: "the error message"},
+					{Name: "input", Type: ParamObject, Help: "the input parameters of the call"},
+					{Name: "path", Type: ParamString, Required: true, Help: "the path of the call"},
+					{Name: "status", Type: ParamInteger, Required: true, Help: "the HTTP status code"},
+				}),
+			},
+			"securitySchemes": Params{
+				"basicAuth": Params{
+					"type":   "http",
+					"scheme": "basic",
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,65 @@
+package rc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPI(t *testing.T) {
+	out, err := rcOpenAPI(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "3.0.0", out["openapi"])
+
+	// Check it round trips through JSON and has the expected shape
+	var doc struct {
+		Paths map[string]struct {
+			Post struct {
+				OperationID string   `json:"operationId"`
+				Summary     string   `json:"summary"`
+				Tags        []string `json:"tags"`
+				Security    []map[string][]string
+				RequestBody struct {
+					Content map[string]struct {
+						Schema struct {
+							Type                 string
+							Properties           map[string]map[string]string
+							Required             []string
+							AdditionalProperties bool
+						}
+					}
+				} `json:"requestBody"`
+			}
+		}
+	}
+	b, err := json.Marshal(out)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(b, &doc))
+
+	obscure, ok := doc.Paths["/core/obscure"]
+	require.True(t, ok)
+	assert.Equal(t, "core_obscure", obscure.Post.OperationID)
+	assert.Equal(t, []string{"core"}, obscure.Post.Tags)
+	assert.Nil(t, obscure.Post.Security)
+	schema := obscure.Post.RequestBody.Content["application/json"].Schema
+	assert.Equal(t, "object", schema.Type)
+	assert.Equal(t, []string{"clear"}, schema.Required)
+	assert.Equal(t, "string", schema.Properties["clear"]["type"])
+	assert.False(t, schema.AdditionalProperties)
+
+	noop, ok := doc.Paths["/rc/noopauth"]
+	require.True(t, ok)
+	assert.Equal(t, []map[string][]string{{"basicAuth": {}}}, noop.Post.Security)
+	schema = noop.Post.RequestBody.Content["application/json"].Schema
+	assert.True(t, schema.AdditionalProperties)
+	assert.Nil(t, schema.Properties)
+
+	// rc/openapi describes itself as taking no parameters
+	openapi, ok := doc.Paths["/rc/openapi"]
+	require.True(t, ok)
+	schema = openapi.Post.RequestBody.Content["application/json"].Schema
+	assert.False(t, schema.AdditionalProperties)
+	assert.Equal(t, 0, len(schema.Properties))
+}
@@ -189,6 +189,9 @@ func (p Params) GetBool(key string) (bool, error) {
 // GetStruct gets a struct from key from the input into the struct
 // pointed to by out. out must be a pointer type.
 //
+// If the value is a string which can't be used directly, as it is
+// when passed as a form or URL parameter, it is decoded as JSON.
+//
 // If the parameter isn't found then error will be of type
 // ErrParamNotFound and out will be unchanged.
 func (p Params) GetStruct(key string, out interface{}) error {
@@ -197,6 +200,9 @@ func (p Params) GetStruct(key string, out interface{}) error {
 		return err
 	}
 	err = Reshape(out, value)
+	if s, ok := value.(string); ok && err != nil {
+		err = json.Unmarshal([]byte(s), out)
+	}
 	if err != nil {
 		return ErrParamInvalid{errors.Wrapf(err, "key %q", key)}
 	}
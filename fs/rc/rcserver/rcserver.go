@@ -142,6 +142,10 @@ func (s *Server) handler(w http.ResponseWriter, r *http.Request) {
 	case "OPTIONS":
 		s.handleOptions(w, r, path)
 	case "GET", "HEAD":
+		if path == streamPath {
+			s.handleStream(w, r, path)
+			return
+		}
 		s.handleGet(w, r, path)
 	default:
 		writeError(path, nil, w, errors.Errorf("method %q not allowed", r.Method), http.StatusMethodNotAllowed)
@@ -193,6 +197,13 @@ func (s *Server) handlePost(w http.ResponseWriter, r *http.Request, path string)
 		return
 	}
 
+	// Check the parameters if the call describes them
+	err := call.Validate(in)
+	if err != nil {
+		writeError(path, in, w, err, http.StatusBadRequest)
+		return
+	}
+
 	// Check to see if it is async or not
 	isAsync, err := in.GetBool("_async")
 	if rc.NotErrParamNotFound(err) {
@@ -248,6 +259,10 @@ func (s *Server) serveRemote(w http.ResponseWriter, r *http.Request, path string
 	}
 	if path == "" || strings.HasSuffix(path, "/") {
 		path = strings.Trim(path, "/")
+		if format := r.URL.Query().Get(serve.DownloadParam); format != "" {
+			serve.Archive(w, r, f, path, format, nil)
+			return
+		}
 		entries, err := list.DirSorted(f, false, path)
 		if err != nil {
 			writeError(path, nil, w, errors.Wrap(err, "failed to list directory"), http.StatusInternalServerError)
@@ -255,6 +270,7 @@ func (s *Server) serveRemote(w http.ResponseWriter, r *http.Request, path string
 		}
 		// Make the entries for display
 		directory := serve.NewDirectory(path, s.HTMLTemplate)
+		directory.DownloadLinks = true
 		for _, entry := range entries {
 			_, isDir := entry.(fs.Directory)
 			directory.AddEntry(entry.Remote(), isDir)
@@ -208,6 +208,7 @@ func TestRemoteServing(t *testing.T) {
 </head>
 <body>
 <h1>Directory listing of /</h1>
+<p>Download as <a href="?download=zip">zip</a> or <a href="?download=tar.gz">tar.gz</a></p>
 <a href="dir/">dir/</a><br />
 <a href="file.txt">file.txt</a><br />
 </body>
@@ -258,6 +259,7 @@ func TestRemoteServing(t *testing.T) {
 </head>
 <body>
 <h1>Directory listing of /dir</h1>
+<p>Download as <a href="?download=zip">zip</a> or <a href="?download=tar.gz">tar.gz</a></p>
 <a href="file2.txt">file2.txt</a><br />
 </body>
 </html>
@@ -630,3 +632,44 @@ func TestRCAsync(t *testing.T) {
 	opt.Files = ""
 	testServer(t, tests, &opt)
 }
+
+func TestRCValidate(t *testing.T) {
+	tests := []testRun{{
+		Name:        "ok",
+		URL:         "core/obscure",
+		Method:      "POST",
+		ContentType: "application/json",
+		Body:        `{ "clear":"potato" }`,
+		Status:      http.StatusOK,
+		Contains:    regexp.MustCompile(`"obscured": "`),
+	}, {
+		Name:        "unknown",
+		URL:         "core/obscure",
+		Method:      "POST",
+		ContentType: "application/json",
+		Body:        `{ "clear":"potato", "potato":"clear" }`,
+		Status:      http.StatusBadRequest,
+		Expected: `{
+	"error": "unknown parameters [\"potato\"] for \"core/obscure\"",
+	"input": {
+		"clear": "potato",
+		"potato": "clear"
+	},
+	"path": "core/obscure",
+	"status": 400
+}
+`,
+	}, {
+		Name:        "mistyped",
+		URL:         "job/status",
+		Method:      "POST",
+		ContentType: "application/json",
+		Body:        `{ "jobid":"potato" }`,
+		Status:      http.StatusBadRequest,
+		Contains:    regexp.MustCompile(`couldn't parse key \\"jobid\\" \(potato\) as int64`),
+	}}
+	opt := newTestOpt()
+	opt.Serve = true
+	opt.Files = ""
+	testServer(t, tests, &opt)
+}
@@ -0,0 +1,340 @@
+// Stream stats, job and log events from the rc server
+
+package rcserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/accounting"
+	"github.com/ncw/rclone/fs/rc"
+	"github.com/pkg/errors"
+)
+
+const (
+	// streamPath is the path the event stream is served on
+	streamPath = "core/stream"
+	// default interval between stats events
+	defaultStreamInterval = time.Second
+	// minimum interval between stats events
+	minStreamInterval = 100 * time.Millisecond
+	// number of events to buffer for each subscriber before dropping them
+	streamBufferSize = 256
+)
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         streamPath,
+		AuthRequired: true,
+		Fn: func(in rc.Params) (out rc.Params, err error) {
+			return nil, errors.Errorf("%s streams events so must be fetched with GET", streamPath)
+		},
+		Title: "Stream stats, job and log events.",
+		Help: `
+Do a GET on /core/stream to receive a stream of events as they happen
+rather than polling core/stats.  It can't be called with POST or
+rclone rc.
+
+The stream is sent as server-sent events by default.  Each event has
+a type of stats, job or log and its data is a JSON object.
+
+- stats - the output of core/stats, sent when it changes
+- job - the output of job/status sent when a job starts and finishes
+- log - a log line with time, level and text
+
+These query parameters can be used
+
+- events - comma separated list of event types to send (default stats,job,log)
+- level - send log lines at or above this level (default INFO)
+- interval - how often to check the stats for changes (default 1s)
+- format - sse (default) or json to send one JSON object per line with type and data
+
+Eg
+
+    curl -N -u user:pass 'http://localhost:5572/core/stream?events=stats,log&level=notice'
+`,
+		Input: []rc.Param{
+			{Name: "events", Type: rc.ParamString, Help: "comma separated list of event types to send"},
+			{Name: "level", Type: rc.ParamString, Help: "send log lines at or above this level"},
+			{Name: "interval", Type: rc.ParamString, Help: "how often to check the stats for changes"},
+			{Name: "format", Type: rc.ParamString, Help: "sse or json"},
+		},
+	})
+}
+
+// Event types which can be streamed
+const (
+	eventStats = "stats"
+	eventJob   = "job"
+	eventLog   = "log"
+)
+
+// streamEvent is a single event sent to a subscriber
+type streamEvent struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// streamSubscriber receives events from the hub
+type streamSubscriber struct {
+	events   chan streamEvent
+	jobs     bool        // set if job events are wanted
+	logs     bool        // set if log events are wanted
+	logLevel fs.LogLevel // only send log events at or above this level
+}
+
+// streamHub distributes job and log events to the subscribers
+type streamHub struct {
+	once        sync.Once
+	mu          sync.Mutex
+	subscribers map[*streamSubscriber]struct{}
+}
+
+// hub is the global streamHub - the hooks it installs are global so
+// there is only one of these
+var hub = &streamHub{
+	subscribers: map[*streamSubscriber]struct{}{},
+}
+
+// subscribe adds sub to the hub installing the hooks if necessary
+func (h *streamHub) subscribe(sub *streamSubscriber) {
+	h.once.Do(func() {
+		rc.AddStartHook(h.jobHook)
+		rc.AddFinishHook(h.jobHook)
+		fs.AddLogHook(h.logHook)
+	})
+	h.mu.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mu.Unlock()
+}
+
+// unsubscribe removes sub from the hub
+func (h *streamHub) unsubscribe(sub *streamSubscriber) {
+	h.mu.Lock()
+	delete(h.subscribers, sub)
+	h.mu.Unlock()
+}
+
+// send the event to all the subscribers for which want returns true
+//
+// If a subscriber isn't keeping up then the event is dropped for it.
+func (h *streamHub) send(event streamEvent, want func(sub *streamSubscriber) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers {
+		if !want(sub) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+		}
+	}
+}
+
+// jobHook is called when jobs start and finish
+func (h *streamHub) jobHook(job *rc.Job) {
+	h.mu.Lock()
+	n := len(h.subscribers)
+	h.mu.Unlock()
+	if n == 0 {
+		return
+	}
+	var status rc.Params
+	err := rc.Reshape(&status, job)
+	if err != nil {
+		return
+	}
+	h.send(streamEvent{Type: eventJob, Data: status}, func(sub *streamSubscriber) bool {
+		return sub.jobs
+	})
+}
+
+// logHook is called with every log line
+func (h *streamHub) logHook(level fs.LogLevel, text string) {
+	event := streamEvent{
+		Type: eventLog,
+		Data: rc.Params{
+			"time":  time.Now(),
+			"level": level.String(),
+			"text":  text,
+		},
+	}
+	h.send(event, func(sub *streamSubscriber) bool {
+		return sub.logs && level <= sub.logLevel
+	})
+}
+
+// streamWriter writes events to the client in the requested format
+type streamWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	sse     bool
+}
+
+// write the event to the client and flush it
+func (sw *streamWriter) write(event streamEvent) error {
+	var err error
+	if sw.sse {
+		var data []byte
+		data, err = json.Marshal(event.Data)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(sw.w, "event: %s\ndata: %s\n\n", event.Type, data)
+	} else {
+		err = json.NewEncoder(sw.w).Encode(event)
+	}
+	if err != nil {
+		return err
+	}
+	sw.flusher.Flush()
+	return nil
+}
+
+// parseStreamParams reads the query parameters of a stream request
+// into sub.
+//
+// It returns whether stats events are wanted, the interval to check
+// the stats at and whether to use the SSE format.
+func parseStreamParams(r *http.Request, sub *streamSubscriber) (stats bool, interval time.Duration, sse bool, err error) {
+	q := r.URL.Query()
+	events := []string{eventStats, eventJob, eventLog}
+	if value := q.Get("events"); value != "" {
+		events = strings.Split(value, ",")
+	}
+	for _, event := range events {
+		switch strings.TrimSpace(event) {
+		case eventStats:
+			stats = true
+		case eventJob:
+			sub.jobs = true
+		case eventLog:
+			sub.logs = true
+		default:
+			return false, 0, false, errors.Errorf("unknown event type %q", event)
+		}
+	}
+	sub.logLevel = fs.LogLevelInfo
+	if value := q.Get("level"); value != "" {
+		err = sub.logLevel.Set(strings.ToUpper(value))
+		if err != nil {
+			return false, 0, false, err
+		}
+	}
+	interval = defaultStreamInterval
+	if value := q.Get("interval"); value != "" {
+		interval, err = time.ParseDuration(value)
+		if err != nil {
+			return false, 0, false, errors.Wrap(err, "bad interval")
+		}
+		if interval < minStreamInterval {
+			interval = minStreamInterval
+		}
+	}
+	switch format := q.Get("format"); format {
+	case "", "sse":
+		sse = true
+	case "json":
+		sse = false
+	default:
+		return false, 0, false, errors.Errorf("unknown format %q", format)
+	}
+	return stats, interval, sse, nil
+}
+
+// handleStream streams events to the client until it disconnects
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request, path string) {
+	if !s.opt.NoAuth && !s.UsingAuth() {
+		writeError(path, nil, w, errors.Errorf("authentication must be set up on the rc server to use %q or the --rc-no-auth flag must be in use", path), http.StatusForbidden)
+		return
+	}
+	sub := &streamSubscriber{
+		events: make(chan streamEvent, streamBufferSize),
+	}
+	stats, interval, sse, err := parseStreamParams(r, sub)
+	if err != nil {
+		writeError(path, nil, w, err, http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(path, nil, w, errors.New("streaming not supported"), http.StatusInternalServerError)
+		return
+	}
+	sw := &streamWriter{
+		w:       w,
+		flusher: flusher,
+		sse:     sse,
+	}
+	// Subscribe before replying so no events are missed once the
+	// client has seen the headers
+	if sub.jobs || sub.logs {
+		hub.subscribe(sub)
+		defer hub.unsubscribe(sub)
+	}
+
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Send the stats if they have changed since last time
+	var lastStats []byte
+	sendStats := func() error {
+		out, err := accounting.Stats.RemoteStats(nil)
+		if err != nil {
+			return err
+		}
+		// Ignore the changing elapsedTime and speed when
+		// looking for changes
+		elapsedTime, speed := out["elapsedTime"], out["speed"]
+		delete(out, "elapsedTime")
+		delete(out, "speed")
+		current, err := json.Marshal(out)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(current, lastStats) {
+			return nil
+		}
+		lastStats = current
+		out["elapsedTime"], out["speed"] = elapsedTime, speed
+		return sw.write(streamEvent{Type: eventStats, Data: out})
+	}
+	var tick <-chan time.Time
+	if stats {
+		err = sendStats()
+		if err != nil {
+			return
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	done := r.Context().Done()
+	for {
+		select {
+		case <-done:
+			return
+		case event := <-sub.events:
+			err = sw.write(event)
+		case <-tick:
+			err = sendStats()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
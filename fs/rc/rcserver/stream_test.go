@@ -0,0 +1,155 @@
+// +build go1.8
+
+package rcserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamErrors(t *testing.T) {
+	tests := []testRun{{
+		Name:     "events",
+		URL:      "core/stream?events=potato",
+		Status:   http.StatusBadRequest,
+		Contains: regexp.MustCompile(`unknown event type \\"potato\\"`),
+	}, {
+		Name:     "level",
+		URL:      "core/stream?level=potato",
+		Status:   http.StatusBadRequest,
+		Contains: regexp.MustCompile(`Unknown log level \\"POTATO\\"`),
+	}, {
+		Name:     "interval",
+		URL:      "core/stream?interval=potato",
+		Status:   http.StatusBadRequest,
+		Contains: regexp.MustCompile(`bad interval`),
+	}, {
+		Name:     "format",
+		URL:      "core/stream?format=potato",
+		Status:   http.StatusBadRequest,
+		Contains: regexp.MustCompile(`unknown format \\"potato\\"`),
+	}}
+	opt := newTestOpt()
+	opt.NoAuth = true
+	testServer(t, tests, &opt)
+
+	tests = []testRun{{
+		Name:     "auth",
+		URL:      "core/stream",
+		Status:   http.StatusForbidden,
+		Contains: regexp.MustCompile(`authentication must be set up`),
+	}}
+	opt = newTestOpt()
+	testServer(t, tests, &opt)
+}
+
+// startStream starts a stream with the query and returns a scanner
+// reading from it and a function to close it
+func startStream(t *testing.T, query string) (*bufio.Scanner, func()) {
+	opt := newTestOpt()
+	opt.NoAuth = true
+	rcServer := newServer(&opt, http.NewServeMux())
+	ts := httptest.NewServer(http.HandlerFunc(rcServer.handler))
+	resp, err := http.Get(ts.URL + "/core/stream?" + query)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	return bufio.NewScanner(resp.Body), func() {
+		_ = resp.Body.Close()
+		ts.Close()
+	}
+}
+
+// readEvents reads JSON events from in passing them to fn until it
+// returns true
+func readEvents(t *testing.T, in *bufio.Scanner, fn func(event streamEvent) bool) {
+	timeout := time.AfterFunc(10*time.Second, func() {
+		t.Error("timed out waiting for event")
+	})
+	defer timeout.Stop()
+	for in.Scan() {
+		var event streamEvent
+		require.NoError(t, json.Unmarshal(in.Bytes(), &event))
+		if fn(event) {
+			return
+		}
+	}
+	t.Fatalf("stream finished early: %v", in.Err())
+}
+
+func TestStreamJSON(t *testing.T) {
+	in, cleanup := startStream(t, "events=log,job&format=json&level=notice")
+	defer cleanup()
+
+	fs.Logf("stream", "potato %d", 42)
+	fs.Infof("stream", "not at level")
+	readEvents(t, in, func(event streamEvent) bool {
+		require.Equal(t, eventLog, event.Type)
+		data := event.Data.(map[string]interface{})
+		assert.NotEqual(t, "stream: not at level", data["text"])
+		if data["text"] != "stream: potato 42" {
+			return false
+		}
+		assert.Equal(t, "NOTICE", data["level"])
+		return true
+	})
+
+	out, err := rc.StartJob(func(in rc.Params) (rc.Params, error) {
+		return rc.Params{"potato": 1.0}, nil
+	}, rc.Params{})
+	require.NoError(t, err)
+	jobID := float64(out["jobid"].(int64))
+	var started bool
+	readEvents(t, in, func(event streamEvent) bool {
+		if event.Type != eventJob {
+			return false
+		}
+		data := event.Data.(map[string]interface{})
+		if data["id"] != jobID {
+			return false
+		}
+		if !started {
+			assert.Equal(t, false, data["finished"])
+			started = true
+			return false
+		}
+		assert.Equal(t, true, data["finished"])
+		assert.Equal(t, true, data["success"])
+		assert.Equal(t, map[string]interface{}{"potato": 1.0}, data["output"])
+		return true
+	})
+}
+
+func TestStreamRegistered(t *testing.T) {
+	call := rc.Calls.Get(streamPath)
+	require.NotNil(t, call)
+	assert.True(t, call.AuthRequired)
+	_, err := call.Fn(rc.Params{})
+	assert.Error(t, err)
+}
+
+func TestStreamSSE(t *testing.T) {
+	in, cleanup := startStream(t, "events=stats")
+	defer cleanup()
+
+	require.True(t, in.Scan())
+	assert.Equal(t, "event: stats", in.Text())
+	require.True(t, in.Scan())
+	assert.True(t, strings.HasPrefix(in.Text(), "data: {"), in.Text())
+	var stats rc.Params
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(in.Text(), "data: ")), &stats))
+	assert.Contains(t, stats, "bytes")
+	assert.Contains(t, stats, "elapsedTime")
+	require.True(t, in.Scan())
+	assert.Equal(t, "", in.Text())
+}
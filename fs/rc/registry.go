@@ -16,11 +16,13 @@ type Func func(in Params) (out Params, err error)
 // Call defines info about a remote control function and is used in
 // the Add function to create new entry points.
 type Call struct {
-	Path         string // path to activate this RC
-	Fn           Func   `json:"-"` // function to call
-	Title        string // help for the function
-	AuthRequired bool   // if set then this call requires authorisation to be set
-	Help         string // multi-line markdown formatted help
+	Path         string  // path to activate this RC
+	Fn           Func    `json:"-"` // function to call
+	Title        string  // help for the function
+	AuthRequired bool    // if set then this call requires authorisation to be set
+	Help         string  // multi-line markdown formatted help
+	Input        []Param `json:",omitempty"` // if set, the parameters this call accepts
+	Output       []Param `json:",omitempty"` // if set, the parameters this call returns
 }
 
 // Registry holds the list of all the registered remote control functions
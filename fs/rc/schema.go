@@ -0,0 +1,128 @@
+// Describe the parameters of the remote control functions
+
+package rc
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ParamType is the type of a parameter of a Call
+//
+// The values are the JSON schema type names
+type ParamType string
+
+// The possible parameter types
+const (
+	ParamString  ParamType = "string"
+	ParamInteger ParamType = "integer"
+	ParamNumber  ParamType = "number"
+	ParamBool    ParamType = "boolean"
+	ParamObject  ParamType = "object"
+	ParamArray   ParamType = "array"
+)
+
+// Param describes a single input or output parameter of a Call
+type Param struct {
+	Name     string    // name of the parameter
+	Type     ParamType // type of the parameter
+	Required bool      // set if the parameter must be supplied
+	Help     string    // single line description of the parameter
+}
+
+// jsonKind returns the kind of value.  Strings which hold JSON, as
+// objects and arrays do when passed as form or URL parameters, are
+// decoded first.
+func jsonKind(value interface{}) reflect.Kind {
+	if s, ok := value.(string); ok {
+		var decoded interface{}
+		if json.Unmarshal([]byte(s), &decoded) != nil {
+			return reflect.String
+		}
+		value = decoded
+	}
+	if value == nil {
+		return reflect.Invalid
+	}
+	return reflect.TypeOf(value).Kind()
+}
+
+// check returns an error if the value in p doesn't match the type of
+// param
+func (param *Param) check(p Params) (err error) {
+	value := p[param.Name]
+	switch param.Type {
+	case ParamString:
+		if _, ok := value.(string); !ok {
+			err = ErrParamInvalid{errors.Errorf("expecting string value for key %q (was %T)", param.Name, value)}
+		}
+	case ParamInteger:
+		var i int64
+		i, err = p.GetInt64(param.Name)
+		if x, ok := value.(float64); ok && err == nil && (float64(i) != x || math.IsInf(x, 0)) {
+			err = ErrParamInvalid{errors.Errorf("expecting integer value for key %q (was %v)", param.Name, value)}
+		}
+	case ParamNumber:
+		_, err = p.GetFloat64(param.Name)
+	case ParamBool:
+		_, err = p.GetBool(param.Name)
+	case ParamObject:
+		if jsonKind(value) != reflect.Map {
+			err = ErrParamInvalid{errors.Errorf("expecting object value for key %q (was %T)", param.Name, value)}
+		}
+	case ParamArray:
+		kind := jsonKind(value)
+		if kind != reflect.Slice && kind != reflect.Array {
+			err = ErrParamInvalid{errors.Errorf("expecting array value for key %q (was %T)", param.Name, value)}
+		}
+	default:
+		err = errors.Errorf("unknown type %q for key %q", param.Type, param.Name)
+	}
+	return err
+}
+
+// Validate checks the input parameters against the Input declared in
+// the Call.
+//
+// It returns an error of type ErrParamInvalid for unknown or mistyped
+// parameters and ErrParamNotFound for missing required parameters.
+//
+// Parameters starting with "_" (eg "_async") are reserved for the rc
+// server and are always allowed.
+//
+// If the Call doesn't declare its Input then nothing is checked.
+func (call *Call) Validate(in Params) error {
+	if call.Input == nil {
+		return nil
+	}
+	known := make(map[string]*Param, len(call.Input))
+	for i := range call.Input {
+		param := &call.Input[i]
+		known[param.Name] = param
+		if _, found := in[param.Name]; !found {
+			if param.Required {
+				return ErrParamNotFound(param.Name)
+			}
+			continue
+		}
+		if err := param.check(in); err != nil {
+			return err
+		}
+	}
+	var unknown []string
+	for key := range in {
+		if _, found := known[key]; !found && !strings.HasPrefix(key, "_") {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) != 0 {
+		sort.Strings(unknown)
+		return ErrParamInvalid{errors.Errorf("unknown parameters %q for %q", unknown, call.Path)}
+	}
+	return nil
+}
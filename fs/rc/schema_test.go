@@ -0,0 +1,65 @@
+package rc
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallValidate(t *testing.T) {
+	call := &Call{
+		Path: "test/validate",
+		Input: []Param{
+			{Name: "string", Type: ParamString, Required: true},
+			{Name: "integer", Type: ParamInteger},
+			{Name: "number", Type: ParamNumber},
+			{Name: "bool", Type: ParamBool},
+			{Name: "object", Type: ParamObject},
+			{Name: "array", Type: ParamArray},
+		},
+	}
+	for _, test := range []struct {
+		in      Params
+		wantErr func(error) bool
+	}{
+		{Params{"string": "potato"}, nil},
+		{Params{"string": "potato", "_async": true}, nil},
+		{Params{"string": "potato", "integer": 3.0, "number": 3.5, "bool": "true"}, nil},
+		{Params{"string": "potato", "integer": "42", "number": "1e3", "bool": false}, nil},
+		{Params{"string": "potato", "object": map[string]interface{}{"a": 1}, "array": []interface{}{1}}, nil},
+		{Params{"string": "potato", "object": Params{}, "array": []string{}}, nil},
+		{Params{}, IsErrParamNotFound},
+		{Params{"integer": 1}, IsErrParamNotFound},
+		{Params{"string": 1}, IsErrParamInvalid},
+		{Params{"string": "potato", "integer": 3.5}, IsErrParamInvalid},
+		{Params{"string": "potato", "integer": "3.5"}, IsErrParamInvalid},
+		{Params{"string": "potato", "number": "potato"}, IsErrParamInvalid},
+		{Params{"string": "potato", "bool": "potato"}, IsErrParamInvalid},
+		{Params{"string": "potato", "object": `{"a":1}`, "array": `["b"]`}, nil},
+		{Params{"string": "potato", "object": "{"}, IsErrParamInvalid},
+		{Params{"string": "potato", "object": "[]"}, IsErrParamInvalid},
+		{Params{"string": "potato", "object": nil}, IsErrParamInvalid},
+		{Params{"string": "potato", "array": "{}"}, IsErrParamInvalid},
+		{Params{"string": "potato", "array": "potato"}, IsErrParamInvalid},
+		{Params{"string": "potato", "potato": "string"}, IsErrParamInvalid},
+	} {
+		what := fmt.Sprintf("%+v", test.in)
+		err := call.Validate(test.in)
+		if test.wantErr == nil {
+			assert.NoError(t, err, what)
+		} else {
+			assert.Error(t, err, what)
+			assert.True(t, test.wantErr(err), what)
+		}
+	}
+
+	// No Input means no validation
+	call.Input = nil
+	assert.NoError(t, call.Validate(Params{"potato": 1}))
+
+	// Empty Input means no parameters allowed
+	call.Input = []Param{}
+	assert.NoError(t, call.Validate(Params{}))
+	assert.True(t, IsErrParamInvalid(call.Validate(Params{"potato": 1})))
+}
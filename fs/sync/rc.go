@@ -8,8 +8,14 @@ func init() {
 	for _, name := range []string{"sync", "copy", "move"} {
 		name := name
 		moveHelp := ""
+		input := []rc.Param{
+			{Name: "srcFs", Type: rc.ParamString, Required: true, Help: "a remote name string eg \"drive:src\" for the source"},
+			{Name: "dstFs", Type: rc.ParamString, Required: true, Help: "a remote name string eg \"drive:dst\" for the destination"},
+			{Name: "createEmptySrcDirs", Type: rc.ParamBool, Help: "create empty src directories on the destination if set"},
+		}
 		if name == "move" {
 			moveHelp = "- deleteEmptySrcDirs - delete empty src directories if set\n"
+			input = append(input, rc.Param{Name: "deleteEmptySrcDirs", Type: rc.ParamBool, Help: "delete empty src directories if set"})
 		}
 		rc.Add(rc.Call{
 			Path:         "sync/" + name,
@@ -22,9 +28,12 @@ func init() {
 
 - srcFs - a remote name string eg "drive:src" for the source
 - dstFs - a remote name string eg "drive:dst" for the destination
+- createEmptySrcDirs - create empty src directories on the destination if set
 ` + moveHelp + `
 
 See the [` + name + ` command](/commands/rclone_` + name + `/) command for more information on the above.`,
+			Input:  input,
+			Output: []rc.Param{},
 		})
 	}
 }
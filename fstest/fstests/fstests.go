@@ -942,6 +942,34 @@ func Run(t *testing.T, opt *Opt) {
 
 			})
 
+			// TestFsCompose tests Compose
+			t.Run("FsCompose", func(t *testing.T) {
+				skipIfNotOk(t)
+
+				// Check have Compose
+				doCompose := remote.Features().Compose
+				if doCompose == nil {
+					t.Skip("FS has no Composer interface")
+				}
+
+				// Compose file1 on its own as backends may not
+				// be able to compose small objects together
+				src := findObject(t, remote, file1.Path)
+				dstRemote := file1.Path + "-compose"
+				dst, err := doCompose([]fs.Object{src}, dstRemote)
+				if err == fs.ErrorCantCompose {
+					t.Skip("FS can't compose")
+				}
+				require.NoError(t, err, fmt.Sprintf("Error: %#v", err))
+				assert.Equal(t, dstRemote, dst.Remote())
+				assert.Equal(t, file1.Size, dst.Size())
+				assert.Equal(t, file1Contents, readObject(t, dst, -1))
+
+				// Delete composed object
+				err = dst.Remove()
+				require.NoError(t, err)
+			})
+
 			// TestFsMove tests Move
 			t.Run("FsMove", func(t *testing.T) {
 				skipIfNotOk(t)
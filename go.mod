@@ -12,7 +12,6 @@ require (
 	github.com/anacrolix/dms v0.0.0-20180117034613-8af4925bffb5
 	github.com/aws/aws-sdk-go v1.16.31
 	github.com/billziss-gh/cgofuse v1.1.0
-	github.com/coreos/bbolt v1.3.2
 	github.com/cpuguy83/go-md2man v1.0.8 // indirect
 	github.com/djherbis/times v1.2.0
 	github.com/dropbox/dropbox-sdk-go-unofficial v5.4.0+incompatible
@@ -48,7 +47,7 @@ require (
 	github.com/thinkhy/go-adb v0.0.0-20190123053734-b4b48de70418
 	github.com/xanzy/ssh-agent v0.2.0
 	github.com/yunify/qingstor-sdk-go v2.2.15+incompatible
-	go.etcd.io/bbolt v1.3.2 // indirect
+	go.etcd.io/bbolt v1.3.5
 	golang.org/x/crypto v0.0.0-20190208162236-193df9c0f06f
 	golang.org/x/net v0.0.0-20190206173232-65e2d4e15006
 	golang.org/x/oauth2 v0.0.0-20190130055435-99b60b757ec1
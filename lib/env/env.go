@@ -0,0 +1,16 @@
+// Package env contains functions for dealing with environment variables
+package env
+
+import "os"
+
+// ShellExpand replaces a leading "~" with "${HOME}" and expands all
+// environment variables afterwards.
+func ShellExpand(s string) string {
+	if s != "" {
+		if s[0] == '~' {
+			s = "${HOME}" + s[1:]
+		}
+		s = os.ExpandEnv(s)
+	}
+	return s
+}
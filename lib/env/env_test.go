@@ -0,0 +1,29 @@
+package env
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellExpand(t *testing.T) {
+	home := os.Getenv("HOME")
+	err := os.Setenv("EXPAND_TEST", "potato")
+	assert.NoError(t, err)
+	defer func() {
+		_ = os.Unsetenv("EXPAND_TEST")
+	}()
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"~", home},
+		{"~/dir/file.txt", home + "/dir/file.txt"},
+		{"/dir/~/file.txt", "/dir/~/file.txt"},
+		{"~/${EXPAND_TEST}", home + "/potato"},
+	} {
+		got := ShellExpand(test.in)
+		assert.Equal(t, test.want, got, test.in)
+	}
+}
@@ -0,0 +1,141 @@
+// Package ranges provides the Ranges type for keeping track of byte
+// ranges which may or may not be present in an object.
+package ranges
+
+import "sort"
+
+// Range describes a single byte range
+type Range struct {
+	Pos  int64
+	Size int64
+}
+
+// End returns the end of the Range - one past the last byte
+func (r Range) End() int64 {
+	return r.Pos + r.Size
+}
+
+// IsEmpty returns true if the range has no bytes in
+func (r Range) IsEmpty() bool {
+	return r.Size <= 0
+}
+
+// Clip ensures r doesn't extend beyond size
+func (r *Range) Clip(size int64) {
+	if r.End() > size {
+		r.Size = size - r.Pos
+	}
+	if r.Size < 0 {
+		r.Size = 0
+	}
+}
+
+// Intersection returns the common part of r and b
+func (r Range) Intersection(b Range) (intersection Range) {
+	start, end := r.Pos, r.End()
+	if b.Pos > start {
+		start = b.Pos
+	}
+	if b.End() < end {
+		end = b.End()
+	}
+	if end <= start {
+		return Range{}
+	}
+	return Range{Pos: start, Size: end - start}
+}
+
+// Ranges is a sorted list of non overlapping, non touching ranges
+type Ranges []Range
+
+// search finds the index of the first range in rs which ends at or
+// after pos
+func (rs Ranges) search(pos int64) int {
+	return sort.Search(len(rs), func(i int) bool {
+		return rs[i].End() >= pos
+	})
+}
+
+// Insert the new range into rs, merging it with any ranges it
+// overlaps or touches
+func (rs *Ranges) Insert(r Range) {
+	if r.IsEmpty() {
+		return
+	}
+	ranges := *rs
+	i := ranges.search(r.Pos)
+	// find the ranges r overlaps or touches
+	j := i
+	for j < len(ranges) && ranges[j].Pos <= r.End() {
+		if ranges[j].Pos < r.Pos {
+			r.Size += r.Pos - ranges[j].Pos
+			r.Pos = ranges[j].Pos
+		}
+		if ranges[j].End() > r.End() {
+			r.Size = ranges[j].End() - r.Pos
+		}
+		j++
+	}
+	// replace ranges[i:j] with r
+	newRanges := make(Ranges, 0, len(ranges)-(j-i)+1)
+	newRanges = append(newRanges, ranges[:i]...)
+	newRanges = append(newRanges, r)
+	newRanges = append(newRanges, ranges[j:]...)
+	*rs = newRanges
+}
+
+// Present returns true if all of r is in rs
+func (rs Ranges) Present(r Range) bool {
+	if r.IsEmpty() {
+		return true
+	}
+	i := rs.search(r.Pos)
+	return i < len(rs) && rs[i].Pos <= r.Pos && rs[i].End() >= r.End() && rs[i].End() > r.Pos
+}
+
+// FindMissing returns the first part of r which isn't in rs.  ok is
+// false if all of r is present.
+func (rs Ranges) FindMissing(r Range) (missing Range, ok bool) {
+	if r.IsEmpty() {
+		return Range{}, false
+	}
+	pos, end := r.Pos, r.End()
+	for _, present := range rs[rs.search(pos):] {
+		if present.Pos > pos {
+			// gap before this range
+			if present.Pos < end {
+				end = present.Pos
+			}
+			break
+		}
+		if present.End() > pos {
+			pos = present.End()
+		}
+		if pos >= end {
+			return Range{}, false
+		}
+	}
+	return Range{Pos: pos, Size: end - pos}, true
+}
+
+// Truncate removes anything in rs at or beyond size
+func (rs *Ranges) Truncate(size int64) {
+	ranges := *rs
+	i := sort.Search(len(ranges), func(i int) bool {
+		return ranges[i].Pos >= size
+	})
+	newRanges := make(Ranges, i)
+	copy(newRanges, ranges[:i])
+	if i > 0 {
+		newRanges[i-1].Clip(size)
+	}
+	*rs = newRanges
+}
+
+// Size returns the total number of bytes in rs
+func (rs Ranges) Size() (size int64) {
+	for _, r := range rs {
+		size += r.Size
+	}
+	return size
+}
@@ -0,0 +1,127 @@
+package ranges
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRangeEnd(t *testing.T) {
+	assert.Equal(t, int64(3), Range{Pos: 1, Size: 2}.End())
+}
+
+func TestRangeClip(t *testing.T) {
+	r := Range{Pos: 1, Size: 10}
+	r.Clip(5)
+	assert.Equal(t, Range{Pos: 1, Size: 4}, r)
+	r.Clip(0)
+	assert.Equal(t, Range{Pos: 1, Size: 0}, r)
+}
+
+func TestRangeIntersection(t *testing.T) {
+	for _, test := range []struct {
+		r, b, want Range
+	}{
+		{Range{1, 5}, Range{3, 5}, Range{3, 3}},
+		{Range{3, 5}, Range{1, 5}, Range{3, 3}},
+		{Range{1, 10}, Range{3, 2}, Range{3, 2}},
+		{Range{1, 2}, Range{3, 2}, Range{}},
+		{Range{1, 2}, Range{5, 2}, Range{}},
+	} {
+		assert.Equal(t, test.want, test.r.Intersection(test.b), fmt.Sprintf("%v^%v", test.r, test.b))
+	}
+}
+
+func TestRangesInsert(t *testing.T) {
+	for _, test := range []struct {
+		rs   Ranges
+		r    Range
+		want Ranges
+	}{
+		{nil, Range{1, 2}, Ranges{{1, 2}}},
+		{Ranges{{1, 2}}, Range{}, Ranges{{1, 2}}},
+		{Ranges{{5, 2}}, Range{1, 2}, Ranges{{1, 2}, {5, 2}}},
+		{Ranges{{1, 2}}, Range{5, 2}, Ranges{{1, 2}, {5, 2}}},
+		{Ranges{{1, 2}}, Range{3, 2}, Ranges{{1, 4}}},
+		{Ranges{{3, 2}}, Range{1, 2}, Ranges{{1, 4}}},
+		{Ranges{{1, 2}, {5, 2}}, Range{3, 2}, Ranges{{1, 6}}},
+		{Ranges{{1, 2}, {5, 2}, {10, 1}}, Range{2, 4}, Ranges{{1, 6}, {10, 1}}},
+		{Ranges{{1, 2}, {5, 2}, {10, 1}}, Range{0, 20}, Ranges{{0, 20}}},
+		{Ranges{{1, 10}}, Range{2, 2}, Ranges{{1, 10}}},
+	} {
+		rs := append(Ranges(nil), test.rs...)
+		rs.Insert(test.r)
+		assert.Equal(t, test.want, rs, fmt.Sprintf("%v + %v", test.rs, test.r))
+	}
+}
+
+func TestRangesPresent(t *testing.T) {
+	rs := Ranges{{1, 2}, {5, 5}}
+	for _, test := range []struct {
+		r    Range
+		want bool
+	}{
+		{Range{}, true},
+		{Range{0, 1}, false},
+		{Range{1, 1}, true},
+		{Range{1, 2}, true},
+		{Range{1, 3}, false},
+		{Range{3, 1}, false},
+		{Range{5, 5}, true},
+		{Range{6, 3}, true},
+		{Range{9, 2}, false},
+		{Range{20, 1}, false},
+	} {
+		assert.Equal(t, test.want, rs.Present(test.r), fmt.Sprintf("%v", test.r))
+	}
+}
+
+func TestRangesFindMissing(t *testing.T) {
+	rs := Ranges{{1, 2}, {5, 5}}
+	for _, test := range []struct {
+		r      Range
+		want   Range
+		wantOK bool
+	}{
+		{Range{}, Range{}, false},
+		{Range{0, 1}, Range{0, 1}, true},
+		{Range{0, 20}, Range{0, 1}, true},
+		{Range{1, 2}, Range{}, false},
+		{Range{1, 10}, Range{3, 2}, true},
+		{Range{2, 2}, Range{3, 1}, true},
+		{Range{5, 5}, Range{}, false},
+		{Range{6, 10}, Range{10, 6}, true},
+		{Range{20, 1}, Range{20, 1}, true},
+	} {
+		got, gotOK := rs.FindMissing(test.r)
+		assert.Equal(t, test.wantOK, gotOK, fmt.Sprintf("%v", test.r))
+		assert.Equal(t, test.want, got, fmt.Sprintf("%v", test.r))
+	}
+	got, gotOK := Ranges(nil).FindMissing(Range{3, 4})
+	assert.True(t, gotOK)
+	assert.Equal(t, Range{3, 4}, got)
+}
+
+func TestRangesTruncate(t *testing.T) {
+	for _, test := range []struct {
+		size int64
+		want Ranges
+	}{
+		{0, Ranges{}},
+		{1, Ranges{}},
+		{2, Ranges{{1, 1}}},
+		{4, Ranges{{1, 2}}},
+		{6, Ranges{{1, 2}, {5, 1}}},
+		{20, Ranges{{1, 2}, {5, 5}}},
+	} {
+		rs := Ranges{{1, 2}, {5, 5}}
+		rs.Truncate(test.size)
+		assert.Equal(t, test.want, rs, fmt.Sprintf("%d", test.size))
+	}
+}
+
+func TestRangesSize(t *testing.T) {
+	assert.Equal(t, int64(0), Ranges(nil).Size())
+	assert.Equal(t, int64(7), Ranges{{1, 2}, {5, 5}}.Size())
+}
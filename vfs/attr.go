@@ -0,0 +1,567 @@
+// This deals with storing the mode, owner and extended attributes
+// set on the files and directories
+
+package vfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+	"github.com/ncw/rclone/fs"
+	"github.com/pkg/errors"
+)
+
+// Flags for Setxattr - these have the same values as XATTR_CREATE
+// and XATTR_REPLACE on Linux, macOS and FreeBSD
+const (
+	XattrCreate  = 1 // fail if the attribute exists already
+	XattrReplace = 2 // fail if the attribute doesn't exist
+)
+
+// bucket the attributes are stored in
+var attrBucket = []byte("attrs")
+
+// nodeAttrs are the attributes set on a file or directory.  Nil
+// values haven't been set so the defaults from the options are used.
+type nodeAttrs struct {
+	Mode   *os.FileMode      `json:"m,omitempty"`
+	UID    *uint32           `json:"u,omitempty"`
+	GID    *uint32           `json:"g,omitempty"`
+	Xattrs map[string][]byte `json:"x,omitempty"`
+}
+
+// empty returns true if no attributes are set
+func (a *nodeAttrs) empty() bool {
+	return a.Mode == nil && a.UID == nil && a.GID == nil && len(a.Xattrs) == 0
+}
+
+// copy returns a copy of a which can be changed without changing a
+func (a *nodeAttrs) copy() nodeAttrs {
+	attrs := *a
+	if a.Xattrs != nil {
+		attrs.Xattrs = make(map[string][]byte, len(a.Xattrs))
+		for name, value := range a.Xattrs {
+			attrs.Xattrs[name] = value
+		}
+	}
+	return attrs
+}
+
+// attrStore stores the attributes of the files and directories.
+//
+// If the remote can store them (eg the local backend) they are set on
+// the files and directories themselves.  Otherwise they are kept
+// locally in a bolt database keyed on their paths.
+type attrStore struct {
+	getAttrs func(remote string) (*fs.Attrs, error)     // set if the remote stores the attributes
+	setAttrs func(remote string, attrs *fs.Attrs) error // set if the remote stores the attributes
+	dbPath   string                                     // path to the database file
+	mu       sync.Mutex                                 // protects db
+	db       *bolt.DB                                   // nil if closed
+}
+
+// newAttrStore opens the attribute store for f
+func newAttrStore(f fs.Fs) (*attrStore, error) {
+	features := f.Features()
+	if features.GetAttrs != nil && features.SetAttrs != nil {
+		fs.Debugf(f, "vfs attributes are stored on the remote")
+		return &attrStore{
+			getAttrs: features.GetAttrs,
+			setAttrs: features.SetAttrs,
+		}, nil
+	}
+	return newAttrDB(f)
+}
+
+// newAttrDB opens the database storing the attributes for f
+func newAttrDB(f fs.Fs) (*attrStore, error) {
+	dbPath := filepath.Join(cachePath("vfsAttr", f), "attrs.db")
+	fs.Debugf(nil, "vfs attribute store is %q", dbPath)
+	db, err := openBolt(dbPath, attrBucket)
+	if err != nil {
+		return nil, errors.Wrap(err, "attribute store")
+	}
+	return &attrStore{
+		dbPath: dbPath,
+		db:     db,
+	}, nil
+}
+
+// attrKey returns the database key for the node at p
+func attrKey(p string) []byte {
+	return []byte("/" + p)
+}
+
+// attrTreeKeys returns the keys of p and everything below it in b
+func attrTreeKeys(b *bolt.Bucket, p string) (keys [][]byte) {
+	key := attrKey(p)
+	if b.Get(key) != nil {
+		keys = append(keys, key)
+	}
+	prefix := key
+	if p != "" {
+		prefix = append(attrKey(p), '/')
+	}
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, _ = c.Next() {
+		if len(k) == len(key) {
+			continue // the root which is already in keys
+		}
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	return keys
+}
+
+// view runs fn in a read only transaction if the store is open
+func (as *attrStore) view(fn func(b *bolt.Bucket) error) error {
+	if as == nil {
+		return nil
+	}
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if as.db == nil {
+		return nil
+	}
+	return as.db.View(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket(attrBucket))
+	})
+}
+
+// update runs fn in a read write transaction if the store is open
+func (as *attrStore) update(fn func(b *bolt.Bucket) error) error {
+	if as == nil {
+		return nil
+	}
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if as.db == nil {
+		return nil
+	}
+	return as.db.Update(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket(attrBucket))
+	})
+}
+
+// remote returns true if the attributes are stored on the remote
+func (as *attrStore) remote() bool {
+	return as != nil && as.getAttrs != nil
+}
+
+// getRemote returns the attributes of p from the remote
+func (as *attrStore) getRemote(p string) (attrs nodeAttrs, err error) {
+	remoteAttrs, err := as.getAttrs(p)
+	if err != nil {
+		return attrs, err
+	}
+	attrs.Mode = remoteAttrs.Mode
+	attrs.UID = remoteAttrs.UID
+	attrs.GID = remoteAttrs.GID
+	if len(remoteAttrs.Xattrs) > 0 {
+		attrs.Xattrs = remoteAttrs.Xattrs
+	}
+	return attrs, nil
+}
+
+// setRemote calls fn to change the attributes of p on the remote,
+// setting only those which fn changed, and returns the new attributes
+func (as *attrStore) setRemote(p string, fn func(attrs *nodeAttrs) error) (nodeAttrs, error) {
+	old, err := as.getRemote(p)
+	if err != nil {
+		return old, err
+	}
+	attrs := old.copy()
+	if attrs.Xattrs == nil {
+		attrs.Xattrs = make(map[string][]byte)
+	}
+	err = fn(&attrs)
+	if err != nil {
+		return old, err
+	}
+	var change fs.Attrs
+	if attrs.Mode != nil && (old.Mode == nil || *attrs.Mode != *old.Mode) {
+		change.Mode = attrs.Mode
+	}
+	if attrs.UID != nil && (old.UID == nil || *attrs.UID != *old.UID) {
+		change.UID = attrs.UID
+	}
+	if attrs.GID != nil && (old.GID == nil || *attrs.GID != *old.GID) {
+		change.GID = attrs.GID
+	}
+	change.Xattrs = make(map[string][]byte)
+	for name, value := range attrs.Xattrs {
+		if oldValue, found := old.Xattrs[name]; !found || !bytes.Equal(value, oldValue) {
+			change.Xattrs[name] = value
+		}
+	}
+	for name := range old.Xattrs {
+		if _, found := attrs.Xattrs[name]; !found {
+			change.Xattrs[name] = nil
+		}
+	}
+	err = as.setAttrs(p, &change)
+	if os.IsPermission(err) {
+		return old, EPERM
+	} else if err != nil {
+		return old, err
+	}
+	return attrs, nil
+}
+
+// get returns the attributes stored for p
+func (as *attrStore) get(p string) (attrs nodeAttrs) {
+	if as.remote() {
+		attrs, err := as.getRemote(p)
+		if err != nil {
+			fs.Debugf(p, "Failed to read attributes: %v", err)
+			return nodeAttrs{}
+		}
+		return attrs
+	}
+	err := as.view(func(b *bolt.Bucket) error {
+		data := b.Get(attrKey(p))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &attrs)
+	})
+	if err != nil {
+		fs.Errorf(p, "Failed to read attributes: %v", err)
+		return nodeAttrs{}
+	}
+	return attrs
+}
+
+// set calls fn to change the attributes stored for p, removing them
+// if none are left, and returns the new attributes.  If fn returns an
+// error nothing is changed.
+func (as *attrStore) set(p string, fn func(attrs *nodeAttrs) error) (attrs nodeAttrs, err error) {
+	if as.remote() {
+		return as.setRemote(p, fn)
+	}
+	err = as.update(func(b *bolt.Bucket) error {
+		attrs = nodeAttrs{}
+		key := attrKey(p)
+		if data := b.Get(key); data != nil {
+			err := json.Unmarshal(data, &attrs)
+			if err != nil {
+				fs.Errorf(p, "Ignoring corrupted attributes: %v", err)
+				attrs = nodeAttrs{}
+			}
+		}
+		err := fn(&attrs)
+		if err != nil {
+			return err
+		}
+		if attrs.empty() {
+			return b.Delete(key)
+		}
+		data, err := json.Marshal(&attrs)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode attributes")
+		}
+		return b.Put(key, data)
+	})
+	if err != nil {
+		return nodeAttrs{}, err
+	}
+	return attrs, nil
+}
+
+// remove removes the attributes of p and everything below it
+//
+// Attributes stored on the remote are removed with the files
+func (as *attrStore) remove(p string) {
+	err := as.update(func(b *bolt.Bucket) error {
+		for _, k := range attrTreeKeys(b, p) {
+			err := b.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fs.Errorf(p, "Failed to remove attributes: %v", err)
+	}
+}
+
+// rename moves the attributes of oldPath and everything below it to
+// newPath replacing any which were there
+//
+// Attributes stored on the remote move with the files
+func (as *attrStore) rename(oldPath, newPath string) {
+	if oldPath == newPath {
+		return
+	}
+	err := as.update(func(b *bolt.Bucket) error {
+		for _, k := range attrTreeKeys(b, newPath) {
+			err := b.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		oldKey := attrKey(oldPath)
+		newKey := attrKey(newPath)
+		for _, k := range attrTreeKeys(b, oldPath) {
+			data := append([]byte(nil), b.Get(k)...)
+			err := b.Delete(k)
+			if err != nil {
+				return err
+			}
+			k = append(append([]byte(nil), newKey...), k[len(oldKey):]...)
+			err = b.Put(k, data)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fs.Errorf(oldPath, "Failed to move attributes to %q: %v", newPath, err)
+	}
+}
+
+// close closes the database
+func (as *attrStore) close() {
+	if as == nil {
+		return
+	}
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	if as.db == nil {
+		return
+	}
+	if err := as.db.Close(); err != nil {
+		fs.Errorf(nil, "Failed to close attribute store: %v", err)
+	}
+	as.db = nil
+}
+
+// attrCache caches the attributes of a node so they aren't read from
+// the store every time the node is stat-ed.
+//
+// The attributes of a file which hasn't been uploaded yet can't be
+// set on the remote so they are kept here until it has been.
+type attrCache struct {
+	mu      sync.Mutex
+	attrs   *nodeAttrs // nil if not read yet
+	pending bool       // set if attrs need setting on the remote after the upload
+}
+
+// _get returns the attributes of the node at p reading them from as
+// if necessary - call with mu held
+func (c *attrCache) _get(as *attrStore, p string) nodeAttrs {
+	if c.attrs == nil {
+		attrs := as.get(p)
+		c.attrs = &attrs
+	}
+	return *c.attrs
+}
+
+// get returns the attributes of the node at p
+func (c *attrCache) get(as *attrStore, p string) nodeAttrs {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c._get(as, p)
+}
+
+// set calls fn to change the attributes of the node at p.  If the
+// node is waiting to be uploaded and the attributes are stored on
+// the remote they are kept until apply is called.
+func (c *attrCache) set(as *attrStore, p string, uploading bool, fn func(attrs *nodeAttrs) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if as.remote() && (uploading || c.pending) {
+		old := c._get(as, p)
+		attrs := old.copy()
+		err := fn(&attrs)
+		if err != nil {
+			return err
+		}
+		c.attrs = &attrs
+		c.pending = true
+		return nil
+	}
+	attrs, err := as.set(p, fn)
+	if err != nil {
+		return err
+	}
+	c.attrs = &attrs
+	return nil
+}
+
+// apply sets any attributes which were waiting for the upload on the
+// object at p
+func (c *attrCache) apply(as *attrStore, p string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.pending {
+		return
+	}
+	c.pending = false
+	want := *c.attrs
+	attrs, err := as.set(p, func(attrs *nodeAttrs) error {
+		if want.Mode != nil {
+			attrs.Mode = want.Mode
+		}
+		if want.UID != nil {
+			attrs.UID = want.UID
+		}
+		if want.GID != nil {
+			attrs.GID = want.GID
+		}
+		attrs.Xattrs = want.Xattrs
+		return nil
+	})
+	if err != nil {
+		fs.Errorf(p, "Failed to set attributes after upload: %v", err)
+		c.attrs = nil
+		return
+	}
+	c.attrs = &attrs
+}
+
+// forget discards the cached attributes so they are read again unless
+// they are waiting for the upload
+func (c *attrCache) forget() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.pending {
+		c.attrs = nil
+	}
+}
+
+// nodeMode returns the mode of the node at p with the permissions
+// replaced by any set with chmod
+func (vfs *VFS) nodeMode(c *attrCache, p string, mode os.FileMode) os.FileMode {
+	if attrs := c.get(vfs.attrs, p); attrs.Mode != nil {
+		mode = (mode &^ os.ModePerm) | attrs.Mode.Perm()
+	}
+	return mode
+}
+
+// nodeOwner returns the owner of the node at p
+func (vfs *VFS) nodeOwner(c *attrCache, p string) (uid, gid uint32) {
+	uid, gid = vfs.Opt.UID, vfs.Opt.GID
+	attrs := c.get(vfs.attrs, p)
+	if attrs.UID != nil {
+		uid = *attrs.UID
+	}
+	if attrs.GID != nil {
+		gid = *attrs.GID
+	}
+	return uid, gid
+}
+
+// chmod sets the permissions of the node at p
+func (vfs *VFS) chmod(c *attrCache, p string, uploading bool, mode os.FileMode) error {
+	if vfs.Opt.ReadOnly {
+		return EROFS
+	}
+	if err := vfs.checkLock(p); err != nil {
+		return err
+	}
+	return c.set(vfs.attrs, p, uploading, func(attrs *nodeAttrs) error {
+		mode = mode.Perm()
+		attrs.Mode = &mode
+		return nil
+	})
+}
+
+// chown sets the owner of the node at p
+func (vfs *VFS) chown(c *attrCache, p string, uploading bool, uid, gid uint32) error {
+	if vfs.Opt.ReadOnly {
+		return EROFS
+	}
+	if err := vfs.checkLock(p); err != nil {
+		return err
+	}
+	return c.set(vfs.attrs, p, uploading, func(attrs *nodeAttrs) error {
+		attrs.UID = &uid
+		attrs.GID = &gid
+		return nil
+	})
+}
+
+// getxattr returns the extended attribute name of the node at p
+func (vfs *VFS) getxattr(c *attrCache, p string, name string) ([]byte, error) {
+	if !vfs.Opt.AttrPersist {
+		return nil, ENOSYS
+	}
+	value, found := c.get(vfs.attrs, p).Xattrs[name]
+	if !found {
+		return nil, ENOATTR
+	}
+	return value, nil
+}
+
+// setxattr sets the extended attribute name of the node at p
+func (vfs *VFS) setxattr(c *attrCache, p string, uploading bool, name string, value []byte, flags int) error {
+	if !vfs.Opt.AttrPersist {
+		return ENOSYS
+	}
+	if vfs.Opt.ReadOnly {
+		return EROFS
+	}
+	if err := vfs.checkLock(p); err != nil {
+		return err
+	}
+	if name == "" {
+		return EINVAL
+	}
+	return c.set(vfs.attrs, p, uploading, func(attrs *nodeAttrs) error {
+		_, found := attrs.Xattrs[name]
+		if found && flags&XattrCreate != 0 {
+			return EEXIST
+		}
+		if !found && flags&XattrReplace != 0 {
+			return ENOATTR
+		}
+		if attrs.Xattrs == nil {
+			attrs.Xattrs = make(map[string][]byte)
+		}
+		attrs.Xattrs[name] = append([]byte{}, value...)
+		return nil
+	})
+}
+
+// listxattr returns the names of the extended attributes of the
+// node at p
+func (vfs *VFS) listxattr(c *attrCache, p string) ([]string, error) {
+	if !vfs.Opt.AttrPersist {
+		return nil, ENOSYS
+	}
+	xattrs := c.get(vfs.attrs, p).Xattrs
+	names := make([]string, 0, len(xattrs))
+	for name := range xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// removexattr removes the extended attribute name from the node at p
+func (vfs *VFS) removexattr(c *attrCache, p string, uploading bool, name string) error {
+	if !vfs.Opt.AttrPersist {
+		return ENOSYS
+	}
+	if vfs.Opt.ReadOnly {
+		return EROFS
+	}
+	if err := vfs.checkLock(p); err != nil {
+		return err
+	}
+	return c.set(vfs.attrs, p, uploading, func(attrs *nodeAttrs) error {
+		if _, found := attrs.Xattrs[name]; !found {
+			return ENOATTR
+		}
+		delete(attrs.Xattrs, name)
+		return nil
+	})
+}
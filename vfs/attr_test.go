@@ -0,0 +1,243 @@
+package vfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newAttrTestVFS makes a VFS with opt which stores the attributes of
+// its nodes in the database even if the remote could store them
+func newAttrTestVFS(t *testing.T, r *fstest.Run, opt Options) *VFS {
+	opt.AttrPersist = true
+	vfs := New(r.Fremote, &opt)
+	vfs.attrs.close()
+	var err error
+	vfs.attrs, err = newAttrDB(r.Fremote)
+	require.NoError(t, err)
+	return vfs
+}
+
+// statAttributer returns the node at p
+func statAttributer(t *testing.T, vfs *VFS, p string) Attributer {
+	node, err := vfs.Stat(p)
+	require.NoError(t, err)
+	attrNode, ok := node.(Attributer)
+	require.True(t, ok)
+	return attrNode
+}
+
+// removeAttrs removes the database of the attribute store
+func removeAttrs(t *testing.T, vfs *VFS) {
+	vfs.Shutdown()
+	assert.NoError(t, os.RemoveAll(filepath.Dir(vfs.attrs.dbPath)))
+}
+
+func TestAttrDisabled(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	vfs := New(r.Fremote, nil)
+	defer vfs.Shutdown()
+	r.WriteObject("file1", "potato", t1)
+
+	node := statAttributer(t, vfs, "file1")
+
+	// mode and owner changes are ignored
+	require.NoError(t, node.Chmod(0700))
+	require.NoError(t, node.Chown(1, 2))
+	assert.Equal(t, vfs.Opt.FilePerms, node.Mode())
+	uid, gid := node.Owner()
+	assert.Equal(t, vfs.Opt.UID, uid)
+	assert.Equal(t, vfs.Opt.GID, gid)
+
+	// extended attributes aren't supported
+	_, err := node.Getxattr("user.potato")
+	assert.Equal(t, ENOSYS, err)
+	assert.Equal(t, ENOSYS, node.Setxattr("user.potato", []byte("x"), 0))
+	_, err = node.Listxattr()
+	assert.Equal(t, ENOSYS, err)
+	assert.Equal(t, ENOSYS, node.Removexattr("user.potato"))
+}
+
+func TestAttrPersist(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	vfs := newAttrTestVFS(t, r, DefaultOpt)
+	defer func() { removeAttrs(t, vfs) }()
+	r.WriteObject("dir/file1", "potato", t1)
+
+	file := statAttributer(t, vfs, "dir/file1")
+	dir := statAttributer(t, vfs, "dir")
+
+	require.NoError(t, file.Chmod(0751))
+	assert.Equal(t, os.FileMode(0751), file.Mode())
+	require.NoError(t, dir.Chmod(0700))
+	assert.Equal(t, os.ModeDir|0700, dir.Mode())
+	require.NoError(t, file.Chown(1001, 1002))
+	uid, gid := file.Owner()
+	assert.Equal(t, uint32(1001), uid)
+	assert.Equal(t, uint32(1002), gid)
+
+	// extended attributes
+	require.NoError(t, file.Setxattr("user.b", []byte("two"), 0))
+	require.NoError(t, file.Setxattr("user.a", []byte("one"), XattrCreate))
+	assert.Equal(t, EEXIST, file.Setxattr("user.a", []byte("1"), XattrCreate))
+	assert.Equal(t, ENOATTR, file.Setxattr("user.c", []byte("3"), XattrReplace))
+	require.NoError(t, file.Setxattr("user.a", []byte("1"), XattrReplace))
+	value, err := file.Getxattr("user.a")
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(value))
+	_, err = file.Getxattr("user.c")
+	assert.Equal(t, ENOATTR, err)
+	names, err := file.Listxattr()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user.a", "user.b"}, names)
+	require.NoError(t, file.Removexattr("user.b"))
+	assert.Equal(t, ENOATTR, file.Removexattr("user.b"))
+	require.NoError(t, dir.Setxattr("user.dir", []byte("yes"), 0))
+
+	// attributes follow renames of the file and its directory
+	require.NoError(t, vfs.Rename("dir/file1", "dir/file2"))
+	require.NoError(t, vfs.Rename("dir", "dir2"))
+	file = statAttributer(t, vfs, "dir2/file2")
+	assert.Equal(t, os.FileMode(0751), file.Mode())
+	dir = statAttributer(t, vfs, "dir2")
+	assert.Equal(t, os.ModeDir|0700, dir.Mode())
+	value, err = dir.Getxattr("user.dir")
+	require.NoError(t, err)
+	assert.Equal(t, "yes", string(value))
+
+	// and are still there after a restart
+	vfs.Shutdown()
+	vfs = newAttrTestVFS(t, r, DefaultOpt)
+	file = statAttributer(t, vfs, "dir2/file2")
+	assert.Equal(t, os.FileMode(0751), file.Mode())
+	uid, gid = file.Owner()
+	assert.Equal(t, uint32(1001), uid)
+	assert.Equal(t, uint32(1002), gid)
+	value, err = file.Getxattr("user.a")
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(value))
+
+	// removing the file removes its attributes
+	require.NoError(t, file.Remove())
+	fd, err := vfs.OpenFile("dir2/file2", os.O_CREATE|os.O_WRONLY, 0777)
+	require.NoError(t, err)
+	require.NoError(t, fd.Close())
+	file = statAttributer(t, vfs, "dir2/file2")
+	assert.Equal(t, vfs.Opt.FilePerms, file.Mode())
+	names, err = file.Listxattr()
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, names)
+}
+
+func TestAttrReadOnly(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	opt := DefaultOpt
+	opt.ReadOnly = true
+	vfs := newAttrTestVFS(t, r, opt)
+	defer removeAttrs(t, vfs)
+	r.WriteObject("file1", "potato", t1)
+
+	node := statAttributer(t, vfs, "file1")
+	assert.Equal(t, EROFS, node.Chmod(0700))
+	assert.Equal(t, EROFS, node.Chown(1, 2))
+	assert.Equal(t, EROFS, node.Setxattr("user.potato", []byte("x"), 0))
+	assert.Equal(t, EROFS, node.Removexattr("user.potato"))
+}
+
+func TestAttrRemote(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	features := r.Fremote.Features()
+	if features.GetAttrs == nil || features.SetAttrs == nil {
+		t.Skip("remote can't store attributes")
+	}
+	opt := DefaultOpt
+	opt.AttrPersist = true
+	vfs := New(r.Fremote, &opt)
+	defer vfs.Shutdown()
+	require.True(t, vfs.attrs.remote())
+	r.WriteObject("file1", "potato", t1)
+
+	file := statAttributer(t, vfs, "file1")
+	require.NoError(t, file.Chmod(0751))
+	assert.Equal(t, os.FileMode(0751), file.Mode())
+	err := file.Setxattr("user.a", []byte("one"), XattrCreate)
+	if err != nil {
+		t.Skipf("remote can't store extended attributes: %v", err)
+	}
+	assert.Equal(t, EEXIST, file.Setxattr("user.a", []byte("1"), XattrCreate))
+	require.NoError(t, file.Setxattr("user.b", []byte("two"), 0))
+	require.NoError(t, file.Removexattr("user.b"))
+	assert.Equal(t, ENOATTR, file.Removexattr("user.b"))
+
+	// the attributes are stored on the remote
+	attrs, err := features.GetAttrs("file1")
+	require.NoError(t, err)
+	require.NotNil(t, attrs.Mode)
+	assert.Equal(t, os.FileMode(0751), *attrs.Mode)
+	assert.Equal(t, map[string][]byte{"user.a": []byte("one")}, attrs.Xattrs)
+
+	// so they follow a rename without rclone's help
+	require.NoError(t, vfs.Rename("file1", "file2"))
+	vfs.Shutdown()
+	vfs = New(r.Fremote, &opt)
+	file = statAttributer(t, vfs, "file2")
+	assert.Equal(t, os.FileMode(0751), file.Mode())
+	value, err := file.Getxattr("user.a")
+	require.NoError(t, err)
+	assert.Equal(t, "one", string(value))
+	names, err := file.Listxattr()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user.a"}, names)
+}
+
+func TestAttrRemoteUploading(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	features := r.Fremote.Features()
+	if features.GetAttrs == nil || features.SetAttrs == nil {
+		t.Skip("remote can't store attributes")
+	}
+	opt := DefaultOpt
+	opt.AttrPersist = true
+	opt.CacheMode = CacheModeWrites
+	opt.CachePollInterval = 0
+	vfs := New(r.Fremote, &opt)
+	defer func() {
+		assert.NoError(t, vfs.CleanUp())
+		vfs.Shutdown()
+	}()
+	require.True(t, vfs.attrs.remote())
+
+	fh, err := vfs.OpenFile("file1", os.O_WRONLY|os.O_CREATE, 0777)
+	require.NoError(t, err)
+	_, err = fh.WriteString("potato")
+	require.NoError(t, err)
+
+	// the file only exists in the cache so its attributes are
+	// kept until it has been uploaded
+	file := statAttributer(t, vfs, "file1")
+	require.NoError(t, file.Chmod(0751))
+	require.NoError(t, file.Setxattr("user.a", []byte("one"), 0))
+	assert.Equal(t, os.FileMode(0751), file.Mode())
+	_, err = features.GetAttrs("file1")
+	require.True(t, os.IsNotExist(err))
+
+	// and set on the remote when it is
+	require.NoError(t, fh.Close())
+	attrs, err := features.GetAttrs("file1")
+	require.NoError(t, err)
+	require.NotNil(t, attrs.Mode)
+	assert.Equal(t, os.FileMode(0751), *attrs.Mode)
+	assert.Equal(t, os.FileMode(0751), file.Mode())
+	if len(attrs.Xattrs) != 0 {
+		assert.Equal(t, map[string][]byte{"user.a": []byte("one")}, attrs.Xattrs)
+	}
+}
@@ -62,19 +62,72 @@ func (l *CacheMode) Type() string {
 	return "CacheMode"
 }
 
+// CacheEviction chooses which files are removed first when the cache
+// needs space
+type CacheEviction byte
+
+// CacheEviction options
+const (
+	CacheEvictLRU  CacheEviction = iota // least recently used first
+	CacheEvictLFU                       // least frequently used first
+	CacheEvictSize                      // largest and least recently used first
+)
+
+var cacheEvictionToString = []string{
+	CacheEvictLRU:  "lru",
+	CacheEvictLFU:  "lfu",
+	CacheEvictSize: "size",
+}
+
+// String turns a CacheEviction into a string
+func (e CacheEviction) String() string {
+	if e >= CacheEviction(len(cacheEvictionToString)) {
+		return fmt.Sprintf("CacheEviction(%d)", e)
+	}
+	return cacheEvictionToString[e]
+}
+
+// Set a CacheEviction
+func (e *CacheEviction) Set(s string) error {
+	for n, name := range cacheEvictionToString {
+		if s != "" && name == s {
+			*e = CacheEviction(n)
+			return nil
+		}
+	}
+	return errors.Errorf("Unknown cache eviction policy %q", s)
+}
+
+// Type of the value
+func (e *CacheEviction) Type() string {
+	return "CacheEviction"
+}
+
+// evictInterval is the minimum time between the evictions started
+// by files growing while the cache is over quota
+const evictInterval = time.Second
+
 // cache opened files
 type cache struct {
-	f      fs.Fs                 // fs for the cache directory
-	opt    *Options              // vfs Options
-	root   string                // root of the cache directory
-	itemMu sync.Mutex            // protects the following variables
-	item   map[string]*cacheItem // files/directories in the cache
-	used   int64                 // total size of files in the cache
+	f         fs.Fs                 // fs for the cache directory
+	opt       *Options              // vfs Options
+	root      string                // root of the cache directory
+	metaRoot  string                // root of the cache metadata directory
+	queuePath string                // file to save the upload queue in
+	pinPath   string                // file to save the pinned files in
+	kick      chan struct{}         // starts an eviction
+	itemMu    sync.Mutex            // protects the following variables
+	item      map[string]*cacheItem // files/directories in the cache
+	used      int64                 // total size of files in the cache
+	free      int64                 // estimated free space on the disk or -1 if unknown
+	kicked    time.Time             // when an eviction was last started by a file growing
+	pins      map[string]struct{}   // files which mustn't be removed from the cache
 }
 
 // cacheItem is stored in the item map
 type cacheItem struct {
 	opens  int       // number of times file is open
+	hits   int64     // number of times the file has been opened
 	atime  time.Time // last time file was accessed
 	isFile bool      // if this is a file or a directory
 	size   int64     // size of the cached item
@@ -85,11 +138,9 @@ func newCacheItem(isFile bool) *cacheItem {
 	return &cacheItem{atime: time.Now(), isFile: isFile}
 }
 
-// newCache creates a new cache heirachy for f
-//
-// This starts background goroutines which can be cancelled with the
-// context passed in.
-func newCache(ctx context.Context, f fs.Fs, opt *Options) (*cache, error) {
+// cachePath returns the directory in the cache directory for things
+// of the kind given for f
+func cachePath(kind string, f fs.Fs) string {
 	fRoot := filepath.FromSlash(f.Root())
 	if runtime.GOOS == "windows" {
 		if strings.HasPrefix(fRoot, `\\?`) {
@@ -97,8 +148,20 @@ func newCache(ctx context.Context, f fs.Fs, opt *Options) (*cache, error) {
 		}
 		fRoot = strings.Replace(fRoot, ":", "", -1)
 	}
-	root := filepath.Join(config.CacheDir, "vfs", f.Name(), fRoot)
+	return filepath.Join(config.CacheDir, kind, f.Name(), fRoot)
+}
+
+// newCache creates a new cache heirachy for f
+//
+// This starts background goroutines which can be cancelled with the
+// context passed in.
+func newCache(ctx context.Context, f fs.Fs, opt *Options) (*cache, error) {
+	root := cachePath("vfs", f)
 	fs.Debugf(nil, "vfs cache root is %q", root)
+	metaRoot := cachePath("vfsMeta", f)
+	fs.Debugf(nil, "vfs metadata root is %q", metaRoot)
+	queuePath := filepath.Join(cachePath("vfsQueue", f), "queue.json")
+	pinPath := filepath.Join(cachePath("vfsPin", f), "pins.json")
 
 	f, err := fs.NewFs(root)
 	if err != nil {
@@ -106,10 +169,21 @@ func newCache(ctx context.Context, f fs.Fs, opt *Options) (*cache, error) {
 	}
 
 	c := &cache{
-		f:    f,
-		opt:  opt,
-		root: root,
-		item: make(map[string]*cacheItem),
+		f:         f,
+		opt:       opt,
+		root:      root,
+		metaRoot:  metaRoot,
+		queuePath: queuePath,
+		pinPath:   pinPath,
+		kick:      make(chan struct{}, 1),
+		item:      make(map[string]*cacheItem),
+		free:      -1,
+		pins:      make(map[string]struct{}),
+	}
+
+	err = c.loadPins()
+	if err != nil {
+		fs.Errorf(nil, "vfs cache: failed to load pinned files: %v", err)
 	}
 
 	go c.cleaner(ctx)
@@ -216,6 +290,40 @@ func (c *cache) updateStat(name string, when time.Time, size int64) {
 	c.itemMu.Unlock()
 }
 
+// setSize records that name now uses size bytes of the cache.  If
+// this takes the cache over quota or the disk below the free space
+// wanted then an eviction is started rather than waiting for the next
+// clean.
+//
+// name should be a remote path not an osPath
+func (c *cache) setSize(name string, size int64) {
+	name = clean(name)
+	c.itemMu.Lock()
+	item, _ := c._get(true, name)
+	delta := size - item.size
+	c._grow(item, delta)
+	kick := delta > 0 && c._overQuota(int64(c.opt.CacheMaxSize)) && time.Since(c.kicked) >= evictInterval
+	if kick {
+		c.kicked = time.Now()
+	}
+	c.itemMu.Unlock()
+	if kick {
+		select {
+		case c.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// _grow adds delta bytes to the size of item - call with itemMu held
+func (c *cache) _grow(item *cacheItem, delta int64) {
+	item.size += delta
+	c.used += delta
+	if c.free >= 0 {
+		c.free -= delta
+	}
+}
+
 // _open marks name as open, must be called with the lock held
 //
 // name should be a remote path not an osPath
@@ -223,6 +331,9 @@ func (c *cache) _open(isFile bool, name string) {
 	for {
 		item, _ := c._get(isFile, name)
 		item.opens++
+		if isFile {
+			item.hits++
+		}
 		item.atime = time.Now()
 		if name == "" {
 			break
@@ -275,7 +386,7 @@ func (c *cache) _close(isFile bool, name string) {
 		fi, err := os.Stat(osPath)
 		// Update the size on close
 		if err == nil && !fi.IsDir() {
-			item.size = fi.Size()
+			c._grow(item, c.diskSize(name, fi)-item.size)
 		}
 		if name == "" {
 			break
@@ -304,6 +415,17 @@ func (c *cache) remove(name string) {
 	} else {
 		fs.Infof(name, "Removed from cache")
 	}
+	c.removeInfo(name)
+}
+
+// purge removes name from the cache to free up space unless it has
+// changes which haven't been uploaded
+func (c *cache) purge(name string) {
+	if c.isDirty(name) {
+		fs.Debugf(name, "Not removing from cache as it hasn't been uploaded")
+		return
+	}
+	c.remove(name)
 }
 
 // removeDir should be called if dir is deleted and returns true if
@@ -325,7 +447,26 @@ func (c *cache) removeDir(dir string) bool {
 
 // cleanUp empties the cache of everything
 func (c *cache) cleanUp() error {
-	return os.RemoveAll(c.root)
+	err := os.RemoveAll(c.root)
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(c.metaRoot)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(c.queuePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	c.itemMu.Lock()
+	c.pins = make(map[string]struct{})
+	c.itemMu.Unlock()
+	err = os.Remove(c.pinPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
 }
 
 // walk walks the cache calling the function
@@ -358,8 +499,16 @@ func (c *cache) updateStats() error {
 		if !fi.IsDir() {
 			// Update the atime with that of the file
 			atime := times.Get(fi).AccessTime()
-			c.updateStat(name, atime, fi.Size())
-			newUsed += fi.Size()
+			size := fi.Size()
+			if info, err := c.loadInfo(name); err == nil {
+				size = info.Rs.Size()
+				// the OS may not keep access times
+				if info.ATime.After(atime) {
+					atime = info.ATime
+				}
+			}
+			c.updateStat(name, atime, size)
+			newUsed += size
 		} else {
 			c.cacheDir(name)
 		}
@@ -371,9 +520,56 @@ func (c *cache) updateStats() error {
 	return err
 }
 
+// updateFree reads the free space on the disk the cache is on if
+// --vfs-cache-min-free-space is set
+func (c *cache) updateFree() {
+	if c.opt.CacheMinFreeSpace <= 0 {
+		return
+	}
+	free := int64(-1)
+	if do := c.f.Features().About; do == nil {
+		fs.Errorf(nil, "vfs cache: can't read the free space on this OS - ignoring --vfs-cache-min-free-space")
+	} else if err := os.MkdirAll(c.root, 0700); err != nil {
+		fs.Errorf(nil, "vfs cache: failed to make cache directory: %v", err)
+	} else if usage, err := do(); err != nil {
+		fs.Errorf(nil, "vfs cache: failed to read free space: %v", err)
+	} else if usage.Free != nil {
+		free = *usage.Free
+	}
+	c.itemMu.Lock()
+	c.free = free
+	c.itemMu.Unlock()
+}
+
+// _overQuota returns true if the cache uses quota bytes or more or
+// there is less free space on the disk than wanted - call with itemMu
+// held
+func (c *cache) _overQuota(quota int64) bool {
+	if quota > 0 && c.used >= quota {
+		return true
+	}
+	minFree := int64(c.opt.CacheMinFreeSpace)
+	return minFree > 0 && c.free >= 0 && c.free < minFree
+}
+
+// _evictable returns true if the item called name may be removed
+// from the cache - call with itemMu held
+//
+// Files with changes which haven't been uploaded aren't evictable so
+// they stay in the cache and are still counted in the space used.
+func (c *cache) _evictable(name string, item *cacheItem) bool {
+	if !item.isFile || item.opens != 0 {
+		return false
+	}
+	if _, pinned := c.pins[name]; pinned {
+		return false
+	}
+	return !c.isDirty(name)
+}
+
 // purgeOld gets rid of any files that are over age
 func (c *cache) purgeOld(maxAge time.Duration) {
-	c._purgeOld(maxAge, c.remove)
+	c._purgeOld(maxAge, c.purge)
 }
 
 func (c *cache) _purgeOld(maxAge time.Duration, remove func(name string)) {
@@ -381,7 +577,7 @@ func (c *cache) _purgeOld(maxAge time.Duration, remove func(name string)) {
 	defer c.itemMu.Unlock()
 	cutoff := time.Now().Add(-maxAge)
 	for name, item := range c.item {
-		if item.isFile && item.opens == 0 {
+		if c._evictable(name, item) {
 			// If not locked and access time too long ago - delete the file
 			dt := item.atime.Sub(cutoff)
 			// fs.Debugf(name, "atime=%v cutoff=%v, dt=%v", item.atime, cutoff, dt)
@@ -389,6 +585,7 @@ func (c *cache) _purgeOld(maxAge time.Duration, remove func(name string)) {
 				remove(name)
 				// Remove the entry
 				delete(c.item, name)
+				c._grow(item, -item.size)
 			}
 		}
 	}
@@ -426,21 +623,45 @@ type cacheNamedItem struct {
 }
 type cacheNamedItems []cacheNamedItem
 
-func (v cacheNamedItems) Len() int           { return len(v) }
-func (v cacheNamedItems) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
-func (v cacheNamedItems) Less(i, j int) bool { return v[i].item.atime.Before(v[j].item.atime) }
+// sort sorts the items into the order they should be removed from
+// the cache according to the eviction policy
+func (v cacheNamedItems) sort(policy CacheEviction, now time.Time) {
+	// score for the size policy - bigger files which haven't been
+	// used for longer are removed first
+	score := func(item *cacheItem) float64 {
+		idle := now.Sub(item.atime)
+		if idle < 0 {
+			idle = 0
+		}
+		return float64(item.size) * (idle + time.Second).Seconds()
+	}
+	sort.Slice(v, func(i, j int) bool {
+		a, b := v[i].item, v[j].item
+		switch policy {
+		case CacheEvictLFU:
+			if a.hits != b.hits {
+				return a.hits < b.hits
+			}
+		case CacheEvictSize:
+			if sa, sb := score(a), score(b); sa != sb {
+				return sa > sb
+			}
+		}
+		return a.atime.Before(b.atime)
+	})
+}
 
-// Remove any files that are over quota starting from the
-// oldest first
+// Remove any files that are over quota or stop the disk having the
+// free space wanted, in the order given by the eviction policy
 func (c *cache) purgeOverQuota(quota int64) {
-	c._purgeOverQuota(quota, c.remove)
+	c._purgeOverQuota(quota, c.purge)
 }
 
 func (c *cache) _purgeOverQuota(quota int64, remove func(name string)) {
 	c.itemMu.Lock()
 	defer c.itemMu.Unlock()
 
-	if quota <= 0 || c.used < quota {
+	if !c._overQuota(quota) {
 		return
 	}
 
@@ -448,27 +669,34 @@ func (c *cache) _purgeOverQuota(quota int64, remove func(name string)) {
 
 	// Make a slice of unused files
 	for name, item := range c.item {
-		if item.isFile && item.opens == 0 {
+		if c._evictable(name, item) {
 			items = append(items, cacheNamedItem{
 				name: name,
 				item: item,
 			})
 		}
 	}
-	sort.Sort(items)
+	items.sort(c.opt.CacheEviction, time.Now())
 
 	// Remove items until the quota is OK
 	for _, item := range items {
-		if c.used < quota {
+		if !c._overQuota(quota) {
 			break
 		}
 		remove(item.name)
 		// Remove the entry
 		delete(c.item, item.name)
-		c.used -= item.item.size
+		c._grow(item.item, -item.item.size)
 	}
 }
 
+// evict removes files straight away to get the cache back under
+// quota rather than waiting for the next clean
+func (c *cache) evict() {
+	c.updateFree()
+	c.purgeOverQuota(int64(c.opt.CacheMaxSize))
+}
+
 // clean empties the cache of stuff if it can
 func (c *cache) clean() {
 	// Cache may be empty so end
@@ -486,12 +714,13 @@ func (c *cache) clean() {
 	if err != nil {
 		fs.Errorf(nil, "Error traversing cache %q: %v", c.root, err)
 	}
+	c.updateFree()
 
 	// Remove any files that are over age
 	c.purgeOld(c.opt.CacheMaxAge)
 
-	// Now remove any files that are over quota starting from the
-	// oldest first
+	// Now remove any files that are over quota in the order
+	// given by the eviction policy
 	c.purgeOverQuota(int64(c.opt.CacheMaxSize))
 
 	// Remove any empty directories
@@ -522,6 +751,8 @@ func (c *cache) cleaner(ctx context.Context) {
 		select {
 		case <-timer.C:
 			c.clean()
+		case <-c.kick:
+			c.evict()
 		case <-ctx.Done():
 			fs.Debugf(nil, "cache cleaner exiting")
 			return
@@ -0,0 +1,108 @@
+// This deals with pinning files so they are never removed from the
+// cache
+
+package vfs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// loadPins reads the pinned files saved by a previous run
+func (c *cache) loadPins() error {
+	data, err := ioutil.ReadFile(c.pinPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var names []string
+	err = json.Unmarshal(data, &names)
+	if err != nil {
+		return errors.Wrap(err, "failed to decode pinned files")
+	}
+	c.itemMu.Lock()
+	defer c.itemMu.Unlock()
+	for _, name := range names {
+		c.pins[clean(name)] = struct{}{}
+	}
+	return nil
+}
+
+// _savePins writes the pinned files to disk - call with itemMu held
+func (c *cache) _savePins() error {
+	if len(c.pins) == 0 {
+		err := os.Remove(c.pinPath)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "failed to remove pinned files")
+		}
+		return nil
+	}
+	data, err := json.Marshal(c._pinned())
+	if err != nil {
+		return errors.Wrap(err, "failed to encode pinned files")
+	}
+	err = os.MkdirAll(filepath.Dir(c.pinPath), 0700)
+	if err != nil {
+		return errors.Wrap(err, "failed to make pinned files directory")
+	}
+	tmp := c.pinPath + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to write pinned files")
+	}
+	return os.Rename(tmp, c.pinPath)
+}
+
+// _pinned returns the pinned files sorted by name - call with itemMu
+// held
+func (c *cache) _pinned() []string {
+	names := make([]string, 0, len(c.pins))
+	for name := range c.pins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pinned returns the pinned files sorted by name
+func (c *cache) pinned() []string {
+	c.itemMu.Lock()
+	defer c.itemMu.Unlock()
+	return c._pinned()
+}
+
+// pin stops name being removed from the cache by age, quota or free
+// space until it is unpinned.  The pin is on the path so it doesn't
+// follow the file if it is renamed and stays if it is removed.
+//
+// name should be a remote path not an osPath
+func (c *cache) pin(name string) error {
+	name = clean(name)
+	c.itemMu.Lock()
+	defer c.itemMu.Unlock()
+	if _, found := c.pins[name]; found {
+		return nil
+	}
+	c.pins[name] = struct{}{}
+	return c._savePins()
+}
+
+// unpin allows name to be removed from the cache again
+//
+// name should be a remote path not an osPath
+func (c *cache) unpin(name string) error {
+	name = clean(name)
+	c.itemMu.Lock()
+	defer c.itemMu.Unlock()
+	if _, found := c.pins[name]; !found {
+		return nil
+	}
+	delete(c.pins, name)
+	return c._savePins()
+}
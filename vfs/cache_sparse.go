@@ -0,0 +1,604 @@
+// This deals with files in the cache which are only partly present
+
+package vfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/chunkedreader"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/fs/operations"
+	"github.com/ncw/rclone/lib/file"
+	"github.com/ncw/rclone/lib/ranges"
+	"github.com/pkg/errors"
+)
+
+const (
+	// size of the blocks the downloader reads and writes
+	downloadBlockSize = 128 * 1024
+	// how far a read can be ahead of the downloader before it
+	// seeks rather than reading up to it
+	downloadMaxSkip = 1024 * 1024
+	// how long the downloader waits for more work before exiting
+	downloadIdleTime = 5 * time.Second
+)
+
+// cacheInfo is the metadata stored for each file in the cache
+//
+// The ranges record which parts of the file have been downloaded or
+// written.  The rest of the file is a hole which is read from the
+// remote object with the fingerprint given.
+//
+// If the file is dirty it has been changed and not uploaded yet so
+// must be kept and uploaded even if the remote object has changed.
+type cacheInfo struct {
+	ModTime     time.Time     // modification time of the remote object
+	Size        int64         // size of the file
+	Rs          ranges.Ranges // parts of the file which are present
+	Fingerprint string        // fingerprint of the remote object
+	Dirty       bool          // set if the file has changes which haven't been uploaded
+	ATime       time.Time     // last time the file was closed
+}
+
+// fingerprint returns a string which should change if o changes.
+//
+// It is made from the size and modification time.  Hashes are only
+// used if the remote doesn't support modification times as they can
+// be slow to read on some remotes.
+func fingerprint(o fs.Object) string {
+	f := o.Fs()
+	fp := fmt.Sprintf("%d,%s", o.Size(), o.ModTime().UTC().Format(time.RFC3339Nano))
+	if f.Precision() == fs.ModTimeNotSupported {
+		ht := f.Hashes().GetOne()
+		if ht != hash.None {
+			sum, err := o.Hash(ht)
+			if err == nil && sum != "" {
+				fp += "," + sum
+			}
+		}
+	}
+	return fp
+}
+
+// valid returns true if the cache file described by info with size
+// given is a copy of o or is dirty so should be used anyway
+func (info *cacheInfo) valid(o fs.Object, size int64) bool {
+	if info.Dirty {
+		return true
+	}
+	if size != info.Size {
+		return false
+	}
+	if info.Fingerprint == "" {
+		// from before fingerprints were kept
+		return info.Size == o.Size() && info.ModTime.Equal(o.ModTime())
+	}
+	return info.Fingerprint == fingerprint(o)
+}
+
+// complete returns true if all of the file is present
+func (info *cacheInfo) complete() bool {
+	return info.Rs.Present(ranges.Range{Pos: 0, Size: info.Size})
+}
+
+// toMetaPath turns a remote relative name into an OS path for its
+// metadata
+func (c *cache) toMetaPath(name string) string {
+	return filepath.Join(c.metaRoot, filepath.FromSlash(name))
+}
+
+// loadInfo reads the metadata for name returning an error satisfying
+// os.IsNotExist if there isn't any
+func (c *cache) loadInfo(name string) (info cacheInfo, err error) {
+	data, err := ioutil.ReadFile(c.toMetaPath(name))
+	if err != nil {
+		return info, err
+	}
+	err = json.Unmarshal(data, &info)
+	if err != nil {
+		return info, errors.Wrap(err, "failed to decode cache metadata")
+	}
+	return info, nil
+}
+
+// saveInfo writes the metadata for name
+func (c *cache) saveInfo(name string, info *cacheInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode cache metadata")
+	}
+	metaPath := c.toMetaPath(name)
+	err = os.MkdirAll(filepath.Dir(metaPath), 0700)
+	if err != nil {
+		return errors.Wrap(err, "failed to make cache metadata directory")
+	}
+	tmp := metaPath + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to write cache metadata")
+	}
+	return os.Rename(tmp, metaPath)
+}
+
+// removeInfo removes the metadata for name
+func (c *cache) removeInfo(name string) {
+	err := os.Remove(c.toMetaPath(name))
+	if err != nil && !os.IsNotExist(err) {
+		fs.Errorf(name, "Failed to remove cache metadata: %v", err)
+	}
+}
+
+// diskSize returns the number of bytes of name which are in the
+// cache.  This is smaller than the size of the file if it is sparse.
+func (c *cache) diskSize(name string, fi os.FileInfo) int64 {
+	info, err := c.loadInfo(name)
+	if err != nil {
+		return fi.Size()
+	}
+	return info.Rs.Size()
+}
+
+// isDirty returns true if name has changes which haven't been
+// uploaded so mustn't be removed from the cache
+func (c *cache) isDirty(name string) bool {
+	info, err := c.loadInfo(name)
+	return err == nil && info.Dirty
+}
+
+// sparseFile is a file in the cache which may only be partly
+// present.  Missing parts are downloaded from the remote object when
+// they are read, or before the file is uploaded.
+//
+// There is one sparseFile for each file with open RWFileHandles and
+// they share it.  Anything which writes to the cache file must hold
+// mu while it does so, so the downloader can't overwrite new data
+// with old.
+type sparseFile struct {
+	vfs    *VFS
+	name   string // remote path of the file
+	osPath string // path of the file in the cache
+
+	mu         sync.Mutex
+	cond       *sync.Cond    // signalled when ranges are downloaded or the downloader stops
+	info       cacheInfo     // metadata for the file
+	o          fs.Object     // object to download missing ranges from - may be nil
+	closed     bool          // set when the last handle closes
+	running    bool          // set if the downloader is running
+	dlOffset   int64         // where the downloader will read next
+	dlMax      int64         // how far the downloader should read to
+	dlSeek     int64         // if >= 0 the downloader should seek here
+	dlErr      error         // error from the last download
+	kick       chan struct{} // wakes an idle downloader
+	downloaded sync.WaitGroup
+}
+
+// newSparseFile prepares the cache file for name, reusing any parts
+// of it already downloaded if they are still valid for o.  If the
+// file isn't in the cache it is made as an empty sparse file of o's
+// size.
+//
+// If o is nil then the cache file is all there is.  In this case an
+// error satisfying os.IsNotExist is returned if it doesn't exist.
+func newSparseFile(vfs *VFS, name, osPath string, o fs.Object) (sf *sparseFile, err error) {
+	sf = &sparseFile{
+		vfs:    vfs,
+		name:   name,
+		osPath: osPath,
+		o:      o,
+		dlSeek: -1,
+		kick:   make(chan struct{}, 1),
+	}
+	sf.cond = sync.NewCond(&sf.mu)
+	c := vfs.cache
+	fi, statErr := os.Stat(osPath)
+	if statErr != nil && !os.IsNotExist(statErr) {
+		return nil, errors.Wrap(statErr, "failed to stat cache file")
+	}
+	exists := statErr == nil
+	if o == nil {
+		if !exists {
+			return nil, statErr
+		}
+		// the cache file is all there is and it isn't on the
+		// remote so needs uploading
+		sf._setLocal(fi.Size())
+		sf.info.Dirty = true
+		return sf, nil
+	}
+	if exists {
+		info, err := c.loadInfo(name)
+		if err == nil {
+			if info.valid(o, fi.Size()) {
+				if info.Dirty {
+					fs.Debugf(name, "Reusing cached copy with changes which haven't been uploaded")
+					if info.Fingerprint != fingerprint(o) {
+						fs.Logf(name, "Remote has changed since the cached copy was changed - it will be overwritten")
+					}
+					// if rclone stopped while the file was being
+					// written the size may not have been saved
+					if fi.Size() > info.Size {
+						info.Rs.Insert(ranges.Range{Pos: info.Size, Size: fi.Size() - info.Size})
+					} else {
+						info.Rs.Truncate(fi.Size())
+					}
+					info.Size = fi.Size()
+				} else {
+					fs.Debugf(name, "Reusing cached copy with %d/%d bytes present", info.Rs.Size(), info.Size)
+				}
+				sf.info = info
+				return sf, nil
+			}
+			fs.Debugf(name, "Discarding stale cached copy as the remote has changed")
+		} else if os.IsNotExist(err) {
+			// a complete file from before the metadata was kept
+			cacheObj, err := c.f.NewObject(name)
+			if err == nil && !operations.NeedTransfer(cacheObj, o) {
+				fs.Debugf(name, "Reusing complete cached copy")
+				sf._setLocal(o.Size())
+				return sf, sf._save()
+			}
+		} else {
+			fs.Errorf(name, "Discarding cached copy: %v", err)
+		}
+	}
+	// Make an empty sparse file of the right size.  Save the
+	// metadata first so a crash can't leave a sparse file which
+	// looks complete.
+	fs.Debugf(name, "Making sparse cache file of size %d", o.Size())
+	sf.info = cacheInfo{
+		ModTime:     o.ModTime(),
+		Size:        o.Size(),
+		Fingerprint: fingerprint(o),
+	}
+	err = sf._save()
+	if err != nil {
+		return nil, err
+	}
+	fd, err := file.OpenFile(osPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cache file")
+	}
+	err = fd.Truncate(o.Size())
+	closeErr := fd.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to size cache file")
+	}
+	return sf, nil
+}
+
+// newLocalSparseFile makes a sparseFile for a cache file which has
+// just been created or truncated to size so has nothing to download.
+// It is marked as dirty as it needs uploading.
+func newLocalSparseFile(vfs *VFS, name, osPath string, size int64) *sparseFile {
+	sf := &sparseFile{
+		vfs:    vfs,
+		name:   name,
+		osPath: osPath,
+		dlSeek: -1,
+		kick:   make(chan struct{}, 1),
+	}
+	sf.cond = sync.NewCond(&sf.mu)
+	sf._setLocal(size)
+	sf._setDirty()
+	return sf
+}
+
+// _setLocal marks the file as entirely present with size given - call
+// with mu held
+func (sf *sparseFile) _setLocal(size int64) {
+	sf.info = cacheInfo{
+		Size: size,
+	}
+	if sf.o != nil {
+		sf.info.ModTime = sf.o.ModTime()
+		sf.info.Fingerprint = fingerprint(sf.o)
+	}
+	sf.info.Rs.Insert(ranges.Range{Pos: 0, Size: size})
+}
+
+// _setDirty marks the file as changed, saving the metadata straight
+// away if it wasn't already so the changes are uploaded even if
+// rclone stops before the file is closed - call with mu held
+func (sf *sparseFile) _setDirty() {
+	if sf.info.Dirty {
+		return
+	}
+	sf.info.Dirty = true
+	if err := sf._save(); err != nil {
+		fs.Errorf(sf.name, "Failed to save cache metadata: %v", err)
+	}
+}
+
+// _save saves the metadata - call with mu held
+func (sf *sparseFile) _save() error {
+	return sf.vfs.cache.saveInfo(sf.name, &sf.info)
+}
+
+// _used tells the cache how much of the file is present so it can
+// keep to its quota - call with mu held
+func (sf *sparseFile) _used() {
+	sf.vfs.cache.setSize(sf.name, sf.info.Rs.Size())
+}
+
+// _written marks size bytes at off as present as they have been
+// written by a handle - call with mu held
+func (sf *sparseFile) _written(off, size int64) {
+	sf._setDirty()
+	if off > sf.info.Size {
+		// the gap is a hole which reads as zeros
+		sf.info.Rs.Insert(ranges.Range{Pos: sf.info.Size, Size: off - sf.info.Size})
+	}
+	sf.info.Rs.Insert(ranges.Range{Pos: off, Size: size})
+	if off+size > sf.info.Size {
+		sf.info.Size = off + size
+	}
+	sf._used()
+}
+
+// _truncate records that the cache file has been truncated to size -
+// call with mu held
+func (sf *sparseFile) _truncate(size int64) {
+	sf._setDirty()
+	if size < sf.info.Size {
+		sf.info.Rs.Truncate(size)
+		if sf.dlMax > size {
+			sf.dlMax = size
+		}
+	} else {
+		sf.info.Rs.Insert(ranges.Range{Pos: sf.info.Size, Size: size - sf.info.Size})
+	}
+	sf.info.Size = size
+	sf._used()
+}
+
+// truncate records that the cache file has been truncated to size
+func (sf *sparseFile) truncate(size int64) {
+	sf.mu.Lock()
+	sf._truncate(size)
+	sf.mu.Unlock()
+}
+
+// setObject is called when the cache file has been uploaded as o so
+// it is all present, matches o and is clean
+func (sf *sparseFile) setObject(o fs.Object) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.o = o
+	sf._setLocal(o.Size())
+	sf._used()
+	if err := sf._save(); err != nil {
+		fs.Errorf(sf.name, "Failed to save cache metadata: %v", err)
+	}
+}
+
+// present returns true if the whole file is in the cache
+func (sf *sparseFile) present() bool {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.info.Rs.Present(ranges.Range{Pos: 0, Size: sf.info.Size})
+}
+
+// ensure waits until size bytes at off are in the cache file,
+// downloading them and some more for read ahead if necessary.
+func (sf *sparseFile) ensure(off, size int64) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	r := ranges.Range{Pos: off, Size: size}
+	r.Clip(sf.info.Size)
+	if sf.o == nil {
+		return nil
+	}
+	for {
+		missing, ok := sf.info.Rs.FindMissing(r)
+		if !ok {
+			return nil
+		}
+		if sf.dlErr != nil && !sf.running {
+			err := sf.dlErr
+			sf.dlErr = nil
+			return err
+		}
+		if sf.closed {
+			return ECLOSED
+		}
+		// download at least a block and the read ahead
+		end := r.End() + int64(fs.Config.BufferSize) + int64(sf.vfs.Opt.ReadAhead)
+		if end < missing.Pos+downloadBlockSize {
+			end = missing.Pos + downloadBlockSize
+		}
+		sf._download(missing.Pos, end)
+		sf.cond.Wait()
+	}
+}
+
+// _download makes sure the downloader is running and will download
+// from pos to at least end - call with mu held
+func (sf *sparseFile) _download(pos, end int64) {
+	if end > sf.info.Size {
+		end = sf.info.Size
+	}
+	if sf.running {
+		if pos < sf.dlOffset || pos > sf.dlOffset+downloadMaxSkip {
+			// too far away so start again from pos
+			sf.dlSeek = pos
+			sf.dlMax = end
+		} else if end > sf.dlMax {
+			sf.dlMax = end
+		}
+		select {
+		case sf.kick <- struct{}{}:
+		default:
+		}
+		return
+	}
+	sf.running = true
+	sf.dlMax = end
+	sf.dlErr = nil
+	sf.dlOffset = pos
+	sf.dlSeek = -1
+	sf.downloaded.Add(1)
+	go sf.downloader(pos)
+}
+
+// _writeMissing writes the parts of buf, which came from off in the
+// object, which aren't already in the cache file - call with mu held
+func (sf *sparseFile) _writeMissing(fd *os.File, buf []byte, off int64) error {
+	r := ranges.Range{Pos: off, Size: int64(len(buf))}
+	// don't write anything beyond the end if the file was truncated
+	r.Clip(sf.info.Size)
+	for {
+		missing, ok := sf.info.Rs.FindMissing(r)
+		if !ok {
+			return nil
+		}
+		start := missing.Pos - off
+		_, err := fd.WriteAt(buf[start:start+missing.Size], missing.Pos)
+		if err != nil {
+			return errors.Wrap(err, "failed to write to cache file")
+		}
+		sf.info.Rs.Insert(missing)
+		sf._used()
+	}
+}
+
+// downloader reads missing parts of the object into the cache file
+// starting from offset until it reaches dlMax.  It waits a short time
+// for more work then exits.
+func (sf *sparseFile) downloader(offset int64) {
+	defer sf.downloaded.Done()
+	var (
+		in     *chunkedreader.ChunkedReader
+		fd     *os.File
+		err    error
+		seeked = false
+		buf    = make([]byte, downloadBlockSize)
+	)
+	defer func() {
+		if in != nil {
+			_ = in.Close()
+		}
+		if fd != nil {
+			if closeErr := fd.Close(); closeErr != nil && err == nil {
+				err = errors.Wrap(closeErr, "failed to close cache file")
+			}
+		}
+		sf.mu.Lock()
+		sf.running = false
+		if err != nil {
+			fs.Errorf(sf.name, "vfs cache: failed to download: %v", err)
+			sf.dlErr = err
+		}
+		sf.cond.Broadcast()
+		sf.mu.Unlock()
+	}()
+	fd, err = file.OpenFile(sf.osPath, os.O_WRONLY, 0600)
+	if err != nil {
+		err = errors.Wrap(err, "failed to open cache file")
+		return
+	}
+	for {
+		sf.mu.Lock()
+		if sf.closed {
+			sf.mu.Unlock()
+			return
+		}
+		if sf.dlSeek >= 0 {
+			offset, seeked = sf.dlSeek, false
+			sf.dlSeek = -1
+		}
+		want := ranges.Range{Pos: offset, Size: sf.dlMax - offset}
+		want.Clip(sf.info.Size)
+		missing, ok := sf.info.Rs.FindMissing(want)
+		if !ok {
+			// nothing more to do so wait to see if more is wanted
+			sf.dlOffset = sf.dlMax
+			sf.mu.Unlock()
+			select {
+			case <-sf.kick:
+				continue
+			case <-time.After(downloadIdleTime):
+			}
+			sf.mu.Lock()
+			idle := sf.dlSeek < 0 && sf.dlOffset >= sf.dlMax
+			sf.mu.Unlock()
+			if idle {
+				return
+			}
+			continue
+		}
+		if missing.Pos != offset {
+			offset, seeked = missing.Pos, false
+		}
+		sf.dlOffset = offset
+		o := sf.o
+		sf.mu.Unlock()
+
+		if in == nil {
+			in = chunkedreader.NewWithChunkSizeIterator(o, sf.vfs.chunkSizeFunc())
+		}
+		if !seeked {
+			fs.Debugf(sf.name, "vfs cache: downloading from offset %d", offset)
+			_, err = in.RangeSeek(offset, io.SeekStart, -1)
+			if err != nil {
+				err = errors.Wrap(err, "failed to seek")
+				return
+			}
+			seeked = true
+		}
+		n := int64(len(buf))
+		if missing.Size < n {
+			n = missing.Size
+		}
+		var nn int
+		nn, err = io.ReadFull(in, buf[:n])
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			// the object is shorter than expected
+			err = errors.Errorf("unexpected EOF at offset %d", offset+int64(nn))
+		}
+
+		sf.mu.Lock()
+		if nn > 0 {
+			writeErr := sf._writeMissing(fd, buf[:nn], offset)
+			if writeErr != nil && err == nil {
+				err = writeErr
+			}
+		}
+		offset += int64(nn)
+		sf.dlOffset = offset
+		sf.cond.Broadcast()
+		sf.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// close stops the downloader and saves the metadata.  It is called
+// when the last handle using the file closes.
+func (sf *sparseFile) close() {
+	sf.mu.Lock()
+	sf.closed = true
+	select {
+	case sf.kick <- struct{}{}:
+	default:
+	}
+	sf.mu.Unlock()
+	sf.downloaded.Wait()
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.info.ATime = time.Now()
+	if err := sf._save(); err != nil {
+		fs.Errorf(sf.name, "Failed to save cache metadata: %v", err)
+	}
+}
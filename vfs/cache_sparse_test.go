@@ -0,0 +1,319 @@
+package vfs
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fstest"
+	"github.com/ncw/rclone/lib/ranges"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sparseTestData makes some data which is different at each offset
+func sparseTestData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7 % 251)
+	}
+	return data
+}
+
+// newSparseTestVFS makes a VFS in cache mode full
+func newSparseTestVFS(t *testing.T, r *fstest.Run) *VFS {
+	opt := DefaultOpt
+	opt.CacheMode = CacheModeFull
+	opt.CachePollInterval = 0
+	return New(r.Fremote, &opt)
+}
+
+// openSparse opens name in vfs as an RWFileHandle
+func openSparse(t *testing.T, vfs *VFS, name string, flags int) *RWFileHandle {
+	h, err := vfs.OpenFile(name, flags, 0777)
+	require.NoError(t, err)
+	fh, ok := h.(*RWFileHandle)
+	require.True(t, ok)
+	return fh
+}
+
+func TestSparseFileReadPartial(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	// no read ahead so only a block is downloaded for each read
+	oldBufferSize := fs.Config.BufferSize
+	fs.Config.BufferSize = 0
+	defer func() { fs.Config.BufferSize = oldBufferSize }()
+	vfs := newSparseTestVFS(t, r)
+	defer func() {
+		assert.NoError(t, vfs.CleanUp())
+		vfs.Shutdown()
+	}()
+
+	const size = 3 * 1024 * 1024
+	data := sparseTestData(size)
+	r.WriteObject("big", string(data), t1)
+
+	// read a little from the middle
+	fh := openSparse(t, vfs, "big", os.O_RDONLY)
+	buf := make([]byte, 100)
+	n, err := fh.ReadAt(buf, 2*1024*1024)
+	require.NoError(t, err)
+	assert.Equal(t, 100, n)
+	assert.Equal(t, data[2*1024*1024:2*1024*1024+100], buf)
+
+	// only the block containing it should have been fetched
+	want := ranges.Ranges{{Pos: 2 * 1024 * 1024, Size: downloadBlockSize}}
+	fh.sparse.mu.Lock()
+	assert.Equal(t, want, fh.sparse.info.Rs)
+	fh.sparse.mu.Unlock()
+
+	// the cache file is full size but sparse
+	fi, err := os.Stat(fh.osPath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(size), fi.Size())
+
+	// a sequential read from the start
+	n, err = fh.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, 100, n)
+	assert.Equal(t, data[:100], buf)
+	require.NoError(t, fh.Close())
+
+	// the ranges should be saved when the file is closed
+	info, err := vfs.cache.loadInfo("big")
+	require.NoError(t, err)
+	assert.Equal(t, int64(size), info.Size)
+	assert.Equal(t, ranges.Ranges{{Pos: 0, Size: downloadBlockSize}, {Pos: 2 * 1024 * 1024, Size: downloadBlockSize}}, info.Rs)
+	assert.Equal(t, int64(2*downloadBlockSize), vfs.cache.diskSize("big", fi))
+
+	// a new VFS on the same cache should reuse them
+	vfs2 := newSparseTestVFS(t, r)
+	defer vfs2.Shutdown()
+	fh = openSparse(t, vfs2, "big", os.O_RDONLY)
+	n, err = fh.ReadAt(buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 100, n)
+	fh.sparse.mu.Lock()
+	assert.Equal(t, info.Rs, fh.sparse.info.Rs)
+	fh.sparse.mu.Unlock()
+
+	// reading all of it fetches the rest
+	all, err := ioutil.ReadAll(fh)
+	require.NoError(t, err)
+	assert.Equal(t, data, all)
+	assert.True(t, fh.sparse.present())
+	require.NoError(t, fh.Close())
+}
+
+func TestSparseFileWriteMiddle(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	vfs := newSparseTestVFS(t, r)
+	defer func() {
+		assert.NoError(t, vfs.CleanUp())
+		vfs.Shutdown()
+	}()
+
+	const size = 1024 * 1024
+	data := sparseTestData(size)
+	r.WriteObject("file", string(data), t1)
+
+	// write into the middle without reading anything
+	fh := openSparse(t, vfs, "file", os.O_RDWR)
+	n, err := fh.WriteAt([]byte("HELLO"), 500000)
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	fh.sparse.mu.Lock()
+	assert.Equal(t, ranges.Ranges{{Pos: 500000, Size: 5}}, fh.sparse.info.Rs)
+	fh.sparse.mu.Unlock()
+
+	// the rest is downloaded before the upload
+	require.NoError(t, fh.Close())
+	copy(data[500000:], "HELLO")
+	o, err := r.Fremote.NewObject("file")
+	require.NoError(t, err)
+	in, err := o.Open()
+	require.NoError(t, err)
+	got, err := ioutil.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, data, got)
+
+	// and the cache matches the uploaded object
+	info, err := vfs.cache.loadInfo("file")
+	require.NoError(t, err)
+	assert.Equal(t, ranges.Ranges{{Pos: 0, Size: size}}, info.Rs)
+	assert.True(t, info.ModTime.Equal(o.ModTime()))
+}
+
+func TestSparseFileTruncateAndExtend(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	vfs := newSparseTestVFS(t, r)
+	defer func() {
+		assert.NoError(t, vfs.CleanUp())
+		vfs.Shutdown()
+	}()
+
+	data := sparseTestData(1000)
+	r.WriteObject("file", string(data), t1)
+
+	fh := openSparse(t, vfs, "file", os.O_RDWR)
+	require.NoError(t, fh.Truncate(500))
+	_, err := fh.WriteAt([]byte("end"), 600)
+	require.NoError(t, err)
+	fh.sparse.mu.Lock()
+	assert.Equal(t, int64(603), fh.sparse.info.Size)
+	// the hole 500-600 is zeros so is present
+	assert.Equal(t, ranges.Ranges{{Pos: 500, Size: 103}}, fh.sparse.info.Rs)
+	fh.sparse.mu.Unlock()
+
+	buf := make([]byte, 603)
+	n, err := fh.ReadAt(buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 603, n)
+	want := append(append(append([]byte{}, data[:500]...), make([]byte, 100)...), "end"...)
+	assert.Equal(t, want, buf)
+	require.NoError(t, fh.Close())
+}
+
+func TestSparseFileRemoteChanged(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	vfs := newSparseTestVFS(t, r)
+	defer func() {
+		assert.NoError(t, vfs.CleanUp())
+		vfs.Shutdown()
+	}()
+
+	r.WriteObject("file", "0123456789", t1)
+	fh := openSparse(t, vfs, "file", os.O_RDONLY)
+	all, err := ioutil.ReadAll(fh)
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(all))
+	require.NoError(t, fh.Close())
+
+	// change the remote and look with a new VFS so the cached
+	// ranges are stale
+	r.WriteObject("file", "abcdefghijklmnop", t2)
+	vfs2 := newSparseTestVFS(t, r)
+	defer vfs2.Shutdown()
+	fh = openSparse(t, vfs2, "file", os.O_RDONLY)
+	all, err = ioutil.ReadAll(fh)
+	require.NoError(t, err)
+	assert.Equal(t, "abcdefghijklmnop", string(all))
+	require.NoError(t, fh.Close())
+	info, err := vfs2.cache.loadInfo("file")
+	require.NoError(t, err)
+	assert.True(t, info.ModTime.Equal(t2), info.ModTime.Sub(t2) < time.Second)
+}
+
+func TestSparseFileMetadata(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	vfs := newSparseTestVFS(t, r)
+	defer func() {
+		assert.NoError(t, vfs.CleanUp())
+		vfs.Shutdown()
+	}()
+
+	r.WriteObject("file", "0123456789", t1)
+	o, err := r.Fremote.NewObject("file")
+	require.NoError(t, err)
+
+	// reading the file leaves it clean with the fingerprint of o
+	before := time.Now()
+	fh := openSparse(t, vfs, "file", os.O_RDONLY)
+	_, err = ioutil.ReadAll(fh)
+	require.NoError(t, err)
+	require.NoError(t, fh.Close())
+	info, err := vfs.cache.loadInfo("file")
+	require.NoError(t, err)
+	assert.Equal(t, fingerprint(o), info.Fingerprint)
+	assert.False(t, info.Dirty)
+	assert.False(t, info.ATime.Before(before))
+	assert.True(t, info.valid(o, 10))
+	assert.False(t, info.valid(o, 11))
+
+	// writing makes it dirty straight away
+	fh = openSparse(t, vfs, "file", os.O_RDWR)
+	_, err = fh.WriteAt([]byte("X"), 0)
+	require.NoError(t, err)
+	info, err = vfs.cache.loadInfo("file")
+	require.NoError(t, err)
+	assert.True(t, info.Dirty)
+
+	// dirty files can't be purged
+	vfs.cache.purge("file")
+	_, err = os.Stat(fh.osPath)
+	assert.NoError(t, err)
+
+	// and it is clean again once uploaded
+	require.NoError(t, fh.Close())
+	info, err = vfs.cache.loadInfo("file")
+	require.NoError(t, err)
+	assert.False(t, info.Dirty)
+	o, err = r.Fremote.NewObject("file")
+	require.NoError(t, err)
+	assert.Equal(t, fingerprint(o), info.Fingerprint)
+}
+
+func TestCacheInfoValid(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	r.WriteObject("file", "0123456789", t1)
+	o, err := r.Fremote.NewObject("file")
+	require.NoError(t, err)
+
+	for _, test := range []struct {
+		name string
+		info cacheInfo
+		size int64
+		want bool
+	}{
+		{"match", cacheInfo{Size: 10, Fingerprint: fingerprint(o)}, 10, true},
+		{"changed", cacheInfo{Size: 10, Fingerprint: "10,potato"}, 10, false},
+		{"file size", cacheInfo{Size: 10, Fingerprint: fingerprint(o)}, 5, false},
+		{"dirty", cacheInfo{Size: 5, Fingerprint: "10,potato", Dirty: true}, 10, true},
+		{"old match", cacheInfo{Size: 10, ModTime: t1}, 10, true},
+		{"old changed", cacheInfo{Size: 10, ModTime: t2}, 10, false},
+	} {
+		assert.Equal(t, test.want, test.info.valid(o, test.size), test.name)
+	}
+}
+
+func TestCacheDirtyUploadedAfterRestart(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	opt := DefaultOpt
+	opt.CacheMode = CacheModeWrites
+	opt.CachePollInterval = 0
+	vfs := New(r.Fremote, &opt)
+	defer vfs.Shutdown()
+
+	// write a file but stop before closing it
+	h, err := vfs.OpenFile("file", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	require.NoError(t, err)
+	_, err = h.WriteString("hello")
+	require.NoError(t, err)
+	vfs.Shutdown()
+	_, err = r.Fremote.NewObject("file")
+	assert.Error(t, err)
+
+	// the next run finds it is dirty and uploads it
+	opt.WriteBack = time.Millisecond
+	vfs2 := New(r.Fremote, &opt)
+	defer func() {
+		assert.NoError(t, vfs2.CleanUp())
+		vfs2.Shutdown()
+	}()
+	waitForEmptyQueue(t, vfs2)
+	checkWriteBackRemote(t, r, "file", "hello")
+	info, err := vfs2.cache.loadInfo("file")
+	require.NoError(t, err)
+	assert.False(t, info.Dirty)
+	_ = h.Close()
+}
@@ -17,8 +17,11 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-// Check CacheMode it satisfies the pflag interface
-var _ pflag.Value = (*CacheMode)(nil)
+// Check CacheMode and CacheEviction satisfy the pflag interface
+var (
+	_ pflag.Value = (*CacheMode)(nil)
+	_ pflag.Value = (*CacheEviction)(nil)
+)
 
 func TestCacheModeString(t *testing.T) {
 	assert.Equal(t, "off", CacheModeOff.String())
@@ -45,6 +48,31 @@ func TestCacheModeType(t *testing.T) {
 	assert.Equal(t, "CacheMode", m.Type())
 }
 
+func TestCacheEvictionString(t *testing.T) {
+	assert.Equal(t, "lru", CacheEvictLRU.String())
+	assert.Equal(t, "size", CacheEvictSize.String())
+	assert.Equal(t, "CacheEviction(17)", CacheEviction(17).String())
+}
+
+func TestCacheEvictionSet(t *testing.T) {
+	var e CacheEviction
+
+	err := e.Set("lfu")
+	assert.NoError(t, err)
+	assert.Equal(t, CacheEvictLFU, e)
+
+	err = e.Set("potato")
+	assert.Error(t, err, "Unknown cache eviction policy")
+
+	err = e.Set("")
+	assert.Error(t, err, "Unknown cache eviction policy")
+}
+
+func TestCacheEvictionType(t *testing.T) {
+	var e CacheEviction
+	assert.Equal(t, "CacheEviction", e.Type())
+}
+
 // convert c.item to a string
 func itemAsString(c *cache) []string {
 	c.itemMu.Lock()
@@ -622,3 +650,184 @@ func TestCachePurgeOverQuota(t *testing.T) {
 	assert.Equal(t, int64(0), c.used)
 	assert.Equal(t, []string(nil), itemAsString(c))
 }
+
+// newQuotaTestCache makes a cache without the cleaner containing
+// files of the sizes given, the first accessed least recently
+func newQuotaTestCache(t *testing.T, r *fstest.Run, opt Options, sizes ...int64) *cache {
+	opt.CachePollInterval = 0
+	c, err := newCache(context.Background(), r.Fremote, &opt)
+	require.NoError(t, err)
+	now := time.Now()
+	for i, size := range sizes {
+		c.updateStat(fmt.Sprintf("file%d", i), now.Add(time.Duration(i-len(sizes))*time.Minute), size)
+		c.used += size
+	}
+	return c
+}
+
+func TestCachePurgeOverQuotaEviction(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+
+	for _, test := range []struct {
+		policy CacheEviction
+		want   []string
+	}{
+		{CacheEvictLRU, []string{"file0", "file1", "file2"}},
+		{CacheEvictLFU, []string{"file1", "file2"}},
+		{CacheEvictSize, []string{"file2"}},
+	} {
+		opt := DefaultOpt
+		opt.CacheEviction = test.policy
+		c := newQuotaTestCache(t, r, opt, 10, 20, 100, 30)
+		c.item["file0"].hits = 3
+		c.item["file1"].hits = 1
+		c.item["file2"].hits = 2
+		c.item["file3"].hits = 4
+
+		var removed []string
+		c._purgeOverQuota(100, func(name string) {
+			removed = append(removed, name)
+		})
+		assert.Equal(t, test.want, removed, test.policy.String())
+		assert.True(t, c.used < 100, test.policy.String())
+	}
+}
+
+func TestCachePurgeMinFreeSpace(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+
+	opt := DefaultOpt
+	opt.CacheMinFreeSpace = 1000
+	c := newQuotaTestCache(t, r, opt, 10, 20, 30)
+
+	// nothing is removed if the free space is unknown
+	var removed []string
+	remove := func(name string) {
+		removed = append(removed, name)
+	}
+	c._purgeOverQuota(-1, remove)
+	assert.Equal(t, []string(nil), removed)
+
+	// enough is removed to get the free space wanted
+	c.free = 975
+	c._purgeOverQuota(-1, remove)
+	assert.Equal(t, []string{"file0", "file1"}, removed)
+	assert.Equal(t, int64(1005), c.free)
+	assert.Equal(t, int64(30), c.used)
+
+	// the free space can be read from the disk
+	c.updateFree()
+	assert.True(t, c.free > 0)
+}
+
+func TestCachePurgeDirty(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+
+	opt := DefaultOpt
+	c := newQuotaTestCache(t, r, opt, 10, 20, 30)
+	defer func() {
+		require.NoError(t, c.cleanUp())
+	}()
+	require.NoError(t, c.saveInfo("file0", &cacheInfo{Dirty: true}))
+
+	// dirty files aren't removed by age
+	var removed []string
+	remove := func(name string) {
+		removed = append(removed, name)
+	}
+	c._purgeOld(-10*time.Second, remove)
+	sort.Strings(removed)
+	assert.Equal(t, []string{"file1", "file2"}, removed)
+
+	// or by quota and are still counted as used
+	removed = nil
+	c = newQuotaTestCache(t, r, opt, 10, 20, 30)
+	c._purgeOverQuota(1, remove)
+	assert.Equal(t, []string{"file1", "file2"}, removed)
+	assert.Equal(t, int64(10), c.used)
+	assert.Equal(t, []string{
+		`name="file0" isFile=true opens=0 size=10`,
+	}, itemAsString(c))
+}
+
+func TestCacheSetSize(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+
+	opt := DefaultOpt
+	opt.CacheMaxSize = 100
+	c := newQuotaTestCache(t, r, opt, 10, 20)
+
+	// growing a file under quota doesn't start an eviction
+	c.setSize("file1", 60)
+	assert.Equal(t, int64(70), c.used)
+	assert.Equal(t, 0, len(c.kick))
+
+	// going over quota does
+	c.setSize("file2", 40)
+	assert.Equal(t, int64(110), c.used)
+	assert.Equal(t, 1, len(c.kick))
+
+	// but not again straight away
+	<-c.kick
+	c.setSize("file2", 50)
+	assert.Equal(t, 0, len(c.kick))
+
+	// shrinking doesn't
+	c.kicked = time.Time{}
+	c.setSize("file2", 45)
+	assert.Equal(t, int64(115), c.used)
+	assert.Equal(t, 0, len(c.kick))
+
+	// the eviction removes the oldest files to get under quota
+	c.evict()
+	assert.Equal(t, int64(45), c.used)
+	assert.Equal(t, []string{
+		`name="file2" isFile=true opens=0 size=45`,
+	}, itemAsString(c))
+}
+
+func TestCachePin(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+
+	opt := DefaultOpt
+	c := newQuotaTestCache(t, r, opt, 10, 20, 30)
+	defer func() {
+		require.NoError(t, c.cleanUp())
+	}()
+
+	require.NoError(t, c.pin("file0"))
+	require.NoError(t, c.pin("/file2/"))
+	require.NoError(t, c.pin("file2"))
+	assert.Equal(t, []string{"file0", "file2"}, c.pinned())
+
+	// pinned files aren't removed by age or quota
+	var removed []string
+	remove := func(name string) {
+		removed = append(removed, name)
+	}
+	c._purgeOld(-10*time.Second, remove)
+	assert.Equal(t, []string{"file1"}, removed)
+	removed = nil
+	c._purgeOverQuota(1, remove)
+	assert.Equal(t, []string(nil), removed)
+
+	// pins are kept for the next run
+	c2 := newQuotaTestCache(t, r, opt)
+	assert.Equal(t, []string{"file0", "file2"}, c2.pinned())
+
+	// unpinned files can be removed again
+	require.NoError(t, c.unpin("file0"))
+	require.NoError(t, c.unpin("file1"))
+	assert.Equal(t, []string{"file2"}, c.pinned())
+	c._purgeOverQuota(1, remove)
+	assert.Equal(t, []string{"file0"}, removed)
+
+	require.NoError(t, c.unpin("file2"))
+	_, err := os.Stat(c.pinPath)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -17,16 +17,21 @@ import (
 
 // Dir represents a directory entry
 type Dir struct {
-	vfs     *VFS
-	inode   uint64 // inode number
-	f       fs.Fs
-	parent  *Dir // parent, nil for root
-	path    string
-	modTime time.Time
-	entry   fs.Directory
-	mu      sync.Mutex      // protects the following
-	read    time.Time       // time directory entry last read
-	items   map[string]Node // directory entries - can be empty but not nil
+	vfs       *VFS
+	inode     uint64 // inode number
+	f         fs.Fs
+	parent    *Dir // parent, nil for root
+	path      string
+	modTime   time.Time
+	entry     fs.Directory
+	mu        sync.Mutex          // protects the following
+	read      time.Time           // time directory entry last read
+	items     map[string]Node     // directory entries - can be empty but not nil
+	lower     map[string][]string // sorted names in items by lower case name - only if case insensitive
+	persisted bool                // set if the listing is in the persistent directory cache
+	refresh   bool                // set if a stale persisted listing is being read again in the background
+
+	attrs attrCache // permissions, owner and extended attributes
 }
 
 func newDir(vfs *VFS, f fs.Fs, parent *Dir, fsDir fs.Directory) *Dir {
@@ -62,7 +67,7 @@ func (d *Dir) IsDir() bool {
 
 // Mode bits of the directory - satisfies Node interface
 func (d *Dir) Mode() (mode os.FileMode) {
-	return d.vfs.Opt.DirPerms
+	return d.vfs.nodeMode(&d.attrs, d.path, d.vfs.Opt.DirPerms)
 }
 
 // Name (base) of the directory - satisfies Node interface
@@ -119,8 +124,12 @@ func (d *Dir) ForgetPath(relativePath string, entryType fs.EntryType) {
 				fs.Debugf(dir.path, "invalidating directory cache")
 				dir.read = time.Time{}
 			}
+			dir.persisted = false
 			dir.mu.Unlock()
 		}
+		// The parent may not be in memory but its listing may
+		// still be on disk
+		d.vfs.dirCache.forget(parent)
 	}
 
 	if entryType == fs.EntryDirectory {
@@ -128,9 +137,11 @@ func (d *Dir) ForgetPath(relativePath string, entryType fs.EntryType) {
 			dir.walk(func(dir *Dir) {
 				fs.Debugf(dir.path, "forgetting directory cache")
 				dir.read = time.Time{}
-				dir.items = make(map[string]Node)
+				dir._clearItems()
+				dir.persisted = false
 			})
 		}
+		d.vfs.dirCache.forgetTree(path.Join(d.path, relativePath))
 	}
 }
 
@@ -186,41 +197,176 @@ func (d *Dir) rename(newParent *Dir, fsDir fs.Directory) {
 // note that we add new objects rather than updating old ones
 func (d *Dir) addObject(node Node) {
 	d.mu.Lock()
-	d.items[node.Name()] = node
+	d._setItem(node.Name(), node)
+	d._forgetPersisted()
+	d._updateMetaFiles(node.Name())
 	d.mu.Unlock()
 }
 
 // delObject removes an object from the directory
 func (d *Dir) delObject(leaf string) {
 	d.mu.Lock()
-	delete(d.items, leaf)
+	d._delItem(leaf)
+	d._forgetPersisted()
+	d._updateMetaFiles(leaf)
 	d.mu.Unlock()
 }
 
+// _setItem sets the entry name in the directory to node - call with
+// the lock held
+func (d *Dir) _setItem(name string, node Node) {
+	if _, found := d.items[name]; !found && d.vfs.Opt.CaseInsensitive {
+		if d.lower == nil {
+			d.lower = make(map[string][]string)
+		}
+		key := strings.ToLower(name)
+		names := d.lower[key]
+		i := sort.SearchStrings(names, name)
+		names = append(names, "")
+		copy(names[i+1:], names[i:])
+		names[i] = name
+		d.lower[key] = names
+	}
+	d.items[name] = node
+}
+
+// _delItem removes the entry name from the directory - call with the
+// lock held
+func (d *Dir) _delItem(name string) {
+	if _, found := d.items[name]; found && d.vfs.Opt.CaseInsensitive {
+		key := strings.ToLower(name)
+		names := d.lower[key]
+		i := sort.SearchStrings(names, name)
+		if i < len(names) && names[i] == name {
+			names = append(names[:i], names[i+1:]...)
+		}
+		if len(names) == 0 {
+			delete(d.lower, key)
+		} else {
+			d.lower[key] = names
+		}
+	}
+	delete(d.items, name)
+}
+
+// _clearItems removes all the entries from the directory - call with
+// the lock held
+func (d *Dir) _clearItems() {
+	d.items = make(map[string]Node)
+	d.lower = nil
+}
+
+// _forgetPersisted removes the listing from the persistent directory
+// cache as it no longer matches d.items - call with the lock held
+func (d *Dir) _forgetPersisted() {
+	if d.persisted {
+		d.vfs.dirCache.forget(d.path)
+		d.persisted = false
+	}
+}
+
 // read the directory and sets d.items - must be called with the lock held
 func (d *Dir) _readDir() error {
 	when := time.Now()
 	if age, stale := d.age(when); stale {
+		if age != 0 && d.refresh {
+			// use the stale listing until it has been read again
+			return nil
+		}
 		if age != 0 {
 			fs.Debugf(d.path, "Re-reading directory (%v old)", age)
+		} else if d._readDirFromPersisted(when) {
+			return nil
 		}
 	} else {
 		return nil
 	}
+	return d._readDirFromRemote(when)
+}
+
+// read the directory from the persistent directory cache if it is
+// there, returning true if it was - must be called with the lock held
+//
+// If the listing is older than DirCacheTime it is used anyway and read
+// again from the remote in the background.
+func (d *Dir) _readDirFromPersisted(when time.Time) bool {
+	entries, read, ok := d.vfs.dirCache.get(d.path)
+	if !ok {
+		return false
+	}
+	if err := d._readDirFromEntries(entries, nil, time.Time{}); err != nil {
+		return false
+	}
+	age := when.Sub(read)
+	d.read = read
+	d.persisted = true
+	if age > d.vfs.Opt.DirCacheTime {
+		fs.Debugf(d.path, "Read directory from stale persisted listing (%v old) - refreshing", age)
+		d.refresh = true
+		go d.refreshPersisted(read)
+	} else {
+		fs.Debugf(d.path, "Read directory from persisted listing (%v old)", age)
+	}
+	return true
+}
+
+// refreshPersisted reads the directory from the remote to replace the
+// stale persisted listing read at read, unless the directory has
+// changed since
+func (d *Dir) refreshPersisted(read time.Time) {
+	when := time.Now()
+	entries, err := d.listRemote()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.refresh = false
+	if err != nil {
+		fs.Errorf(d.path, "Failed to refresh persisted directory listing: %v", err)
+		return
+	}
+	if !d.persisted || !d.read.Equal(read) {
+		fs.Debugf(d.path, "Directory changed while refreshing persisted listing")
+		return
+	}
+	err = d._setEntries(entries, when)
+	if err != nil {
+		fs.Errorf(d.path, "Failed to refresh persisted directory listing: %v", err)
+	}
+}
+
+// listRemote lists the directory on the remote
+func (d *Dir) listRemote() (fs.DirEntries, error) {
 	entries, err := list.DirSorted(d.f, false, d.path)
 	if err == fs.ErrorDirNotFound {
 		// We treat directory not found as empty because we
 		// create directories on the fly
-	} else if err != nil {
+		return nil, nil
+	}
+	return entries, err
+}
+
+// read the directory from the remote and sets d.items - must be
+// called with the lock held
+func (d *Dir) _readDirFromRemote(when time.Time) error {
+	entries, err := d.listRemote()
+	if err != nil {
 		return err
 	}
+	return d._setEntries(entries, when)
+}
 
-	err = d._readDirFromEntries(entries, nil, time.Time{})
+// sets d.items from the entries read from the remote at when and
+// persists them - must be called with the lock held
+func (d *Dir) _setEntries(entries fs.DirEntries, when time.Time) error {
+	err := d._readDirFromEntries(entries, nil, time.Time{})
 	if err != nil {
 		return err
 	}
 
 	d.read = when
+	if d.vfs.dirCache != nil {
+		d.vfs.dirCache.put(d.path, entries, when)
+		d.persisted = true
+	}
 	return nil
 }
 
@@ -256,6 +402,9 @@ func (d *Dir) _readDirFromEntries(entries fs.DirEntries, dirTree walk.DirTree, w
 			// Reuse old dir value if it exists
 			if node == nil || !node.IsDir() {
 				node = newDir(d.vfs, d.f, d, item)
+			} else {
+				// the attributes may have been changed on the remote
+				node.(*Dir).attrs.forget()
 			}
 			if dirTree != nil {
 				dir := node.(*Dir)
@@ -265,6 +414,7 @@ func (d *Dir) _readDirFromEntries(entries fs.DirEntries, dirTree walk.DirTree, w
 					dir.read = time.Time{}
 				} else {
 					dir.read = when
+					dir.persisted = d.vfs.dirCache != nil
 				}
 				dir.mu.Unlock()
 				if err != nil {
@@ -276,14 +426,15 @@ func (d *Dir) _readDirFromEntries(entries fs.DirEntries, dirTree walk.DirTree, w
 			fs.Errorf(d, "readDir error: %v", err)
 			return err
 		}
-		d.items[name] = node
+		d._setItem(name, node)
 	}
 	// delete unused entries
 	for name := range d.items {
 		if _, ok := found[name]; !ok {
-			delete(d.items, name)
+			d._delItem(name)
 		}
 	}
+	d._addMetaFiles()
 	return nil
 }
 
@@ -307,6 +458,10 @@ func (d *Dir) ReadDirTree() error {
 	}
 	fs.Debugf(d.path, "Reading directory tree done in %s", time.Since(when))
 	d.read = when
+	if d.vfs.dirCache != nil {
+		d.vfs.dirCache.putTree(d.path, dt, when)
+		d.persisted = true
+	}
 	return nil
 }
 
@@ -315,7 +470,7 @@ func (d *Dir) ReadDir() error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 	d.read = time.Time{}
-	return d._readDir()
+	return d._readDirFromRemote(time.Now())
 }
 
 // stat a single item in the directory
@@ -328,13 +483,33 @@ func (d *Dir) stat(leaf string) (Node, error) {
 	if err != nil {
 		return nil, err
 	}
-	item, ok := d.items[leaf]
+	item, ok := d._find(leaf)
 	if !ok {
 		return nil, ENOENT
 	}
 	return item, nil
 }
 
+// _find looks up leaf in the directory - call with the lock held
+//
+// If the VFS is case insensitive and there is no exact match then it
+// returns the item whose name matches leaf ignoring case.  If more
+// than one does then the first in sort order is returned so the
+// result doesn't depend on the order of the listing.
+func (d *Dir) _find(leaf string) (Node, bool) {
+	if item, ok := d.items[leaf]; ok {
+		return item, true
+	}
+	if !d.vfs.Opt.CaseInsensitive {
+		return nil, false
+	}
+	names := d.lower[strings.ToLower(leaf)]
+	if len(names) == 0 {
+		return nil, false
+	}
+	return d.items[names[0]], true
+}
+
 // Check to see if a directory is empty
 func (d *Dir) isEmpty() (bool, error) {
 	d.mu.Lock()
@@ -343,7 +518,12 @@ func (d *Dir) isEmpty() (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	return len(d.items) == 0, nil
+	for _, node := range d.items {
+		if !isMetaFile(node) {
+			return false, nil
+		}
+	}
+	return true, nil
 }
 
 // ModTime returns the modification time of the directory
@@ -362,12 +542,50 @@ func (d *Dir) SetModTime(modTime time.Time) error {
 	if d.vfs.Opt.ReadOnly {
 		return EROFS
 	}
+	if err := d.vfs.checkLock(d.path); err != nil {
+		return err
+	}
 	d.mu.Lock()
 	defer d.mu.Unlock()
 	d.modTime = modTime
 	return nil
 }
 
+// Chmod sets the permissions of the directory
+func (d *Dir) Chmod(mode os.FileMode) error {
+	return d.vfs.chmod(&d.attrs, d.path, false, mode)
+}
+
+// Chown sets the owner of the directory
+func (d *Dir) Chown(uid, gid uint32) error {
+	return d.vfs.chown(&d.attrs, d.path, false, uid, gid)
+}
+
+// Owner returns the owner of the directory
+func (d *Dir) Owner() (uid, gid uint32) {
+	return d.vfs.nodeOwner(&d.attrs, d.path)
+}
+
+// Getxattr returns the value of the extended attribute name
+func (d *Dir) Getxattr(name string) ([]byte, error) {
+	return d.vfs.getxattr(&d.attrs, d.path, name)
+}
+
+// Setxattr sets the extended attribute name to value
+func (d *Dir) Setxattr(name string, value []byte, flags int) error {
+	return d.vfs.setxattr(&d.attrs, d.path, false, name, value, flags)
+}
+
+// Listxattr returns the names of the extended attributes
+func (d *Dir) Listxattr() ([]string, error) {
+	return d.vfs.listxattr(&d.attrs, d.path)
+}
+
+// Removexattr removes the extended attribute name
+func (d *Dir) Removexattr(name string) error {
+	return d.vfs.removexattr(&d.attrs, d.path, false, name)
+}
+
 func (d *Dir) cachedDir(relativePath string) (dir *Dir) {
 	dir, _ = d.cachedNode(relativePath).(*Dir)
 	return
@@ -451,6 +669,13 @@ func (d *Dir) Create(name string, flags int) (*File, error) {
 	if d.vfs.Opt.ReadOnly {
 		return nil, EROFS
 	}
+	// Files made by the VFS can't be replaced
+	d.mu.Lock()
+	node, _ := d._find(name)
+	d.mu.Unlock()
+	if isMetaFile(node) {
+		return nil, EROFS
+	}
 	// This gets added to the directory when the file is opened for write
 	return newFile(d, nil, name), nil
 }
@@ -461,6 +686,9 @@ func (d *Dir) Mkdir(name string) (*Dir, error) {
 		return nil, EROFS
 	}
 	path := path.Join(d.path, name)
+	if err := d.vfs.checkLock(path); err != nil {
+		return nil, err
+	}
 	node, err := d.stat(name)
 	switch err {
 	case ENOENT:
@@ -494,6 +722,9 @@ func (d *Dir) Remove() error {
 	if d.vfs.Opt.ReadOnly {
 		return EROFS
 	}
+	if err := d.vfs.checkLock(d.path); err != nil {
+		return err
+	}
 	// Check directory is empty first
 	empty, err := d.isEmpty()
 	if err != nil {
@@ -514,6 +745,8 @@ func (d *Dir) Remove() error {
 	if d.parent != nil {
 		d.parent.delObject(d.Name())
 	}
+	d.vfs.dirCache.forgetTree(d.path)
+	d.vfs.attrs.remove(d.path)
 	return nil
 }
 
@@ -529,6 +762,9 @@ func (d *Dir) RemoveAll() error {
 		return err
 	}
 	for _, node := range nodes {
+		if isMetaFile(node) {
+			continue
+		}
 		err = node.RemoveAll()
 		if err != nil {
 			fs.Errorf(node.Path(), "Dir.RemoveAll failed to remove: %v", err)
@@ -567,11 +803,34 @@ func (d *Dir) Rename(oldName, newName string, destDir *Dir) error {
 	oldPath := path.Join(d.path, oldName)
 	newPath := path.Join(destDir.path, newName)
 	// fs.Debugf(oldPath, "Dir.Rename to %q", newPath)
+	if err := d.vfs.checkLock(oldPath); err != nil {
+		return err
+	}
+	if err := d.vfs.checkLock(newPath); err != nil {
+		return err
+	}
 	oldNode, err := d.stat(oldName)
 	if err != nil {
 		fs.Errorf(oldPath, "Dir.Rename error: %v", err)
 		return err
 	}
+	if d.vfs.Opt.CaseInsensitive {
+		// Use the real names so the rename replaces any
+		// existing file whose name differs only in case
+		// rather than making another one beside it
+		oldName = oldNode.Name()
+		oldPath = path.Join(d.path, oldName)
+		if newNode, err := destDir.stat(newName); err == nil && newNode != oldNode {
+			newName = newNode.Name()
+			newPath = path.Join(destDir.path, newName)
+		}
+		if err := d.vfs.checkLock(oldPath); err != nil {
+			return err
+		}
+		if err := d.vfs.checkLock(newPath); err != nil {
+			return err
+		}
+	}
 	switch x := oldNode.DirEntry().(type) {
 	case nil:
 		if oldFile, ok := oldNode.(*File); ok {
@@ -625,6 +884,7 @@ func (d *Dir) Rename(oldName, newName string, destDir *Dir) error {
 	// Show moved - delete from old dir and add to new
 	d.delObject(oldName)
 	destDir.addObject(oldNode)
+	d.vfs.attrs.rename(oldPath, newPath)
 
 	// fs.Debugf(newPath, "Dir.Rename renamed from %q", oldPath)
 	return nil
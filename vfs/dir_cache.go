@@ -0,0 +1,419 @@
+// This deals with keeping directory listings on disk between runs
+
+package vfs
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/fs/walk"
+	"github.com/pkg/errors"
+)
+
+// bucket the listings are stored in
+var dirCacheBucket = []byte("dirs")
+
+// dirCacheEntry is a file or directory in a stored listing
+type dirCacheEntry struct {
+	Name    string    `json:"n"`
+	Dir     bool      `json:"d,omitempty"`
+	Size    int64     `json:"s,omitempty"`
+	ModTime time.Time `json:"t"`
+}
+
+// dirCacheListing is a stored directory listing
+type dirCacheListing struct {
+	Read    time.Time       // when the listing was read from the remote
+	Entries []dirCacheEntry // the entries in the directory
+}
+
+// dirCache stores directory listings in a bolt database so they can
+// be used after a restart without listing the remote again.
+//
+// The listings are removed when the directories are forgotten, which
+// happens when they are changed locally or ChangeNotify says they
+// have changed on the remote.
+type dirCache struct {
+	f      fs.Fs
+	dbPath string     // path to the database file
+	mu     sync.Mutex // protects db
+	db     *bolt.DB   // nil if closed
+}
+
+// newDirCache opens the directory cache for f
+func newDirCache(f fs.Fs) (*dirCache, error) {
+	dbPath := filepath.Join(cachePath("vfsDir", f), "dircache.db")
+	fs.Debugf(nil, "vfs directory cache is %q", dbPath)
+	db, err := openBolt(dbPath, dirCacheBucket)
+	if err != nil {
+		return nil, errors.Wrap(err, "directory cache")
+	}
+	return &dirCache{
+		f:      f,
+		dbPath: dbPath,
+		db:     db,
+	}, nil
+}
+
+// openBolt opens the bolt database at dbPath making the directory
+// and bucket if necessary
+func openBolt(dbPath string, bucket []byte) (*bolt.DB, error) {
+	err := os.MkdirAll(filepath.Dir(dbPath), 0700)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to make directory")
+	}
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %q", dbPath)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Wrap(err, "failed to make bucket")
+	}
+	return db, nil
+}
+
+// dirCacheKey returns the database key for dir - keys can't be empty
+// so they all start with /
+func dirCacheKey(dir string) []byte {
+	return []byte("/" + dir)
+}
+
+// update runs fn in a read write transaction if the cache is open
+func (dc *dirCache) update(fn func(b *bolt.Bucket) error) error {
+	if dc == nil {
+		return nil
+	}
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if dc.db == nil {
+		return nil
+	}
+	return dc.db.Update(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket(dirCacheBucket))
+	})
+}
+
+// _put stores the entries for dir read at when in b
+func (dc *dirCache) _put(b *bolt.Bucket, dir string, entries fs.DirEntries, when time.Time) error {
+	listing := dirCacheListing{
+		Read:    when,
+		Entries: make([]dirCacheEntry, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		item := dirCacheEntry{
+			Name:    path.Base(entry.Remote()),
+			ModTime: entry.ModTime(),
+		}
+		switch x := entry.(type) {
+		case fs.Object:
+			item.Size = x.Size()
+		case fs.Directory:
+			item.Dir = true
+		default:
+			continue
+		}
+		listing.Entries = append(listing.Entries, item)
+	}
+	data, err := json.Marshal(&listing)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode directory listing")
+	}
+	return b.Put(dirCacheKey(dir), data)
+}
+
+// put stores the entries for dir read at when
+func (dc *dirCache) put(dir string, entries fs.DirEntries, when time.Time) {
+	err := dc.update(func(b *bolt.Bucket) error {
+		return dc._put(b, dir, entries, when)
+	})
+	if err != nil {
+		fs.Errorf(dir, "Failed to save directory listing: %v", err)
+	}
+}
+
+// putTree replaces the stored listings for dir and all the
+// directories below it with those in dirTree read at when
+func (dc *dirCache) putTree(dir string, dirTree walk.DirTree, when time.Time) {
+	err := dc.update(func(b *bolt.Bucket) error {
+		err := dc._forgetTree(b, dir)
+		if err != nil {
+			return err
+		}
+		for dir, entries := range dirTree {
+			err := dc._put(b, dir, entries, when)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fs.Errorf(nil, "Failed to save directory tree: %v", err)
+	}
+}
+
+// get returns the stored entries for dir and when they were read
+// from the remote.  ok is false if there aren't any.
+func (dc *dirCache) get(dir string) (entries fs.DirEntries, when time.Time, ok bool) {
+	if dc == nil {
+		return nil, when, false
+	}
+	var listing dirCacheListing
+	dc.mu.Lock()
+	if dc.db != nil {
+		err := dc.db.View(func(tx *bolt.Tx) error {
+			data := tx.Bucket(dirCacheBucket).Get(dirCacheKey(dir))
+			if data == nil {
+				return nil
+			}
+			ok = true
+			return json.Unmarshal(data, &listing)
+		})
+		if err != nil {
+			fs.Errorf(dir, "Failed to read stored directory listing: %v", err)
+			ok = false
+		}
+	}
+	dc.mu.Unlock()
+	if !ok {
+		return nil, when, false
+	}
+	entries = make(fs.DirEntries, 0, len(listing.Entries))
+	for _, item := range listing.Entries {
+		remote := path.Join(dir, item.Name)
+		if item.Dir {
+			entries = append(entries, fs.NewDir(remote, item.ModTime))
+		} else {
+			entries = append(entries, &dirCacheObject{
+				f:       dc.f,
+				remote:  remote,
+				size:    item.Size,
+				modTime: item.ModTime,
+			})
+		}
+	}
+	return entries, listing.Read, true
+}
+
+// forget removes the stored listing for dir
+func (dc *dirCache) forget(dir string) {
+	err := dc.update(func(b *bolt.Bucket) error {
+		return b.Delete(dirCacheKey(dir))
+	})
+	if err != nil {
+		fs.Errorf(dir, "Failed to remove stored directory listing: %v", err)
+	}
+}
+
+// forgetTree removes the stored listings for dir and all the
+// directories below it
+func (dc *dirCache) forgetTree(dir string) {
+	err := dc.update(func(b *bolt.Bucket) error {
+		return dc._forgetTree(b, dir)
+	})
+	if err != nil {
+		fs.Errorf(dir, "Failed to remove stored directory listings: %v", err)
+	}
+}
+
+// _forgetTree removes the listings for dir and all the directories
+// below it from b
+func (dc *dirCache) _forgetTree(b *bolt.Bucket, dir string) error {
+	key := dirCacheKey(dir)
+	prefix := key
+	if dir != "" {
+		prefix = append(dirCacheKey(dir), '/')
+	}
+	err := b.Delete(key)
+	if err != nil {
+		return err
+	}
+	// NB deleting with the cursor skips the next key so collect
+	// the keys first
+	var keys [][]byte
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	for _, k := range keys {
+		err = b.Delete(k)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close closes the database
+func (dc *dirCache) close() {
+	if dc == nil {
+		return
+	}
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if dc.db == nil {
+		return
+	}
+	if err := dc.db.Close(); err != nil {
+		fs.Errorf(nil, "Failed to close directory cache: %v", err)
+	}
+	dc.db = nil
+}
+
+// dirCacheObject stands in for an object from a stored directory
+// listing.  It finds the real object the first time it is needed for
+// anything other than its name, size and modification time.
+type dirCacheObject struct {
+	f       fs.Fs
+	remote  string
+	mu      sync.Mutex // protects the following
+	size    int64
+	modTime time.Time
+	o       fs.Object // the real object once found
+}
+
+// Check interfaces
+var (
+	_ fs.Object          = (*dirCacheObject)(nil)
+	_ fs.ObjectUnWrapper = (*dirCacheObject)(nil)
+)
+
+// object finds the real object
+func (o *dirCacheObject) object() (fs.Object, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.o != nil {
+		return o.o, nil
+	}
+	obj, err := o.f.NewObject(o.remote)
+	if err != nil {
+		return nil, err
+	}
+	o.o = obj
+	return obj, nil
+}
+
+// String returns a description of the Object
+func (o *dirCacheObject) String() string {
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *dirCacheObject) Remote() string {
+	return o.remote
+}
+
+// ModTime returns the modification time as stored
+func (o *dirCacheObject) ModTime() time.Time {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.modTime
+}
+
+// Size returns the size as stored
+func (o *dirCacheObject) Size() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.size
+}
+
+// refresh reads the size and modification time from the real object
+// after it has been changed
+func (o *dirCacheObject) refresh(obj fs.Object) {
+	o.mu.Lock()
+	o.size = obj.Size()
+	o.modTime = obj.ModTime()
+	o.mu.Unlock()
+}
+
+// Fs returns the Fs the object is in
+func (o *dirCacheObject) Fs() fs.Info {
+	return o.f
+}
+
+// Storable says whether this object can be stored
+func (o *dirCacheObject) Storable() bool {
+	return true
+}
+
+// Hash returns the hash of the real object
+func (o *dirCacheObject) Hash(ht hash.Type) (string, error) {
+	obj, err := o.object()
+	if err != nil {
+		return "", err
+	}
+	return obj.Hash(ht)
+}
+
+// SetModTime sets the modification time of the real object
+func (o *dirCacheObject) SetModTime(t time.Time) error {
+	obj, err := o.object()
+	if err != nil {
+		return err
+	}
+	err = obj.SetModTime(t)
+	o.refresh(obj)
+	return err
+}
+
+// Open opens the real object
+func (o *dirCacheObject) Open(options ...fs.OpenOption) (io.ReadCloser, error) {
+	obj, err := o.object()
+	if err != nil {
+		return nil, err
+	}
+	return obj.Open(options...)
+}
+
+// Update updates the real object
+func (o *dirCacheObject) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	obj, err := o.object()
+	if err != nil {
+		return err
+	}
+	err = obj.Update(in, src, options...)
+	o.refresh(obj)
+	return err
+}
+
+// Remove removes the real object
+func (o *dirCacheObject) Remove() error {
+	obj, err := o.object()
+	if err != nil {
+		return err
+	}
+	return obj.Remove()
+}
+
+// UnWrap returns the real object or nil if it can't be found
+func (o *dirCacheObject) UnWrap() fs.Object {
+	obj, err := o.object()
+	if err != nil {
+		return nil
+	}
+	return obj
+}
+
+// realObject returns the object that o stands in for if it came from
+// a stored directory listing, otherwise o.  Use this when passing
+// objects to operations which need the backend's own objects.
+func realObject(o fs.Object) (fs.Object, error) {
+	if dco, ok := o.(*dirCacheObject); ok {
+		return dco.object()
+	}
+	return o, nil
+}
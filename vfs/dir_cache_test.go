@@ -0,0 +1,244 @@
+package vfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/walk"
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDirCacheTestVFS makes a VFS which persists its directory cache
+func newDirCacheTestVFS(t *testing.T, r *fstest.Run) *VFS {
+	opt := DefaultOpt
+	opt.DirCachePersist = true
+	vfs := New(r.Fremote, &opt)
+	require.NotNil(t, vfs.dirCache)
+	return vfs
+}
+
+// removeDirCache removes the database of the persistent directory cache
+func removeDirCache(t *testing.T, vfs *VFS) {
+	vfs.Shutdown()
+	assert.NoError(t, os.RemoveAll(filepath.Dir(vfs.dirCache.dbPath)))
+}
+
+// dirCacheNames returns the names in dir
+func dirCacheNames(t *testing.T, vfs *VFS, dir string) (names []string) {
+	node, err := vfs.Stat(dir)
+	require.NoError(t, err)
+	nodes, err := node.(*Dir).ReadDirAll()
+	require.NoError(t, err)
+	for _, node := range nodes {
+		names = append(names, node.Name())
+	}
+	return names
+}
+
+// waitForRefresh waits for the background refresh of d to finish
+func waitForRefresh(t *testing.T, d *Dir) {
+	for i := 0; i < 100; i++ {
+		d.mu.Lock()
+		refresh := d.refresh
+		d.mu.Unlock()
+		if !refresh {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%v wasn't refreshed", d)
+}
+
+func TestDirCachePutGetForget(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	dc, err := newDirCache(r.Fremote)
+	require.NoError(t, err)
+	defer func() {
+		dc.close()
+		assert.NoError(t, os.RemoveAll(filepath.Dir(dc.dbPath)))
+	}()
+
+	when := time.Now().Truncate(time.Second)
+	file1 := r.WriteObject("dir/file1", "potato", t1)
+	o, err := r.Fremote.NewObject(file1.Path)
+	require.NoError(t, err)
+	dc.put("dir", fs.DirEntries{o, fs.NewDir("dir/sub", t2)}, when)
+
+	entries, read, ok := dc.get("dir")
+	require.True(t, ok)
+	assert.True(t, read.Equal(when))
+	require.Equal(t, 2, len(entries))
+	assert.Equal(t, "dir/file1", entries[0].Remote())
+	assert.Equal(t, int64(6), entries[0].Size())
+	assert.True(t, entries[0].ModTime().Equal(o.ModTime()))
+	assert.Equal(t, "dir/sub", entries[1].Remote())
+	_, isDir := entries[1].(fs.Directory)
+	assert.True(t, isDir)
+
+	// the stand in finds the real object when needed
+	in, err := entries[0].(fs.Object).Open()
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, "potato", string(data))
+	real, err := realObject(entries[0].(fs.Object))
+	require.NoError(t, err)
+	assert.Equal(t, o.Remote(), real.Remote())
+	assert.NotEqual(t, entries[0], real)
+
+	_, _, ok = dc.get("")
+	assert.False(t, ok)
+	dc.put("", nil, when)
+	dc.put("dir/sub", nil, when)
+	dc.put("dir2", nil, when)
+
+	dc.forget("dir/sub")
+	_, _, ok = dc.get("dir/sub")
+	assert.False(t, ok)
+
+	// forgetTree doesn't remove directories with the same prefix
+	dc.put("dir/sub", nil, when)
+	dc.forgetTree("dir")
+	for _, dir := range []string{"dir", "dir/sub"} {
+		_, _, ok = dc.get(dir)
+		assert.False(t, ok, dir)
+	}
+	for _, dir := range []string{"", "dir2"} {
+		_, _, ok = dc.get(dir)
+		assert.True(t, ok, dir)
+	}
+
+	// putTree replaces everything below the directory
+	dc.put("dir/old", nil, when)
+	dc.putTree("dir", walk.DirTree{"dir": fs.DirEntries{o}}, when)
+	_, _, ok = dc.get("dir/old")
+	assert.False(t, ok)
+	entries, _, ok = dc.get("dir")
+	assert.True(t, ok)
+	assert.Equal(t, 1, len(entries))
+
+	// forgetting the root forgets everything
+	dc.forgetTree("")
+	for _, dir := range []string{"", "dir", "dir2"} {
+		_, _, ok = dc.get(dir)
+		assert.False(t, ok, dir)
+	}
+
+	// a closed cache does nothing
+	dc.close()
+	dc.put("dir", nil, when)
+	_, _, ok = dc.get("dir")
+	assert.False(t, ok)
+}
+
+func TestDirCachePersist(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	r.WriteObject("dir/file1", "file1", t1)
+	r.WriteObject("dir/file2", "file2 contents", t2)
+
+	vfs := newDirCacheTestVFS(t, r)
+	assert.Equal(t, []string{"dir"}, dirCacheNames(t, vfs, ""))
+	assert.Equal(t, []string{"file1", "file2"}, dirCacheNames(t, vfs, "dir"))
+	vfs.Shutdown()
+
+	// change the remote behind the cache's back
+	o, err := r.Fremote.NewObject("dir/file1")
+	require.NoError(t, err)
+	require.NoError(t, o.Remove())
+
+	// the next run lists from the disk so doesn't see the change
+	vfs = newDirCacheTestVFS(t, r)
+	defer removeDirCache(t, vfs)
+	assert.Equal(t, []string{"file1", "file2"}, dirCacheNames(t, vfs, "dir"))
+	node, err := vfs.Stat("dir/file2")
+	require.NoError(t, err)
+	assert.Equal(t, int64(14), node.Size())
+	assert.True(t, node.ModTime().Equal(t2), node.ModTime())
+
+	// the files can be read and renamed
+	fd, err := vfs.OpenFile("dir/file2", os.O_RDONLY, 0)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(fd)
+	require.NoError(t, err)
+	require.NoError(t, fd.Close())
+	assert.Equal(t, "file2 contents", string(data))
+	require.NoError(t, vfs.Rename("dir/file2", "dir/file3"))
+	assert.Equal(t, []string{"file1", "file3"}, dirCacheNames(t, vfs, "dir"))
+
+	// the change forgot the listing so the next run reads it
+	vfs.Shutdown()
+	vfs = newDirCacheTestVFS(t, r)
+	assert.Equal(t, []string{"file3"}, dirCacheNames(t, vfs, "dir"))
+
+	// a change notification forgets the listing too
+	r.WriteObject("dir/file4", "file4", t1)
+	vfs.root.ForgetPath("dir/file4", fs.EntryObject)
+	_, _, ok := vfs.dirCache.get("dir")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"file3", "file4"}, dirCacheNames(t, vfs, "dir"))
+	_, _, ok = vfs.dirCache.get("dir")
+	assert.True(t, ok)
+
+	// even if the directory hasn't been read in this run
+	vfs.Shutdown()
+	vfs = newDirCacheTestVFS(t, r)
+	vfs.root.ForgetPath("dir", fs.EntryDirectory)
+	for _, dir := range []string{"", "dir"} {
+		_, _, ok = vfs.dirCache.get(dir)
+		assert.False(t, ok, dir)
+	}
+}
+
+func TestDirCachePersistStale(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	r.WriteObject("file1", "file1", t1)
+
+	vfs := newDirCacheTestVFS(t, r)
+	defer removeDirCache(t, vfs)
+	assert.Equal(t, []string{"file1"}, dirCacheNames(t, vfs, ""))
+	vfs.Shutdown()
+	r.WriteObject("file2", "file2", t1)
+
+	// listings older than the dir cache time are used but read
+	// again in the background
+	opt := DefaultOpt
+	opt.DirCachePersist = true
+	opt.DirCacheTime = time.Nanosecond
+	vfs = New(r.Fremote, &opt)
+	assert.Equal(t, []string{"file1"}, dirCacheNames(t, vfs, ""))
+	waitForRefresh(t, vfs.root)
+	entries, _, ok := vfs.dirCache.get("")
+	require.True(t, ok)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, []string{"file1", "file2"}, dirCacheNames(t, vfs, ""))
+
+	// and so are those forced with ReadDir
+	vfs.Shutdown()
+	r.WriteObject("file3", "file3", t1)
+	vfs = newDirCacheTestVFS(t, r)
+	assert.Equal(t, []string{"file1", "file2"}, dirCacheNames(t, vfs, ""))
+	require.NoError(t, vfs.root.ReadDir())
+	assert.Equal(t, []string{"file1", "file2", "file3"}, dirCacheNames(t, vfs, ""))
+
+	// removed directories don't come back from the disk
+	_, err := vfs.root.Mkdir("dir")
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(dirCacheNames(t, vfs, "dir")))
+	_, _, ok = vfs.dirCache.get("dir")
+	assert.True(t, ok)
+	node, err := vfs.Stat("dir")
+	require.NoError(t, err)
+	require.NoError(t, node.Remove())
+	_, _, ok = vfs.dirCache.get("dir")
+	assert.False(t, ok)
+}
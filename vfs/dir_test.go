@@ -525,3 +525,75 @@ func TestDirRename(t *testing.T) {
 	err = dir.Rename("potato", "tuba", dir)
 	assert.Equal(t, EROFS, err)
 }
+
+func TestDirCaseInsensitive(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	r.WriteObject("Dir/file1", "file1", t1)
+	r.WriteObject("Dir/FILE2", "FILE2", t1)
+	r.WriteObject("Dir/File2", "File2", t1)
+
+	// exact matches only by default
+	vfs := New(r.Fremote, nil)
+	_, err := vfs.Stat("dir/file1")
+	assert.Equal(t, ENOENT, err)
+
+	opt := DefaultOpt
+	opt.CaseInsensitive = true
+	vfs = New(r.Fremote, &opt)
+	for _, test := range []struct {
+		in   string
+		want string
+	}{
+		{"Dir/file1", "Dir/file1"},
+		{"dir/FILE1", "Dir/file1"},
+		{"DIR/File2", "Dir/File2"},
+		{"dir/file2", "Dir/FILE2"}, // first in sort order
+		{"dir/FiLe2", "Dir/FILE2"},
+	} {
+		node, err := vfs.Stat(test.in)
+		require.NoError(t, err, test.in)
+		assert.Equal(t, test.want, node.Path(), test.in)
+	}
+	_, err = vfs.Stat("dir/file3")
+	assert.Equal(t, ENOENT, err)
+
+	// writing to another case writes the existing file
+	fd, err := vfs.OpenFile("DIR/FILE1", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	require.NoError(t, err)
+	_, err = fd.Write([]byte("potato"))
+	require.NoError(t, err)
+	require.NoError(t, fd.Close())
+
+	// as does making a directory
+	root, err := vfs.Root()
+	require.NoError(t, err)
+	dir, err := root.Mkdir("DIR")
+	require.NoError(t, err)
+	assert.Equal(t, "Dir", dir.Path())
+
+	// renaming onto another case replaces the existing file
+	require.NoError(t, vfs.Rename("dir/File2", "dir/FILE1"))
+	// and changing the case of a name renames it
+	require.NoError(t, vfs.Rename("dir/FILE2", "dir/file2"))
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{
+		fstest.NewItem("Dir/file1", "File2", t1),
+		fstest.NewItem("Dir/file2", "FILE2", t1),
+	}, []string{"Dir"}, fs.ModTimeNotSupported)
+
+	// the names ignoring case follow the renames
+	for _, test := range []struct {
+		in   string
+		want string
+	}{
+		{"dir/FILE1", "Dir/file1"},
+		{"dir/FILE2", "Dir/file2"},
+	} {
+		node, err := vfs.Stat(test.in)
+		require.NoError(t, err, test.in)
+		assert.Equal(t, test.want, node.Path(), test.in)
+	}
+	node, err := vfs.Stat("Dir")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"file1": {"file1"}, "file2": {"file2"}}, node.(*Dir).lower)
+}
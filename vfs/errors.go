@@ -20,6 +20,8 @@ const (
 	EBADF
 	EROFS
 	ENOSYS
+	ELOCKED
+	ENOATTR
 )
 
 // Errors which have exact counterparts in os
@@ -38,6 +40,8 @@ var errorNames = []string{
 	EBADF:     "Bad file descriptor",
 	EROFS:     "Read only file system",
 	ENOSYS:    "Function not implemented",
+	ELOCKED:   "Resource is locked",
+	ENOATTR:   "No such attribute",
 }
 
 // Error renders the error as a string
@@ -19,6 +19,8 @@ type File struct {
 	size  int64  // size of file - read and written with atomic int64 - must be 64 bit aligned
 	d     *Dir   // parent directory - read only
 
+	virtual bool // set if this is a read only file made by the VFS - read only
+
 	mu                sync.Mutex   // protects the following
 	o                 fs.Object    // NB o may be nil if file is being written
 	leaf              string       // leaf name of the object
@@ -30,6 +32,11 @@ type File struct {
 	modified          bool         // has the cache file be modified by a RWFileHandle?
 	pendingModTime    time.Time    // will be applied once o becomes available, i.e. after file was written
 	pendingRenameFun  func() error // will be run/renamed after all writers close
+	pendingUpload     bool         // set if the cache file is queued for upload
+	cacheModTime      time.Time    // modification time of the cache file waiting for upload
+	sparse            *sparseFile  // cache file state shared by open RWFileHandles - protected by muRW
+
+	attrs attrCache // permissions, owner and extended attributes
 
 	muRW sync.Mutex // synchonize RWFileHandle.openPending(), RWFileHandle.close() and File.Remove
 }
@@ -44,6 +51,14 @@ func newFile(d *Dir, o fs.Object, leaf string) *File {
 	}
 }
 
+// newVirtualFile creates a read only File made by the VFS whose
+// contents are in o
+func newVirtualFile(d *Dir, o fs.Object, leaf string) *File {
+	f := newFile(d, o, leaf)
+	f.virtual = true
+	return f
+}
+
 // String converts it to printable
 func (f *File) String() string {
 	if f == nil {
@@ -64,7 +79,10 @@ func (f *File) IsDir() bool {
 
 // Mode bits of the file or directory - satisfies Node interface
 func (f *File) Mode() (mode os.FileMode) {
-	return f.d.vfs.Opt.FilePerms
+	if f.virtual {
+		return f.d.vfs.Opt.FilePerms &^ 0222
+	}
+	return f.d.vfs.nodeMode(&f.attrs, f.Path(), f.d.vfs.Opt.FilePerms)
 }
 
 // Name (base) of the directory - satisfies Node interface
@@ -109,6 +127,9 @@ func (f *File) applyPendingRename() {
 // Otherwise it will queue the rename operation on the remote until no writers
 // remain.
 func (f *File) rename(destDir *Dir, newName string) error {
+	if f.virtual {
+		return EROFS
+	}
 	if features := f.d.f.Features(); features.Move == nil && features.Copy == nil {
 		err := errors.Errorf("Fs %q can't rename files (no server side Move or Copy)", f.d.f)
 		fs.Errorf(f.Path(), "Dir.Rename error: %v", err)
@@ -118,7 +139,13 @@ func (f *File) rename(destDir *Dir, newName string) error {
 	renameCall := func() error {
 		newPath := path.Join(destDir.path, newName)
 		dstOverwritten, _ := f.d.f.NewObject(newPath)
-		newObject, err := operations.Move(f.d.f, dstOverwritten, newPath, f.o)
+		// the backend needs its own object to do a server side move
+		srcObject, err := realObject(f.o)
+		if err != nil {
+			fs.Errorf(f.Path(), "File.Rename error: %v", err)
+			return err
+		}
+		newObject, err := operations.Move(f.d.f, dstOverwritten, newPath, srcObject)
 		if err != nil {
 			fs.Errorf(f.Path(), "File.Rename error: %v", err)
 			return err
@@ -143,11 +170,17 @@ func (f *File) rename(destDir *Dir, newName string) error {
 
 	if f.writingInProgress() {
 		fs.Debugf(f.o, "File is currently open, delaying rename %p", f)
+		oldPath := f.Path()
 		f.mu.Lock()
 		f.d = destDir
 		f.leaf = newName
 		f.pendingRenameFun = renameCall
 		f.mu.Unlock()
+		// save the rename with the upload so it isn't lost if
+		// rclone stops before the file is uploaded
+		if wb := f.d.vfs.writeBack; wb != nil {
+			wb.rename(oldPath, f.Path())
+		}
 		return nil
 	}
 
@@ -230,6 +263,40 @@ func (f *File) finishWriterClose() {
 	f.applyPendingRename()
 }
 
+// setPendingUpload marks the file as waiting for the cache file,
+// last modified at modTime, to be uploaded
+func (f *File) setPendingUpload(modTime time.Time) {
+	f.mu.Lock()
+	f.pendingUpload = true
+	f.cacheModTime = modTime
+	f.mu.Unlock()
+}
+
+// finishUpload is called when the cache file has been uploaded and the
+// object set
+func (f *File) finishUpload() {
+	f.mu.Lock()
+	f.pendingUpload = false
+	f.mu.Unlock()
+	f.applyPendingRename()
+}
+
+// uploadPending returns true if the cache file is waiting to be
+// uploaded
+func (f *File) uploadPending() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pendingUpload
+}
+
+// setModified marks the cache file as modified so it is uploaded
+// when the last writer closes
+func (f *File) setModified() {
+	f.mu.Lock()
+	f.modified = true
+	f.mu.Unlock()
+}
+
 // activeWriters returns the number of writers on the file
 //
 // Note that we don't take the mutex here.  If we do then we can get a
@@ -247,10 +314,13 @@ func (f *File) ModTime() (modTime time.Time) {
 
 	if !f.d.vfs.Opt.NoModTime {
 		// if o is nil it isn't valid yet or there are writers, so return the size so far
-		if f.o == nil || len(f.writers) != 0 || f.readWriterClosing {
+		if f.writingInProgress() {
 			if !f.pendingModTime.IsZero() {
 				return f.pendingModTime
 			}
+			if f.pendingUpload {
+				return f.cacheModTime
+			}
 		} else {
 			return f.o.ModTime()
 		}
@@ -281,9 +351,12 @@ func (f *File) Size() int64 {
 
 // SetModTime sets the modtime for the file
 func (f *File) SetModTime(modTime time.Time) error {
-	if f.d.vfs.Opt.ReadOnly {
+	if f.d.vfs.Opt.ReadOnly || f.virtual {
 		return EROFS
 	}
+	if err := f.d.vfs.checkLock(f.Path()); err != nil {
+		return err
+	}
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
@@ -298,6 +371,61 @@ func (f *File) SetModTime(modTime time.Time) error {
 	return nil
 }
 
+// uploading returns true if the file hasn't been uploaded yet so its
+// attributes can't be set on the remote
+func (f *File) uploading() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.writingInProgress()
+}
+
+// Chmod sets the permissions of the file
+func (f *File) Chmod(mode os.FileMode) error {
+	if f.virtual {
+		return EROFS
+	}
+	return f.d.vfs.chmod(&f.attrs, f.Path(), f.uploading(), mode)
+}
+
+// Chown sets the owner of the file
+func (f *File) Chown(uid, gid uint32) error {
+	if f.virtual {
+		return EROFS
+	}
+	return f.d.vfs.chown(&f.attrs, f.Path(), f.uploading(), uid, gid)
+}
+
+// Owner returns the owner of the file
+func (f *File) Owner() (uid, gid uint32) {
+	return f.d.vfs.nodeOwner(&f.attrs, f.Path())
+}
+
+// Getxattr returns the value of the extended attribute name
+func (f *File) Getxattr(name string) ([]byte, error) {
+	return f.d.vfs.getxattr(&f.attrs, f.Path(), name)
+}
+
+// Setxattr sets the extended attribute name to value
+func (f *File) Setxattr(name string, value []byte, flags int) error {
+	if f.virtual {
+		return EROFS
+	}
+	return f.d.vfs.setxattr(&f.attrs, f.Path(), f.uploading(), name, value, flags)
+}
+
+// Listxattr returns the names of the extended attributes
+func (f *File) Listxattr() ([]string, error) {
+	return f.d.vfs.listxattr(&f.attrs, f.Path())
+}
+
+// Removexattr removes the extended attribute name
+func (f *File) Removexattr(name string) error {
+	if f.virtual {
+		return EROFS
+	}
+	return f.d.vfs.removexattr(&f.attrs, f.Path(), f.uploading(), name)
+}
+
 // call with the mutex held
 func (f *File) applyPendingModTime() error {
 	defer func() { f.pendingModTime = time.Time{} }()
@@ -324,9 +452,10 @@ func (f *File) applyPendingModTime() error {
 	return nil
 }
 
-// writingInProgress returns true of there are any open writers
+// writingInProgress returns true of there are any open writers or
+// the cache file is waiting to be uploaded
 func (f *File) writingInProgress() bool {
-	return f.o == nil || len(f.writers) != 0 || f.readWriterClosing
+	return f.o == nil || len(f.writers) != 0 || f.readWriterClosing || f.pendingUpload
 }
 
 // Update the size while writing
@@ -340,6 +469,9 @@ func (f *File) setObject(o fs.Object) {
 	f.o = o
 	_ = f.applyPendingModTime()
 	f.mu.Unlock()
+	if o != nil {
+		f.attrs.apply(f.d.vfs.attrs, o.Remote())
+	}
 
 	f.d.addObject(f)
 }
@@ -348,8 +480,10 @@ func (f *File) setObject(o fs.Object) {
 // the directory cache
 func (f *File) setObjectNoUpdate(o fs.Object) {
 	f.mu.Lock()
-	defer f.mu.Unlock()
 	f.o = o
+	f.mu.Unlock()
+	// the attributes may have been changed on the remote
+	f.attrs.forget()
 }
 
 // Get the current fs.Object - may be nil
@@ -410,6 +544,9 @@ func (f *File) openWrite(flags int) (fh *WriteFileHandle, err error) {
 	if f.d.vfs.Opt.ReadOnly {
 		return nil, EROFS
 	}
+	if err := f.d.vfs.checkLock(f.Path()); err != nil {
+		return nil, err
+	}
 	// fs.Debugf(o, "File.openWrite")
 
 	fh, err = newWriteFileHandle(f.d, f, f.Path(), flags)
@@ -425,8 +562,13 @@ func (f *File) openWrite(flags int) (fh *WriteFileHandle, err error) {
 // It uses the open flags passed in.
 func (f *File) openRW(flags int) (fh *RWFileHandle, err error) {
 	// FIXME chunked
-	if flags&accessModeMask != os.O_RDONLY && f.d.vfs.Opt.ReadOnly {
-		return nil, EROFS
+	if flags&accessModeMask != os.O_RDONLY {
+		if f.d.vfs.Opt.ReadOnly {
+			return nil, EROFS
+		}
+		if err := f.d.vfs.checkLock(f.Path()); err != nil {
+			return nil, err
+		}
 	}
 	// fs.Debugf(o, "File.openRW")
 
@@ -447,9 +589,16 @@ func (f *File) Sync() error {
 
 // Remove the file
 func (f *File) Remove() error {
-	if f.d.vfs.Opt.ReadOnly {
+	if f.d.vfs.Opt.ReadOnly || f.virtual {
 		return EROFS
 	}
+	if err := f.d.vfs.checkLock(f.Path()); err != nil {
+		return err
+	}
+	// Stop any queued upload, waiting for it if it has started
+	if wb := f.d.vfs.writeBack; wb != nil {
+		wb.cancel(f.Path())
+	}
 	f.muRW.Lock() // muRW must be locked before mu to avoid
 	f.mu.Lock()   // deadlock in RWFileHandle.openPending and .close
 	if f.o != nil {
@@ -461,11 +610,13 @@ func (f *File) Remove() error {
 			return err
 		}
 	}
+	f.pendingUpload = false
 	f.mu.Unlock()
 	f.muRW.Unlock()
 
 	// Remove the item from the directory listing
 	f.d.delObject(f.Name())
+	f.d.vfs.attrs.remove(f.Path())
 	// Remove the object from the cache
 	if f.d.vfs.Opt.CacheMode >= CacheModeMinimal {
 		f.d.vfs.cache.remove(f.Path())
@@ -535,8 +686,11 @@ func (f *File) Open(flags int) (fd Handle, err error) {
 		return nil, EPERM
 	}
 
-	// If append is set then set read to force openRW
-	if flags&os.O_APPEND != 0 {
+	// If append is set then set read to force openRW unless
+	// appending write only files without the cache is allowed
+	CacheMode := f.d.vfs.Opt.CacheMode
+	appendWrite := rdwrMode == os.O_WRONLY && f.d.vfs.Opt.WriteAppend && CacheMode < CacheModeWrites
+	if flags&os.O_APPEND != 0 && !appendWrite {
 		read = true
 	}
 
@@ -547,8 +701,15 @@ func (f *File) Open(flags int) (fd Handle, err error) {
 
 	// FIXME discover if file is in cache or not?
 
+	// Files made by the VFS are read only and never cached
+	if f.virtual {
+		if write {
+			return nil, EROFS
+		}
+		return f.openRead()
+	}
+
 	// Open the correct sort of handle
-	CacheMode := f.d.vfs.Opt.CacheMode
 	if CacheMode >= CacheModeMinimal && f.d.vfs.cache.opens(f.Path()) > 0 {
 		fd, err = f.openRW(flags)
 	} else if read && write {
@@ -27,6 +27,115 @@ Or individual files or directories:
 
     rclone rc vfs/forget file=path/to/file dir=path/to/dir
 
+### Persistent Directory Cache
+
+If you use the ` + "`--vfs-dir-cache-persist`" + ` flag then rclone will
+keep the directory listings it reads in a database in the
+` + "`--cache-dir`" + `.  When rclone is restarted it will use these
+listings instead of reading the directories from the remote again.
+Listings older than ` + "`--dir-cache-time`" + ` are still used, but are
+read again from the remote in the background.  This makes large
+remotes browsable straight away after a restart.
+
+Listings are removed from the database when they are changed in the
+mount, when the remote says they have changed if it supports polling
+for changes (see ` + "`--poll-interval`" + `) and when ` + "`vfs/forget`" + ` is
+used.  Listings are added to it whenever directories are read, and
+` + "`rclone rc vfs/refresh recursive=true`" + ` is a quick way of filling
+it on remotes which can list recursively.
+
+Note that changes made on the remote while rclone isn't running
+won't be seen until the listings have been read again.
+
+    --vfs-dir-cache-persist              Keep directory listings on disk so they can be used after a restart.
+
+### Case Insensitivity
+
+Most remotes are case sensitive, so ` + "`file.txt`" + ` and ` + "`FILE.TXT`" + `
+are different files, but Windows programs and Samba shares of the
+mount expect to find files whatever case is used to look them up.
+
+If you use the ` + "`--vfs-case-insensitive`" + ` flag then when a name
+isn't found exactly rclone will look for one which matches it
+ignoring case and use that instead, whether the remote is case
+sensitive or not.  If more than one name matches, eg ` + "`File.txt`" + `
+and ` + "`file.txt`" + `, then the first in sort order is used, so that
+is always the same one.  An exact match is always used if there is
+one.
+
+Creating or renaming a file to a name which matches an existing one
+ignoring case replaces the existing file rather than making another
+beside it, except when only the case of a file's own name is being
+changed.
+
+    --vfs-case-insensitive               If a file name isn't found, find a case insensitive match.
+
+### Metadata Sidecar Files
+
+If you use the ` + "`--vfs-meta-files`" + ` flag then rclone shows extra
+read only files with the metadata of the remote, so programs which
+can only see the mount can use it without running rclone.
+
+For each file rclone shows a file for each hash the remote supports,
+eg ` + "`file.txt.md5`" + ` and ` + "`file.txt.sha1`" + `.  These are in the
+format used by ` + "`md5sum`" + ` and friends so can be checked with
+` + "`md5sum -c file.txt.md5`" + `.  The extensions are ` + "`md5`" + `,
+` + "`sha1`" + `, ` + "`dropbox`" + ` and ` + "`quickxor`" + `.
+
+Each directory also has a ` + "`.rclone-meta.json`" + ` file listing the
+name, size, modification time, hashes and ID (if the remote has them)
+of the files and directories in it.  If ` + "`--vfs-meta-public-links`" + `
+is set and the remote supports it, public links are made for each of
+them and listed too.  Note that this creates the links on the remote
+when the file is read.
+
+The contents are made the first time they are read, not when they are
+listed, and are refreshed when the directory is, so reading them may
+be slow on remotes which have to calculate the hashes, eg the local
+backend.  As their sizes are needed before then they are padded with
+spaces at the end if a hash isn't known or a public link is shorter
+than the longest allowed (512 characters - longer ones are left
+out).  The files can't be
+written, removed or renamed and a file on the remote with the same name
+as one of them is shown instead.
+
+    --vfs-meta-files                     Show read only sidecar files with the hashes and metadata of the files.
+    --vfs-meta-public-links              Make public links for the files listed in the metadata sidecar files.
+
+### Permissions and Extended Attributes
+
+Normally every file has the permissions from ` + "`--file-perms`" + `, every
+directory has those from ` + "`--dir-perms`" + ` and everything is owned
+by ` + "`--uid`" + ` and ` + "`--gid`" + `.  Changes made with ` + "`chmod`" + ` and
+` + "`chown`" + ` are ignored and extended attributes aren't supported,
+which upsets programs such as ` + "`rsync`" + ` and ` + "`git`" + ` which
+expect the changes to stick.
+
+If you use the ` + "`--vfs-attr-persist`" + ` flag then the permissions,
+owner and extended attributes set on files and directories are stored
+and shown instead of the defaults.
+
+If the remote can store these then they are set on the files and
+directories themselves, so they are seen by other users of the remote
+too.  Only the local backend on Linux can do this at the moment.  Note
+that this shows the permissions and owners the files really have
+rather than the defaults, and changing the owner usually needs rclone
+to be run as root.  Attributes set on a file which is still being
+written, or is waiting to be uploaded, are set on the remote once it
+has been uploaded.
+
+Otherwise they are kept in a database in the cache directory and are
+only seen through rclone, not by other users of the remote.  They
+follow the files when they are renamed and are removed with them, but
+changes made on the remote without rclone aren't noticed, so a file
+replaced there keeps the attributes of the old one.
+
+Note that only the permission bits are stored, not the setuid, setgid
+or sticky bits, and that rclone doesn't check the permissions itself -
+use ` + "`--default-permissions`" + ` if you want the kernel to do that.
+
+    --vfs-attr-persist                   Store the mode, owner and extended attributes set on files and directories.
+
 ### File Buffering
 
 The ` + "`--buffer-size`" + ` flag determines the amount of memory,
@@ -44,6 +153,46 @@ will be used.
 The maximum memory used by rclone for buffering can be up to
 ` + "`--buffer-size * open files`" + `.
 
+When the cache mode is off or minimal, ` + "`--vfs-read-ahead`" + ` is added
+to ` + "`--buffer-size`" + ` to make a larger read ahead window.  Files are
+read in chunks (see ` + "`--vfs-read-chunk-size`" + `) and the next chunk
+is opened in the background when the read ahead gets within a window
+of the end of the current one, which stops reads stuttering at the
+chunk boundaries on remotes which are slow to open files.
+
+Each open file descriptor can read from up to 4 places in the file at
+once, each with its own buffer.  When reading comes back to where it
+was left by a seek another reader is started there, so programs such
+as media players which read several streams from different parts of a
+file don't make rclone seek back and forth between them.  This means
+the buffers can use up to 4 times the memory above.
+
+### Writing Without the Cache
+
+When the cache mode is off or minimal, files opened for write only are
+streamed straight to the remote so they must be written in order.
+
+If ` + "`--vfs-write-buffer`" + ` is set then writes which arrive ahead
+of the current position, as they do when the kernel or a program
+writes blocks out of order, are kept in memory until the data before
+them has been written.  Up to this much memory is used per open file
+and a write which would need more, or which goes back before data
+already sent, fails with ` + "`ESPIPE`" + `.  Any gaps left when the
+file is closed are filled with zeros.
+
+If ` + "`--vfs-write-append`" + ` is set then existing files opened
+write only with ` + "`O_APPEND`" + ` (and not ` + "`O_TRUNC`" + `) are
+appended to rather than replaced.  The new data is uploaded to a
+temporary object called ` + "`name.XXXXXXXX.rclone-append`" + ` next to the
+file.  On remotes which can join objects on the server, such as Google
+Cloud Storage and S3, this is then composed with the existing file
+without downloading it.  Otherwise the existing file is streamed
+through rclone followed by the new data into the temporary object,
+which is then moved over the file.  The temporary objects may be seen
+in listings while this is happening.  Note that S3 can only join
+objects where all but the last are at least 5MB, so smaller files are
+copied through rclone.
+
 ### File Caching
 
 These flags control the VFS file caching options.  The VFS layer is
@@ -61,6 +210,12 @@ may find that you need one or the other or both.
     --vfs-cache-mode string              Cache mode off|minimal|writes|full (default "off")
     --vfs-cache-poll-interval duration   Interval to poll the cache for stale objects. (default 1m0s)
     --vfs-cache-max-size int             Max total size of objects in the cache. (default off)
+    --vfs-cache-min-free-space int       Remove files from the cache to keep at least this much free space on its disk. (default off)
+    --vfs-cache-eviction string          Which files to remove from the cache first lru|lfu|size (default "lru")
+    --vfs-read-ahead int                 Extra read ahead over --buffer-size.
+    --vfs-write-append                   Allow appending to existing files without the cache.
+    --vfs-write-back duration            Time to wait after closing a file before uploading it. 0 uploads it before the close returns.
+    --vfs-write-buffer int               Max out of order writes to buffer in memory per file handle when not using the cache.
 
 If run with ` + "`-vv`" + ` rclone will print the location of the file cache.  The
 files are stored in the user cache file area which is OS dependent but
@@ -74,12 +229,53 @@ cost of using disk space.
 Note that files are written back to the remote only when they are
 closed so if rclone is quit or dies with open files then these won't
 get written back to the remote.  However they will still be in the on
-disk cache.
+disk cache and will be uploaded the next time rclone runs with the
+same remote and cache directory.  Changes written after the file was
+last opened may be incomplete in this case.
+
+Each file in the cache has a metadata file which records the
+fingerprint (size and modification time, or hash if the remote doesn't
+support modification times) of the remote object it is a copy of,
+whether it has changes which haven't been uploaded and when it was
+last used.  When rclone restarts the cached files are reused if their
+fingerprint still matches the remote object, and fetched again if it
+doesn't.  Files with changes which haven't been uploaded are never
+removed from the cache until they are uploaded.
+
+Normally a file is uploaded before the close returns, so an
+application closing a large file waits for the upload.  If
+--vfs-write-back is set to a duration then the close returns straight
+away and the file is queued for upload after that delay.  If the file
+is opened for writing again before then the upload is put off until
+it is closed again.  If it is being uploaded then the upload carries
+on and the file is uploaded again once it is closed.  Failed uploads are retried with the delay
+doubling each time up to 5 minutes.  The queue is kept on disk so
+uploads which haven't finished when rclone stops are done when it next
+runs with the same remote and cache directory.  Use ` + "`rclone rc vfs/queue`" + `
+to see the files waiting to be uploaded.
 
 If using --vfs-cache-max-size note that the cache may exceed this size
-for two reasons.  Firstly because it is only checked every
---vfs-cache-poll-interval.  Secondly because open files cannot be
-evicted from the cache.
+because open files cannot be evicted from the cache.  The size is
+checked every --vfs-cache-poll-interval and also as files in the cache
+grow, so files are evicted straight away when writing or downloading
+takes the cache over quota.
+
+If --vfs-cache-min-free-space is set then files are also evicted to
+keep at least that much space free on the disk the cache is on, so
+other things using the disk don't fill it up.  This is checked at the
+same times as --vfs-cache-max-size.
+
+--vfs-cache-eviction chooses which files are evicted first
+
+  * lru - the least recently used files (the default)
+  * lfu - the least frequently used files, counting the opens since rclone started, then the least recently used
+  * size - the files with the largest size multiplied by the time since they were used
+
+Files can be pinned with ` + "`rclone rc vfs/pin file=path`" + ` which stops
+them being evicted for any reason until they are unpinned with
+` + "`rclone rc vfs/unpin file=path`" + `.  Pins are remembered between
+runs.  Note that pinned files and open files can make the cache
+exceed its limits.
 
 #### --vfs-cache-mode off
 
@@ -89,11 +285,11 @@ directly to the remote without caching anything on disk.
 This will mean some operations are not possible
 
   * Files can't be opened for both read AND write
-  * Files opened for write can't be seeked
+  * Files opened for write can't be seeked (but see ` + "`--vfs-write-buffer`" + `)
   * Existing files opened for write must have O_TRUNC set
   * Files open for read with O_TRUNC will be opened write only
   * Files open for write only will behave as if O_TRUNC was supplied
-  * Open modes O_APPEND, O_TRUNC are ignored
+  * Open modes O_APPEND, O_TRUNC are ignored (but see ` + "`--vfs-write-append`" + `)
   * If an upload fails it can't be retried
 
 #### --vfs-cache-mode minimal
@@ -122,7 +318,15 @@ If an upload fails it will be retried up to --low-level-retries times.
 #### --vfs-cache-mode full
 
 In this mode all reads and writes are buffered to and from disk.  When
-a file is opened for read it will be downloaded in its entirety first.
+data is read from the remote it is stored in a sparse file in the
+cache, so only the parts of the file which are read are downloaded.
+Reads wait only for the data they need, and the downloader reads
+--buffer-size plus --vfs-read-ahead bytes ahead of them.  Which parts
+of the file are present is remembered between runs, so those parts
+don't need downloading again if the file hasn't changed on the remote.
+
+If a file is changed then the parts which haven't been read are
+downloaded before it is uploaded.
 
 This may be appropriate for your needs, or you may prefer to look at
 the cache backend which does a much more sophisticated job of caching,
@@ -0,0 +1,357 @@
+// This makes the read only sidecar files showing the metadata of the
+// objects in a directory
+
+package vfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/fs/object"
+)
+
+// metaDirName is the name of the sidecar file describing the
+// directory it is in
+const metaDirName = ".rclone-meta.json"
+
+// metaHashExtensions are the extensions of the sidecar files holding
+// the hashes of each object
+var metaHashExtensions = map[hash.Type]string{
+	hash.MD5:          "md5",
+	hash.SHA1:         "sha1",
+	hash.Dropbox:      "dropbox",
+	hash.QuickXorHash: "quickxor",
+}
+
+// metaMaxPublicLink is the longest public link which is listed in
+// the directory sidecar
+const metaMaxPublicLink = 512
+
+// metaObject is a read only object whose contents are made the first
+// time they are read.
+//
+// Its size is known before then so the contents are padded with
+// spaces before the final newline if they are shorter.
+type metaObject struct {
+	remote  string
+	modTime time.Time
+	size    int64
+	fn      func() []byte // makes the contents
+	once    sync.Once
+	data    []byte
+}
+
+// Check interfaces
+var _ fs.Object = (*metaObject)(nil)
+
+// newMetaObject makes a metaObject at remote of size bytes with
+// contents from fn
+func newMetaObject(remote string, modTime time.Time, size int64, fn func() []byte) *metaObject {
+	return &metaObject{
+		remote:  remote,
+		modTime: modTime,
+		size:    size,
+		fn:      fn,
+	}
+}
+
+// contents returns the contents making them if necessary
+func (o *metaObject) contents() []byte {
+	o.once.Do(func() {
+		data := o.fn()
+		if int64(len(data)) > o.size {
+			fs.Errorf(o, "Metadata is %d bytes longer than expected - truncating", int64(len(data))-o.size)
+			data = data[:o.size]
+		}
+		if int64(len(data)) < o.size {
+			data = bytes.TrimSuffix(data, []byte{'\n'})
+			data = append(data, bytes.Repeat([]byte{' '}, int(o.size)-len(data)-1)...)
+			data = append(data, '\n')
+		}
+		o.data = data
+	})
+	return o.data
+}
+
+// Fs returns the Fs the object is in
+func (o *metaObject) Fs() fs.Info {
+	return object.MemoryFs
+}
+
+// String returns a description of the Object
+func (o *metaObject) String() string {
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *metaObject) Remote() string {
+	return o.remote
+}
+
+// ModTime returns the modification time
+func (o *metaObject) ModTime() time.Time {
+	return o.modTime
+}
+
+// Size returns the size of the contents
+func (o *metaObject) Size() int64 {
+	return o.size
+}
+
+// Storable says whether this object can be stored
+func (o *metaObject) Storable() bool {
+	return false
+}
+
+// Hash returns the requested hash of the contents
+func (o *metaObject) Hash(ht hash.Type) (string, error) {
+	hasher, err := hash.NewMultiHasherTypes(hash.NewHashSet(ht))
+	if err != nil {
+		return "", err
+	}
+	_, err = hasher.Write(o.contents())
+	if err != nil {
+		return "", err
+	}
+	return hasher.Sums()[ht], nil
+}
+
+// SetModTime is not supported
+func (o *metaObject) SetModTime(time.Time) error {
+	return EROFS
+}
+
+// Open opens the contents for reading
+func (o *metaObject) Open(options ...fs.OpenOption) (io.ReadCloser, error) {
+	data := o.contents()
+	size := int64(len(data))
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(size)
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	if offset > size {
+		offset = size
+	}
+	data = data[offset:]
+	if limit >= 0 && limit < int64(len(data)) {
+		data = data[:limit]
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Update is not supported
+func (o *metaObject) Update(in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	return EROFS
+}
+
+// Remove is not supported
+func (o *metaObject) Remove() error {
+	return EROFS
+}
+
+// metaHash returns the ht hash of o for the sidecars or "" if it
+// isn't known
+func metaHash(o fs.Object, ht hash.Type) string {
+	sum, err := o.Hash(ht)
+	if err != nil {
+		fs.Debugf(o, "Failed to read %v for metadata: %v", ht, err)
+		return ""
+	}
+	if len(sum) != hash.Width[ht] {
+		return ""
+	}
+	return sum
+}
+
+// metaHashSidecarSize returns the size of the sidecar for the ht hash
+// of the file called name
+func metaHashSidecarSize(name string, ht hash.Type) int64 {
+	return int64(hash.Width[ht] + len("  ") + len(name) + len("\n"))
+}
+
+// metaHashSidecar returns the contents of the sidecar for the ht hash
+// of file called name in the format used by md5sum and friends, or
+// nothing if the hash isn't known
+func metaHashSidecar(file *File, name string, ht hash.Type) []byte {
+	o := file.getObject()
+	if o == nil {
+		return nil
+	}
+	sum := metaHash(o, ht)
+	if sum == "" {
+		return nil
+	}
+	return []byte(fmt.Sprintf("%s  %s\n", sum, name))
+}
+
+// metaItem describes an object or directory in a directory sidecar
+type metaItem struct {
+	Name       string
+	Size       int64
+	ModTime    time.Time
+	IsDir      bool
+	Hashes     map[string]string `json:",omitempty"`
+	ID         string            `json:",omitempty"`
+	PublicLink string            `json:",omitempty"`
+}
+
+// metaDirItems returns the parts of the directory sidecar for nodes
+// which can be read without calling the remote, and the entries to
+// read the rest from
+func metaDirItems(nodes []Node) (items []metaItem, entries []fs.DirEntry) {
+	items = make([]metaItem, 0, len(nodes))
+	entries = make([]fs.DirEntry, 0, len(nodes))
+	for _, node := range nodes {
+		item := metaItem{
+			Name:    node.Name(),
+			Size:    node.Size(),
+			ModTime: node.ModTime(),
+			IsDir:   node.IsDir(),
+		}
+		entry := node.DirEntry()
+		if o, ok := entry.(fs.Object); ok {
+			if real, err := realObject(o); err == nil {
+				entry = real
+			}
+		}
+		if do, ok := entry.(fs.IDer); ok {
+			item.ID = do.ID()
+		}
+		items = append(items, item)
+		entries = append(entries, entry)
+	}
+	return items, entries
+}
+
+// metaDirSidecar returns the contents of the sidecar describing items
+// adding the hashes and public links read from entries.  If maxSize
+// is set the longest possible contents are returned instead.
+func (d *Dir) metaDirSidecar(items []metaItem, entries []fs.DirEntry, maxSize bool) []byte {
+	items = append([]metaItem(nil), items...)
+	publicLink := d.f.Features().PublicLink
+	for i := range items {
+		item := &items[i]
+		entry := entries[i]
+		if o, ok := entry.(fs.Object); ok {
+			for _, ht := range d.f.Hashes().Array() {
+				var sum string
+				if maxSize {
+					sum = strings.Repeat("0", hash.Width[ht])
+				} else {
+					sum = metaHash(o, ht)
+				}
+				if sum != "" {
+					if item.Hashes == nil {
+						item.Hashes = make(map[string]string)
+					}
+					item.Hashes[ht.String()] = sum
+				}
+			}
+		}
+		if publicLink != nil && d.vfs.Opt.MetaPublicLinks && entry != nil {
+			if maxSize {
+				item.PublicLink = strings.Repeat("x", metaMaxPublicLink)
+			} else if link, err := publicLink(entry.Remote()); err != nil {
+				fs.Debugf(entry, "Failed to make public link for metadata: %v", err)
+			} else if quoted, _ := json.Marshal(link); len(quoted)-2 > metaMaxPublicLink {
+				fs.Debugf(entry, "Public link for metadata is too long: %q", link)
+			} else {
+				item.PublicLink = link
+			}
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Name < items[j].Name
+	})
+	data, err := json.MarshalIndent(items, "", "\t")
+	if err != nil {
+		fs.Errorf(d, "Failed to make metadata: %v", err)
+		return nil
+	}
+	return append(data, '\n')
+}
+
+// isMetaFile returns true if node is a sidecar made by the VFS
+func isMetaFile(node Node) bool {
+	file, ok := node.(*File)
+	return ok && file.virtual
+}
+
+// _addMetaFiles adds any sidecar files which are missing from the
+// directory if they are enabled - call with the lock held
+func (d *Dir) _addMetaFiles() {
+	if !d.vfs.Opt.MetaFiles {
+		return
+	}
+	now := time.Now()
+	var nodes []Node
+	for _, node := range d.items {
+		if !isMetaFile(node) {
+			nodes = append(nodes, node)
+		}
+	}
+	for _, node := range nodes {
+		file, ok := node.(*File)
+		if !ok {
+			continue
+		}
+		for _, ht := range d.f.Hashes().Array() {
+			ext, ok := metaHashExtensions[ht]
+			if !ok {
+				continue
+			}
+			name := file.Name() + "." + ext
+			if _, found := d.items[name]; found {
+				continue
+			}
+			ht := ht
+			fileName := file.Name()
+			size := metaHashSidecarSize(fileName, ht)
+			o := newMetaObject(path.Join(d.path, name), now, size, func() []byte {
+				return metaHashSidecar(file, fileName, ht)
+			})
+			d._setItem(name, newVirtualFile(d, o, name))
+		}
+	}
+	if _, found := d.items[metaDirName]; !found {
+		items, entries := metaDirItems(nodes)
+		size := int64(len(d.metaDirSidecar(items, entries, true)))
+		o := newMetaObject(path.Join(d.path, metaDirName), now, size, func() []byte {
+			return d.metaDirSidecar(items, entries, false)
+		})
+		d._setItem(metaDirName, newVirtualFile(d, o, metaDirName))
+	}
+}
+
+// _updateMetaFiles replaces the sidecar files after leaf has been
+// added or removed - call with the lock held
+func (d *Dir) _updateMetaFiles(leaf string) {
+	if !d.vfs.Opt.MetaFiles {
+		return
+	}
+	for name, node := range d.items {
+		if isMetaFile(node) && (name == metaDirName || strings.HasPrefix(name, leaf+".")) {
+			d._delItem(name)
+		}
+	}
+	d._addMetaFiles()
+}
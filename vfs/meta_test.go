@@ -0,0 +1,189 @@
+package vfs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/hash"
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMetaTestVFS makes a VFS showing the metadata sidecars
+func newMetaTestVFS(r *fstest.Run, cacheMode CacheMode) *VFS {
+	opt := DefaultOpt
+	opt.MetaFiles = true
+	opt.CacheMode = cacheMode
+	opt.CachePollInterval = 0
+	return New(r.Fremote, &opt)
+}
+
+// readMetaFile reads name from vfs
+func readMetaFile(t *testing.T, vfs *VFS, name string) string {
+	fd, err := vfs.OpenFile(name, os.O_RDONLY, 0)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(fd)
+	require.NoError(t, err)
+	require.NoError(t, fd.Close())
+	return string(data)
+}
+
+func TestMetaFiles(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	vfs := newMetaTestVFS(r, CacheModeOff)
+	r.WriteObject("dir/file1", "file1 contents", t1)
+	o, err := r.Fremote.NewObject("dir/file1")
+	require.NoError(t, err)
+
+	var want []string
+	for _, ht := range r.Fremote.Hashes().Array() {
+		want = append(want, "file1."+metaHashExtensions[ht])
+	}
+	want = append(want, ".rclone-meta.json", "file1")
+	assert.ElementsMatch(t, want, dirCacheNames(t, vfs, "dir"))
+
+	// the sizes are known without making the contents
+	var nodes []Node
+	for _, name := range want {
+		node, err := vfs.Stat("dir/" + name)
+		require.NoError(t, err)
+		nodes = append(nodes, node)
+		if file := node.(*File); file.virtual {
+			assert.True(t, node.Size() > 0)
+			assert.Nil(t, file.getObject().(*metaObject).data)
+		}
+	}
+
+	// the hash sidecars are in md5sum format
+	for _, ht := range r.Fremote.Hashes().Array() {
+		sum, err := o.Hash(ht)
+		require.NoError(t, err)
+		assert.Equal(t, sum+"  file1\n", readMetaFile(t, vfs, "dir/file1."+metaHashExtensions[ht]))
+	}
+
+	// and the directory sidecar is as long as its size
+	for _, node := range nodes {
+		if node.Name() == metaDirName {
+			data := readMetaFile(t, vfs, "dir/"+metaDirName)
+			assert.Equal(t, node.Size(), int64(len(data)))
+			var items []metaItem
+			require.NoError(t, json.Unmarshal([]byte(data), &items))
+		}
+	}
+
+	// the directory sidecar lists the files and directories
+	r.WriteObject("dir/sub/file2", "file2", t2)
+	vfs.root.ForgetPath("dir", fs.EntryDirectory)
+	var items []metaItem
+	require.NoError(t, json.Unmarshal([]byte(readMetaFile(t, vfs, "dir/.rclone-meta.json")), &items))
+	require.Equal(t, 2, len(items))
+	assert.Equal(t, "file1", items[0].Name)
+	assert.Equal(t, int64(14), items[0].Size)
+	assert.False(t, items[0].IsDir)
+	md5, err := o.Hash(hash.MD5)
+	require.NoError(t, err)
+	assert.Equal(t, md5, items[0].Hashes["MD5"])
+	assert.Equal(t, "sub", items[1].Name)
+	assert.True(t, items[1].IsDir)
+
+	// they are read only
+	node, err := vfs.Stat("dir/file1.md5")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0444), node.Mode()&0777)
+	assert.Equal(t, EROFS, node.Remove())
+	assert.Equal(t, EROFS, node.SetModTime(t2))
+	_, err = vfs.OpenFile("dir/file1.md5", os.O_WRONLY|os.O_TRUNC, 0777)
+	assert.Equal(t, EROFS, err)
+	assert.Equal(t, EROFS, vfs.Rename("dir/file1.md5", "dir/potato"))
+	dir, err := vfs.Stat("dir")
+	require.NoError(t, err)
+	_, err = dir.(*Dir).Create("file1.md5", os.O_WRONLY)
+	assert.Equal(t, EROFS, err)
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{
+		fstest.NewItem("dir/file1", "file1 contents", t1),
+		fstest.NewItem("dir/sub/file2", "file2", t2),
+	}, []string{"dir", "dir/sub"}, fs.ModTimeNotSupported)
+
+	// they follow changes made through the VFS
+	require.NoError(t, vfs.Rename("dir/file1", "dir/file3"))
+	names := dirCacheNames(t, vfs, "dir")
+	assert.NotContains(t, names, "file1.md5")
+	assert.Contains(t, names, "file3.md5")
+	require.NoError(t, json.Unmarshal([]byte(readMetaFile(t, vfs, "dir/.rclone-meta.json")), &items))
+	assert.Equal(t, "file3", items[0].Name)
+
+	// directories with only sidecars in can be removed
+	node, err = vfs.Stat("dir/sub/file2")
+	require.NoError(t, err)
+	require.NoError(t, node.Remove())
+	assert.Equal(t, []string{".rclone-meta.json"}, dirCacheNames(t, vfs, "dir/sub"))
+	node, err = vfs.Stat("dir/sub")
+	require.NoError(t, err)
+	require.NoError(t, node.Remove())
+}
+
+func TestMetaFilesCacheModeFull(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	vfs := newMetaTestVFS(r, CacheModeFull)
+	defer func() {
+		assert.NoError(t, vfs.CleanUp())
+		vfs.Shutdown()
+	}()
+	r.WriteObject("file1", "file1 contents", t1)
+	o, err := r.Fremote.NewObject("file1")
+	require.NoError(t, err)
+	md5, err := o.Hash(hash.MD5)
+	require.NoError(t, err)
+
+	// the sidecars aren't cached
+	assert.Equal(t, md5+"  file1\n", readMetaFile(t, vfs, "file1.md5"))
+	_, err = vfs.cache.loadInfo("file1.md5")
+	assert.Error(t, err)
+}
+
+func TestMetaObjectOpen(t *testing.T) {
+	o := newMetaObject("file", t1, 10, func() []byte {
+		return []byte("0123456789")
+	})
+	assert.Equal(t, int64(10), o.Size())
+	for _, test := range []struct {
+		options []fs.OpenOption
+		want    string
+	}{
+		{nil, "0123456789"},
+		{[]fs.OpenOption{&fs.SeekOption{Offset: 3}}, "3456789"},
+		{[]fs.OpenOption{&fs.RangeOption{Start: 2, End: 4}}, "234"},
+		{[]fs.OpenOption{&fs.RangeOption{Start: 7, End: -1}}, "789"},
+		{[]fs.OpenOption{&fs.RangeOption{Start: -1, End: 2}}, "89"},
+		{[]fs.OpenOption{&fs.SeekOption{Offset: 20}}, ""},
+	} {
+		in, err := o.Open(test.options...)
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(in)
+		require.NoError(t, err)
+		assert.Equal(t, test.want, string(data), test.options)
+	}
+	assert.Equal(t, EROFS, o.Remove())
+}
+
+func TestMetaObjectPadding(t *testing.T) {
+	// short contents are padded to the size
+	o := newMetaObject("file", t1, 8, func() []byte {
+		return []byte("abc\n")
+	})
+	assert.Nil(t, o.data)
+	assert.Equal(t, int64(8), o.Size())
+	assert.Equal(t, "abc    \n", string(o.contents()))
+
+	// and missing contents are blank
+	o = newMetaObject("file", t1, 4, func() []byte {
+		return nil
+	})
+	assert.Equal(t, "   \n", string(o.contents()))
+}
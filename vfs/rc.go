@@ -169,6 +169,88 @@ will get refreshed. This refresh will use --fast-list if enabled.
 
 `,
 	})
+	rc.Add(rc.Call{
+		Path: "vfs/queue",
+		Fn: func(in rc.Params) (out rc.Params, err error) {
+			if vfs.writeBack == nil {
+				return nil, errors.New("the upload queue needs --vfs-cache-mode minimal or above")
+			}
+			out = rc.Params{
+				"queue": vfs.writeBack.queue(),
+			}
+			return out, nil
+		},
+		Title: "List the files waiting to be uploaded.",
+		Help: `
+This returns the files in the VFS cache which are waiting to be
+uploaded to the remote, in the order they will be uploaded.
+
+    rclone rc vfs/queue
+
+Each item in the queue has these keys
+
+- name - remote path of the file
+- size - size of the file in bytes
+- expiry - seconds until the upload starts, negative if it is overdue
+- tries - number of times the upload has failed
+- uploading - true if the file is being uploaded now
+- error - the error from the last failed upload or ""
+- renameTo - the path the file will be moved to once uploaded if it
+  was renamed while waiting, or ""
+
+Files are queued when they are closed if --vfs-write-back is set and
+when a previous run of rclone didn't finish uploading them.
+`,
+		Input: []rc.Param{},
+		Output: []rc.Param{
+			{Name: "queue", Type: rc.ParamArray, Required: true, Help: "files waiting to be uploaded"},
+		},
+	})
+	rc.Add(rc.Call{
+		Path: "vfs/pin",
+		Fn: func(in rc.Params) (out rc.Params, err error) {
+			return vfs.rcPin(in, true)
+		},
+		Title: "Pin files in the VFS cache.",
+		Help: `
+This stops the files given being removed from the VFS cache by
+--vfs-cache-max-age, --vfs-cache-max-size or
+--vfs-cache-min-free-space until they are unpinned.  Pass the files
+in as file=path.  Any parameter key starting with file will pin that
+file, eg
+
+    rclone rc vfs/pin file=hello file2=data/goodbye
+
+Pinning doesn't download the file - it is kept once it has been read
+or written.  Pins are kept with the cache so they last between runs.
+The pin is on the path so it doesn't follow the file if it is
+renamed.
+
+This returns the list of pinned files, so call it with no parameters
+to see them.
+`,
+		Output: []rc.Param{
+			{Name: "pinned", Type: rc.ParamArray, Required: true, Help: "paths of the pinned files"},
+		},
+	})
+	rc.Add(rc.Call{
+		Path: "vfs/unpin",
+		Fn: func(in rc.Params) (out rc.Params, err error) {
+			return vfs.rcPin(in, false)
+		},
+		Title: "Unpin files in the VFS cache.",
+		Help: `
+This allows files pinned with vfs/pin to be removed from the VFS cache
+again.  Pass the files in as file=path, eg
+
+    rclone rc vfs/unpin file=hello file2=data/goodbye
+
+This returns the list of files which are still pinned.
+`,
+		Output: []rc.Param{
+			{Name: "pinned", Type: rc.ParamArray, Required: true, Help: "paths of the pinned files"},
+		},
+	})
 	rc.Add(rc.Call{
 		Path:  "vfs/poll-interval",
 		Fn:    rcPollFunc(vfs),
@@ -197,6 +279,49 @@ used remote.
 	})
 }
 
+// rcPin pins or unpins the files passed in returning the files
+// which are pinned afterwards
+func (vfs *VFS) rcPin(in rc.Params, pin bool) (out rc.Params, err error) {
+	if vfs.cache == nil {
+		return nil, errors.New("pinning files needs --vfs-cache-mode minimal or above")
+	}
+	for k, v := range in {
+		if strings.HasPrefix(k, "_") {
+			continue // reserved for the rc server
+		}
+		if !strings.HasPrefix(k, "file") {
+			return nil, errors.Errorf("unknown key %q", k)
+		}
+		path, ok := v.(string)
+		if !ok {
+			return nil, errors.Errorf("value must be string %q=%v", k, v)
+		}
+		path = strings.Trim(path, "/")
+		if pin {
+			node, err := vfs.Stat(path)
+			if err != nil {
+				return nil, errors.Wrapf(err, "can't pin %q", path)
+			}
+			if !node.IsFile() {
+				return nil, errors.Errorf("can't pin %q: not a file", path)
+			}
+			err = vfs.cache.pin(path)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			err = vfs.cache.unpin(path)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	out = rc.Params{
+		"pinned": vfs.cache.pinned(),
+	}
+	return out, nil
+}
+
 func rcPollFunc(vfs *VFS) (rcPollFunc rc.Func) {
 	getDuration := func(k string, v interface{}) (time.Duration, error) {
 		s, ok := v.(string)
@@ -27,6 +27,18 @@ type ReadFileHandle struct {
 	hash       *hash.MultiHasher
 	opened     bool
 	remote     string
+	streams    []readStream // other readers kept open, least recently used first
+	leftAt     []int64      // offsets where reading was left by a seek, oldest first
+}
+
+// maxReadStreams is the most readers a ReadFileHandle keeps open so
+// it can serve several sequential streams at once
+const maxReadStreams = 4
+
+// readStream is a reader kept open at offset while another is in use
+type readStream struct {
+	r      *accounting.Account
+	offset int64
 }
 
 // Check interfaces
@@ -65,16 +77,112 @@ func (fh *ReadFileHandle) openPending() (err error) {
 		return nil
 	}
 	o := fh.file.getObject()
-	r, err := chunkedreader.NewWithChunkSizeIterator(o, fh.file.d.vfs.chunkSizeFunc()).Open()
+	fh.r, err = fh.openStream(o, 0)
 	if err != nil {
 		return err
 	}
-	fh.r = accounting.NewAccount(r, o).WithBuffer() // account the transfer
 	fh.opened = true
 	accounting.Stats.Transferring(o.Remote())
 	return nil
 }
 
+// readAhead returns how many bytes are read ahead of the reads
+func (fh *ReadFileHandle) readAhead() int64 {
+	return int64(fs.Config.BufferSize) + int64(fh.file.d.vfs.Opt.ReadAhead)
+}
+
+// newChunkedReader makes a reader for o which opens the next chunk
+// in the background before the read ahead reaches it
+func (fh *ReadFileHandle) newChunkedReader(o fs.Object) *chunkedreader.ChunkedReader {
+	return chunkedreader.NewWithChunkSizeIterator(o, fh.file.d.vfs.chunkSizeFunc()).WithPrefetch(fh.readAhead())
+}
+
+// openStream opens a reader for o at offset which reads ahead in the
+// background
+func (fh *ReadFileHandle) openStream(o fs.Object, offset int64) (*accounting.Account, error) {
+	r := fh.newChunkedReader(o)
+	if offset > 0 {
+		_, err := r.Seek(offset, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r, err := r.Open()
+	if err != nil {
+		return nil, err
+	}
+	return accounting.NewAccount(r, o).WithBufferSize(fh.readAhead()), nil // account the transfer
+}
+
+// parkStream keeps the current reader open for later, closing the
+// least recently used one if there are too many
+//
+// Must be called with fh.mu held
+func (fh *ReadFileHandle) parkStream() {
+	if len(fh.streams) >= maxReadStreams-1 {
+		old := fh.streams[0]
+		fh.streams = fh.streams[1:]
+		fs.Debugf(fh.remote, "ReadFileHandle.Read closing stream at %d", old.offset)
+		if err := old.r.Close(); err != nil {
+			fs.Debugf(fh.remote, "ReadFileHandle.Read close stream failed: %v", err)
+		}
+	}
+	fh.streams = append(fh.streams, readStream{r: fh.r, offset: fh.offset})
+}
+
+// leaveStream notes that reading was left at the current offset by
+// a seek
+//
+// Must be called with fh.mu held
+func (fh *ReadFileHandle) leaveStream() {
+	if len(fh.leftAt) >= maxReadStreams {
+		fh.leftAt = fh.leftAt[1:]
+	}
+	fh.leftAt = append(fh.leftAt, fh.offset)
+}
+
+// switchStream makes a reader at off the current one, returning
+// false if there isn't one and the current reader should be seeked
+// instead.
+//
+// A reader kept open at off is used if there is one.  Otherwise, if
+// reading was left at off by an earlier seek, another reader is
+// opened there as it looks like several streams are being read at
+// once, eg a media player reading the video and audio from different
+// parts of the file.  Keeping a reader for each stops the handle
+// seeking back and forth between them.
+//
+// Must be called with fh.mu held
+func (fh *ReadFileHandle) switchStream(off int64) bool {
+	for i, stream := range fh.streams {
+		if stream.offset == off {
+			fs.Debugf(fh.remote, "ReadFileHandle.Read switching stream from %d to %d", fh.offset, off)
+			fh.streams = append(fh.streams[:i], fh.streams[i+1:]...)
+			fh.parkStream()
+			fh.r, fh.offset = stream.r, stream.offset
+			fh.hash = nil
+			return true
+		}
+	}
+	for i, leftAt := range fh.leftAt {
+		if leftAt == off {
+			fh.leftAt = append(fh.leftAt[:i], fh.leftAt[i+1:]...)
+			fs.Debugf(fh.remote, "ReadFileHandle.Read opening stream at %d", off)
+			r, err := fh.openStream(fh.file.getObject(), off)
+			if err != nil {
+				fs.Debugf(fh.remote, "ReadFileHandle.Read open stream failed: %v", err)
+				return false
+			}
+			fh.parkStream()
+			fh.r, fh.offset = r, off
+			fh.hash = nil
+			return true
+		}
+	}
+	fh.leaveStream()
+	return false
+}
+
 // String converts it to printable
 func (fh *ReadFileHandle) String() string {
 	if fh == nil {
@@ -136,7 +244,7 @@ func (fh *ReadFileHandle) seek(offset int64, reopen bool) (err error) {
 		}
 		// re-open with a seek
 		o := fh.file.getObject()
-		r = chunkedreader.NewWithChunkSizeIterator(o, fh.file.d.vfs.chunkSizeFunc())
+		r = fh.newChunkedReader(o)
 		_, err := r.Seek(offset, 0)
 		if err != nil {
 			fs.Debugf(fh.remote, "ReadFileHandle.Read seek failed: %v", err)
@@ -230,8 +338,12 @@ func (fh *ReadFileHandle) readAt(p []byte, off int64) (n int, err error) {
 				fs.Debugf(fh.remote, "ReadFileHandle.Read attempt to read beyond end of file: %d > %d", off, fh.size)
 				return 0, io.EOF
 			}
-			// Otherwise do the seek
-			err = fh.seek(off, doReopen)
+			// Otherwise use another reader or do the seek
+			if doReopen || !fh.switchStream(off) {
+				err = fh.seek(off, doReopen)
+			} else {
+				err = nil
+			}
 		} else {
 			err = nil
 		}
@@ -347,6 +459,12 @@ func (fh *ReadFileHandle) close() error {
 
 	if fh.opened {
 		accounting.Stats.DoneTransferring(fh.remote, true)
+		for _, stream := range fh.streams {
+			if err := stream.r.Close(); err != nil {
+				fs.Debugf(fh.remote, "ReadFileHandle.Close close stream failed: %v", err)
+			}
+		}
+		fh.streams = nil
 		// Close first so that we have hashes
 		err := fh.r.Close()
 		if err != nil {
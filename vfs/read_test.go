@@ -2,9 +2,11 @@ package vfs
 
 import (
 	"io"
+	"io/ioutil"
 	"os"
 	"testing"
 
+	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fstest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -180,6 +182,78 @@ func TestReadFileHandleReadAt(t *testing.T) {
 	assert.Equal(t, ECLOSED, err)
 }
 
+func TestReadFileHandleStreams(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	_, fh := readHandleCreate(t, r)
+
+	// read two interleaved sequential streams
+	readAt := func(off int64, n int) string {
+		buf := make([]byte, n)
+		n, err := fh.ReadAt(buf, off)
+		if err != io.EOF {
+			assert.NoError(t, err)
+		}
+		return string(buf[:n])
+	}
+	assert.Equal(t, "01", readAt(0, 2))
+	assert.Equal(t, "89", readAt(8, 2))
+	assert.Equal(t, 0, len(fh.streams))
+	assert.Equal(t, []int64{2}, fh.leftAt)
+
+	// coming back to where the first stream was left opens another reader
+	assert.Equal(t, "23", readAt(2, 2))
+	require.Equal(t, 1, len(fh.streams))
+	assert.Equal(t, int64(10), fh.streams[0].offset)
+	assert.Equal(t, 0, len(fh.leftAt))
+
+	// then they take it in turns without seeking
+	for i := int64(0); i < 2; i++ {
+		assert.Equal(t, "ab"[i:i+1], readAt(10+i, 1))
+		assert.Equal(t, int64(4+i), fh.streams[0].offset)
+		assert.Equal(t, "45"[i:i+1], readAt(4+i, 1))
+		assert.Equal(t, int64(11+i), fh.streams[0].offset)
+	}
+	assert.Equal(t, 1, len(fh.streams))
+
+	// the number of readers is limited
+	for _, off := range []int64{14, 0, 15, 1, 13, 6, 3} {
+		readAt(off, 1)
+	}
+	assert.True(t, len(fh.streams) <= maxReadStreams-1)
+	assert.True(t, len(fh.leftAt) <= maxReadStreams)
+
+	// and they are all closed on close
+	streams := fh.streams
+	require.NoError(t, fh.Close())
+	assert.Equal(t, 0, len(fh.streams))
+	for _, stream := range streams {
+		_, err := stream.r.Read(make([]byte, 1))
+		assert.Error(t, err)
+	}
+}
+
+func TestReadFileHandleReadAhead(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	opt := DefaultOpt
+	opt.ReadAhead = 3 * fs.MebiByte
+	opt.ChunkSize = 1 * fs.MebiByte
+	vfs := New(r.Fremote, &opt)
+
+	data := sparseTestData(5 * 1024 * 1024)
+	r.WriteObject("file", string(data), t1)
+	h, err := vfs.OpenFile("file", os.O_RDONLY, 0777)
+	require.NoError(t, err)
+	fh := h.(*ReadFileHandle)
+	assert.Equal(t, int64(fs.Config.BufferSize)+3*1024*1024, fh.readAhead())
+
+	got, err := ioutil.ReadAll(fh)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	require.NoError(t, fh.Close())
+}
+
 func TestReadFileHandleFlush(t *testing.T) {
 	r := fstest.NewRun(t)
 	defer r.Finalise()
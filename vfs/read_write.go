@@ -7,6 +7,7 @@ import (
 	"os"
 	"runtime"
 	"sync"
+	"time"
 
 	"github.com/ncw/rclone/fs"
 	"github.com/ncw/rclone/fs/accounting"
@@ -28,10 +29,11 @@ type RWFileHandle struct {
 	file        *File
 	d           *Dir
 	opened      bool
-	flags       int    // open flags
-	osPath      string // path to the file in the cache
-	writeCalled bool   // if any Write() methods have been called
-	changed     bool   // file contents was changed in any other way
+	flags       int         // open flags
+	osPath      string      // path to the file in the cache
+	writeCalled bool        // if any Write() methods have been called
+	changed     bool        // file contents was changed in any other way
+	sparse      *sparseFile // which parts of the cache file are present
 }
 
 // Check interfaces
@@ -70,6 +72,17 @@ func newRWFileHandle(d *Dir, f *File, remote string, flags int) (fh *RWFileHandl
 	rdwrMode := fh.flags & accessModeMask
 	if rdwrMode != os.O_RDONLY {
 		fh.file.addWriter(fh)
+		// The file is about to change so stop any queued upload
+		// of it without waiting for one in progress.  The
+		// changes stay in the cache file and are uploaded when
+		// this handle closes.
+		if wb := d.vfs.writeBack; wb != nil && wb.hold(remote) {
+			fh.file.setModified()
+			if fi, err := os.Stat(fh.osPath); err == nil {
+				fh.file.setSize(fi.Size())
+				fh.file.setPendingUpload(fi.ModTime())
+			}
+		}
 	}
 
 	// truncate or create files immediately to prepare the cache
@@ -112,52 +125,32 @@ func (fh *RWFileHandle) openPending(truncate bool) (err error) {
 	cacheFileOpenFlags := fh.flags
 	// if not truncating the file, need to read it first
 	if fh.flags&os.O_TRUNC == 0 && !truncate {
-		// If the remote object exists AND its cached file exists locally AND there are no
-		// other RW handles with it open, then attempt to update it.
-		if o != nil && fh.file.rwOpens() == 0 {
-			cacheObj, err := fh.d.vfs.cache.f.NewObject(fh.remote)
-			if err == nil && cacheObj != nil {
-				_, err = copyObj(fh.d.vfs.cache.f, cacheObj, fh.remote, o)
-				if err != nil {
-					return errors.Wrap(err, "open RW handle failed to update cached file")
-				}
+		// If there are no other RW handles with the file open
+		// then prepare the cache file.  If the remote object
+		// exists this makes a sparse file whose contents are
+		// downloaded as they are read, reusing any parts
+		// already in the cache if they are still valid.
+		sf := fh.file.sparse
+		if sf == nil {
+			sf, err = newSparseFile(fh.d.vfs, fh.remote, fh.osPath, o)
+			if os.IsNotExist(err) && fh.flags&os.O_CREATE != 0 {
+				// if the object wasn't found AND O_CREATE is set then
+				// ignore error as we are about to create the file
+				fh.file.setSize(0)
+				fh.changed = true
+				sf = newLocalSparseFile(fh.d.vfs, fh.remote, fh.osPath, 0)
+			} else if err != nil {
+				return errors.Wrap(err, "open RW handle failed to cache file")
 			}
 		}
 
-		// try to open a exising cache file
-		fd, err = file.OpenFile(fh.osPath, cacheFileOpenFlags&^os.O_CREATE, 0600)
-		if os.IsNotExist(err) {
-			// cache file does not exist, so need to fetch it if we have an object to fetch
-			// it from
-			if o != nil {
-				_, err = copyObj(fh.d.vfs.cache.f, nil, fh.remote, o)
-				if err != nil {
-					cause := errors.Cause(err)
-					if cause != fs.ErrorObjectNotFound && cause != fs.ErrorDirNotFound {
-						// return any non NotFound errors
-						return errors.Wrap(err, "open RW handle failed to cache file")
-					}
-					// continue here with err=fs.Error{Object,Dir}NotFound
-				}
-			}
-			// if err == nil, then we have cached the file successfully, otherwise err is
-			// indicating some kind of non existent file/directory either
-			// os.IsNotExist(err) or fs.Error{Object,Dir}NotFound
-			if err != nil {
-				if fh.flags&os.O_CREATE != 0 {
-					// if the object wasn't found AND O_CREATE is set then
-					// ignore error as we are about to create the file
-					fh.file.setSize(0)
-					fh.changed = true
-				} else {
-					return errors.Wrap(err, "open RW handle failed to cache file")
-				}
-			}
-		} else if err != nil {
+		// open the cache file
+		fd, err = file.OpenFile(fh.osPath, cacheFileOpenFlags, 0600)
+		if err != nil {
 			return errors.Wrap(err, "cache open file failed")
-		} else {
-			fs.Debugf(fh.logPrefix(), "Opened existing cached copy with flags=%s", decodeOpenFlags(fh.flags))
 		}
+		fs.Debugf(fh.logPrefix(), "Opened cached copy with flags=%s", decodeOpenFlags(fh.flags))
+		fh.sparse = sf
 	} else {
 		// Set the size to 0 since we are truncating and flag we need to write it back
 		fh.file.setSize(0)
@@ -190,9 +183,17 @@ func (fh *RWFileHandle) openPending(truncate bool) (err error) {
 		if err != nil {
 			return errors.Wrap(err, "cache open file failed")
 		}
+		// the cache file is now empty so nothing needs downloading
+		if fh.file.sparse != nil {
+			fh.file.sparse.truncate(0)
+			fh.sparse = fh.file.sparse
+		} else {
+			fh.sparse = newLocalSparseFile(fh.d.vfs, fh.remote, fh.osPath, 0)
+		}
 	}
 	fh.File = fd
 	fh.opened = true
+	fh.file.sparse = fh.sparse
 	fh.file.addRWOpen()
 	fh.d.addObject(fh.file) // make sure the directory has this object in it now
 	return nil
@@ -251,6 +252,12 @@ func (fh *RWFileHandle) close() (err error) {
 	defer func() {
 		if fh.opened {
 			fh.file.delRWOpen()
+			// the last handle stops the downloads and saves
+			// which parts of the file are present
+			if fh.file.rwOpens() == 0 && fh.file.sparse != nil {
+				fh.file.sparse.close()
+				fh.file.sparse = nil
+			}
 		}
 		fh.d.vfs.cache.close(fh.remote)
 	}()
@@ -276,12 +283,14 @@ func (fh *RWFileHandle) close() (err error) {
 		}
 	}
 
+	var modTime time.Time
 	if writer && fh.opened {
 		fi, err := fh.File.Stat()
 		if err != nil {
 			fs.Errorf(fh.logPrefix(), "Failed to stat cache file: %v", err)
 		} else {
 			fh.file.setSize(fi.Size())
+			modTime = fi.ModTime()
 		}
 	}
 
@@ -295,6 +304,23 @@ func (fh *RWFileHandle) close() (err error) {
 	}
 
 	if isCopied {
+		// Make sure all of the file is in the cache first
+		if fh.sparse != nil {
+			err = fh.sparse.ensure(0, fh.file.Size())
+			if err != nil {
+				err = errors.Wrap(err, "failed to download rest of file before upload")
+				fs.Errorf(fh.logPrefix(), "%v", err)
+				return err
+			}
+		}
+
+		// Queue the upload if writing back later
+		if fh.d.vfs.Opt.WriteBack > 0 {
+			fh.file.setPendingUpload(modTime)
+			fh.d.vfs.writeBack.add(fh.file, fh.remote, fh.file.Size())
+			return nil
+		}
+
 		// Transfer the temp file to the remote
 		cacheObj, err := fh.d.vfs.cache.f.NewObject(fh.remote)
 		if err != nil {
@@ -310,6 +336,10 @@ func (fh *RWFileHandle) close() (err error) {
 			return err
 		}
 		fh.file.setObject(o)
+		if fh.sparse != nil {
+			fh.sparse.setObject(o)
+		}
+		fh.file.finishUpload()
 		fs.Debugf(o, "transferred to remote")
 	}
 
@@ -419,6 +449,14 @@ func (fh *RWFileHandle) readFn(read func() (int, error)) (n int, err error) {
 // Read bytes from the file
 func (fh *RWFileHandle) Read(b []byte) (n int, err error) {
 	return fh.readFn(func() (int, error) {
+		off, err := fh.File.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+		err = fh.sparse.ensure(off, int64(len(b)))
+		if err != nil {
+			return 0, err
+		}
 		return fh.File.Read(b)
 	})
 }
@@ -426,6 +464,10 @@ func (fh *RWFileHandle) Read(b []byte) (n int, err error) {
 // ReadAt bytes from the file at off
 func (fh *RWFileHandle) ReadAt(b []byte, off int64) (n int, err error) {
 	return fh.readFn(func() (int, error) {
+		err := fh.sparse.ensure(off, int64(len(b)))
+		if err != nil {
+			return 0, err
+		}
 		return fh.File.ReadAt(b, off)
 	})
 }
@@ -462,7 +504,11 @@ func (fh *RWFileHandle) writeFn(write func() error) (err error) {
 		return err
 	}
 	fh.writeCalled = true
+	// hold the sparse file lock so the downloader can't write
+	// over the new data
+	fh.sparse.mu.Lock()
 	err = write()
+	fh.sparse.mu.Unlock()
 	if err != nil {
 		return err
 	}
@@ -474,10 +520,27 @@ func (fh *RWFileHandle) writeFn(write func() error) (err error) {
 	return nil
 }
 
+// writtenAtOffset marks the n bytes just written by Write or
+// WriteString as present in the cache file - call with
+// fh.sparse.mu held
+func (fh *RWFileHandle) writtenAtOffset(n int) error {
+	off, err := fh.File.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	fh.sparse._written(off-int64(n), int64(n))
+	return nil
+}
+
 // Write bytes to the file
 func (fh *RWFileHandle) Write(b []byte) (n int, err error) {
 	err = fh.writeFn(func() error {
 		n, err = fh.File.Write(b)
+		if n > 0 {
+			if seekErr := fh.writtenAtOffset(n); err == nil {
+				err = seekErr
+			}
+		}
 		return err
 	})
 	return n, err
@@ -487,6 +550,7 @@ func (fh *RWFileHandle) Write(b []byte) (n int, err error) {
 func (fh *RWFileHandle) WriteAt(b []byte, off int64) (n int, err error) {
 	err = fh.writeFn(func() error {
 		n, err = fh.File.WriteAt(b, off)
+		fh.sparse._written(off, int64(n))
 		return err
 	})
 	return n, err
@@ -496,6 +560,11 @@ func (fh *RWFileHandle) WriteAt(b []byte, off int64) (n int, err error) {
 func (fh *RWFileHandle) WriteString(s string) (n int, err error) {
 	err = fh.writeFn(func() error {
 		n, err = fh.File.WriteString(s)
+		if n > 0 {
+			if seekErr := fh.writtenAtOffset(n); err == nil {
+				err = seekErr
+			}
+		}
 		return err
 	})
 	return n, err
@@ -513,7 +582,14 @@ func (fh *RWFileHandle) Truncate(size int64) (err error) {
 	}
 	fh.changed = true
 	fh.file.setSize(size)
-	return fh.File.Truncate(size)
+	fh.sparse.mu.Lock()
+	defer fh.sparse.mu.Unlock()
+	err = fh.File.Truncate(size)
+	if err != nil {
+		return err
+	}
+	fh.sparse._truncate(size)
+	return nil
 }
 
 // Sync commits the current contents of the file to stable storage. Typically,
@@ -53,6 +53,17 @@ var DefaultOpt = Options{
 	ChunkSize:         128 * fs.MebiByte,
 	ChunkSizeLimit:    -1,
 	CacheMaxSize:      -1,
+	CacheMinFreeSpace: -1,
+	CacheEviction:     CacheEvictLRU,
+	ReadAhead:         0,
+	WriteBack:         0,
+	DirCachePersist:   false,
+	MetaFiles:         false,
+	MetaPublicLinks:   false,
+	CaseInsensitive:   false,
+	AttrPersist:       false,
+	WriteBuffer:       0,
+	WriteAppend:       false,
 }
 
 // Node represents either a directory (*Dir) or a file (*File)
@@ -77,6 +88,35 @@ var (
 	_ Node = (*Dir)(nil)
 )
 
+// Attributer is a Node whose permissions, owner and extended
+// attributes can be read and changed
+type Attributer interface {
+	Node
+	Chmod(mode os.FileMode) error
+	Chown(uid, gid uint32) error
+	Owner() (uid, gid uint32)
+	Getxattr(name string) ([]byte, error)
+	Setxattr(name string, value []byte, flags int) error
+	Listxattr() ([]string, error)
+	Removexattr(name string) error
+}
+
+// Check interfaces
+var (
+	_ Attributer = (*File)(nil)
+	_ Attributer = (*Dir)(nil)
+)
+
+// Owner returns the owner of node, or the owner set in the options
+// if node doesn't have one
+func Owner(node Node) (uid, gid uint32) {
+	if a, ok := node.(Attributer); ok {
+		return a.Owner()
+	}
+	opt := &node.VFS().Opt
+	return opt.UID, opt.GID
+}
+
 // Nodes is a slice of Node
 type Nodes []Node
 
@@ -175,11 +215,16 @@ type VFS struct {
 	root      *Dir
 	Opt       Options
 	cache     *cache
+	writeBack *writeBack
+	dirCache  *dirCache
+	attrs     *attrStore
 	cancel    context.CancelFunc
 	usageMu   sync.Mutex
 	usageTime time.Time
 	usage     *fs.Usage
 	pollChan  chan time.Duration
+	lockMu    sync.RWMutex
+	lockCheck LockChecker
 
 	chunkSizeFunc func() chunkedreader.ChunkSizeIterator
 }
@@ -203,7 +248,18 @@ type Options struct {
 	CacheMode         CacheMode
 	CacheMaxAge       time.Duration
 	CacheMaxSize      fs.SizeSuffix
+	CacheMinFreeSpace fs.SizeSuffix // remove files from the cache to keep this much free on its disk
+	CacheEviction     CacheEviction // which files to remove from the cache first
 	CachePollInterval time.Duration
+	ReadAhead         fs.SizeSuffix // bytes to read ahead over --buffer-size
+	WriteBack         time.Duration // time to wait before uploading closed files - 0 to upload when closed
+	DirCachePersist   bool          // keep directory listings on disk between runs
+	MetaFiles         bool          // show read only sidecar files with the metadata of the objects
+	MetaPublicLinks   bool          // make public links for the metadata sidecar files
+	CaseInsensitive   bool          // look up names ignoring case if there is no exact match
+	AttrPersist       bool          // store the mode, owner and extended attributes set on nodes
+	WriteBuffer       fs.SizeSuffix // max out of order writes to buffer per handle without the cache
+	WriteAppend       bool          // append to existing files without the cache
 }
 
 // New creates a new VFS and root directory.  If opt is nil, then
@@ -236,6 +292,28 @@ func New(f fs.Fs, opt *Options) *VFS {
 		vfs.chunkSizeFunc = vfs.Opt.ChunkSizeList.Iter
 	}
 
+	// Open the persistent directory cache
+	if vfs.Opt.DirCachePersist {
+		dirCache, err := newDirCache(f)
+		if err != nil {
+			fs.Errorf(nil, "Failed to open vfs directory cache - disabling: %v", err)
+			vfs.Opt.DirCachePersist = false
+		} else {
+			vfs.dirCache = dirCache
+		}
+	}
+
+	// Open the attribute store
+	if vfs.Opt.AttrPersist {
+		attrs, err := newAttrStore(f)
+		if err != nil {
+			fs.Errorf(nil, "Failed to open vfs attribute store - disabling: %v", err)
+			vfs.Opt.AttrPersist = false
+		} else {
+			vfs.attrs = attrs
+		}
+	}
+
 	// Create root directory
 	vfs.root = newDir(vfs, f, nil, fsDir)
 
@@ -255,10 +333,16 @@ func New(f fs.Fs, opt *Options) *VFS {
 	return vfs
 }
 
+// Fs returns the Fs passed into the New call
+func (vfs *VFS) Fs() fs.Fs {
+	return vfs.f
+}
+
 // SetCacheMode change the cache mode
 func (vfs *VFS) SetCacheMode(cacheMode CacheMode) {
-	vfs.Shutdown()
+	vfs.stopCache()
 	vfs.cache = nil
+	vfs.writeBack = nil
 	if vfs.Opt.CacheMode > CacheModeOff {
 		ctx, cancel := context.WithCancel(context.Background())
 		cache, err := newCache(ctx, vfs.f, &vfs.Opt) // FIXME pass on context or get from Opt?
@@ -270,17 +354,52 @@ func (vfs *VFS) SetCacheMode(cacheMode CacheMode) {
 		}
 		vfs.cancel = cancel
 		vfs.cache = cache
+		vfs.writeBack = newWriteBack(ctx, vfs)
 	}
 }
 
-// Shutdown stops any background go-routines
-func (vfs *VFS) Shutdown() {
+// LockChecker is called with the path of a file or directory before
+// the VFS changes it.  It should return nil if the change may go
+// ahead or an error, usually ELOCKED, if not.
+type LockChecker func(name string) error
+
+// SetLockChecker sets the function used to check whether files and
+// directories may be changed.  This is used by servers which lock
+// paths on behalf of their clients so other users of the VFS can't
+// change them.  Pass nil to remove it.
+func (vfs *VFS) SetLockChecker(fn LockChecker) {
+	vfs.lockMu.Lock()
+	vfs.lockCheck = fn
+	vfs.lockMu.Unlock()
+}
+
+// checkLock returns an error if name may not be changed
+func (vfs *VFS) checkLock(name string) error {
+	vfs.lockMu.RLock()
+	fn := vfs.lockCheck
+	vfs.lockMu.RUnlock()
+	if fn == nil {
+		return nil
+	}
+	return fn(name)
+}
+
+// stopCache stops the background go-routines of the file cache
+func (vfs *VFS) stopCache() {
 	if vfs.cancel != nil {
 		vfs.cancel()
 		vfs.cancel = nil
 	}
 }
 
+// Shutdown stops any background go-routines and closes the
+// persistent directory cache and attribute store
+func (vfs *VFS) Shutdown() {
+	vfs.stopCache()
+	vfs.dirCache.close()
+	vfs.attrs.close()
+}
+
 // CleanUp deletes the contents of the on disk cache
 func (vfs *VFS) CleanUp() error {
 	if vfs.Opt.CacheMode == CacheModeOff {
@@ -5,6 +5,7 @@ package vfs
 import (
 	"io"
 	"os"
+	"strings"
 	"testing"
 
 	_ "github.com/ncw/rclone/backend/all" // import all the backends
@@ -305,3 +306,46 @@ func TestVFSStatfs(t *testing.T) {
 	assert.Equal(t, free, free2)
 	assert.Equal(t, oldTime, vfs.usageTime)
 }
+
+func TestVFSLockChecker(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	vfs := New(r.Fremote, nil)
+
+	file1 := r.WriteObject("dir/file1", "file1 contents", t1)
+	fstest.CheckItems(t, r.Fremote, file1)
+
+	vfs.SetLockChecker(func(name string) error {
+		if strings.HasPrefix(name, "dir") {
+			return ELOCKED
+		}
+		return nil
+	})
+
+	_, err := vfs.OpenFile("dir/file1", os.O_WRONLY|os.O_TRUNC, 0777)
+	assert.Equal(t, ELOCKED, err)
+	_, err = vfs.OpenFile("dir/file2", os.O_WRONLY|os.O_CREATE, 0777)
+	assert.Equal(t, ELOCKED, err)
+	assert.Equal(t, ELOCKED, vfs.Rename("dir/file1", "file1"))
+	node, err := vfs.Stat("dir/file1")
+	require.NoError(t, err)
+	assert.Equal(t, ELOCKED, node.Remove())
+	dir, err := vfs.Stat("dir")
+	require.NoError(t, err)
+	_, err = dir.(*Dir).Mkdir("sub")
+	assert.Equal(t, ELOCKED, err)
+
+	// reading is still allowed
+	fd, err := vfs.OpenFile("dir/file1", os.O_RDONLY, 0777)
+	require.NoError(t, err)
+	require.NoError(t, fd.Close())
+
+	// paths which aren't locked can be changed
+	root, err := vfs.Root()
+	require.NoError(t, err)
+	_, err = root.Mkdir("other")
+	require.NoError(t, err)
+
+	vfs.SetLockChecker(nil)
+	require.NoError(t, vfs.Rename("dir/file1", "file1"))
+}
@@ -28,7 +28,18 @@ func AddFlags(flagSet *pflag.FlagSet) {
 	flags.DurationVarP(flagSet, &Opt.CachePollInterval, "vfs-cache-poll-interval", "", Opt.CachePollInterval, "Interval to poll the cache for stale objects.")
 	flags.DurationVarP(flagSet, &Opt.CacheMaxAge, "vfs-cache-max-age", "", Opt.CacheMaxAge, "Max age of objects in the cache.")
 	flags.FVarP(flagSet, &Opt.CacheMaxSize, "vfs-cache-max-size", "", "Max total size of objects in the cache.")
+	flags.FVarP(flagSet, &Opt.CacheMinFreeSpace, "vfs-cache-min-free-space", "", "Remove files from the cache to keep at least this much free space on its disk.")
+	flags.FVarP(flagSet, &Opt.CacheEviction, "vfs-cache-eviction", "", "Which files to remove from the cache first lru|lfu|size")
 	flags.FVarP(flagSet, &Opt.ChunkSize, "vfs-read-chunk-size", "", "Read the source objects in chunks.")
+	flags.DurationVarP(flagSet, &Opt.WriteBack, "vfs-write-back", "", Opt.WriteBack, "Time to wait after closing a file before uploading it. 0 uploads it before the close returns.")
+	flags.BoolVarP(flagSet, &Opt.DirCachePersist, "vfs-dir-cache-persist", "", Opt.DirCachePersist, "Keep directory listings on disk so they can be used after a restart.")
+	flags.BoolVarP(flagSet, &Opt.MetaFiles, "vfs-meta-files", "", Opt.MetaFiles, "Show read only sidecar files with the hashes and metadata of the files.")
+	flags.BoolVarP(flagSet, &Opt.MetaPublicLinks, "vfs-meta-public-links", "", Opt.MetaPublicLinks, "Make public links for the files listed in the metadata sidecar files.")
+	flags.BoolVarP(flagSet, &Opt.CaseInsensitive, "vfs-case-insensitive", "", Opt.CaseInsensitive, "If a file name isn't found, find a case insensitive match.")
+	flags.BoolVarP(flagSet, &Opt.AttrPersist, "vfs-attr-persist", "", Opt.AttrPersist, "Store the mode, owner and extended attributes set on files and directories.")
+	flags.FVarP(flagSet, &Opt.WriteBuffer, "vfs-write-buffer", "", "Max out of order writes to buffer in memory per file handle when not using the cache.")
+	flags.BoolVarP(flagSet, &Opt.WriteAppend, "vfs-write-append", "", Opt.WriteAppend, "Allow appending to existing files without the cache.")
+	flags.FVarP(flagSet, &Opt.ReadAhead, "vfs-read-ahead", "", "Extra read ahead over --buffer-size.")
 	flags.FVarP(flagSet, &Opt.ChunkSizeLimit, "vfs-read-chunk-size-limit", "", "If greater than --vfs-read-chunk-size, double the chunk size after each chunk read, until the limit is reached. 'off' is unlimited.")
 	flags.FVarP(flagSet, DirPerms, "dir-perms", "", "Directory permissions")
 	flags.FVarP(flagSet, FilePerms, "file-perms", "", "File permissions")
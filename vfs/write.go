@@ -1,7 +1,10 @@
 package vfs
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"io"
+	"io/ioutil"
 	"os"
 	"sync"
 	"time"
@@ -25,6 +28,8 @@ type WriteFileHandle struct {
 	opened      bool
 	flags       int
 	truncated   bool
+	appendTo    fs.Object   // object being appended to if set
+	pending     writeBuffer // writes made ahead of offset
 }
 
 // Check interfaces
@@ -41,6 +46,13 @@ func newWriteFileHandle(d *Dir, f *File, remote string, flags int) (*WriteFileHa
 		result: make(chan error, 1),
 		file:   f,
 	}
+	// Append to the existing object rather than replacing it
+	if flags&os.O_APPEND != 0 && flags&os.O_TRUNC == 0 && d.vfs.Opt.WriteAppend {
+		if o := f.getObject(); o != nil {
+			fh.appendTo = o
+			fh.offset = o.Size()
+		}
+	}
 	fh.file.addWriter(fh)
 	return fh, nil
 }
@@ -57,6 +69,9 @@ func (fh *WriteFileHandle) openPending() (err error) {
 	if fh.opened {
 		return nil
 	}
+	if fh.appendTo != nil {
+		return fh.openAppend()
+	}
 	if !fh.safeToTruncate() {
 		fs.Errorf(fh.remote, "WriteFileHandle: Can't open for write without O_TRUNC on existing file without --vfs-cache-mode >= writes")
 		return EPERM
@@ -81,6 +96,92 @@ func (fh *WriteFileHandle) openPending() (err error) {
 	return nil
 }
 
+// openAppend starts appending the data written to fh.appendTo
+//
+// call with the lock held
+func (fh *WriteFileHandle) openAppend() error {
+	var pipeReader *io.PipeReader
+	pipeReader, fh.pipeWriter = io.Pipe()
+	go func() {
+		o, err := appendObject(fh.file.d.f, fh.appendTo, fh.remote, pipeReader)
+		if err != nil {
+			fs.Errorf(fh.remote, "WriteFileHandle.New append failed: %v", err)
+		}
+		// Close the pipeReader so the pipeWriter fails with ErrClosedPipe
+		_ = pipeReader.Close()
+		fh.o = o
+		fh.result <- err
+	}()
+	fh.opened = true
+	return nil
+}
+
+// appendTempName returns a name for a temporary object to use when
+// appending to remote
+func appendTempName(remote string) string {
+	var id [4]byte
+	_, _ = io.ReadFull(rand.Reader, id[:])
+	return remote + "." + hex.EncodeToString(id[:]) + ".rclone-append"
+}
+
+// removeTemp removes the temporary object o logging any errors
+func removeTemp(o fs.Object) {
+	err := o.Remove()
+	if err != nil {
+		fs.Errorf(o, "Failed to remove temporary object: %v", err)
+	}
+}
+
+// appendObject makes remote from the contents of old followed by the
+// data read from in.
+//
+// If the remote can compose objects then in is uploaded to a
+// temporary object which is composed onto the end of old.  Otherwise
+// old followed by in is uploaded to a temporary object which is then
+// moved over old.
+func appendObject(f fs.Fs, old fs.Object, remote string, in io.Reader) (newObj fs.Object, err error) {
+	old, err = realObject(old)
+	if err != nil {
+		return nil, err
+	}
+	var tmp fs.Object
+	var rc io.ReadCloser
+	if compose := f.Features().Compose; compose != nil {
+		// NB Rcat deals with Stats.Transferring etc
+		tmp, err = operations.Rcat(f, appendTempName(remote), ioutil.NopCloser(in), time.Now())
+		if err != nil {
+			return nil, err
+		}
+		defer removeTemp(tmp)
+		newObj, err = compose([]fs.Object{old, tmp}, remote)
+		if err != fs.ErrorCantCompose {
+			return newObj, err
+		}
+		fs.Debugf(remote, "Can't compose so appending by copying")
+		rc, err = tmp.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer fs.CheckClose(rc, &err)
+		in = rc
+	}
+	rc, err = old.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(rc, &err)
+	tmp, err = operations.Rcat(f, appendTempName(remote), ioutil.NopCloser(io.MultiReader(rc, in)), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	newObj, err = operations.Move(f, old, remote, tmp)
+	if err != nil {
+		removeTemp(tmp)
+		return nil, err
+	}
+	return newObj, nil
+}
+
 // String converts it to printable
 func (fh *WriteFileHandle) String() string {
 	if fh == nil {
@@ -126,9 +227,8 @@ func (fh *WriteFileHandle) writeAt(p []byte, off int64) (n int, err error) {
 		fs.Errorf(fh.remote, "WriteFileHandle.Write: error: %v", EBADF)
 		return 0, ECLOSED
 	}
-	if fh.offset != off {
-		fs.Errorf(fh.remote, "WriteFileHandle.Write: can't seek in file without --vfs-cache-mode >= writes")
-		return 0, ESPIPE
+	if fh.offset != off || !fh.pending.empty() {
+		return fh.writeOutOfOrder(p, off)
 	}
 	if err = fh.openPending(); err != nil {
 		return 0, err
@@ -145,6 +245,74 @@ func (fh *WriteFileHandle) writeAt(p []byte, off int64) (n int, err error) {
 	return n, nil
 }
 
+// writeOutOfOrder buffers p to be written at off if there is room
+// in the write buffer, then writes any buffered data which now
+// follows on from the offset - call with lock held
+func (fh *WriteFileHandle) writeOutOfOrder(p []byte, off int64) (n int, err error) {
+	if off < fh.offset || fh.pending.size+int64(len(p)) > int64(fh.file.d.vfs.Opt.WriteBuffer) {
+		fs.Errorf(fh.remote, "WriteFileHandle.Write: can't seek in file without --vfs-cache-mode >= writes or a bigger --vfs-write-buffer")
+		return 0, ESPIPE
+	}
+	if err = fh.openPending(); err != nil {
+		return 0, err
+	}
+	fh.writeCalled = true
+	fh.pending.add(off, p)
+	err = fh.writePending(false)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// zeros is used to fill the gaps between buffered writes
+var zeros = make([]byte, 64*1024)
+
+// writePending writes the buffered data which follows on from the
+// offset, or all of it filling the gaps with zeros if all is set -
+// call with lock held
+func (fh *WriteFileHandle) writePending(all bool) (err error) {
+	defer func() {
+		size := fh.offset
+		if end := fh.pending.end(); end > size {
+			size = end
+		}
+		fh.file.setSize(size)
+	}()
+	for {
+		off, ok := fh.pending.peek()
+		if !ok || (off > fh.offset && !all) {
+			return nil
+		}
+		for off > fh.offset {
+			gap := zeros
+			if off-fh.offset < int64(len(gap)) {
+				gap = gap[:off-fh.offset]
+			}
+			err = fh.writePipe(gap)
+			if err != nil {
+				return err
+			}
+		}
+		b, _ := fh.pending.next()
+		err = fh.writePipe(b.data)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// writePipe writes p to the upload - call with lock held
+func (fh *WriteFileHandle) writePipe(p []byte) error {
+	n, err := fh.pipeWriter.Write(p)
+	fh.offset += int64(n)
+	if err != nil {
+		fs.Errorf(fh.remote, "WriteFileHandle.Write error: %v", err)
+		return err
+	}
+	return nil
+}
+
 // Write writes len(p) bytes from p to the underlying data stream. It returns
 // the number of bytes written from p (0 <= n <= len(p)) and any error
 // encountered that caused the write to stop early. Write must return a non-nil
@@ -192,6 +360,11 @@ func (fh *WriteFileHandle) close() (err error) {
 	if err = fh.openPending(); err != nil {
 		return err
 	}
+	if err = fh.writePending(true); err != nil {
+		_ = fh.pipeWriter.CloseWithError(err)
+		<-fh.result
+		return err
+	}
 	writeCloseErr := fh.pipeWriter.Close()
 	err = <-fh.result
 	if err == nil {
@@ -233,6 +406,10 @@ func (fh *WriteFileHandle) Flush() error {
 	// fs.Debugf(fh.remote, "WriteFileHandle.Flush")
 	// If Write hasn't been called then ignore the Flush - Release
 	// will pick it up
+	if !fh.writeCalled && fh.appendTo != nil {
+		fs.Debugf(fh.remote, "WriteFileHandle.Flush nothing appended")
+		return nil
+	}
 	if !fh.writeCalled {
 		fs.Debugf(fh.remote, "WriteFileHandle.Flush unwritten handle, writing 0 bytes to avoid race conditions")
 		_, err := fh.writeAt([]byte{}, fh.offset)
@@ -282,7 +459,11 @@ func (fh *WriteFileHandle) Truncate(size int64) (err error) {
 	if fh.closed {
 		return ECLOSED
 	}
-	if size != fh.offset {
+	end := fh.offset
+	if pendingEnd := fh.pending.end(); pendingEnd > end {
+		end = pendingEnd
+	}
+	if size != end {
 		fs.Errorf(fh.remote, "WriteFileHandle: Truncate: Can't change size without --vfs-cache-mode >= writes")
 		return EPERM
 	}
@@ -0,0 +1,605 @@
+// This deals with uploading files from the cache to the remote in the
+// background
+
+package vfs
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/operations"
+	"github.com/ncw/rclone/lib/ranges"
+	"github.com/pkg/errors"
+)
+
+const (
+	// delay before the first retry of a failed upload - this
+	// doubles after each failure
+	writeBackMinRetry = time.Second
+	// maximum delay between retries of a failed upload
+	writeBackMaxRetry = 5 * time.Minute
+)
+
+// writeBackItem is a file in the cache waiting to be uploaded
+type writeBackItem struct {
+	Name     string    // remote path of the file
+	Size     int64     // size of the file when it was queued
+	Expiry   time.Time // when the upload should start
+	Tries    int       // number of failed uploads
+	Error    string    // error from the last failed upload
+	RenameTo string    // remote path to move the file to once uploaded - set if renamed while queued
+
+	file      *File         // file to update when uploaded - nil if queued by a previous run
+	uploading bool          // set while the file is being uploaded
+	again     bool          // set if the file was queued again while uploading
+	held      bool          // set if the file was opened for writing while uploading
+	done      chan struct{} // closed when the upload finishes
+}
+
+// writeBack uploads files from the cache to the remote after a
+// delay, retrying failed uploads.  The queue is saved to disk so
+// uploads which are pending when rclone stops are done when it next
+// starts.
+//
+// Each queued file is kept open in the cache so it can't be purged
+// before it is uploaded.
+type writeBack struct {
+	vfs   *VFS
+	path  string // file the queue is saved in
+	kick  chan struct{}
+	mu    sync.Mutex                // protects the following
+	items map[string]*writeBackItem // queued files by remote path
+	n     int                       // number of uploads running
+}
+
+// newWriteBack makes the upload queue for vfs, loading any uploads
+// queued by a previous run.
+//
+// This starts a background goroutine which can be cancelled with the
+// context passed in.
+func newWriteBack(ctx context.Context, vfs *VFS) *writeBack {
+	wb := &writeBack{
+		vfs:   vfs,
+		path:  vfs.cache.queuePath,
+		kick:  make(chan struct{}, 1),
+		items: make(map[string]*writeBackItem),
+	}
+	err := wb.load()
+	if err != nil {
+		fs.Errorf(nil, "vfs cache: failed to load upload queue: %v", err)
+	}
+	err = wb.queueDirty()
+	if err != nil {
+		fs.Errorf(nil, "vfs cache: failed to find files to upload: %v", err)
+	}
+	go wb.run(ctx)
+	return wb
+}
+
+// load reads the queue saved by a previous run
+func (wb *writeBack) load() error {
+	data, err := ioutil.ReadFile(wb.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var items []*writeBackItem
+	err = json.Unmarshal(data, &items)
+	if err != nil {
+		return errors.Wrap(err, "failed to decode upload queue")
+	}
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	for _, item := range items {
+		_, err := os.Stat(wb.vfs.cache.toOSPath(item.Name))
+		if err != nil {
+			fs.Errorf(item.Name, "vfs cache: can't resume upload: %v", err)
+			continue
+		}
+		fs.Infof(item.Name, "vfs cache: resuming upload queued by previous run")
+		item.Expiry = time.Now().Add(wb.vfs.Opt.WriteBack)
+		wb.items[item.Name] = item
+		wb.vfs.cache.open(item.Name)
+	}
+	return wb._save()
+}
+
+// queueDirty queues the files in the cache which have changes which
+// haven't been uploaded and aren't queued already.  These were being
+// written when rclone stopped or failed to upload.
+func (wb *writeBack) queueDirty() error {
+	c := wb.vfs.cache
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	err := filepath.Walk(c.metaRoot, func(metaPath string, fi os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if fi.IsDir() || strings.HasSuffix(metaPath, ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(c.metaRoot, metaPath)
+		if err != nil {
+			return errors.Wrap(err, "filepath.Rel failed in queueDirty")
+		}
+		name := filepath.ToSlash(rel)
+		if wb.items[name] != nil {
+			return nil
+		}
+		info, err := c.loadInfo(name)
+		if err != nil {
+			fs.Errorf(name, "vfs cache: failed to read cache metadata: %v", err)
+			return nil
+		}
+		if !info.Dirty {
+			return nil
+		}
+		cacheFi, err := os.Stat(c.toOSPath(name))
+		if err != nil {
+			fs.Errorf(name, "vfs cache: can't upload changes made by previous run: %v", err)
+			return nil
+		}
+		fs.Infof(name, "vfs cache: queueing upload of changes made by previous run")
+		wb.items[name] = &writeBackItem{
+			Name:   name,
+			Size:   cacheFi.Size(),
+			Expiry: time.Now().Add(wb.vfs.Opt.WriteBack),
+		}
+		c.open(name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return wb._save()
+}
+
+// _save writes the queue to disk - call with mu held
+func (wb *writeBack) _save() error {
+	if len(wb.items) == 0 {
+		err := os.Remove(wb.path)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "failed to remove upload queue")
+		}
+		return nil
+	}
+	data, err := json.Marshal(wb._list())
+	if err != nil {
+		return errors.Wrap(err, "failed to encode upload queue")
+	}
+	err = os.MkdirAll(filepath.Dir(wb.path), 0700)
+	if err != nil {
+		return errors.Wrap(err, "failed to make upload queue directory")
+	}
+	tmp := wb.path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to write upload queue")
+	}
+	return os.Rename(tmp, wb.path)
+}
+
+// _saveOrLog saves the queue logging any errors - call with mu held
+func (wb *writeBack) _saveOrLog() {
+	if err := wb._save(); err != nil {
+		fs.Errorf(nil, "vfs cache: failed to save upload queue: %v", err)
+	}
+}
+
+// _list returns the queued items in the order they will be uploaded -
+// call with mu held
+func (wb *writeBack) _list() []*writeBackItem {
+	items := make([]*writeBackItem, 0, len(wb.items))
+	for _, item := range wb.items {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].Expiry.Equal(items[j].Expiry) {
+			return items[i].Expiry.Before(items[j].Expiry)
+		}
+		return items[i].Name < items[j].Name
+	})
+	return items
+}
+
+// _kick wakes the scheduler - call with mu held
+func (wb *writeBack) _kick() {
+	select {
+	case wb.kick <- struct{}{}:
+	default:
+	}
+}
+
+// add queues the cache file for name, which is size bytes long, to be
+// uploaded after the write back delay.  f is updated with the new
+// object when it has been uploaded.
+func (wb *writeBack) add(f *File, name string, size int64) {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	item := wb.items[name]
+	if item == nil {
+		item = &writeBackItem{Name: name}
+		wb.items[name] = item
+		wb.vfs.cache.open(name)
+	}
+	item.file = f
+	item.Size = size
+	item.Expiry = time.Now().Add(wb.vfs.Opt.WriteBack)
+	item.Tries = 0
+	item.Error = ""
+	if item.uploading {
+		item.again = true
+	}
+	fs.Debugf(name, "vfs cache: queued for upload in %v", wb.vfs.Opt.WriteBack)
+	wb._saveOrLog()
+	wb._kick()
+}
+
+// _remove takes item off the queue - call with mu held
+func (wb *writeBack) _remove(item *writeBackItem) {
+	delete(wb.items, item.Name)
+	wb.vfs.cache.close(item.Name)
+	wb._saveOrLog()
+}
+
+// cancel stops name being uploaded, waiting for it to finish if it is
+// being uploaded now.  It returns true if name was still waiting to be
+// uploaded.
+func (wb *writeBack) cancel(name string) bool {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	for {
+		item := wb.items[name]
+		if item == nil {
+			return false
+		}
+		if !item.uploading {
+			fs.Debugf(name, "vfs cache: cancelled queued upload")
+			wb._remove(item)
+			return true
+		}
+		done := item.done
+		wb.mu.Unlock()
+		<-done
+		wb.mu.Lock()
+	}
+}
+
+// hold stops name being uploaded as it is being opened for writing.
+//
+// Unlike cancel this doesn't wait for an upload in progress.  That
+// carries on but isn't recorded in the cache as the file may be
+// changed before it finishes, and the file is taken off the queue
+// when it does.  It returns true if name was waiting to be uploaded
+// or being uploaded so needs uploading again when it is closed.
+func (wb *writeBack) hold(name string) bool {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	item := wb.items[name]
+	if item == nil {
+		return false
+	}
+	if item.uploading {
+		fs.Debugf(name, "vfs cache: opened for writing while uploading so will upload again when closed")
+		item.held = true
+		return true
+	}
+	fs.Debugf(name, "vfs cache: cancelled queued upload")
+	wb._remove(item)
+	return true
+}
+
+// isHeld returns true if item was opened for writing while uploading
+func (wb *writeBack) isHeld(item *writeBackItem) bool {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	return item.held
+}
+
+// rename records that the queued file now called oldName has been
+// renamed to newName.  The File moves it once it is uploaded, but the
+// new name is saved in the queue so an upload resumed by a later run
+// moves it too.
+func (wb *writeBack) rename(oldName, newName string) {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	for _, item := range wb.items {
+		target := item.Name
+		if item.RenameTo != "" {
+			target = item.RenameTo
+		}
+		if target != oldName {
+			continue
+		}
+		item.RenameTo = newName
+		if newName == item.Name {
+			item.RenameTo = ""
+		}
+		fs.Debugf(item.Name, "vfs cache: queued upload will be renamed to %q", newName)
+		wb._saveOrLog()
+		return
+	}
+}
+
+// pending returns true if name is waiting to be uploaded
+func (wb *writeBack) pending(name string) bool {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	return wb.items[name] != nil
+}
+
+// retryDelay returns how long to wait before the next upload after
+// tries failures
+func retryDelay(tries int) time.Duration {
+	delay := writeBackMinRetry
+	for i := 1; i < tries; i++ {
+		delay *= 2
+		if delay >= writeBackMaxRetry {
+			return writeBackMaxRetry
+		}
+	}
+	return delay
+}
+
+// run starts the uploads when they are due
+//
+// doesn't return until context is cancelled
+func (wb *writeBack) run(ctx context.Context) {
+	for {
+		var (
+			timer   *time.Timer
+			timeout <-chan time.Time
+		)
+		next := wb.startUploads()
+		if !next.IsZero() {
+			timer = time.NewTimer(next.Sub(time.Now()))
+			timeout = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			fs.Debugf(nil, "vfs cache: upload queue exiting")
+		case <-wb.kick:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// startUploads starts the uploads which are due, running at most
+// --transfers at once.  It returns when the next one is due or zero
+// if nothing is waiting.
+func (wb *writeBack) startUploads() (next time.Time) {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	now := time.Now()
+	for _, item := range wb._list() {
+		if item.uploading {
+			continue
+		}
+		if item.Expiry.After(now) {
+			if next.IsZero() || item.Expiry.Before(next) {
+				next = item.Expiry
+			}
+			continue
+		}
+		if wb.n >= fs.Config.Transfers {
+			// the next upload to finish will kick us
+			continue
+		}
+		item.uploading = true
+		item.done = make(chan struct{})
+		wb.n++
+		go wb.upload(item)
+	}
+	return next
+}
+
+// upload transfers the cache file for item to the remote
+func (wb *writeBack) upload(item *writeBackItem) {
+	wb.mu.Lock()
+	name, f, renameTo := item.Name, item.file, item.RenameTo
+	wb.mu.Unlock()
+
+	o, err := wb.transfer(name, f)
+	if err == nil && f == nil && renameTo != "" {
+		// queued by a previous run so there is no File to do
+		// the rename
+		o, err = wb.move(o, renameTo)
+	}
+	if err == nil {
+		wb.uploaded(item, name, f, o)
+	}
+
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	item.uploading = false
+	close(item.done)
+	wb.n--
+	held := item.held
+	item.held = false
+	switch {
+	case held && !item.again:
+		// still open for writing so it is queued again when
+		// it is closed
+		wb._remove(item)
+	case err != nil:
+		item.Tries++
+		item.Error = err.Error()
+		delay := retryDelay(item.Tries)
+		item.Expiry = time.Now().Add(delay)
+		fs.Errorf(name, "vfs cache: failed to upload try #%d, will retry in %v: %v", item.Tries, delay, err)
+		wb._saveOrLog()
+	case item.again:
+		// queued again while uploading so leave it in the queue
+		item.again = false
+	default:
+		wb._remove(item)
+	}
+	wb._kick()
+}
+
+// complete makes sure all of the cache file for name is present,
+// downloading any parts which are missing.  This is only needed for
+// files which were being written when rclone stopped.
+func (wb *writeBack) complete(name string) error {
+	info, err := wb.vfs.cache.loadInfo(name)
+	if err != nil || info.complete() {
+		return nil
+	}
+	o, err := wb.vfs.f.NewObject(name)
+	if err != nil {
+		return errors.Wrap(err, "failed to find object to complete cache file")
+	}
+	sf, err := newSparseFile(wb.vfs, name, wb.vfs.cache.toOSPath(name), o)
+	if err != nil {
+		return err
+	}
+	err = sf.ensure(0, info.Size)
+	sf.close()
+	if err != nil {
+		return errors.Wrap(err, "failed to download rest of file before upload")
+	}
+	return nil
+}
+
+// transfer copies the cache file for name to the remote returning the
+// new object
+func (wb *writeBack) transfer(name string, f *File) (o fs.Object, err error) {
+	if f == nil {
+		err = wb.complete(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cacheObj, err := wb.vfs.cache.f.NewObject(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find cache file")
+	}
+	var dst fs.Object
+	if f != nil {
+		dst = f.getObject()
+	} else {
+		dst, _ = wb.vfs.f.NewObject(name)
+	}
+	o, err = copyObj(wb.vfs.f, dst, name, cacheObj)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to transfer file from cache to remote")
+	}
+	fs.Debugf(o, "transferred to remote")
+	return o, nil
+}
+
+// move renames the uploaded object o to newName returning the new
+// object
+func (wb *writeBack) move(o fs.Object, newName string) (fs.Object, error) {
+	dst, _ := wb.vfs.f.NewObject(newName)
+	newObject, err := operations.Move(wb.vfs.f, dst, newName, o)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to rename uploaded file")
+	}
+	// newObject can be nil here for example if --dry-run
+	if newObject == nil {
+		return nil, errors.New("failed to rename uploaded file: nil object returned")
+	}
+	fs.Debugf(newObject, "renamed from %q after upload", o.Remote())
+	return newObject, nil
+}
+
+// uploaded is called when the cache file for name has been uploaded as
+// o.  It marks the cache file as matching o and updates f if set.
+//
+// If the file was opened for writing while item was uploading then
+// the cache file may not match o so only f is updated.
+func (wb *writeBack) uploaded(item *writeBackItem, name string, f *File, o fs.Object) {
+	info := cacheInfo{
+		ModTime:     o.ModTime(),
+		Size:        o.Size(),
+		Rs:          ranges.Ranges{{Pos: 0, Size: o.Size()}},
+		Fingerprint: fingerprint(o),
+		ATime:       time.Now(),
+	}
+	if f == nil && wb.isHeld(item) {
+		return
+	}
+	if f == nil && o.Remote() != name {
+		// renamed after it was uploaded so the cache file
+		// doesn't match anything on the remote now
+		wb.vfs.cache.remove(name)
+		wb.vfs.root.ForgetPath(name, fs.EntryObject)
+		wb.vfs.root.ForgetPath(o.Remote(), fs.EntryObject)
+		return
+	}
+	if f == nil {
+		// queued by a previous run so there is no File to
+		// update - make the directory read it again instead
+		if err := wb.vfs.cache.saveInfo(name, &info); err != nil {
+			fs.Errorf(name, "Failed to save cache metadata: %v", err)
+		}
+		wb.vfs.root.ForgetPath(name, fs.EntryObject)
+		return
+	}
+	// a writer must lock muRW to open the cache file so it can't
+	// change it until this is done
+	f.muRW.Lock()
+	if wb.isHeld(item) {
+		f.muRW.Unlock()
+		f.setObject(o)
+		return
+	}
+	if f.sparse != nil {
+		f.sparse.setObject(o)
+	} else if err := wb.vfs.cache.saveInfo(name, &info); err != nil {
+		fs.Errorf(name, "Failed to save cache metadata: %v", err)
+	}
+	f.muRW.Unlock()
+	f.setObject(o)
+	f.finishUpload()
+}
+
+// queueItem is the description of a queued upload returned by the rc
+type queueItem struct {
+	Name      string  `json:"name"`      // remote path of the file
+	Size      int64   `json:"size"`      // size of the file
+	Expiry    float64 `json:"expiry"`    // seconds until the upload starts - negative if it is overdue
+	Tries     int     `json:"tries"`     // number of failed uploads
+	Uploading bool    `json:"uploading"` // set if the file is being uploaded
+	Error     string  `json:"error"`     // error from the last failed upload
+	RenameTo  string  `json:"renameTo"`  // remote path the file will be moved to once uploaded or ""
+}
+
+// queue returns the queued uploads
+func (wb *writeBack) queue() []queueItem {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+	now := time.Now()
+	items := wb._list()
+	out := make([]queueItem, 0, len(items))
+	for _, item := range items {
+		out = append(out, queueItem{
+			Name:      item.Name,
+			Size:      item.Size,
+			Expiry:    item.Expiry.Sub(now).Seconds(),
+			Tries:     item.Tries,
+			Uploading: item.uploading,
+			Error:     item.Error,
+			RenameTo:  item.RenameTo,
+		})
+	}
+	return out
+}
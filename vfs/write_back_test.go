@@ -0,0 +1,271 @@
+package vfs
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/rc"
+	"github.com/ncw/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newWriteBackTestVFS makes a VFS in cache mode writes which uploads
+// files writeBack after they are closed
+func newWriteBackTestVFS(r *fstest.Run, writeBack time.Duration) *VFS {
+	opt := DefaultOpt
+	opt.CacheMode = CacheModeWrites
+	opt.CachePollInterval = 0
+	opt.WriteBack = writeBack
+	return New(r.Fremote, &opt)
+}
+
+// writeBackWrite writes contents to name in vfs
+func writeBackWrite(t *testing.T, vfs *VFS, name, contents string) {
+	fh, err := vfs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	require.NoError(t, err)
+	_, err = fh.WriteString(contents)
+	require.NoError(t, err)
+	require.NoError(t, fh.Close())
+}
+
+// writeBackRead reads name from vfs
+func writeBackRead(t *testing.T, vfs *VFS, name string) string {
+	fh, err := vfs.OpenFile(name, os.O_RDONLY, 0777)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(fh)
+	require.NoError(t, err)
+	require.NoError(t, fh.Close())
+	return string(data)
+}
+
+// waitForEmptyQueue waits for all the uploads in vfs to finish
+func waitForEmptyQueue(t *testing.T, vfs *VFS) {
+	for i := 0; i < 100; i++ {
+		if len(vfs.writeBack.queue()) == 0 {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("upload queue not empty: %+v", vfs.writeBack.queue())
+}
+
+// checkWriteBackRemote checks the remote has just name with contents
+// ignoring its modification time
+func checkWriteBackRemote(t *testing.T, r *fstest.Run, name, contents string) {
+	item := fstest.NewItem(name, contents, time.Now())
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{item}, nil, fs.ModTimeNotSupported)
+}
+
+func TestWriteBackQueueAndResume(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	vfs := newWriteBackTestVFS(r, time.Hour)
+	defer vfs.Shutdown()
+
+	// the close returns before the file is uploaded
+	writeBackWrite(t, vfs, "file", "hello")
+	_, err := r.Fremote.NewObject("file")
+	assert.Error(t, err)
+
+	queue := vfs.writeBack.queue()
+	require.Equal(t, 1, len(queue))
+	assert.Equal(t, "file", queue[0].Name)
+	assert.Equal(t, int64(5), queue[0].Size)
+	assert.False(t, queue[0].Uploading)
+	assert.True(t, queue[0].Expiry > 3000)
+
+	// the rc shows the queue too
+	out, err := rc.Calls.Get("vfs/queue").Fn(rc.Params{})
+	require.NoError(t, err)
+	assert.Equal(t, queue[0].Name, out["queue"].([]queueItem)[0].Name)
+
+	// the file can be used while it is waiting
+	node, err := vfs.Stat("file")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), node.Size())
+	assert.Equal(t, "hello", writeBackRead(t, vfs, "file"))
+
+	// stop this VFS and start another which should do the upload
+	vfs.Shutdown()
+	vfs2 := newWriteBackTestVFS(r, time.Millisecond)
+	defer func() {
+		assert.NoError(t, vfs2.CleanUp())
+		vfs2.Shutdown()
+	}()
+	waitForEmptyQueue(t, vfs2)
+	checkWriteBackRemote(t, r, "file", "hello")
+	_, err = os.Stat(vfs2.cache.queuePath)
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, "hello", writeBackRead(t, vfs2, "file"))
+}
+
+func TestWriteBackUpload(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	vfs := newWriteBackTestVFS(r, time.Millisecond)
+	defer func() {
+		assert.NoError(t, vfs.CleanUp())
+		vfs.Shutdown()
+	}()
+
+	writeBackWrite(t, vfs, "file", "hello")
+	waitForEmptyQueue(t, vfs)
+
+	node, err := vfs.Stat("file")
+	require.NoError(t, err)
+	file := node.(*File)
+	assert.False(t, file.uploadPending())
+	o := file.getObject()
+	require.NotNil(t, o)
+	assert.Equal(t, int64(5), o.Size())
+	checkWriteBackRemote(t, r, "file", "hello")
+}
+
+func TestWriteBackRewriteAndRemove(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	vfs := newWriteBackTestVFS(r, time.Hour)
+	defer func() {
+		assert.NoError(t, vfs.CleanUp())
+		vfs.Shutdown()
+	}()
+	r.WriteObject("file", "old", t1)
+
+	writeBackWrite(t, vfs, "file", "hello")
+	expiry := vfs.writeBack.queue()[0].Expiry
+
+	// writing again puts the upload off
+	time.Sleep(10 * time.Millisecond)
+	writeBackWrite(t, vfs, "file", "potato")
+	queue := vfs.writeBack.queue()
+	require.Equal(t, 1, len(queue))
+	assert.Equal(t, int64(6), queue[0].Size)
+	assert.True(t, queue[0].Expiry > expiry-1)
+	assert.Equal(t, "potato", writeBackRead(t, vfs, "file"))
+	checkWriteBackRemote(t, r, "file", "old")
+
+	// opening for write without changing it keeps it queued
+	fh, err := vfs.OpenFile("file", os.O_RDWR, 0777)
+	require.NoError(t, err)
+	buf := make([]byte, 3)
+	_, err = fh.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "pot", string(buf))
+	require.NoError(t, fh.Close())
+	assert.Equal(t, 1, len(vfs.writeBack.queue()))
+
+	// removing the file removes it from the queue
+	node, err := vfs.Stat("file")
+	require.NoError(t, err)
+	require.NoError(t, node.Remove())
+	assert.Equal(t, 0, len(vfs.writeBack.queue()))
+	_, err = vfs.Stat("file")
+	assert.Equal(t, ENOENT, err)
+	fstest.CheckItems(t, r.Fremote)
+}
+
+func TestWriteBackOpenWhileUploading(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	vfs := newWriteBackTestVFS(r, time.Hour)
+	defer func() {
+		assert.NoError(t, vfs.CleanUp())
+		vfs.Shutdown()
+	}()
+	wb := vfs.writeBack
+
+	// pretend the upload has started
+	writeBackWrite(t, vfs, "file", "hello")
+	wb.mu.Lock()
+	item := wb.items["file"]
+	require.NotNil(t, item)
+	item.uploading = true
+	item.done = make(chan struct{})
+	wb.n++
+	wb.mu.Unlock()
+
+	// opening for write doesn't wait for it to finish
+	opened := make(chan struct{})
+	var fh Handle
+	var err error
+	go func() {
+		fh, err = vfs.OpenFile("file", os.O_WRONLY|os.O_TRUNC, 0777)
+		close(opened)
+	}()
+	select {
+	case <-opened:
+	case <-time.After(10 * time.Second):
+		t.Fatal("open waited for the upload to finish")
+	}
+	require.NoError(t, err)
+	_, err = fh.WriteString("potato")
+	require.NoError(t, err)
+
+	// when it finishes the changes aren't marked as uploaded and
+	// it leaves the queue
+	wb.upload(item)
+	assert.Equal(t, 0, len(wb.queue()))
+	assert.True(t, vfs.cache.isDirty("file"))
+
+	// closing the file queues the changes again
+	require.NoError(t, fh.Close())
+	queue := wb.queue()
+	require.Equal(t, 1, len(queue))
+	assert.Equal(t, int64(6), queue[0].Size)
+	wb.mu.Lock()
+	wb.items["file"].Expiry = time.Now()
+	wb._kick()
+	wb.mu.Unlock()
+	waitForEmptyQueue(t, vfs)
+	checkWriteBackRemote(t, r, "file", "potato")
+	assert.False(t, vfs.cache.isDirty("file"))
+}
+
+func TestWriteBackRetryDelay(t *testing.T) {
+	for _, test := range []struct {
+		tries int
+		want  time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{9, 256 * time.Second},
+		{10, writeBackMaxRetry},
+		{100, writeBackMaxRetry},
+	} {
+		assert.Equal(t, test.want, retryDelay(test.tries), test.tries)
+	}
+}
+
+func TestWriteBackRenameAndResume(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	vfs := newWriteBackTestVFS(r, time.Hour)
+	defer vfs.Shutdown()
+
+	writeBackWrite(t, vfs, "file", "hello")
+	require.NoError(t, vfs.Rename("file", "renamed"))
+	require.NoError(t, vfs.Rename("renamed", "file2"))
+	queue := vfs.writeBack.queue()
+	require.Equal(t, 1, len(queue))
+	assert.Equal(t, "file", queue[0].Name)
+	assert.Equal(t, "file2", queue[0].RenameTo)
+
+	// stop this VFS and start another which should do the upload
+	// and the rename
+	vfs.Shutdown()
+	vfs2 := newWriteBackTestVFS(r, time.Millisecond)
+	defer func() {
+		assert.NoError(t, vfs2.CleanUp())
+		vfs2.Shutdown()
+	}()
+	waitForEmptyQueue(t, vfs2)
+	checkWriteBackRemote(t, r, "file2", "hello")
+	assert.Equal(t, "hello", writeBackRead(t, vfs2, "file2"))
+	_, err := vfs2.Stat("file")
+	assert.Equal(t, ENOENT, err)
+}
@@ -0,0 +1,87 @@
+package vfs
+
+import "sort"
+
+// writeBlock is some data to be written at off
+type writeBlock struct {
+	off  int64
+	data []byte
+}
+
+// end returns the offset just after the block
+func (b *writeBlock) end() int64 {
+	return b.off + int64(len(b.data))
+}
+
+// writeBuffer holds the writes made to a WriteFileHandle ahead of its
+// offset until the data before them has been written.
+//
+// Where writes overlap the data from the latest one is kept.
+type writeBuffer struct {
+	blocks []writeBlock // sorted by offset and not overlapping
+	size   int64        // bytes of data in blocks
+}
+
+// empty returns true if nothing is buffered
+func (wb *writeBuffer) empty() bool {
+	return len(wb.blocks) == 0
+}
+
+// end returns the offset after the last buffered byte or 0 if
+// nothing is buffered
+func (wb *writeBuffer) end() int64 {
+	if len(wb.blocks) == 0 {
+		return 0
+	}
+	return wb.blocks[len(wb.blocks)-1].end()
+}
+
+// add stores a copy of p to be written at off replacing any data
+// buffered there already
+func (wb *writeBuffer) add(off int64, p []byte) {
+	b := writeBlock{off: off, data: append([]byte(nil), p...)}
+	end := b.end()
+	blocks := make([]writeBlock, 0, len(wb.blocks)+2)
+	wb.size = 0
+	for _, old := range wb.blocks {
+		if old.end() <= off || old.off >= end {
+			blocks = append(blocks, old)
+		} else {
+			// keep the parts outside the new block
+			if old.off < off {
+				blocks = append(blocks, writeBlock{off: old.off, data: old.data[:off-old.off]})
+			}
+			if old.end() > end {
+				blocks = append(blocks, writeBlock{off: end, data: old.data[end-old.off:]})
+			}
+		}
+	}
+	blocks = append(blocks, b)
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].off < blocks[j].off
+	})
+	for _, b := range blocks {
+		wb.size += int64(len(b.data))
+	}
+	wb.blocks = blocks
+}
+
+// next removes the first block and returns it
+func (wb *writeBuffer) next() (b writeBlock, ok bool) {
+	if len(wb.blocks) == 0 {
+		return b, false
+	}
+	b = wb.blocks[0]
+	wb.blocks[0] = writeBlock{}
+	wb.blocks = wb.blocks[1:]
+	wb.size -= int64(len(b.data))
+	return b, true
+}
+
+// peek returns the offset of the first block
+func (wb *writeBuffer) peek() (off int64, ok bool) {
+	if len(wb.blocks) == 0 {
+		return 0, false
+	}
+	return wb.blocks[0].off, true
+}
@@ -0,0 +1,76 @@
+package vfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeBufferContents returns the blocks in wb as offsets and strings
+func writeBufferContents(wb *writeBuffer) (offs []int64, data []string) {
+	for _, b := range wb.blocks {
+		offs = append(offs, b.off)
+		data = append(data, string(b.data))
+	}
+	return offs, data
+}
+
+func TestWriteBufferAdd(t *testing.T) {
+	var wb writeBuffer
+	assert.True(t, wb.empty())
+	assert.Equal(t, int64(0), wb.end())
+
+	for _, test := range []struct {
+		off      int64
+		data     string
+		wantOffs []int64
+		wantData []string
+	}{
+		{10, "klmno", []int64{10}, []string{"klmno"}},
+		{2, "cd", []int64{2, 10}, []string{"cd", "klmno"}},
+		{12, "MN", []int64{2, 10, 12, 14}, []string{"cd", "kl", "MN", "o"}},
+		{3, "DEFGHIJKL", []int64{2, 3, 12, 14}, []string{"c", "DEFGHIJKL", "MN", "o"}},
+		{0, "ABCDEFGHIJKLMNOPQ", []int64{0}, []string{"ABCDEFGHIJKLMNOPQ"}},
+	} {
+		wb.add(test.off, []byte(test.data))
+		offs, data := writeBufferContents(&wb)
+		assert.Equal(t, test.wantOffs, offs, test.data)
+		assert.Equal(t, test.wantData, data, test.data)
+		var size int64
+		for _, d := range data {
+			size += int64(len(d))
+		}
+		assert.Equal(t, size, wb.size, test.data)
+	}
+	assert.Equal(t, int64(17), wb.end())
+}
+
+func TestWriteBufferNext(t *testing.T) {
+	var wb writeBuffer
+	buf := []byte("abc")
+	wb.add(5, buf)
+	buf[0] = 'X' // check a copy is kept
+	wb.add(1, []byte("de"))
+
+	off, ok := wb.peek()
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), off)
+
+	b, ok := wb.next()
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), b.off)
+	assert.Equal(t, "de", string(b.data))
+	assert.Equal(t, int64(3), wb.size)
+
+	b, ok = wb.next()
+	assert.True(t, ok)
+	assert.Equal(t, int64(5), b.off)
+	assert.Equal(t, "abc", string(b.data))
+	assert.Equal(t, int64(0), wb.size)
+
+	_, ok = wb.peek()
+	assert.False(t, ok)
+	_, ok = wb.next()
+	assert.False(t, ok)
+	assert.True(t, wb.empty())
+}
@@ -1,12 +1,16 @@
 package vfs
 
 import (
+	"io"
+	"io/ioutil"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/ncw/rclone/fs"
+	"github.com/ncw/rclone/fs/operations"
 	"github.com/ncw/rclone/fstest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -277,3 +281,143 @@ func TestWriteFileModTimeWithOpenWriters(t *testing.T) {
 		assert.Equal(t, info.ModTime().Unix(), mtime.Unix())
 	}
 }
+
+func TestWriteFileHandleOutOfOrder(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	opt := DefaultOpt
+	opt.WriteBuffer = 16
+	vfs := New(r.Fremote, &opt)
+	h, err := vfs.OpenFile("file1", os.O_WRONLY|os.O_CREATE, 0777)
+	require.NoError(t, err)
+	fh := h.(*WriteFileHandle)
+
+	// Writes ahead of the offset are buffered
+	n, err := fh.WriteAt([]byte("world"), 6)
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	n, err = fh.WriteAt([]byte("wor"), 6) // overwrite
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, int64(0), fh.Offset())
+	assert.Equal(t, int64(11), fh.file.Size())
+
+	// Check can't write more than the buffer
+	n, err = fh.WriteAt([]byte("0123456789012"), 20)
+	assert.Equal(t, ESPIPE, err)
+	assert.Equal(t, 0, n)
+
+	// Writing the gap writes the buffered data
+	n, err = fh.WriteAt([]byte("hello "), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 6, n)
+	assert.Equal(t, int64(11), fh.Offset())
+	assert.True(t, fh.pending.empty())
+
+	// Check can't write before the offset
+	n, err = fh.WriteAt([]byte("x"), 3)
+	assert.Equal(t, ESPIPE, err)
+	assert.Equal(t, 0, n)
+
+	// Any gaps left are filled with zeros on close
+	_, err = fh.WriteAt([]byte("!"), 13)
+	require.NoError(t, err)
+	require.NoError(t, fh.Close())
+
+	file1 := fstest.NewItem("file1", "hello world\x00\x00!", t1)
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{file1}, []string{}, fs.ModTimeNotSupported)
+}
+
+func TestWriteFileHandleAppend(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+	opt := DefaultOpt
+	opt.WriteAppend = true
+	vfs := New(r.Fremote, &opt)
+	r.WriteObject("file1", "hello", t1)
+
+	// Opening and closing without writing leaves the file alone
+	h, err := vfs.OpenFile("file1", os.O_WRONLY|os.O_APPEND, 0777)
+	require.NoError(t, err)
+	require.NoError(t, h.Flush())
+	require.NoError(t, h.Release())
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{fstest.NewItem("file1", "hello", t1)}, []string{}, fs.ModTimeNotSupported)
+
+	h, err = vfs.OpenFile("file1", os.O_WRONLY|os.O_APPEND, 0777)
+	require.NoError(t, err)
+	fh, ok := h.(*WriteFileHandle)
+	require.True(t, ok)
+	assert.Equal(t, int64(5), fh.Offset())
+	_, err = fh.Write([]byte(" world"))
+	require.NoError(t, err)
+	require.NoError(t, fh.Close())
+
+	file1 := fstest.NewItem("file1", "hello world", t1)
+	fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{file1}, []string{}, fs.ModTimeNotSupported)
+	node, err := vfs.Stat("file1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), node.Size())
+}
+
+// composeFs is an fs.Fs which composes objects by copying them
+type composeFs struct {
+	fs.Fs
+	composed int   // number of times Compose was called
+	err      error // error to return from Compose if set
+}
+
+// Features returns the features of the wrapped Fs with Compose added
+func (f *composeFs) Features() *fs.Features {
+	features := *f.Fs.Features()
+	features.Compose = f.compose
+	return &features
+}
+
+// compose joins srcs into remote
+func (f *composeFs) compose(srcs []fs.Object, remote string) (o fs.Object, err error) {
+	f.composed++
+	if f.err != nil {
+		return nil, f.err
+	}
+	var in []io.Reader
+	for _, src := range srcs {
+		var rc io.ReadCloser
+		rc, err = src.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer fs.CheckClose(rc, &err)
+		in = append(in, rc)
+	}
+	return operations.Rcat(f.Fs, remote, ioutil.NopCloser(io.MultiReader(in...)), time.Now())
+}
+
+func TestAppendObject(t *testing.T) {
+	r := fstest.NewRun(t)
+	defer r.Finalise()
+
+	for _, test := range []struct {
+		name string
+		err  error
+	}{
+		{name: "Compose"},
+		{name: "CantCompose", err: fs.ErrorCantCompose},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			f := &composeFs{Fs: r.Fremote, err: test.err}
+			r.WriteObject("file1", "hello", t1)
+			old, err := r.Fremote.NewObject("file1")
+			require.NoError(t, err)
+
+			o, err := appendObject(f, old, "file1", strings.NewReader(" world"))
+			require.NoError(t, err)
+			assert.Equal(t, 1, f.composed)
+			assert.Equal(t, "file1", o.Remote())
+			assert.Equal(t, int64(11), o.Size())
+
+			// the temporary objects are removed
+			file1 := fstest.NewItem("file1", "hello world", t1)
+			fstest.CheckListingWithPrecision(t, r.Fremote, []fstest.Item{file1}, []string{}, fs.ModTimeNotSupported)
+		})
+	}
+}